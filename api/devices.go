@@ -0,0 +1,164 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// clientBuffer is the number of events queued for a slow WebSocket client
+// before it is disconnected
+const clientBuffer = 256
+
+// hub fans events out to connected WebSocket clients
+type hub struct {
+	mu      sync.Mutex
+	clients map[chan events.Envelope]bool
+}
+
+// newHub creates an empty hub
+func newHub() *hub {
+	return &hub{clients: make(map[chan events.Envelope]bool)}
+}
+
+// add registers a client and returns its event channel
+func (h *hub) add() chan events.Envelope {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan events.Envelope, clientBuffer)
+	h.clients[ch] = true
+	return ch
+}
+
+// remove unregisters a client
+func (h *hub) remove(ch chan events.Envelope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[ch] {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// broadcast queues an event for every client, dropping clients that fall behind
+func (h *hub) broadcast(env events.Envelope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- env:
+		default:
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeAll disconnects every client
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// Broadcast streams an event to the connected /api/events clients
+func (s *Server) Broadcast(env events.Envelope) {
+	s.hub.broadcast(env)
+}
+
+// registerDevices adds the device list and event stream endpoints
+func (s *Server) registerDevices() {
+	s.mux.HandleFunc("/api/devices", s.handleDevices)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+}
+
+// handleDevices returns the current device list
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.backend.Devices())
+}
+
+// checkOrigin lets browsers open the event stream only from a page served
+// by the listen host, so another site cannot read events through a
+// visitor's browser. Clients that send no Origin are not browsers.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+
+	listenHost, _, _ := net.SplitHostPort(s.Addr())
+	if ip := net.ParseIP(listenHost); ip != nil && ip.IsUnspecified() {
+		// Listening everywhere: the host the client reached us on
+		listenHost, _, err = net.SplitHostPort(r.Host)
+		if err != nil {
+			listenHost = r.Host
+		}
+	}
+	if isLoopback(listenHost) {
+		return isLoopback(host)
+	}
+	return host == listenHost
+}
+
+// handleEvents streams events over a WebSocket until the client goes away
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already wrote the error response
+	}
+	defer conn.Close()
+
+	ch := s.hub.add()
+	defer s.hub.remove(ch)
+
+	// Read and discard client frames so close and ping frames are handled
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case env, ok := <-ch:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(env); err != nil {
+				log.Printf("Event stream client dropped: %v", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// searchRequest is the body of a Grafana /search call
+type searchRequest struct {
+	Target string `json:"target"`
+}
+
+// queryRequest is the body of a Grafana /query call
+type queryRequest struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		Type   string `json:"type"`
+	} `json:"targets"`
+	MaxDataPoints int `json:"maxDataPoints"`
+}
+
+// timeSeries is a Grafana time series response entry; each datapoint is
+// [value, unix milliseconds]
+type timeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// downsample averages datapoints into at most max buckets of equal time
+// span, each placed at the mean time of its points, so the whole range is
+// still covered. For a state series the average is the share of the bucket
+// the outlet was reported ON.
+func downsample(points [][2]float64, max int) [][2]float64 {
+	first, last := points[0][1], points[len(points)-1][1]
+	span := (last - first) / float64(max)
+	if span <= 0 {
+		return points[len(points)-max:]
+	}
+
+	result := make([][2]float64, 0, max)
+	var sum, times, count float64
+	bucket := 0
+	for _, point := range points {
+		b := int((point[1] - first) / span)
+		if b >= max {
+			b = max - 1
+		}
+		if b != bucket && count > 0 {
+			result = append(result, [2]float64{sum / count, times / count})
+			sum, times, count = 0, 0, 0
+		}
+		bucket = b
+		sum += point[0]
+		times += point[1]
+		count++
+	}
+	if count > 0 {
+		result = append(result, [2]float64{sum / count, times / count})
+	}
+	return result
+}
+
+// registerGrafana adds the simple-JSON datasource endpoints
+func (s *Server) registerGrafana() {
+	s.mux.HandleFunc("/", s.handleHealth)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/query", s.handleQuery)
+}
+
+// handleHealth answers the datasource connection test
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleSearch lists the series names containing the requested text
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid search request: %w", err))
+			return
+		}
+	}
+
+	names := make([]string, 0)
+	for _, name := range s.backend.SeriesNames() {
+		if req.Target == "" || strings.Contains(strings.ToLower(name), strings.ToLower(req.Target)) {
+			names = append(names, name)
+		}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// handleQuery returns time series for the requested targets
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("query requires POST"))
+		return
+	}
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid query request: %w", err))
+		return
+	}
+
+	result := make([]timeSeries, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		if target.Target == "" {
+			continue
+		}
+		if target.Type != "" && target.Type != "timeserie" && target.Type != "timeseries" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported target type: %s", target.Type))
+			return
+		}
+
+		points, err := s.backend.Series(target.Target, req.Range.From, req.Range.To)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		series := timeSeries{Target: target.Target, Datapoints: make([][2]float64, 0, len(points))}
+		for _, point := range points {
+			// Clamp a sample taken before the range to its start so the panel
+			// shows the state the outlet was in when the range begins
+			at := point.Time
+			if !req.Range.From.IsZero() && at.Before(req.Range.From) {
+				at = req.Range.From
+			}
+			series.Datapoints = append(series.Datapoints, [2]float64{point.Value, float64(at.UnixMilli())})
+		}
+		if req.MaxDataPoints > 0 && len(series.Datapoints) > req.MaxDataPoints {
+			series.Datapoints = downsample(series.Datapoints, req.MaxDataPoints)
+		}
+		result = append(result, series)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
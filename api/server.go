@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Point is a single sample of a series
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Backend supplies the data served over HTTP
+type Backend interface {
+	// SeriesNames lists the series that can be queried
+	SeriesNames() []string
+	// Series returns the samples of a series between from and to, including
+	// the last sample before from so the value at the start is known
+	Series(name string, from, to time.Time) ([]Point, error)
+	// Devices returns the current device list
+	Devices() []models.DeviceOutlet
+}
+
+// Server is the optional embedded HTTP server
+type Server struct {
+	backend  Backend
+	token    string
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+	hub      *hub
+}
+
+// NewServer creates a server for the given backend. When token is set,
+// every request must carry it as a bearer token.
+func NewServer(backend Backend, token string) *Server {
+	s := &Server{
+		backend: backend,
+		token:   token,
+		mux:     http.NewServeMux(),
+		hub:     newHub(),
+	}
+	s.registerGrafana()
+	s.registerDevices()
+	return s
+}
+
+// Handler returns the HTTP handler serving all endpoints
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.hostAllowed(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host %s is not allowed", r.Host))
+			return
+		}
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		s.mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized checks the bearer token, if one is required
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) == 1
+}
+
+// hostAllowed refuses requests naming a host other than a loopback one
+// when no token is required: a web page whose name an attacker rebinds to
+// 127.0.0.1 (DNS rebinding) still sends its own name in the Host header
+func (s *Server) hostAllowed(r *http.Request) bool {
+	if s.token != "" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host // no port
+	}
+	return isLoopback(strings.Trim(host, "[]"))
+}
+
+// Start listens on addr (e.g. "127.0.0.1:8089") and serves in the
+// background. Addresses other machines can reach require a token.
+func (s *Server) Start(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", addr, err)
+	}
+	if s.token == "" && !isLoopback(host) {
+		return fmt.Errorf("listening on %s, which is not a loopback address, requires an API token", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s.listener = listener
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server stopped: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// isLoopback reports whether host only accepts connections from this machine
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop shuts the server down, waiting for active requests until ctx ends
+func (s *Server) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	s.hub.closeAll()
+	return s.server.Shutdown(ctx)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// pendingAck is a sent command waiting for its outlet to report the result
+type pendingAck struct {
+	payload  events.CommandAckPayload
+	expected string // state that confirms the command; empty accepts any
+	topic    string // command topic, whose echoes are not confirmations
+}
+
+// ackTracker correlates sent commands with the state reports that follow
+type ackTracker struct {
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]*pendingAck
+	latest  map[string]uint64 // key: "deviceName:outletNumber"; the last command sent to the outlet
+}
+
+// add registers a command and returns its ID
+func (t *ackTracker) add(ack *pendingAck) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[uint64]*pendingAck)
+		t.latest = make(map[string]uint64)
+	}
+	t.nextID++
+	ack.payload.ID = t.nextID
+	t.pending[t.nextID] = ack
+	t.latest[ack.payload.DeviceName+":"+ack.payload.OutletNumber] = t.nextID
+	return t.nextID
+}
+
+// confirm resolves the outlet's pending commands that a state report
+// satisfies and returns their payloads
+func (t *ackTracker) confirm(deviceName, outletNumber, topic, status string) []events.CommandAckPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	confirmed := make([]events.CommandAckPayload, 0)
+	for id, ack := range t.pending {
+		if ack.payload.DeviceName != deviceName || ack.payload.OutletNumber != outletNumber ||
+			ack.topic == topic || (ack.expected != "" && ack.expected != status) {
+			continue
+		}
+		delete(t.pending, id)
+		ack.payload.Reported = status
+		ack.payload.ConfirmedAt = &now
+		ack.payload.LatencyMs = float64(now.Sub(ack.payload.SentAt).Microseconds()) / 1000
+		confirmed = append(confirmed, ack.payload)
+	}
+	return confirmed
+}
+
+// expire removes a command that was not confirmed in time, returning false
+// if it was confirmed meanwhile. latest tells whether it is still the last
+// command sent to its outlet.
+func (t *ackTracker) expire(id uint64) (payload events.CommandAckPayload, expected string, latest, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ack, ok := t.pending[id]
+	if !ok {
+		return events.CommandAckPayload{}, "", false, false
+	}
+	delete(t.pending, id)
+	key := ack.payload.DeviceName + ":" + ack.payload.OutletNumber
+	latest = t.latest[key] == id
+	if latest {
+		delete(t.latest, key)
+	}
+	return ack.payload, ack.expected, latest, true
+}
+
+// trackCommand watches for the state report confirming a sent ON, OFF or
+// TOGGLE command and emits command:unconfirmed if none arrives in time. If
+// the outlet then reports another state than the last command asked for,
+// it is flagged as drifted until it reaches that state. messageID is the
+// logged command message, which is annotated with the latency.
+func (a *App) trackCommand(topic string, messageID uint64, entry models.TimelineEntry) {
+	ack := &pendingAck{
+		payload: events.CommandAckPayload{
+			DeviceName:   entry.DeviceName,
+			OutletNumber: entry.OutletNumber,
+			State:        entry.State,
+			Source:       entry.Source,
+			SentAt:       time.Now(),
+			MessageID:    messageID,
+		},
+		topic: topic,
+	}
+
+	current, known := a.deviceStore.Get(entry.DeviceName, entry.OutletNumber)
+	switch entry.State {
+	case "ON", "OFF":
+		ack.expected = entry.State
+	case "TOGGLE":
+		// Any report confirms a toggle of an outlet in an unknown state
+		if known && current.Status == "ON" {
+			ack.expected = "OFF"
+		} else if known && current.Status == "OFF" {
+			ack.expected = "ON"
+		}
+	default:
+		return
+	}
+	ack.payload.Reported = current.Status
+
+	// A new command replaces the state the outlet drifted from
+	if outlet, changed := a.deviceStore.SetDrift(entry.DeviceName, entry.OutletNumber, ""); changed {
+		a.emit(events.DeviceUpdate, outlet)
+	}
+
+	id := a.acks.add(ack)
+	timeout := time.Duration(a.currentConfig().CommandAckTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultCommandAckTimeout * time.Second
+	}
+	time.AfterFunc(timeout, func() {
+		payload, expected, latest, ok := a.acks.expire(id)
+		if !ok {
+			return
+		}
+		if outlet, known := a.deviceStore.Get(payload.DeviceName, payload.OutletNumber); known {
+			payload.Reported = outlet.Status
+		}
+		a.emit(events.CommandUnconfirmed, payload)
+
+		if latest && expected != "" {
+			a.flagDrift(payload, expected)
+		}
+	})
+}
+
+// flagDrift flags an outlet that did not reach the state its last command
+// asked for and emits outlet:drifted
+func (a *App) flagDrift(payload events.CommandAckPayload, desired string) {
+	outlet, changed := a.deviceStore.SetDrift(payload.DeviceName, payload.OutletNumber, desired)
+	if !changed {
+		return
+	}
+	log.Printf("Outlet %s/%s drifted: %s requested, %s reported", outlet.DeviceName, outlet.OutletNumber, desired, outlet.Status)
+	a.emit(events.DeviceUpdate, outlet)
+	a.emit(events.OutletDrifted, events.DriftPayload{
+		DeviceName:   outlet.DeviceName,
+		OutletNumber: outlet.OutletNumber,
+		Desired:      desired,
+		Actual:       outlet.Status,
+		Source:       payload.Source,
+		SentAt:       payload.SentAt,
+	})
+}
+
+// GetDriftedOutlets returns the outlets that did not reach the state last
+// commanded and have not since
+func (a *App) GetDriftedOutlets() []models.DeviceOutlet {
+	drifted := make([]models.DeviceOutlet, 0)
+	for _, outlet := range a.kioskFilter(a.deviceStore.GetAll()) {
+		if outlet.Drifted() {
+			drifted = append(drifted, outlet)
+		}
+	}
+	return drifted
+}
+
+// confirmCommands emits command:confirmed for the commands a state report
+// on topic satisfies and annotates their logged and archived messages with
+// the latency
+func (a *App) confirmCommands(deviceName, outletNumber, topic, status string) {
+	for _, payload := range a.acks.confirm(deviceName, outletNumber, topic, status) {
+		a.emit(events.CommandConfirmed, payload)
+		if payload.MessageID == 0 {
+			continue
+		}
+		a.archiveLatency(payload.MessageID, payload.LatencyMs)
+		if a.messageLog.SetLatency(payload.MessageID, payload.LatencyMs) {
+			a.emit(events.MessageLatency, events.MessageLatencyPayload{ID: payload.MessageID, LatencyMs: payload.LatencyMs})
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/notify"
+)
+
+// raiseAlert records an alert on the timeline and notifies the frontend
+func (a *App) raiseAlert(alert models.Alert) {
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+
+	a.recordTimeline(models.TimelineEntry{
+		Timestamp:    alert.Timestamp,
+		Kind:         models.TimelineAlert,
+		Severity:     alert.Severity,
+		DeviceName:   alert.DeviceName,
+		OutletNumber: alert.OutletNumber,
+		Detail:       alert.Source + ": " + alert.Message,
+	})
+
+	a.emit(events.AlertRaised, alert)
+
+	go a.forwardAlert(alert)
+}
+
+// forwardAlert sends an alert to the configured syslog and SNMP collectors
+func (a *App) forwardAlert(alert models.Alert) {
+	cfg := a.currentConfig()
+
+	minimum := models.AlertSeverity(cfg.AlertForwardMinimum)
+	if minimum == "" {
+		minimum = models.SeverityWarning
+	}
+	if !notify.AtLeast(alert.Severity, minimum) {
+		return
+	}
+
+	var senders []notify.Sender
+	if cfg.SyslogAddress != "" {
+		senders = append(senders, &notify.Syslog{
+			Network:       cfg.SyslogNetwork,
+			Address:       cfg.SyslogAddress,
+			EnterpriseOID: cfg.SNMPEnterpriseOID,
+		})
+	}
+	if cfg.SNMPTrapAddress != "" {
+		senders = append(senders, &notify.SNMPTrap{
+			Address:       cfg.SNMPTrapAddress,
+			Community:     cfg.SNMPCommunity,
+			EnterpriseOID: cfg.SNMPEnterpriseOID,
+		})
+	}
+
+	for _, sender := range senders {
+		if err := sender.Send(alert); err != nil {
+			log.Printf("Failed to forward alert: %v", err)
+		}
+	}
+}
+
+// GetAlerts returns the alerts still held in memory, newest first; a kiosk
+// is not shown alerts
+func (a *App) GetAlerts() ([]models.TimelineEntry, error) {
+	if err := a.kioskLocked(); err != nil {
+		return nil, err
+	}
+
+	recent := a.timeline.Recent()
+	alerts := make([]models.TimelineEntry, 0)
+	for i := len(recent) - 1; i >= 0; i-- {
+		if recent[i].Kind == models.TimelineAlert {
+			alerts = append(alerts, recent[i])
+		}
+	}
+	return alerts, nil
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// anomalyThresholds is the rate (switches per day in a given hour) below
+// which a switch is unusual, per sensitivity
+var anomalyThresholds = map[string]float64{
+	"low":    0.02, // practically never seen at this hour
+	"medium": 0.05, // seen less than once in 20 days
+	"high":   0.15, // seen less than about once a week
+}
+
+// usageHistory bounds how much timeline history is learned at startup
+const usageHistory = 90 * 24 * time.Hour
+
+// learnUsage trains the usage model from the timeline
+func (a *App) learnUsage(ctx context.Context) {
+	entries, err := a.timeline.Range(time.Now().Add(-usageHistory), time.Time{})
+	if err != nil {
+		log.Printf("Failed to learn usage patterns: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if entry.Kind == models.TimelineState && entry.State != "" {
+			a.usage.Observe(entry.DeviceName, entry.OutletNumber, entry.State, entry.Timestamp)
+		}
+	}
+}
+
+// checkUsage raises an alert if an outlet switched at an unusual hour, then
+// learns from the switch
+func (a *App) checkUsage(deviceName, outletNumber, status string, at time.Time) {
+	defer a.usage.Observe(deviceName, outletNumber, status, at)
+
+	cfg := a.currentConfig()
+	if !cfg.AnomalyDetection || cfg.IsAnomalyOptOut(deviceName, outletNumber) {
+		return
+	}
+
+	rate, days := a.usage.Rate(deviceName, outletNumber, status, at)
+	if days < float64(cfg.AnomalyLearningDays) {
+		return // Not enough history to know what is normal
+	}
+
+	threshold, ok := anomalyThresholds[cfg.AnomalySensitivity]
+	if !ok {
+		threshold = anomalyThresholds["medium"]
+	}
+	if rate >= threshold {
+		return
+	}
+
+	a.raiseAlert(models.Alert{
+		Severity:     models.SeverityWarning,
+		Source:       "anomaly",
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Message: fmt.Sprintf("unusual activity: switched %s at %s; seen %.2f times a day at this hour over %.0f days",
+			status, at.Format("15:04"), rate, days),
+	})
+}
+
+// SetAnomalyOptOut excludes an outlet from, or returns it to, anomaly detection
+func (a *App) SetAnomalyOptOut(deviceName, outletNumber string, optOut bool) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	key := deviceName + ":" + outletNumber
+	return a.updateConfig(func(cfg *config.Config) error {
+		patterns := make([]string, 0, len(cfg.AnomalyOptOut)+1)
+		for _, pattern := range cfg.AnomalyOptOut {
+			if pattern != key {
+				patterns = append(patterns, pattern)
+			}
+		}
+		if optOut {
+			patterns = append(patterns, key)
+		}
+		cfg.AnomalyOptOut = patterns
+		return nil
+	})
+}
+
+// SetAnomalySensitivity sets how readily unusual activity is reported
+// ("low", "medium" or "high")
+func (a *App) SetAnomalySensitivity(sensitivity string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.AnomalySensitivity = sensitivity
+		return cfg.Validate()
+	})
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/api"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// connectionSeries is the series name for the broker connection state
+const connectionSeries = "connection"
+
+// wattsSuffix ends the names of outlet power series ("device:outlet:watts")
+const wattsSuffix = ":watts"
+
+// apiBackend exposes the app's stores to the HTTP server
+type apiBackend struct {
+	app *App
+}
+
+// startAPIServer starts the embedded HTTP server
+func (a *App) startAPIServer(addr string) {
+	server := api.NewServer(apiBackend{app: a}, a.currentConfig().APIToken)
+	err := server.Start(addr)
+	if err != nil {
+		log.Printf("HTTP server not started: %v", err)
+	} else {
+		a.apiServer = server
+		a.bus.Subscribe(apiSink, func(env events.Envelope) {
+			// Transient snapshots stay local, and a kiosk's clients see only
+			// what its window does
+			if env.Revision > 0 && !a.kioskHides(env.Name, env.Data) {
+				server.Broadcast(env)
+			}
+		})
+	}
+	a.startup.addStore("http server", err)
+}
+
+// stopAPIServer stops the embedded HTTP server if it is running
+func (a *App) stopAPIServer(ctx context.Context) {
+	if a.apiServer == nil {
+		return
+	}
+	a.bus.Unsubscribe(apiSink)
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := a.apiServer.Stop(ctx); err != nil {
+		log.Printf("Failed to stop HTTP server: %v", err)
+	}
+	a.apiServer = nil
+}
+
+// Devices returns the current device list, without the outlets a kiosk
+// does not show
+func (b apiBackend) Devices() []models.DeviceOutlet {
+	devices := b.app.deviceStore.GetAll()
+	if !b.app.isKiosk() {
+		return devices
+	}
+	shown := make([]models.DeviceOutlet, 0, len(devices))
+	for _, device := range devices {
+		if b.app.kioskAllows(device.DeviceName, device.OutletNumber) {
+			shown = append(shown, device)
+		}
+	}
+	return shown
+}
+
+// SeriesNames lists the connection, one state series per known outlet
+// ("device:outlet") and a power series for each outlet reporting telemetry
+// ("device:outlet:watts")
+func (b apiBackend) SeriesNames() []string {
+	devices := b.app.deviceStore.GetAll()
+	names := make([]string, 0, len(devices)+1)
+	names = append(names, connectionSeries)
+	for _, device := range devices {
+		names = append(names, device.DeviceName+":"+device.OutletNumber)
+	}
+	for _, device := range devices {
+		if device.Watts != nil {
+			names = append(names, device.DeviceName+":"+device.OutletNumber+wattsSuffix)
+		}
+	}
+	return names
+}
+
+// findOutlet returns the known outlet a series is named after
+func (b apiBackend) findOutlet(name string) (models.DeviceOutlet, bool) {
+	for _, device := range b.app.deviceStore.GetAll() {
+		if device.DeviceName+":"+device.OutletNumber == name {
+			return device, true
+		}
+	}
+	return models.DeviceOutlet{}, false
+}
+
+// Series returns 1/0 samples for an outlet (ON/OFF) or the connection
+// (connected/not connected) built from the timeline, or the hourly average
+// watts of an outlet from the power history
+func (b apiBackend) Series(name string, from, to time.Time) ([]api.Point, error) {
+	if outletName, ok := strings.CutSuffix(name, wattsSuffix); ok {
+		outlet, known := b.findOutlet(outletName)
+		if !known {
+			return nil, fmt.Errorf("unknown series: %s", name)
+		}
+		samples := b.app.powerHistory.Samples(outlet.DeviceName, outlet.OutletNumber, from, to)
+		points := make([]api.Point, 0, len(samples))
+		for _, sample := range samples {
+			points = append(points, api.Point{Time: sample.Hour, Value: sample.Watts})
+		}
+		return points, nil
+	}
+
+	// Outlet states come from the timeline's index, without reading the file
+	if outlet, known := b.findOutlet(name); known {
+		changes, before := b.app.timeline.StateChanges(outlet.DeviceName, outlet.OutletNumber, from)
+		points := make([]api.Point, 0, len(changes)+1)
+		if before != nil {
+			if value, ok := seriesValue(name, *before); ok {
+				points = append(points, api.Point{Time: before.Timestamp, Value: value})
+			}
+		}
+		for _, entry := range changes {
+			if !to.IsZero() && entry.Timestamp.After(to) {
+				break
+			}
+			if value, ok := seriesValue(name, entry); ok {
+				points = append(points, api.Point{Time: entry.Timestamp, Value: value})
+			}
+		}
+		return points, nil
+	}
+
+	entries, err := b.app.timeline.Range(time.Time{}, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	var points []api.Point
+	var before *api.Point
+	for _, entry := range entries {
+		value, ok := seriesValue(name, entry)
+		if !ok {
+			continue
+		}
+
+		point := api.Point{Time: entry.Timestamp, Value: value}
+		if !from.IsZero() && entry.Timestamp.Before(from) {
+			before = &point
+			continue
+		}
+		points = append(points, point)
+	}
+
+	if before != nil {
+		points = append([]api.Point{*before}, points...)
+	}
+	return points, nil
+}
+
+// seriesValue maps a timeline entry to a value of the named series
+func seriesValue(name string, entry models.TimelineEntry) (float64, bool) {
+	if name == connectionSeries {
+		if entry.Kind != models.TimelineConnection {
+			return 0, false
+		}
+		if entry.State == string(mqtt.StateConnected) {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if entry.Kind != models.TimelineState || entry.DeviceName+":"+entry.OutletNumber != name {
+		return 0, false
+	}
+	switch entry.State {
+	case "ON":
+		return 1, true
+	case "OFF":
+		return 0, true
+	default:
+		return 0, false
+	}
+}
@@ -2,30 +2,115 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/levonbragg/go-powercontrol/api"
 	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
 	"github.com/levonbragg/go-powercontrol/models"
 	"github.com/levonbragg/go-powercontrol/mqtt"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/levonbragg/go-powercontrol/quirks"
 )
 
 // App struct
 type App struct {
-	ctx         context.Context
-	mqttClient  *mqtt.Client
-	deviceStore *models.DeviceStore
-	messageLog  *models.MessageLog
-	config      *config.Config
+	ctx           context.Context
+	bgCtx         context.Context // cancelled on shutdown to stop background jobs
+	bgCancel      context.CancelFunc
+	mqttClient    *mqtt.Client
+	subscriptions *SubscriptionManager
+	deviceStore   *models.DeviceStore
+	messageLog    *models.MessageLog
+	archive       atomic.Pointer[models.MessageArchive] // nil unless messageArchive is set
+	traffic       atomic.Pointer[models.TrafficLog]     // nil unless trafficLog is set
+	auditLog      *models.AuditLog
+	timeline      *models.Timeline
+	usage         *models.UsageModel
+	baselines     *models.EnergyBaselines
+	powerHistory  *models.PowerHistory
+	switchStats   *models.SwitchStats
+	inventory     *models.Inventory
+	reservations  *models.Reservations
+	groups        *models.Groups
+	scenes        *models.Scenes
+	quirks        *quirks.Library
+	apiServer     *api.Server
+	journal       *events.Journal
+	bus           *events.Bus
+	pendingEvents *events.PendingBuffer
+	frontendSeen  atomic.Int64                  // unix nanoseconds of the last frontend heartbeat; 0 if hidden
+	config        atomic.Pointer[config.Config] // replaced whole, never changed in place; read with currentConfig
+	configMu      sync.Mutex                    // serializes config changes; see updateConfig
+	protocols     atomic.Pointer[protocolCache] // built from config by setConfig
+
+	confirmMu     sync.Mutex
+	confirmations map[string]*confirmation
+
+	elevationMu sync.Mutex
+	elevation   *elevation
+	pinAttempts pinAttempts // guarded by elevationMu
+
+	logNotify chan struct{}
+	throttle  *eventThrottle
+	startup   startupReport
+	recovery  recovery
+	topics    topicCache
+
+	republishQueue chan normalizedState
+	discovered     discoveryRegistry
+	drift          driftTracker
+	devices        deviceProtocols
+	statusAudit    statusAudit
+	pulses         pulseTracker
+	groupRuns      runTracker // groups being switched
+	bulk           bulkRun    // the bulk command being sent
+	sceneRuns      runTracker // scenes being applied
+	unparsed       unparsedCounter
+	acks           ackTracker
+	loops          loopDetector
+	lastRetained   atomic.Int64 // unix nanoseconds of the last retained message
+	archiveFailing atomic.Bool  // the last archive append failed
+	trafficFailing atomic.Bool  // the last traffic log write failed
+	logControl     logControl
+	startupActions sync.Once
+	commissioning  commissioning
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
+	client := mqtt.NewClient()
+	journal := events.NewJournal(1000)
 	return &App{
-		mqttClient:  mqtt.NewClient(),
-		deviceStore: models.NewDeviceStore(),
-		messageLog:  models.NewMessageLog(1000),
+		mqttClient:    client,
+		subscriptions: NewSubscriptionManager(client),
+		deviceStore:   models.NewDeviceStore(),
+		messageLog:    models.NewMessageLog(config.DefaultLogCapacity),
+		auditLog:      models.NewAuditLog(1000, ""),
+		timeline:      models.NewTimeline(5000, ""),
+		usage:         models.NewUsageModel(),
+		baselines:     models.NewEnergyBaselines(),
+		powerHistory:  models.NewPowerHistory(),
+		switchStats:   models.NewSwitchStats(),
+		inventory:     models.NewInventory(),
+		reservations:  models.NewReservations(),
+		groups:        models.NewGroups(),
+		scenes:        models.NewScenes(),
+		quirks:        quirks.NewLibrary(),
+		journal:       journal,
+		bus:           events.NewBus(journal),
+		pendingEvents: events.NewPendingBuffer(pendingEventsSize),
+
+		confirmations: make(map[string]*confirmation),
+		logNotify:     make(chan struct{}, 1),
+
+		republishQueue: make(chan normalizedState, 256),
+		throttle:       newEventThrottle(),
 	}
 }
 
@@ -33,86 +118,502 @@ func NewApp() *App {
 // so we can call the runtime methods
 func (a *App) Startup(ctx context.Context) {
 	a.ctx = ctx
+	a.bus.Subscribe(frontendSink, a.pushToFrontend)
+	a.start()
+}
+
+// start loads the stores and starts the background jobs and the broker
+// connection; it needs no window, so tests run the app with it
+func (a *App) start() {
+	a.bus.Subscribe(pendingSink, a.keepForFrontend)
+	a.bgCtx, a.bgCancel = context.WithCancel(context.Background())
+
+	a.startup.update(func(report *StartupReport) {
+		report.Timestamp = time.Now()
+	})
 
 	// Load configuration
 	cfg, err := config.Load()
+	loadErr, recoverable := config.AsLoadError(err)
 	if err != nil {
 		log.Printf("Error loading config: %v", err)
 		cfg = config.DefaultConfig()
+		a.startup.update(func(report *StartupReport) {
+			report.ConfigDefaulted = true
+			report.ConfigError = err.Error()
+		})
+	} else {
+		a.startup.update(func(report *StartupReport) {
+			report.ConfigLoaded = true
+			report.ConfigDefaulted = cfg.IsEmpty()
+		})
+	}
+	a.setConfig(cfg)
+	if cfg.LogEvents {
+		a.bus.Subscribe(logSink, logEvent)
+	}
+
+	// Check the stored password can be decrypted on this machine
+	_, decryptErr := cfg.GetPassword()
+	a.startup.update(func(report *StartupReport) {
+		report.PasswordDecrypted = decryptErr == nil
+		if decryptErr != nil {
+			report.DecryptionError = decryptErr.Error()
+		}
+	})
+
+	// Ask the user to recover instead of silently running on defaults
+	needsRecovery := recoverable || decryptErr != nil
+	if recoverable {
+		a.beginRecovery(string(loadErr.Kind), loadErr, loadErr.Partial)
+	} else if decryptErr != nil {
+		a.beginRecovery(RecoveryDecrypt, decryptErr, cfg)
+	}
+
+	// Move passwords still encrypted in the config into the OS keychain
+	if !needsRecovery && cfg.MigrateToKeychain() {
+		if err := cfg.Save(); err != nil {
+			log.Printf("Failed to save config after moving passwords to the keychain: %v", err)
+		} else {
+			log.Printf("Moved stored passwords to the OS keychain")
+		}
+	}
+	a.startup.update(func(report *StartupReport) {
+		report.PasswordInKeychain = cfg.InKeychain()
+	})
+	a.throttle.setRates(cfg.EventThrottle)
+	a.checkProtocols()
+
+	// Persist audit entries next to the config file
+	auditPath, err := config.DataPath("audit.log")
+	if err == nil {
+		a.auditLog.SetPath(auditPath)
+	} else {
+		log.Printf("Audit log will not be persisted: %v", err)
 	}
-	a.config = cfg
+	a.startup.addStore("audit log", err)
+
+	// Persist the timeline for incident review
+	timelinePath, err := config.DataPath("timeline.log")
+	if err == nil {
+		a.timeline.SetPath(timelinePath)
+	} else {
+		log.Printf("Timeline will not be persisted: %v", err)
+	}
+	a.startup.addStore("timeline", err)
+
+	// Keep the message log on disk if configured
+	if cfg.MessageArchive {
+		err := a.openArchive(cfg)
+		if err != nil {
+			log.Printf("Message log will not be archived: %v", err)
+		}
+		a.startup.addStore("message archive", err)
+	}
+
+	// Size the message log and restore it from the archive if it is persisted
+	a.openMessageLog(cfg)
+
+	// Record all broker traffic on disk if configured
+	if cfg.TrafficLog {
+		err := a.openTrafficLog(cfg)
+		if err != nil {
+			log.Printf("Traffic will not be logged: %v", err)
+		}
+		a.startup.addStore("traffic log", err)
+	}
+
+	// Load learned energy baselines
+	baselinePath, err := config.DataPath("baselines.json")
+	if err == nil {
+		err = a.baselines.Load(baselinePath)
+	}
+	if err != nil {
+		log.Printf("Energy baselines will not be persisted: %v", err)
+	}
+	a.startup.addStore("energy baselines", err)
+
+	// Load hourly power history for capacity reports
+	powerPath, err := config.DataPath("power.json")
+	if err == nil {
+		err = a.powerHistory.Load(powerPath)
+	}
+	if err != nil {
+		log.Printf("Power history will not be persisted: %v", err)
+	}
+	a.startup.addStore("power history", err)
+
+	// Load switch counts and on-time per outlet
+	statsPath, err := config.DataPath("switchstats.json")
+	if err == nil {
+		err = a.switchStats.Load(statsPath)
+	}
+	if err != nil {
+		log.Printf("Switch statistics will not be persisted: %v", err)
+	}
+	a.startup.addStore("switch statistics", err)
+
+	// Load outlet inventory metadata
+	inventoryPath, err := config.DataPath("inventory.json")
+	if err == nil {
+		err = a.inventory.Load(inventoryPath)
+	}
+	if err != nil {
+		log.Printf("Inventory will not be persisted: %v", err)
+	}
+	a.startup.addStore("inventory", err)
+	a.loadOutletDetails()
+
+	// Load outlet reservations
+	reservationsPath, err := config.DataPath("reservations.json")
+	if err == nil {
+		err = a.reservations.Load(reservationsPath)
+	}
+	if err != nil {
+		log.Printf("Reservations will not be persisted: %v", err)
+	}
+	a.startup.addStore("reservations", err)
+
+	// Load outlet groups
+	groupsPath, err := config.DataPath("groups.json")
+	if err == nil {
+		err = a.groups.Load(groupsPath)
+	}
+	if err != nil {
+		log.Printf("Groups will not be persisted: %v", err)
+	}
+	a.startup.addStore("groups", err)
+
+	// Load saved scenes
+	scenesPath, err := config.DataPath("scenes.json")
+	if err == nil {
+		err = a.scenes.Load(scenesPath)
+	}
+	if err != nil {
+		log.Printf("Scenes will not be persisted: %v", err)
+	}
+	a.startup.addStore("scenes", err)
+
+	// Load quirk files that add to or replace the built-in quirks
+	if err := a.loadQuirks(); err != nil {
+		log.Printf("Some quirks could not be loaded: %v", err)
+	}
+	a.checkQuirks()
+
+	// Load the last known outlet states; they are stale until reported again
+	devicesPath, err := config.DataPath("devices.json")
+	if err == nil {
+		err = a.deviceStore.Load(devicesPath)
+	}
+	if err != nil {
+		log.Printf("Device states will not be persisted: %v", err)
+	}
+	a.startup.addStore("device states", err)
+	a.removeHiddenDevices()
 
 	// Set up MQTT callbacks
 	a.mqttClient.SetMessageCallback(a.handleMQTTMessage)
 	a.mqttClient.SetConnectionCallback(a.handleConnectionStatus)
 
-	// Auto-connect if config is valid
-	if !cfg.IsEmpty() {
-		go func() {
-			if err := a.connectMQTT(); err != nil {
-				log.Printf("Auto-connect failed: %v", err)
-			}
-		}()
+	// Start the embedded HTTP server if configured
+	if cfg.APIListenAddress != "" {
+		a.startAPIServer(cfg.APIListenAddress)
+	}
+
+	// Start background jobs
+	go a.runStatsReporter(a.bgCtx)
+	go a.runLogNotifier(a.bgCtx)
+	go a.runLogPruner(a.bgCtx)
+	go a.watchConfig(a.bgCtx)
+	go a.runRepublisher(a.bgCtx)
+	go a.learnUsage(a.bgCtx)
+	go a.runStatusAuditScheduler(a.bgCtx)
+	go a.runReservations(a.bgCtx)
+	go a.runDeviceSaver(a.bgCtx)
+	go a.runStaleChecker(a.bgCtx)
+	go a.runHistorySaver(a.bgCtx)
+	go a.runTimelinePruner(a.bgCtx)
+
+	// Replicas mirror a primary instead of using the broker
+	if cfg.ReplicaOf != "" {
+		go a.runReplica(a.bgCtx)
+		a.finishStartupReport()
+		return
 	}
+
+	// Auto-connect if enabled and config is valid
+	if cfg.IsEmpty() || needsRecovery || !cfg.AutoConnect {
+		a.finishStartupReport()
+		return
+	}
+
+	go func() {
+		err := a.autoConnect(a.bgCtx, cfg.AutoConnectRetries)
+		if err != nil {
+			log.Printf("Auto-connect failed: %v", err)
+		}
+
+		a.startup.update(func(report *StartupReport) {
+			report.AutoConnect.Attempted = true
+			report.AutoConnect.Connected = err == nil
+			if err != nil {
+				report.AutoConnect.Error = err.Error()
+			}
+		})
+		a.finishStartupReport()
+	}()
 }
 
 // Shutdown is called when the app is closing
 func (a *App) Shutdown(ctx context.Context) {
-	a.mqttClient.Disconnect()
+	if a.bgCancel != nil {
+		a.bgCancel()
+	}
+	// Outlets still off for a power cycle or flipped for a commissioning
+	// test are switched back while the broker connection is up
+	a.pulses.pending.Wait()
+	a.commissioning.tests.Wait()
+	a.stopAPIServer(ctx)
+	a.disconnectMQTT()
+	if err := a.deviceStore.Save(); err != nil {
+		log.Printf("Failed to save device states: %v", err)
+	}
+	if err := a.powerHistory.Flush(); err != nil {
+		log.Printf("Failed to save power history: %v", err)
+	}
+	if err := a.switchStats.Save(); err != nil {
+		log.Printf("Failed to save switch statistics: %v", err)
+	}
+	a.closeArchive()
+	a.closeTrafficLog()
+}
+
+// autoConnect connects on startup, retrying with backoff before giving up
+func (a *App) autoConnect(ctx context.Context, retries int) error {
+	cfg := a.currentConfig()
+	backoff := mqtt.Backoff{
+		Initial: time.Duration(cfg.ReconnectInitialDelay) * time.Second,
+		Max:     time.Duration(cfg.MaxReconnectInterval) * time.Second,
+	}
+
+	err := a.connectMQTT()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		log.Printf("Auto-connect attempt %d failed: %v", attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff.Delay(attempt)):
+		}
+		err = a.connectMQTT()
+	}
+
+	return err
 }
 
 // connectMQTT connects to the MQTT broker
 func (a *App) connectMQTT() error {
-	if err := a.mqttClient.Connect(a.config); err != nil {
+	cfg := a.currentConfig()
+	if err := a.mqttClient.Connect(cfg); err != nil {
 		return err
 	}
 
-	// Subscribe to the configured topic
-	if err := a.mqttClient.Subscribe(a.config.SubscribeString); err != nil {
+	// Subscribe to the configured topic and any runtime extras
+	if err := a.subscriptions.Apply(cfg.SubscriptionTopic()); err != nil {
 		return err
 	}
 
+	// Subscribe to topics handled by other protocol adapters
+	for _, sub := range cfg.ProtocolSubscriptions {
+		if err := a.mqttClient.Subscribe(sub.Topic); err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", sub.Topic, err)
+		}
+	}
+
+	// Learn switches already integrated with Home Assistant
+	if cfg.HADiscovery {
+		if err := a.mqttClient.Subscribe(a.haPrefix() + "/switch/#"); err != nil {
+			return fmt.Errorf("failed to subscribe to discovery topics: %w", err)
+		}
+	}
+
+	a.startupActions.Do(func() {
+		go a.runStartupActions(a.bgCtx, time.Now())
+	})
 	return nil
 }
 
 // handleMQTTMessage processes incoming MQTT messages
-func (a *App) handleMQTTMessage(topic string, payload string) {
-	// Log the message
-	a.messageLog.AddMessage(models.MessageReceived, topic, payload)
-
-	// Emit event to frontend
-	runtime.EventsEmit(a.ctx, "message:new", map[string]interface{}{
-		"direction": "Recv",
-		"topic":     topic,
-		"payload":   payload,
+func (a *App) handleMQTTMessage(topic string, raw []byte, flags mqtt.MessageFlags) {
+	// Log the message and notify the frontend
+	a.logMessage(models.MQTTMessage{
+		Direction: models.MessageReceived,
+		Topic:     topic,
+		Payload:   raw,
+		QoS:       flags.QoS,
+		Retained:  flags.Retained,
+		Duplicate: flags.Duplicate,
+		PacketID:  flags.PacketID,
 	})
+	if flags.Retained {
+		a.lastRetained.Store(time.Now().UnixNano())
+	}
 
-	// Parse topic to extract device and outlet
-	device, outlet, err := mqtt.ParseTopic(topic)
-	if err != nil {
-		log.Printf("Failed to parse topic %s: %v", topic, err)
+	// Device payloads are parsed as text; binary ones end up unparsed
+	payload := string(raw)
+
+	// Discovery configs and the state topics they point to
+	if a.handleDiscovery(topic, payload) {
 		return
 	}
 
-	// Parse payload to get status
-	status := mqtt.ParsePayload(payload)
+	// Device LWT messages
+	if a.handleAvailability(topic, payload) {
+		return
+	}
 
-	// Update device store
+	// Extract the outlet states carried by the message
+	states, err := a.parseStates(topic, payload)
+	if err != nil {
+		states = a.handleUnparsed(topic, payload, err)
+	}
+
+	cfg := a.currentConfig()
+	location := cfg.LocationFor(topic)
+	for _, state := range states {
+		if cfg.IsHiddenDevice(state.Device) {
+			continue
+		}
+		a.updateLocation(state.Device, state.Outlet, location)
+		a.updateBank(state.Device, state.Outlet, state.Bank)
+		if state.Status != "" {
+			a.updateOutlet(state.Device, state.Outlet, state.Status)
+			a.confirmCommands(state.Device, state.Outlet, topic, state.Status)
+		}
+		if state.HasTelemetry() {
+			a.updateTelemetry(state)
+		}
+		if state.Label != "" {
+			a.updateLabel(state.Device, state.Outlet, state.Label)
+		}
+		if state.Level != nil {
+			a.updateLevel(state.Device, state.Outlet, *state.Level)
+		}
+	}
+}
+
+// updateOutlet stores a reported outlet status and notifies the frontend
+func (a *App) updateOutlet(device, outlet, status string) {
+	// Record state changes on the timeline
+	previous, known := a.deviceStore.Get(device, outlet)
+	if !known || previous.Status != status {
+		detail := status
+		if known {
+			detail = previous.Status + " -> " + status
+		}
+		a.recordTimeline(models.TimelineEntry{
+			Kind:         models.TimelineState,
+			DeviceName:   device,
+			OutletNumber: outlet,
+			State:        status,
+			Detail:       detail,
+		})
+		a.republishState(device, outlet, status)
+		a.switchStats.Observe(device, outlet, status, time.Now())
+		if known {
+			a.checkUsage(device, outlet, status, time.Now())
+			a.observeTransition(device, outlet, time.Now())
+		}
+	}
+
+	// Update device store, keeping telemetry and discovered topics
 	deviceOutlet := models.DeviceOutlet{
 		DeviceName:   device,
 		OutletNumber: outlet,
 		Status:       status,
 	}
-	a.deviceStore.Add(deviceOutlet)
+	if known {
+		deviceOutlet = previous
+		deviceOutlet.Status = status
+		deviceOutlet.Stale = false
+	}
+	// Retained and periodic republications of the same state only count
+	// as reports; the frontend hears about changes
+	if stored, changed := a.deviceStore.Add(deviceOutlet); changed {
+		a.emit(events.DeviceUpdate, stored)
+	}
+}
+
+// updateLocation records the location given by the location rules and
+// notifies the frontend if a known outlet moved. Topics no rule matches
+// leave the location alone, since an outlet reports on several topics.
+func (a *App) updateLocation(device, outlet, location string) {
+	if location == "" {
+		return
+	}
+	if deviceOutlet, changed := a.deviceStore.SetLocation(device, outlet, location); changed {
+		a.emit(events.DeviceUpdate, deviceOutlet)
+	}
+}
+
+// updateBank records the bank named by an outlet's topic and notifies the
+// frontend if it changed
+func (a *App) updateBank(device, outlet, bank string) {
+	if bank == "" {
+		return
+	}
+	if deviceOutlet, changed := a.deviceStore.SetBank(device, outlet, bank); changed {
+		a.emit(events.DeviceUpdate, deviceOutlet)
+	}
+}
 
-	// Emit device update event to frontend
-	runtime.EventsEmit(a.ctx, "device:update", deviceOutlet)
+// updateLabel stores an outlet's friendly name and notifies the frontend
+func (a *App) updateLabel(device, outlet, label string) {
+	if previous, known := a.deviceStore.Get(device, outlet); known && previous.Label == label {
+		return // Names are usually retained and re-sent on every connect
+	}
+	a.emit(events.DeviceUpdate, a.deviceStore.SetLabel(device, outlet, label))
 }
 
 // handleConnectionStatus processes connection status changes
-func (a *App) handleConnectionStatus(connected bool) {
-	// Emit connection status event to frontend
-	runtime.EventsEmit(a.ctx, "connection:status", connected)
+func (a *App) handleConnectionStatus(status mqtt.ConnectionStatus) {
+	// Emit connection status events to frontend
+	a.emit(events.ConnectionStatus, status.State == mqtt.StateConnected)
+	a.emit(events.ConnectionState, status)
+
+	detail := string(status.State)
+	if status.Attempt > 0 {
+		detail += fmt.Sprintf(" (attempt %d)", status.Attempt)
+	}
+	if status.LastError != "" {
+		detail += ": " + status.LastError
+	}
+	if status.State == mqtt.StateConnected {
+		// Publishing from the connect handler would block it
+		go a.announceAvailability(true)
+	}
+
+	a.recordTimeline(models.TimelineEntry{
+		Kind:   models.TimelineConnection,
+		State:  string(status.State),
+		Detail: detail,
+	})
+
+	// Alert when an established connection drops and when reconnecting gives up
+	switch {
+	case status.State == mqtt.StateReconnecting && status.Attempt == 1:
+		a.raiseAlert(models.Alert{
+			Severity: models.SeverityWarning,
+			Source:   "connection",
+			Message:  "connection to broker lost: " + status.LastError,
+		})
+	case status.State == mqtt.StateDisconnected && status.LastError != "":
+		a.raiseAlert(models.Alert{
+			Severity: models.SeverityCritical,
+			Source:   "connection",
+			Message:  "broker unreachable: " + status.LastError,
+		})
+	}
 }
 
 // GetConnectionStatus returns the current MQTT connection status
@@ -120,51 +621,152 @@ func (a *App) GetConnectionStatus() bool {
 	return a.mqttClient.IsConnected()
 }
 
-// GetDevices returns all devices
-func (a *App) GetDevices() []models.DeviceOutlet {
-	return a.deviceStore.GetAll()
+// GetDevices returns all devices sorted by sortBy, one of the view sort
+// keys: "device" (name, the default), "label", "location", "status",
+// "watts" or "updated". Names and numbers sort naturally.
+func (a *App) GetDevices(sortBy string, descending bool) []models.DeviceOutlet {
+	devices := a.kioskFilter(a.deviceStore.GetAll())
+	if sortBy != "" || descending {
+		sortDevices(devices, sortBy, descending)
+	}
+	return devices
 }
 
 // SearchDevices returns filtered devices based on search text
 func (a *App) SearchDevices(searchText string) []models.DeviceOutlet {
-	return a.deviceStore.Filter(searchText)
+	return a.kioskFilter(a.deviceStore.Filter(searchText))
+}
+
+// maxPageSize is the most outlets GetDevicePage and SearchDevicePage return
+const maxPageSize = 1000
+
+// GetDevicePage returns up to limit outlets starting at offset, in natural
+// order, with the total count, so large fleets can be shown a page at a time
+func (a *App) GetDevicePage(offset, limit int) (models.DevicePage, error) {
+	if err := checkPage(offset, limit); err != nil {
+		return models.DevicePage{}, err
+	}
+	if a.isKiosk() {
+		return devicePage(a.kioskFilter(a.deviceStore.GetAll()), offset, limit), nil
+	}
+	return a.deviceStore.GetPage(offset, limit), nil
+}
+
+// SearchDevicePage returns one page of the outlets matching the search text
+func (a *App) SearchDevicePage(searchText string, offset, limit int) (models.DevicePage, error) {
+	if err := checkPage(offset, limit); err != nil {
+		return models.DevicePage{}, err
+	}
+	return devicePage(a.SearchDevices(searchText), offset, limit), nil
+}
+
+// checkPage validates a page request
+func checkPage(offset, limit int) error {
+	if offset < 0 {
+		return fmt.Errorf("offset must not be negative")
+	}
+	if limit < 1 || limit > maxPageSize {
+		return fmt.Errorf("limit must be 1 to %d", maxPageSize)
+	}
+	return nil
+}
+
+// devicePage cuts one page out of a device list
+func devicePage(devices []models.DeviceOutlet, offset, limit int) models.DevicePage {
+	page := models.DevicePage{Devices: make([]models.DeviceOutlet, 0), Offset: offset, Total: len(devices)}
+	if offset < len(devices) {
+		page.Devices = append(page.Devices, devices[offset:min(offset+limit, len(devices))]...)
+	}
+	return page
 }
 
 // GetMessages returns all logged messages
 func (a *App) GetMessages() []models.MQTTMessage {
+	if a.isKiosk() {
+		return []models.MQTTMessage{}
+	}
+
 	return a.messageLog.GetAll()
 }
 
-// SaveSettings saves the configuration and reconnects if necessary
-func (a *App) SaveSettings(username, password, server string, port int, subscribeString string) error {
-	// Create new config
-	cfg := &config.Config{
-		Username:        username,
-		MQTTServer:      server,
-		ServerPort:      port,
-		SubscribeString: subscribeString,
-	}
+// QueryMessages returns the logged messages selected by the query, newest
+// first, so the frontend can show a filtered page instead of the whole log.
+// The topic filter's levels may be "+", "#" or globs; text matches the topic
+// or payload, as a regular expression in regex mode. Limit defaults to 500;
+// pass the ID of the oldest message shown as BeforeID to fetch the next page.
+func (a *App) QueryMessages(query models.MessageQuery) ([]models.MQTTMessage, error) {
+	search, err := a.SearchMessages(query)
+	return search.Messages, err
+}
 
-	// Encrypt and set password
-	if err := cfg.SetPassword(password); err != nil {
-		return fmt.Errorf("failed to encrypt password: %w", err)
+// SearchMessages is QueryMessages that also counts every message the query
+// matches, beyond the limit. In regex mode an invalid expression is
+// reported as an error.
+func (a *App) SearchMessages(query models.MessageQuery) (models.MessageSearch, error) {
+	if a.isKiosk() {
+		return models.MessageSearch{Messages: []models.MQTTMessage{}}, nil
 	}
 
-	// Validate
-	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("invalid configuration: %w", err)
+	if query.Limit == 0 {
+		query.Limit = defaultMessageQuery
+	}
+	if query.Limit < 1 || query.Limit > maxMessageQuery {
+		return models.MessageSearch{}, fmt.Errorf("limit must be 1 to %d", maxMessageQuery)
 	}
+	if err := query.Compile(); err != nil {
+		return models.MessageSearch{}, err
+	}
+	return a.messageLog.Search(query), nil
+}
 
-	// Save to disk
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
+// Settings are the settings edited in the settings dialog
+type Settings struct {
+	Username            string `json:"username"`
+	Password            string `json:"password"`
+	Server              string `json:"mqttServer"`
+	Port                int    `json:"serverPort"`
+	SubscribeString     string `json:"subscribeString"`
+	LogCapacity         int    `json:"logCapacity"`
+	LogRetentionMinutes int    `json:"logRetentionMinutes"`
+	LogPersist          bool   `json:"logPersist"`
+}
+
+// SaveSettings saves the configuration and reconnects if necessary. The
+// message log is resized without losing the messages that still fit.
+func (a *App) SaveSettings(settings Settings) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
 	}
 
-	// Update current config
-	a.config = cfg
+	// Start from the current config so settings not shown in the dialog are kept
+	var saved *config.Config
+	err := a.updateConfig(func(cfg *config.Config) error {
+		cfg.Username = settings.Username
+		cfg.MQTTServer = settings.Server
+		cfg.ServerPort = settings.Port
+		cfg.SubscribeString = settings.SubscribeString
+		cfg.LogCapacity = settings.LogCapacity
+		cfg.LogRetentionMinutes = settings.LogRetentionMinutes
+		cfg.LogPersist = settings.LogPersist
+
+		// Encrypt and set password
+		if err := cfg.SetPassword(settings.Password); err != nil {
+			return fmt.Errorf("failed to encrypt password: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		saved = cfg
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.applyLogSettings(saved)
 
 	// Disconnect and reconnect with new settings
-	a.mqttClient.Disconnect()
+	a.disconnectMQTT()
 
 	// Clear devices and messages on reconnect
 	a.deviceStore.Clear()
@@ -177,64 +779,284 @@ func (a *App) SaveSettings(username, password, server string, port int, subscrib
 	return nil
 }
 
-// SendCommand publishes a command to turn an outlet on or off
-func (a *App) SendCommand(deviceName, outletNumber, state string) error {
-	// Build command topic
-	topic := mqtt.MakeCommandTopic(deviceName, outletNumber)
+// SendCommand publishes a command to turn an outlet on or off. Locked
+// outlets are refused unless override is set.
+func (a *App) SendCommand(deviceName, outletNumber, state string, override bool) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+	return a.withCommandPolicy(deviceName, outletNumber, "", "state="+strings.ToUpper(state), lockOverride(override), func() error {
+		return a.sendCommand(deviceName, outletNumber, state, SourceManual)
+	})
+}
+
+// SendCommandAs publishes a command on behalf of a named operator, who may
+// switch outlets they have reserved. Locked outlets are refused unless
+// override is set.
+func (a *App) SendCommandAs(deviceName, outletNumber, state, operator string, override bool) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
 
-	// Convert state to payload
-	payload := mqtt.StatusToPayload(state)
+	source := SourceManual
+	if operator != "" {
+		source = operator
+	}
+	return a.withCommandPolicy(deviceName, outletNumber, operator, "state="+strings.ToUpper(state), lockOverride(override), func() error {
+		return a.sendCommand(deviceName, outletNumber, state, source)
+	})
+}
+
+// withCommandPolicy runs send if the outlet may be switched by operator
+// (empty for anonymous and automatic commands), refusing locked outlets as
+// lock tells and reserved outlets, and auditing commands sent to critical
+// outlets under an elevated session
+func (a *App) withCommandPolicy(deviceName, outletNumber, operator, detail string, lock lockPolicy, send func() error) error {
+	if err := a.checkLock(deviceName, outletNumber, lock, detail); err != nil {
+		return err
+	}
+	if err := a.checkReservation(deviceName, outletNumber, operator); err != nil {
+		return err
+	}
+
+	if a.currentConfig().IsCritical(deviceName, outletNumber) {
+		elevated := a.GetElevation()
+		if !elevated.Active {
+			return fmt.Errorf("outlet %s/%s is critical and requires a confirmation token", deviceName, outletNumber)
+		}
+
+		if err := send(); err != nil {
+			return err
+		}
+		a.audit("elevated_command_sent", elevated.Operator, deviceName, outletNumber, detail)
+		return nil
+	}
+
+	return send()
+}
+
+// sendCommand publishes a command without any policy checks; source tells
+// who or what sent it
+func (a *App) sendCommand(deviceName, outletNumber, state, source string) error {
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+	if err := a.checkLoop(deviceName, outletNumber, source); err != nil {
+		return err
+	}
 
-	// Publish
+	topic, payload, err := a.outletCommand(deviceName, outletNumber, state)
+	if err != nil {
+		return err
+	}
+
+	return a.publishCommand(topic, payload, models.TimelineEntry{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		State:        strings.ToUpper(state),
+		Source:       source,
+		Detail:       "set " + strings.ToUpper(state),
+	})
+}
+
+// outletCommand builds the command topic and payload for the device
+// protocol, or uses the device's own topics if it was learned from discovery
+func (a *App) outletCommand(deviceName, outletNumber, state string) (string, string, error) {
+	topic, payload, err := a.buildCommand(deviceName, outletNumber, state)
+	if sw, ok := a.discovered.byOutlet(deviceName, outletNumber); ok {
+		topic, payload, err = sw.CommandTopic, sw.CommandPayload(state), nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build command: %w", err)
+	}
+	return topic, payload, nil
+}
+
+// publishCommand sends a built command and records it in the message log
+// and, as described by entry, in the timeline
+func (a *App) publishCommand(topic, payload string, entry models.TimelineEntry) error {
 	if err := a.mqttClient.Publish(topic, payload); err != nil {
 		return fmt.Errorf("failed to send command: %w", err)
 	}
 
-	// Log the sent message
-	a.messageLog.AddMessage(models.MessageSent, topic, payload)
+	a.recordCommand(topic, payload, entry)
+	return nil
+}
+
+// recordCommand logs a sent command and records it on the timeline
+func (a *App) recordCommand(topic, payload string, entry models.TimelineEntry) {
+	// Log the sent message and notify the frontend
+	messageID := a.logMessage(models.MQTTMessage{Direction: models.MessageSent, Topic: topic, Payload: []byte(payload)})
+
+	entry.Kind = models.TimelineCommand
+	a.recordTimeline(entry)
+	a.trackCommand(topic, messageID, entry)
+}
 
-	// Emit event to frontend
-	runtime.EventsEmit(a.ctx, "message:new", map[string]interface{}{
-		"direction": "Send",
-		"topic":     topic,
-		"payload":   payload,
+// Connect connects to the broker with the saved settings, for users who
+// disable auto-connect and dial out manually
+func (a *App) Connect() error {
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+	if a.IsConfigEmpty() {
+		return fmt.Errorf("broker settings are not configured")
+	}
+	if a.mqttClient.IsConnected() {
+		return nil
+	}
+
+	// Drop any half-open client or reconnect cycle before starting over
+	a.disconnectMQTT()
+	return a.connectMQTT()
+}
+
+// SetAutoConnect saves the startup connection behavior
+func (a *App) SetAutoConnect(enabled bool, retries int) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.AutoConnect = enabled
+		cfg.AutoConnectRetries = retries
+		return nil
 	})
+}
 
-	return nil
+// Reconnect starts an immediate reconnect cycle, connecting from scratch if needed
+func (a *App) Reconnect() error {
+	if a.IsConfigEmpty() {
+		return fmt.Errorf("broker settings are not configured")
+	}
+	if err := a.mqttClient.Reconnect(); err == nil {
+		return nil
+	}
+
+	// The client was never connected, so there is nothing to resume
+	return a.connectMQTT()
+}
+
+// CancelReconnect stops automatic reconnect attempts
+func (a *App) CancelReconnect() {
+	a.mqttClient.CancelReconnect()
+}
+
+// GetConnectionState returns the detailed connection state
+func (a *App) GetConnectionState() mqtt.ConnectionState {
+	return a.mqttClient.State()
 }
 
 // Disconnect disconnects from the MQTT broker
 func (a *App) Disconnect() error {
-	a.mqttClient.Disconnect()
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	a.disconnectMQTT()
 	return nil
 }
 
 // ClearLog clears the message log
 func (a *App) ClearLog() {
+	if a.isKiosk() {
+		return
+	}
+
 	a.messageLog.Clear()
-	runtime.EventsEmit(a.ctx, "log:cleared")
+	a.emit(events.LogCleared, nil)
 }
 
 // GetConfig returns the current configuration (without password)
 func (a *App) GetConfig() map[string]interface{} {
-	if a.config == nil {
-		return map[string]interface{}{
-			"username":        "",
-			"mqttServer":      "",
-			"serverPort":      1883,
-			"subscribeString": "power/#",
-		}
+	if a.isKiosk() {
+		return map[string]interface{}{"kioskMode": true}
 	}
 
+	cfg := a.currentConfig() // defaults until the config is loaded
 	return map[string]interface{}{
-		"username":        a.config.Username,
-		"mqttServer":      a.config.MQTTServer,
-		"serverPort":      a.config.ServerPort,
-		"subscribeString": a.config.SubscribeString,
+		"username":             cfg.Username,
+		"mqttServer":           cfg.MQTTServer,
+		"serverPort":           cfg.ServerPort,
+		"subscribeString":      cfg.SubscribeString,
+		"keepAlive":            cfg.KeepAlive,
+		"pingTimeout":          cfg.PingTimeout,
+		"connectTimeout":       cfg.ConnectTimeout,
+		"maxReconnectInterval": cfg.MaxReconnectInterval,
+		"logCapacity":          cfg.LogCapacity,
+		"logRetentionMinutes":  cfg.LogRetentionMinutes,
+		"logPersist":           cfg.LogPersist,
 	}
 }
 
+// GetAuditLog returns the recorded audit entries (newest first)
+func (a *App) GetAuditLog() []models.AuditEntry {
+	if a.isKiosk() {
+		return []models.AuditEntry{}
+	}
+
+	return a.auditLog.GetAll()
+}
+
+// audit records an entry in the audit log
+func (a *App) audit(action, operator, deviceName, outletNumber, detail string) {
+	err := a.auditLog.Record(models.AuditEntry{
+		Action:       action,
+		Operator:     operator,
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Detail:       detail,
+	})
+	if err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
+
+// currentConfig returns a copy of the active config, or defaults if none is loaded
+func (a *App) currentConfig() *config.Config {
+	loaded := a.config.Load()
+	if loaded == nil {
+		return config.DefaultConfig()
+	}
+	current := *loaded
+	return &current
+}
+
+// setConfig makes cfg the running config. Callers build it from a copy
+// returned by currentConfig and must not change it afterwards. Outside
+// startup they hold configMu, usually through updateConfig.
+func (a *App) setConfig(cfg *config.Config) {
+	a.config.Store(cfg)
+	a.protocols.Store(a.buildProtocols(cfg))
+}
+
+// errConfigUnchanged is returned by an updateConfig change that turns out
+// to change nothing, so nothing is saved
+var errConfigUnchanged = errors.New("config unchanged")
+
+// updateConfig lets change edit a copy of the running config, then saves
+// it and makes it the running config. Changes are serialized by configMu,
+// so concurrent ones cannot lose each other's updates. An error from
+// change aborts without saving and is returned, except errConfigUnchanged.
+func (a *App) updateConfig(change func(cfg *config.Config) error) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	cfg := a.currentConfig()
+	if err := change(cfg); errors.Is(err, errConfigUnchanged) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	a.setConfig(cfg)
+	return nil
+}
+
 // IsConfigEmpty returns true if the configuration is not set up
 func (a *App) IsConfigEmpty() bool {
-	return a.config == nil || a.config.IsEmpty()
+	loaded := a.config.Load()
+	return loaded == nil || loaded.IsEmpty()
 }
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Message archive pruning interval and message query bounds
+const (
+	archivePruneInterval = time.Minute
+	defaultMessageQuery  = 500
+	maxMessageQuery      = 10000
+)
+
+// openArchive opens the message archive and starts pruning it
+func (a *App) openArchive(cfg *config.Config) error {
+	path, err := config.DataPath("messages.db")
+	if err != nil {
+		return err
+	}
+	maxAge := time.Duration(cfg.MessageArchiveDays) * 24 * time.Hour
+	maxBytes := int64(cfg.MessageArchiveMB) << 20
+	archive, err := models.OpenMessageArchive(path, maxAge, maxBytes)
+	if err != nil {
+		return err
+	}
+
+	// Older versions archived to a JSON-lines file
+	if legacyPath, err := config.DataPath("messages.log"); err == nil {
+		if imported, err := archive.ImportLegacy(legacyPath); err != nil {
+			log.Printf("Failed to import %s into the message archive: %v", legacyPath, err)
+		} else if imported > 0 {
+			log.Printf("Imported %d messages from %s into the message archive", imported, legacyPath)
+		}
+	}
+
+	a.messageLog.SetLastID(archive.LastID())
+	a.archive.Store(archive)
+	go a.runArchivePruner(a.bgCtx, archive)
+	return nil
+}
+
+// closeArchive stops archiving messages
+func (a *App) closeArchive() {
+	if archive := a.archive.Swap(nil); archive != nil {
+		archive.Close()
+	}
+}
+
+// archiveMessage appends a logged message to the archive, if enabled,
+// reporting only the first of a run of failures
+func (a *App) archiveMessage(msg models.MQTTMessage) {
+	archive := a.archive.Load()
+	if archive == nil {
+		return
+	}
+	if err := archive.Append(msg); err != nil {
+		if !a.archiveFailing.Swap(true) {
+			log.Printf("Failed to archive message: %v", err)
+		}
+		return
+	}
+	a.archiveFailing.Store(false)
+}
+
+// archiveLatency records the confirmation latency of an archived command,
+// if the archive is enabled
+func (a *App) archiveLatency(id uint64, latencyMs float64) {
+	archive := a.archive.Load()
+	if archive == nil {
+		return
+	}
+	if err := archive.SetLatency(id, latencyMs); err != nil {
+		log.Printf("Failed to archive the latency of message %d: %v", id, err)
+	}
+}
+
+// QueryMessageArchive returns the archived messages selected by the query,
+// newest first: by topic filter (levels may be "+", "#" or globs),
+// direction and time range, up to the limit (500 if zero, at most 10000)
+func (a *App) QueryMessageArchive(query models.MessageQuery) ([]models.MQTTMessage, error) {
+	if err := a.kioskLocked(); err != nil {
+		return nil, err
+	}
+	archive := a.archive.Load()
+	if archive == nil {
+		return nil, fmt.Errorf("the message archive is not enabled")
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultMessageQuery
+	}
+	if query.Limit < 1 || query.Limit > maxMessageQuery {
+		return nil, fmt.Errorf("limit must be 1 to %d", maxMessageQuery)
+	}
+	if err := query.Compile(); err != nil {
+		return nil, err
+	}
+	messages, err := archive.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message archive: %w", err)
+	}
+	return messages, nil
+}
+
+// ClearMessageArchive removes every archived message
+func (a *App) ClearMessageArchive() error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+	archive := a.archive.Load()
+	if archive == nil {
+		return fmt.Errorf("the message archive is not enabled")
+	}
+
+	if err := archive.Clear(); err != nil {
+		return fmt.Errorf("failed to clear message archive: %w", err)
+	}
+	a.audit("message_archive_cleared", "", "", "", "")
+	return nil
+}
+
+// runArchivePruner applies the archive retention limits every minute until
+// the archive is closed
+func (a *App) runArchivePruner(ctx context.Context, archive *models.MessageArchive) {
+	ticker := time.NewTicker(archivePruneInterval)
+	defer ticker.Stop()
+
+	for a.archive.Load() == archive {
+		if _, err := archive.Prune(time.Now()); err != nil {
+			log.Printf("Failed to prune message archive: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"log"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// handleAvailability applies a device's LWT message, reporting whether the
+// topic was an availability topic
+func (a *App) handleAvailability(topic, payload string) bool {
+	if !mqtt.IsAvailabilityTopic(topic) {
+		return false
+	}
+
+	device, availability, err := mqtt.ParseAvailability(topic, payload)
+	if err != nil {
+		log.Printf("Failed to parse availability on %s: %v", topic, err)
+		return true
+	}
+
+	previous, outlets := a.deviceStore.SetAvailability(device, availability)
+	if previous == availability || a.currentConfig().IsHiddenDevice(device) {
+		return true
+	}
+	for _, outlet := range outlets {
+		a.emit(events.DeviceUpdate, outlet)
+	}
+
+	switch {
+	case availability == models.AvailabilityOffline:
+		a.emit(events.DeviceOffline, events.AvailabilityPayload{DeviceName: device, Availability: availability})
+		a.raiseAlert(models.Alert{
+			Severity:   models.SeverityWarning,
+			Source:     "availability",
+			DeviceName: device,
+			Message:    "device is unreachable",
+		})
+	case previous == models.AvailabilityOffline:
+		a.raiseAlert(models.Alert{
+			Severity:   models.SeverityInfo,
+			Source:     "availability",
+			DeviceName: device,
+			Message:    "device is back online",
+		})
+	}
+	return true
+}
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Backtest limits
+const (
+	defaultBacktestDays = 7
+	maxBacktestDays     = 90
+	maxBacktestActions  = 10000 // stops runaway rule chains
+)
+
+// BacktestSchedule switches outlets at a time of day
+type BacktestSchedule struct {
+	Name    string   `json:"name"`
+	At      string   `json:"at"`             // "15:04", local time
+	Days    []string `json:"days,omitempty"` // "mon" to "sun"; empty means every day
+	Outlets []string `json:"outlets"`        // "device:outlet", glob patterns allowed
+	State   string   `json:"state"`          // ON or OFF
+}
+
+// BacktestRule switches outlets when another outlet reports a state
+type BacktestRule struct {
+	Name      string   `json:"name"`
+	When      string   `json:"when"`                // "device:outlet" pattern that triggers the rule
+	WhenState string   `json:"whenState,omitempty"` // ON or OFF; empty triggers on any change
+	Outlets   []string `json:"outlets"`             // "device:outlet", glob patterns allowed
+	State     string   `json:"state"`               // ON or OFF
+	Delay     int      `json:"delay,omitempty"`     // seconds after the trigger
+}
+
+// BacktestPlan is a proposed set of schedules and rules
+type BacktestPlan struct {
+	Schedules []BacktestSchedule `json:"schedules"`
+	Rules     []BacktestRule     `json:"rules"`
+}
+
+// BacktestAction is a command the plan would have sent
+type BacktestAction struct {
+	Time         time.Time `json:"time"`
+	Source       string    `json:"source"` // the schedule or rule name
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	State        string    `json:"state"`
+	Previous     string    `json:"previous,omitempty"` // state the outlet was in; empty if unknown
+	Changed      bool      `json:"changed"`            // the command would have switched the outlet
+}
+
+// BacktestReport is what a plan would have done over a period
+type BacktestReport struct {
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Actions   []BacktestAction `json:"actions"`
+	Changes   int              `json:"changes"`   // actions that would have switched an outlet
+	BySource  map[string]int   `json:"bySource"`  // actions per schedule or rule
+	Truncated bool             `json:"truncated"` // the action limit was hit, e.g. by rules triggering each other
+}
+
+// backtestEvent is a recorded state report or a planned command, in time order
+type backtestEvent struct {
+	at       time.Time
+	reported *models.TimelineEntry // a state report from history
+	source   string                // planned command: schedule or rule name
+	targets  []string              // planned command: outlet patterns
+	state    string                // planned command: state to set
+}
+
+// weekdays maps day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Backtest runs a proposed plan against the outlet history of the last days
+// (7 if zero) and reports the commands it would have sent. Outlets keep the
+// state a simulated command set until they next reported, and rules react
+// to both recorded and simulated state changes. Nothing is sent.
+func (a *App) Backtest(plan BacktestPlan, days int) (BacktestReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return BacktestReport{}, err
+	}
+
+	if days == 0 {
+		days = defaultBacktestDays
+	}
+	if days < 1 || days > maxBacktestDays {
+		return BacktestReport{}, fmt.Errorf("backtest period must be 1 to %d days", maxBacktestDays)
+	}
+	if err := plan.validate(); err != nil {
+		return BacktestReport{}, err
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -days)
+	entries, err := a.timeline.Range(from, to)
+	if err != nil {
+		return BacktestReport{}, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	// Outlets commands may target: those in the history and those known now
+	outlets := make(map[string]bool)
+	queue := make([]backtestEvent, 0)
+	for i := range entries {
+		if entries[i].Kind != models.TimelineState {
+			continue
+		}
+		outlets[entries[i].DeviceName+":"+entries[i].OutletNumber] = true
+		queue = append(queue, backtestEvent{at: entries[i].Timestamp, reported: &entries[i]})
+	}
+	for _, outlet := range a.deviceStore.GetAll() {
+		outlets[outlet.DeviceName+":"+outlet.OutletNumber] = true
+	}
+	for _, schedule := range plan.Schedules {
+		queue = append(queue, schedule.firings(from, to)...)
+	}
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].at.Before(queue[j].at) })
+
+	report := BacktestReport{From: from, To: to, Actions: make([]BacktestAction, 0), BySource: make(map[string]int)}
+	states := make(map[string]string) // key: "device:outlet"
+
+	// trigger queues the rules reacting to an outlet changing to state
+	trigger := func(at time.Time, key, state string) {
+		for _, rule := range plan.Rules {
+			if matched, _ := path.Match(rule.When, key); !matched {
+				continue
+			}
+			if rule.WhenState != "" && !strings.EqualFold(rule.WhenState, state) {
+				continue
+			}
+			event := backtestEvent{
+				at:      at.Add(time.Duration(rule.Delay) * time.Second),
+				source:  rule.Name,
+				targets: rule.Outlets,
+				state:   strings.ToUpper(rule.State),
+			}
+			if event.at.After(to) {
+				continue
+			}
+			// Keep the queue in time order, after events at the same time
+			i := sort.Search(len(queue), func(i int) bool { return queue[i].at.After(event.at) })
+			queue = append(queue, backtestEvent{})
+			copy(queue[i+1:], queue[i:])
+			queue[i] = event
+		}
+	}
+
+	for len(queue) > 0 {
+		event := queue[0]
+		queue = queue[1:]
+
+		if event.reported != nil {
+			key := event.reported.DeviceName + ":" + event.reported.OutletNumber
+			previous := states[key]
+			states[key] = event.reported.State
+			if previous != event.reported.State {
+				trigger(event.at, key, event.reported.State)
+			}
+			continue
+		}
+
+		for _, key := range matchingOutlets(outlets, event.targets) {
+			if len(report.Actions) == maxBacktestActions {
+				report.Truncated = true
+				return report, nil
+			}
+
+			deviceName, outletNumber, _ := strings.Cut(key, ":")
+			action := BacktestAction{
+				Time:         event.at,
+				Source:       event.source,
+				DeviceName:   deviceName,
+				OutletNumber: outletNumber,
+				State:        event.state,
+				Previous:     states[key],
+				Changed:      states[key] != event.state,
+			}
+			report.Actions = append(report.Actions, action)
+			report.BySource[event.source]++
+			if action.Changed {
+				report.Changes++
+				states[key] = event.state
+				trigger(event.at, key, event.state)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// validate checks a plan before it is run
+func (p BacktestPlan) validate() error {
+	names := make(map[string]bool)
+	checkName := func(name string) error {
+		if name == "" {
+			return fmt.Errorf("every schedule and rule needs a name")
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate schedule or rule name: %s", name)
+		}
+		names[name] = true
+		return nil
+	}
+	checkState := func(name, state string) error {
+		if state = strings.ToUpper(state); state != "ON" && state != "OFF" {
+			return fmt.Errorf("%s: state must be ON or OFF", name)
+		}
+		return nil
+	}
+	checkPatterns := func(name string, patterns []string) error {
+		if len(patterns) == 0 {
+			return fmt.Errorf("%s: no outlets given", name)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: invalid outlet pattern %q", name, pattern)
+			}
+		}
+		return nil
+	}
+
+	for _, schedule := range p.Schedules {
+		if err := checkName(schedule.Name); err != nil {
+			return err
+		}
+		if _, err := time.Parse("15:04", schedule.At); err != nil {
+			return fmt.Errorf("%s: time must be HH:MM", schedule.Name)
+		}
+		for _, day := range schedule.Days {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return fmt.Errorf("%s: unknown day %q", schedule.Name, day)
+			}
+		}
+		if err := checkState(schedule.Name, schedule.State); err != nil {
+			return err
+		}
+		if err := checkPatterns(schedule.Name, schedule.Outlets); err != nil {
+			return err
+		}
+	}
+
+	for _, rule := range p.Rules {
+		if err := checkName(rule.Name); err != nil {
+			return err
+		}
+		if err := checkPatterns(rule.Name, []string{rule.When}); err != nil {
+			return err
+		}
+		if rule.WhenState != "" {
+			if err := checkState(rule.Name, rule.WhenState); err != nil {
+				return err
+			}
+		}
+		if err := checkState(rule.Name, rule.State); err != nil {
+			return err
+		}
+		if err := checkPatterns(rule.Name, rule.Outlets); err != nil {
+			return err
+		}
+		if rule.Delay < 0 {
+			return fmt.Errorf("%s: delay cannot be negative", rule.Name)
+		}
+	}
+	return nil
+}
+
+// firings returns the times a schedule fires between from and to
+func (s BacktestSchedule) firings(from, to time.Time) []backtestEvent {
+	at, _ := time.Parse("15:04", s.At)
+	days := make(map[time.Weekday]bool)
+	for _, day := range s.Days {
+		days[weekdays[strings.ToLower(day)]] = true
+	}
+
+	firings := make([]backtestEvent, 0)
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for day := start; !day.After(to); day = day.AddDate(0, 0, 1) {
+		fire := time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, day.Location())
+		if fire.Before(from) || fire.After(to) || (len(days) > 0 && !days[fire.Weekday()]) {
+			continue
+		}
+		firings = append(firings, backtestEvent{at: fire, source: s.Name, targets: s.Outlets, state: strings.ToUpper(s.State)})
+	}
+	return firings
+}
+
+// matchingOutlets returns the known outlets matching any pattern, sorted
+func matchingOutlets(outlets map[string]bool, patterns []string) []string {
+	matches := make([]string, 0)
+	for key := range outlets {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, key); matched {
+				matches = append(matches, key)
+				break
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,27 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/discovery"
+)
+
+// DiscoverBrokers scans the local network for MQTT brokers advertised via
+// mDNS/DNS-SD so first-time users can pick one instead of typing an address
+func (a *App) DiscoverBrokers(timeoutSeconds int) ([]discovery.Broker, error) {
+	if err := a.kioskLocked(); err != nil {
+		return nil, err
+	}
+
+	if timeoutSeconds <= 0 || timeoutSeconds > 30 {
+		timeoutSeconds = 3
+	}
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return discovery.Browse(ctx, discovery.MQTTService, time.Duration(timeoutSeconds)*time.Second)
+}
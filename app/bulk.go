@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// SourceBulk is the command source of bulk commands
+const SourceBulk = "bulk"
+
+// BulkFilter selects the outlets of a bulk command: the members of Group if
+// set, otherwise the outlets matching Search (every outlet if empty)
+type BulkFilter struct {
+	Search string `json:"search"`
+	Group  string `json:"group,omitempty"`
+}
+
+// BulkOutletResult is the outcome of a bulk command for one outlet
+type BulkOutletResult struct {
+	DeviceName   string `json:"deviceName"`
+	OutletNumber string `json:"outletNumber"`
+	Error        string `json:"error,omitempty"` // empty if the command was sent
+}
+
+// BulkSummary is the payload of bulk:command, emitted when a bulk command
+// has tried every outlet
+type BulkSummary struct {
+	Filter    BulkFilter         `json:"filter"`
+	State     string             `json:"state"`
+	Total     int                `json:"total"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Cancelled bool               `json:"cancelled,omitempty"` // the remaining outlets were not tried
+	Outlets   []BulkOutletResult `json:"outlets"`
+}
+
+// BulkPreview lists the outlets a bulk command would switch. Token must be
+// passed to SendBulkCommand, which refuses to run if the outlets changed.
+type BulkPreview struct {
+	Outlets []models.DeviceOutlet `json:"outlets"`
+	Token   string                `json:"token"`
+}
+
+// bulkRun is the bulk command being sent, if any
+type bulkRun struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc // nil if no bulk command is running
+}
+
+// PreviewBulkCommand returns the outlets a bulk command with the filter
+// would switch, so they can be confirmed first
+func (a *App) PreviewBulkCommand(filter BulkFilter) (BulkPreview, error) {
+	targets, err := a.bulkTargets(filter)
+	if err != nil {
+		return BulkPreview{}, err
+	}
+	return BulkPreview{Outlets: targets, Token: bulkToken(targets)}, nil
+}
+
+// bulkToken identifies a list of bulk command targets
+func bulkToken(targets []models.DeviceOutlet) string {
+	hash := sha256.New()
+	for _, outlet := range targets {
+		fmt.Fprintf(hash, "%s\x00%s\n", outlet.DeviceName, outlet.OutletNumber)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// SendBulkCommand switches the outlets selected by filter ON or OFF in the
+// background, one at a time with bulkCommandDelay milliseconds between
+// commands, and emits a bulk:command summary with the result for each
+// outlet. token is the one PreviewBulkCommand returned for the filter; if
+// the outlets the filter selects have changed since, nothing is switched.
+// Locked outlets are not switched and count as failed. Only one bulk
+// command runs at a time.
+func (a *App) SendBulkCommand(filter BulkFilter, state, token string) error {
+	state = strings.ToUpper(strings.TrimSpace(state))
+	if state != "ON" && state != "OFF" {
+		return fmt.Errorf("bulk command must be ON or OFF, not %q", state)
+	}
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+
+	targets, err := a.bulkTargets(filter)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no outlets match the bulk command")
+	}
+	if token == "" {
+		return fmt.Errorf("bulk command needs the token from PreviewBulkCommand")
+	}
+	if token != bulkToken(targets) {
+		return fmt.Errorf("the outlets selected by the bulk command changed since the preview; preview it again")
+	}
+
+	parent := a.bgCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	a.bulk.mu.Lock()
+	if a.bulk.cancel != nil {
+		a.bulk.mu.Unlock()
+		return fmt.Errorf("a bulk command is already running")
+	}
+	ctx, cancel := context.WithCancel(parent)
+	a.bulk.cancel = cancel
+	a.bulk.mu.Unlock()
+	a.audit("bulk_command", "", "", "", fmt.Sprintf("state=%s outlets=%d search=%q group=%q", state, len(targets), filter.Search, filter.Group))
+
+	go func() {
+		defer func() {
+			a.bulk.mu.Lock()
+			a.bulk.cancel = nil
+			a.bulk.mu.Unlock()
+			cancel()
+		}()
+		a.runBulkCommand(ctx, filter, state, targets)
+	}()
+	return nil
+}
+
+// CancelBulkCommand stops the running bulk command before its next outlet;
+// the bulk:command summary marks it cancelled
+func (a *App) CancelBulkCommand() error {
+	a.bulk.mu.Lock()
+	cancel := a.bulk.cancel
+	a.bulk.mu.Unlock()
+
+	if cancel == nil {
+		return fmt.Errorf("no bulk command is running")
+	}
+	cancel()
+	a.audit("bulk_command_cancelled", "", "", "", "")
+	return nil
+}
+
+// bulkTargets returns the outlets selected by a bulk filter
+func (a *App) bulkTargets(filter BulkFilter) ([]models.DeviceOutlet, error) {
+	if filter.Group == "" {
+		return a.SearchDevices(filter.Search), nil
+	}
+
+	group, ok := a.groups.Get(filter.Group)
+	if !ok {
+		return nil, fmt.Errorf("group not found: %s", filter.Group)
+	}
+	if err := a.kioskGroup(group); err != nil {
+		return nil, err
+	}
+	targets := make([]models.DeviceOutlet, 0, len(group.Members))
+	for _, member := range group.Members {
+		outlet, known := a.deviceStore.Get(member.DeviceName, member.OutletNumber)
+		if !known {
+			outlet = models.DeviceOutlet{DeviceName: member.DeviceName, OutletNumber: member.OutletNumber, Status: "UNKNOWN"}
+		}
+		targets = append(targets, outlet)
+	}
+	return targets, nil
+}
+
+// runBulkCommand switches the targets in order and emits the summary
+func (a *App) runBulkCommand(ctx context.Context, filter BulkFilter, state string, targets []models.DeviceOutlet) {
+	delay := time.Duration(a.currentConfig().BulkCommandDelay) * time.Millisecond
+
+	summary := BulkSummary{Filter: filter, State: state, Total: len(targets), Outlets: make([]BulkOutletResult, 0, len(targets))}
+	for i, outlet := range targets {
+		if i > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		if ctx.Err() != nil {
+			summary.Cancelled = true
+			break
+		}
+
+		result := BulkOutletResult{DeviceName: outlet.DeviceName, OutletNumber: outlet.OutletNumber}
+		err := a.withCommandPolicy(outlet.DeviceName, outlet.OutletNumber, "", SourceBulk+" state="+state, lockEnforced, func() error {
+			return a.sendCommand(outlet.DeviceName, outlet.OutletNumber, state, SourceBulk)
+		})
+		if err != nil {
+			log.Printf("Bulk command: failed to switch %s/%s: %v", outlet.DeviceName, outlet.OutletNumber, err)
+			result.Error = err.Error()
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+		summary.Outlets = append(summary.Outlets, result)
+	}
+
+	a.emit(events.BulkCommand, summary)
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Capacity report period and history save interval
+const (
+	defaultCapacityDays = 7
+	historySaveInterval = 5 * time.Minute
+)
+
+// CapacityLoad is the estimated load of one inventory circuit or group
+type CapacityLoad struct {
+	Name            string     `json:"name"`
+	Outlets         int        `json:"outlets"`
+	Measured        int        `json:"measured"`         // outlets with power readings in the period
+	Estimated       int        `json:"estimated"`        // outlets counted at their rated wattage instead
+	RatedWatts      float64    `json:"ratedWatts"`       // sum of the outlets' rated wattage
+	AverageWatts    float64    `json:"averageWatts"`     // mean load over the hours with readings
+	PeakWatts       float64    `json:"peakWatts"`        // highest hourly load, from each outlet's hourly maximum
+	PeakAt          *time.Time `json:"peakAt,omitempty"` // start of the peak hour
+	CapacityWatts   float64    `json:"capacityWatts,omitempty"`
+	HeadroomWatts   *float64   `json:"headroomWatts,omitempty"`   // capacity minus peak; nil without a capacity
+	HeadroomPercent *float64   `json:"headroomPercent,omitempty"` // of the capacity
+}
+
+// CapacityReport estimates the load of each circuit and group over a period
+type CapacityReport struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Circuits []CapacityLoad `json:"circuits"`
+	Groups   []CapacityLoad `json:"groups"`
+}
+
+// GetCapacityReport estimates the average and peak load of every inventory
+// circuit and group over the last days (7 if zero), from the hourly power
+// history. Outlets without readings count at their rated wattage, so the
+// estimate errs high. Headroom is given where a capacity is configured.
+func (a *App) GetCapacityReport(days int) (CapacityReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CapacityReport{}, err
+	}
+
+	if days == 0 {
+		days = defaultCapacityDays
+	}
+	if days < 1 || days > models.PowerHistoryDays {
+		return CapacityReport{}, fmt.Errorf("capacity period must be 1 to %d days", models.PowerHistoryDays)
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -days)
+	history := a.powerHistory.Range(from, to)
+
+	circuits := make(map[string][]models.OutletMetadata)
+	groups := make(map[string][]models.OutletMetadata)
+	for _, outlet := range a.inventory.GetAll() {
+		if outlet.Circuit != "" {
+			circuits[outlet.Circuit] = append(circuits[outlet.Circuit], outlet)
+		}
+		if outlet.Group != "" {
+			groups[outlet.Group] = append(groups[outlet.Group], outlet)
+		}
+	}
+
+	cfg := a.currentConfig()
+	report := CapacityReport{From: from, To: to, Circuits: make([]CapacityLoad, 0), Groups: make([]CapacityLoad, 0)}
+	for name, outlets := range circuits {
+		report.Circuits = append(report.Circuits, capacityLoad(name, outlets, history, cfg.CircuitCapacity[name]))
+	}
+	for name, outlets := range groups {
+		report.Groups = append(report.Groups, capacityLoad(name, outlets, history, cfg.GroupCapacity[name]))
+	}
+	sort.Slice(report.Circuits, func(i, j int) bool { return report.Circuits[i].Name < report.Circuits[j].Name })
+	sort.Slice(report.Groups, func(i, j int) bool { return report.Groups[i].Name < report.Groups[j].Name })
+	return report, nil
+}
+
+// capacityLoad sums the hourly samples of a circuit's or group's outlets
+func capacityLoad(name string, outlets []models.OutletMetadata, history map[string][]models.PowerSample, capacity float64) CapacityLoad {
+	load := CapacityLoad{Name: name, Outlets: len(outlets), CapacityWatts: capacity}
+
+	average := make(map[time.Time]float64) // key: hour
+	peak := make(map[time.Time]float64)
+	var fixed float64 // outlets counted at their rated wattage
+	for _, outlet := range outlets {
+		if outlet.RatedWatts != nil {
+			load.RatedWatts += *outlet.RatedWatts
+		}
+		samples := history[outlet.DeviceName+":"+outlet.OutletNumber]
+		if len(samples) == 0 {
+			if outlet.RatedWatts != nil {
+				fixed += *outlet.RatedWatts
+				load.Estimated++
+			}
+			continue
+		}
+		load.Measured++
+		for _, sample := range samples {
+			average[sample.Hour] += sample.Watts
+			peak[sample.Hour] += sample.MaxWatts
+		}
+	}
+
+	load.AverageWatts, load.PeakWatts = fixed, fixed
+	if len(average) > 0 {
+		var total float64
+		for _, watts := range average {
+			total += watts
+		}
+		load.AverageWatts += total / float64(len(average))
+
+		var peakHour time.Time
+		var peakWatts float64
+		for hour, watts := range peak {
+			if peakHour.IsZero() || watts > peakWatts {
+				peakHour, peakWatts = hour, watts
+			}
+		}
+		load.PeakWatts += peakWatts
+		load.PeakAt = &peakHour
+	}
+
+	if capacity > 0 {
+		headroom := capacity - load.PeakWatts
+		percent := headroom / capacity * 100
+		load.HeadroomWatts, load.HeadroomPercent = &headroom, &percent
+	}
+	return load
+}
+
+// runHistorySaver saves the power history, once an hour has completed, and
+// the switch statistics every few minutes
+func (a *App) runHistorySaver(ctx context.Context) {
+	ticker := time.NewTicker(historySaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return // Shutdown saves
+		case <-ticker.C:
+			if err := a.powerHistory.Save(); err != nil {
+				log.Printf("Failed to save power history: %v", err)
+			}
+			if err := a.switchStats.Save(); err != nil {
+				log.Printf("Failed to save switch statistics: %v", err)
+			}
+		}
+	}
+}
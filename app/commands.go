@@ -0,0 +1,105 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Command sources recorded on the timeline; confirmed commands record the
+// requesting and confirming operators instead
+const (
+	SourceManual        = "manual"
+	SourcePowerCycle    = "power cycle"
+	SourceCommissioning = "commissioning"
+	SourceStatusAudit   = "status audit"
+	SourceEmergency     = "emergency off"
+)
+
+// commandConfirmWindow bounds how long after a command a reported state
+// still counts as its result
+const commandConfirmWindow = 30 * time.Second
+
+// RecentCommand is a command sent to an outlet and the state the outlet
+// reported in response, if any
+type RecentCommand struct {
+	SentAt      time.Time  `json:"sentAt"`
+	State       string     `json:"state,omitempty"` // requested state; empty for level commands
+	Source      string     `json:"source"`
+	Detail      string     `json:"detail"`
+	Confirmed   bool       `json:"confirmed"`
+	ConfirmedAt *time.Time `json:"confirmedAt,omitempty"`
+	Result      string     `json:"result,omitempty"` // what the outlet reported, e.g. "ON -> OFF"
+	Summary     string     `json:"summary"`          // e.g. "turned OFF by manual at 23:00"
+}
+
+// GetRecentCommands returns up to n of the latest commands sent to an
+// outlet, newest first, each with the state change it caused
+func (a *App) GetRecentCommands(deviceName, outletNumber string, n int) []RecentCommand {
+	commands := make([]RecentCommand, 0)
+	if n <= 0 || !a.kioskAllows(deviceName, outletNumber) {
+		return commands
+	}
+
+	entries := a.timeline.Recent()
+	var confirmation *models.TimelineEntry // earliest state report after the entry being looked at
+	for i := len(entries) - 1; i >= 0 && len(commands) < n; i-- {
+		entry := entries[i]
+		if entry.DeviceName != deviceName || entry.OutletNumber != outletNumber {
+			continue
+		}
+
+		switch entry.Kind {
+		case models.TimelineState:
+			confirmation = &entries[i]
+		case models.TimelineCommand:
+			command := RecentCommand{
+				SentAt: entry.Timestamp,
+				State:  entry.State,
+				Source: entry.Source,
+				Detail: entry.Detail,
+			}
+			if command.Source == "" {
+				command.Source = SourceManual // recorded before sources were
+			}
+			if confirms(entry, confirmation) {
+				command.Confirmed = true
+				command.ConfirmedAt = &confirmation.Timestamp
+				command.Result = confirmation.Detail
+			}
+			command.Summary = commandSummary(command)
+			commands = append(commands, command)
+
+			// A state report belongs to the latest command before it only
+			confirmation = nil
+		}
+	}
+	return commands
+}
+
+// confirms reports whether a state report is the result of a command
+func confirms(command models.TimelineEntry, report *models.TimelineEntry) bool {
+	if report == nil || report.Timestamp.Sub(command.Timestamp) > commandConfirmWindow {
+		return false
+	}
+	switch command.State {
+	case "ON", "OFF":
+		return report.State == command.State
+	default:
+		return true // toggles and levels accept any change
+	}
+}
+
+// commandSummary describes a command for a tooltip
+func commandSummary(command RecentCommand) string {
+	action := command.Detail
+	if command.State == "ON" || command.State == "OFF" {
+		action = "turned " + command.State
+	}
+	summary := fmt.Sprintf("%s by %s at %s", action, command.Source, command.SentAt.Format("15:04"))
+	if !command.Confirmed {
+		summary += " (no state change reported)"
+	}
+	return summary
+}
@@ -0,0 +1,416 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Results of commissioning one outlet
+const (
+	CommissionPending   = "pending"   // not tested yet
+	CommissionTesting   = "testing"   // test toggle in progress
+	CommissionAwaiting  = "awaiting"  // toggled; waiting for the installer to confirm
+	CommissionConfirmed = "confirmed" // the installer saw the right equipment switch
+	CommissionFailed    = "failed"    // the wrong equipment or nothing switched
+	CommissionSkipped   = "skipped"   // left out on purpose, e.g. a critical load
+)
+
+// commissionToggleTime is how long an outlet stays flipped during a test
+const commissionToggleTime = 3 * time.Second
+
+// CommissioningOutlet tracks one outlet through commissioning
+type CommissioningOutlet struct {
+	DeviceName    string    `json:"deviceName"`
+	OutletNumber  string    `json:"outletNumber"`
+	Label         string    `json:"label,omitempty"`
+	InitialStatus string    `json:"initialStatus"`
+	Result        string    `json:"result"`
+	DeviceEchoed  bool      `json:"deviceEchoed"` // the device reported the test state
+	Note          string    `json:"note,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	TestedAt      time.Time `json:"testedAt,omitempty"`
+	ConfirmedAt   time.Time `json:"confirmedAt,omitempty"`
+}
+
+// CommissioningSession is a guided walk through the outlets of a new install
+type CommissioningSession struct {
+	Operator   string                `json:"operator,omitempty"`
+	Started    time.Time             `json:"started"`
+	Finished   time.Time             `json:"finished,omitempty"`
+	Outlets    []CommissioningOutlet `json:"outlets"`
+	Confirmed  int                   `json:"confirmed"`
+	Failed     int                   `json:"failed"`
+	Skipped    int                   `json:"skipped"`
+	Untested   int                   `json:"untested"`
+	ReportPath string                `json:"reportPath,omitempty"`
+}
+
+// commissioning holds the active session
+type commissioning struct {
+	mu       sync.Mutex
+	session  *CommissioningSession
+	starting bool           // a session is scanning for devices
+	tests    sync.WaitGroup // test toggles waiting to restore their outlet
+}
+
+// update changes an outlet of the active session and returns a copy of it
+func (c *commissioning) update(deviceName, outletNumber string, change func(*CommissioningOutlet) error) (CommissioningSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil || !c.session.Finished.IsZero() {
+		return CommissioningSession{}, fmt.Errorf("no commissioning session is active")
+	}
+	for i := range c.session.Outlets {
+		outlet := &c.session.Outlets[i]
+		if outlet.DeviceName == deviceName && outlet.OutletNumber == outletNumber {
+			if err := change(outlet); err != nil {
+				return CommissioningSession{}, err
+			}
+			c.session.tally()
+			return c.session.copy(), nil
+		}
+	}
+	return CommissioningSession{}, fmt.Errorf("outlet %s/%s is not part of the session", deviceName, outletNumber)
+}
+
+// tally recounts the results
+func (s *CommissioningSession) tally() {
+	s.Confirmed, s.Failed, s.Skipped, s.Untested = 0, 0, 0, 0
+	for _, outlet := range s.Outlets {
+		switch outlet.Result {
+		case CommissionConfirmed:
+			s.Confirmed++
+		case CommissionFailed:
+			s.Failed++
+		case CommissionSkipped:
+			s.Skipped++
+		default:
+			s.Untested++
+		}
+	}
+}
+
+// copy returns a snapshot safe to hand out
+func (s *CommissioningSession) copy() CommissioningSession {
+	snapshot := *s
+	snapshot.Outlets = append([]CommissioningOutlet(nil), s.Outlets...)
+	return snapshot
+}
+
+// StartCommissioning begins a session for the outlets reporting within
+// scanSeconds (0 uses the devices already known)
+func (a *App) StartCommissioning(operator string, scanSeconds int) (CommissioningSession, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CommissioningSession{}, err
+	}
+
+	if a.IsReplica() {
+		return CommissioningSession{}, fmt.Errorf("this instance is a read-only replica")
+	}
+	if !a.mqttClient.IsConnected() {
+		return CommissioningSession{}, fmt.Errorf("not connected to broker")
+	}
+	if scanSeconds < 0 || scanSeconds > 60 {
+		return CommissioningSession{}, fmt.Errorf("scan time must be between 0 and 60 seconds")
+	}
+
+	a.commissioning.mu.Lock()
+	active := a.commissioning.starting || (a.commissioning.session != nil && a.commissioning.session.Finished.IsZero())
+	if !active {
+		a.commissioning.starting = true
+	}
+	a.commissioning.mu.Unlock()
+	if active {
+		return CommissioningSession{}, fmt.Errorf("a commissioning session is already active")
+	}
+	defer func() {
+		a.commissioning.mu.Lock()
+		a.commissioning.starting = false
+		a.commissioning.mu.Unlock()
+	}()
+
+	// Give devices a chance to report their retained states
+	if scanSeconds > 0 {
+		ctx := a.bgCtx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case <-ctx.Done():
+			return CommissioningSession{}, ctx.Err()
+		case <-time.After(time.Duration(scanSeconds) * time.Second):
+		}
+	}
+
+	session := &CommissioningSession{Operator: operator, Started: time.Now()}
+	for _, device := range a.deviceStore.GetAll() {
+		outlet := CommissioningOutlet{
+			DeviceName:    device.DeviceName,
+			OutletNumber:  device.OutletNumber,
+			Label:         device.Label,
+			Result:        CommissionPending,
+			InitialStatus: device.Status,
+		}
+		if metadata, ok := a.inventory.Get(device.DeviceName, device.OutletNumber); ok && metadata.Label != "" {
+			outlet.Label = metadata.Label
+		}
+		session.Outlets = append(session.Outlets, outlet)
+	}
+	if len(session.Outlets) == 0 {
+		return CommissioningSession{}, fmt.Errorf("no devices found")
+	}
+	session.tally()
+
+	a.commissioning.mu.Lock()
+	a.commissioning.session = session
+	snapshot := session.copy()
+	a.commissioning.mu.Unlock()
+
+	a.audit("commissioning_started", operator, "", "", fmt.Sprintf("outlets=%d", len(snapshot.Outlets)))
+	a.emit(events.CommissioningUpdate, snapshot)
+	return snapshot, nil
+}
+
+// GetCommissioning returns the active or last finished session
+func (a *App) GetCommissioning() (CommissioningSession, bool) {
+	a.commissioning.mu.Lock()
+	defer a.commissioning.mu.Unlock()
+	if a.commissioning.session == nil {
+		return CommissioningSession{}, false
+	}
+	return a.commissioning.session.copy(), true
+}
+
+// testing returns the outlet of the session being tested, if any; the
+// caller holds mu
+func (c *commissioning) testing() (CommissioningOutlet, bool) {
+	for _, outlet := range c.session.Outlets {
+		if outlet.Result == CommissionTesting {
+			return outlet, true
+		}
+	}
+	return CommissioningOutlet{}, false
+}
+
+// TestCommissioningOutlet flips an outlet briefly so the installer can see
+// which equipment it feeds, then restores it. The outlet then awaits the
+// installer's confirmation. Only one outlet is tested at a time, so the
+// installer knows which one switched.
+func (a *App) TestCommissioningOutlet(deviceName, outletNumber string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	var initial string
+	snapshot, err := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+		if other, busy := a.commissioning.testing(); busy {
+			return fmt.Errorf("outlet %s/%s is already being tested", other.DeviceName, other.OutletNumber)
+		}
+		current, ok := a.deviceStore.Get(deviceName, outletNumber)
+		if !ok || (current.Status != "ON" && current.Status != "OFF") {
+			return fmt.Errorf("state of outlet %s/%s is unknown", deviceName, outletNumber)
+		}
+		initial = current.Status
+		outlet.Result = CommissionTesting
+		outlet.DeviceEchoed = false
+		outlet.Error = ""
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.emit(events.CommissioningUpdate, snapshot)
+
+	test := map[string]string{"ON": "OFF", "OFF": "ON"}[initial]
+	err = a.withCommandPolicy(deviceName, outletNumber, "", "commissioning test", lockEnforced, func() error {
+		return a.sendCommand(deviceName, outletNumber, test, SourceCommissioning)
+	})
+	if err != nil {
+		// Nothing switched, so the outlet can simply be tested again
+		snapshot, updateErr := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+			outlet.Result = CommissionPending
+			outlet.Error = err.Error()
+			return nil
+		})
+		if updateErr == nil {
+			a.emit(events.CommissioningUpdate, snapshot)
+		}
+		return err
+	}
+
+	a.commissioning.tests.Add(1)
+	go a.restoreCommissioningOutlet(deviceName, outletNumber, test, initial)
+	return nil
+}
+
+// restoreCommissioningOutlet switches a tested outlet back to its initial
+// state once the toggle time is over, or at once if the app is shutting down
+func (a *App) restoreCommissioningOutlet(deviceName, outletNumber, test, initial string) {
+	defer a.commissioning.tests.Done()
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down; restoring %s/%s before its commissioning test is over", deviceName, outletNumber)
+	case <-time.After(commissionToggleTime):
+	}
+
+	current, _ := a.deviceStore.Get(deviceName, outletNumber)
+	echoed := current.Status == test
+
+	err := a.sendCommand(deviceName, outletNumber, initial, SourceCommissioning)
+	a.finishCommissioningTest(deviceName, outletNumber, echoed, err)
+}
+
+// finishCommissioningTest records the end of a test toggle; an error means
+// the outlet could not be restored
+func (a *App) finishCommissioningTest(deviceName, outletNumber string, echoed bool, err error) {
+	snapshot, updateErr := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+		outlet.TestedAt = time.Now()
+		outlet.DeviceEchoed = echoed
+		outlet.Result = CommissionAwaiting
+		if err != nil {
+			outlet.Result = CommissionFailed
+			outlet.Error = err.Error()
+		}
+		return nil
+	})
+	if updateErr == nil {
+		a.emit(events.CommissioningUpdate, snapshot)
+	}
+}
+
+// ConfirmCommissioningOutlet records whether the installer saw the expected
+// equipment switch, with an optional note
+func (a *App) ConfirmCommissioningOutlet(deviceName, outletNumber string, confirmed bool, note string) (CommissioningSession, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CommissioningSession{}, err
+	}
+
+	snapshot, err := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+		if outlet.Result == CommissionTesting {
+			return fmt.Errorf("outlet %s/%s is still being tested", deviceName, outletNumber)
+		}
+		outlet.Result = CommissionFailed
+		if confirmed {
+			outlet.Result = CommissionConfirmed
+		}
+		outlet.Note = note
+		outlet.ConfirmedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return CommissioningSession{}, err
+	}
+
+	a.emit(events.CommissioningUpdate, snapshot)
+	return snapshot, nil
+}
+
+// SkipCommissioningOutlet leaves an outlet out of testing, e.g. one feeding
+// equipment that must stay powered
+func (a *App) SkipCommissioningOutlet(deviceName, outletNumber, note string) (CommissioningSession, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CommissioningSession{}, err
+	}
+
+	snapshot, err := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+		outlet.Result = CommissionSkipped
+		outlet.Note = note
+		return nil
+	})
+	if err != nil {
+		return CommissioningSession{}, err
+	}
+
+	a.emit(events.CommissioningUpdate, snapshot)
+	return snapshot, nil
+}
+
+// SetCommissioningLabel records the label the installer reads off the
+// equipment and saves it to the inventory
+func (a *App) SetCommissioningLabel(deviceName, outletNumber, label string) (CommissioningSession, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CommissioningSession{}, err
+	}
+
+	snapshot, err := a.commissioning.update(deviceName, outletNumber, func(outlet *CommissioningOutlet) error {
+		outlet.Label = label
+		return nil
+	})
+	if err != nil {
+		return CommissioningSession{}, err
+	}
+
+	metadata, ok := a.inventory.Get(deviceName, outletNumber)
+	if !ok {
+		metadata = models.OutletMetadata{DeviceName: deviceName, OutletNumber: outletNumber}
+	}
+	metadata.Label = label
+	if _, _, err := a.inventory.Upsert([]models.OutletMetadata{metadata}); err != nil {
+		return CommissioningSession{}, fmt.Errorf("failed to save inventory: %w", err)
+	}
+
+	a.emit(events.CommissioningUpdate, snapshot)
+	return snapshot, nil
+}
+
+// FinishCommissioning closes the session and writes the commissioning
+// report next to the config file
+func (a *App) FinishCommissioning() (CommissioningSession, error) {
+	if err := a.kioskLocked(); err != nil {
+		return CommissioningSession{}, err
+	}
+
+	a.commissioning.mu.Lock()
+	session := a.commissioning.session
+	if session == nil || !session.Finished.IsZero() {
+		a.commissioning.mu.Unlock()
+		return CommissioningSession{}, fmt.Errorf("no commissioning session is active")
+	}
+	for _, outlet := range session.Outlets {
+		if outlet.Result == CommissionTesting {
+			a.commissioning.mu.Unlock()
+			return CommissioningSession{}, fmt.Errorf("outlet %s/%s is still being tested", outlet.DeviceName, outlet.OutletNumber)
+		}
+	}
+	session.Finished = time.Now()
+	session.tally()
+
+	path, err := config.DataPath(fmt.Sprintf("commissioning-%s.json", session.Started.Format("20060102-150405")))
+	if err == nil {
+		session.ReportPath = path
+		var data []byte
+		data, err = json.MarshalIndent(session, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path, data, 0600)
+		}
+	}
+	if err != nil {
+		session.ReportPath = ""
+	}
+	snapshot := session.copy()
+	a.commissioning.mu.Unlock()
+
+	if err != nil {
+		return snapshot, fmt.Errorf("failed to write commissioning report: %w", err)
+	}
+
+	a.audit("commissioning_finished", snapshot.Operator, "", "", fmt.Sprintf("confirmed=%d failed=%d skipped=%d untested=%d",
+		snapshot.Confirmed, snapshot.Failed, snapshot.Skipped, snapshot.Untested))
+	a.emit(events.CommissioningUpdate, snapshot)
+	return snapshot, nil
+}
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// configReloadDelay lets a burst of writes to the config file settle before
+// it is reloaded
+const configReloadDelay = 500 * time.Millisecond
+
+// brokerSettings are the settings a broker connection is made with; a
+// reload that changes them reconnects
+type brokerSettings struct {
+	Username, PasswordHash, MQTTServer string
+	ServerPort                         int
+	Subscription                       string
+	Protocols                          []config.ProtocolSubscription
+	HADiscovery, RepublishState        bool
+	KeepAlive, PingTimeout             int
+	ConnectTimeout                     int
+}
+
+// brokerSettingsOf returns a config's broker settings
+func brokerSettingsOf(cfg *config.Config) brokerSettings {
+	return brokerSettings{
+		Username:       cfg.Username,
+		PasswordHash:   cfg.PasswordHash,
+		MQTTServer:     cfg.MQTTServer,
+		ServerPort:     cfg.ServerPort,
+		Subscription:   cfg.SubscriptionTopic(),
+		Protocols:      cfg.ProtocolSubscriptions,
+		HADiscovery:    cfg.HADiscovery,
+		RepublishState: cfg.RepublishState,
+		KeepAlive:      cfg.KeepAlive,
+		PingTimeout:    cfg.PingTimeout,
+		ConnectTimeout: cfg.ConnectTimeout,
+	}
+}
+
+// watchConfig reloads the config file when another program changes it,
+// until ctx is cancelled. The directory is watched rather than the file, as
+// editors and provisioning tools often replace the file instead of writing it.
+func (a *App) watchConfig(ctx context.Context) {
+	path, err := config.Path()
+	if err != nil {
+		log.Printf("Config file will not be watched: %v", err)
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Config file will not be watched: %v", err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		log.Printf("Config file will not be watched: %v", err)
+		return
+	}
+
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == path && !event.Has(fsnotify.Chmod) {
+				reload = time.After(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Config watcher error: %v", err)
+		case <-reload:
+			reload = nil
+			a.reloadConfig()
+		}
+	}
+}
+
+// reloadConfig applies a config file changed on disk and emits
+// config:changed, reconnecting if the broker settings differ and the app is
+// connected. Files that do not load are logged and ignored, as are the
+// app's own saves.
+func (a *App) reloadConfig() {
+	if a.GetRecoveryState().Needed {
+		if err := a.RetryConfigLoad(); err != nil {
+			log.Printf("Changed config file does not recover the config yet: %v", err)
+		}
+		return
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Ignoring changed config file: %v", err)
+		return
+	}
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	current := a.currentConfig()
+	if sameConfig(current, cfg) {
+		return // Saved by the app itself, or no change that matters
+	}
+
+	log.Printf("Config file changed on disk; reloaded")
+	a.audit("config_reloaded", "", "", "", "")
+	a.replaceConfig(current, cfg)
+}
+
+// restartSettings returns the settings that differ between two configs but
+// are only applied at startup
+func restartSettings(current, cfg *config.Config) []string {
+	var names []string
+	if cfg.APIListenAddress != current.APIListenAddress {
+		names = append(names, "apiListenAddress")
+	}
+	if cfg.APIToken != current.APIToken {
+		names = append(names, "apiToken")
+	}
+	if cfg.ReplicaOf != current.ReplicaOf {
+		names = append(names, "replicaOf")
+	}
+	if cfg.ReplicaToken != current.ReplicaToken {
+		names = append(names, "replicaToken")
+	}
+	if cfg.LogEvents != current.LogEvents {
+		names = append(names, "logEvents")
+	}
+	return names
+}
+
+// applyLogStores opens, closes or reopens the message archive and traffic
+// log where their settings differ between two configs
+func (a *App) applyLogStores(current, cfg *config.Config) {
+	if cfg.MessageArchive != current.MessageArchive || cfg.MessageArchiveDays != current.MessageArchiveDays ||
+		cfg.MessageArchiveMB != current.MessageArchiveMB {
+		a.closeArchive()
+		if cfg.MessageArchive {
+			if err := a.openArchive(cfg); err != nil {
+				log.Printf("Message log will not be archived: %v", err)
+			}
+		}
+	}
+	if cfg.TrafficLog != current.TrafficLog || cfg.TrafficLogDays != current.TrafficLogDays ||
+		cfg.TrafficLogMB != current.TrafficLogMB || cfg.TrafficLogTotalMB != current.TrafficLogTotalMB {
+		a.closeTrafficLog()
+		if cfg.TrafficLog {
+			if err := a.openTrafficLog(cfg); err != nil {
+				log.Printf("Traffic will not be logged: %v", err)
+			}
+		}
+	}
+}
+
+// replaceConfig makes a config loaded from elsewhere the running one,
+// reopening the log stores whose settings changed, and emits
+// config:changed, reconnecting if the broker settings differ from current
+// and the app is connected. Settings only applied at startup are logged
+// and listed in the event. The caller holds configMu.
+func (a *App) replaceConfig(current, cfg *config.Config) {
+	a.setConfig(cfg)
+	a.throttle.setRates(cfg.EventThrottle)
+	a.applyLogSettings(cfg)
+	a.applyLogStores(current, cfg)
+	restart := restartSettings(current, cfg)
+	if len(restart) > 0 {
+		log.Printf("Changed settings take effect at the next start: %s", strings.Join(restart, ", "))
+	}
+	reconnect := !reflect.DeepEqual(brokerSettingsOf(current), brokerSettingsOf(cfg))
+	if !reconnect {
+		// Backoff and rate limit changes apply to the live connection
+		a.mqttClient.UpdateSettings(cfg)
+	}
+	a.emit(events.ConfigChanged, events.ConfigChangedPayload{
+		Reconnect:     reconnect,
+		KioskChanged:  cfg.KioskMode != current.KioskMode,
+		RestartNeeded: restart,
+	})
+
+	if !reconnect || cfg.IsEmpty() || a.mqttClient.State() == mqtt.StateDisconnected {
+		return
+	}
+	a.disconnectMQTT()
+	if cfg.MQTTServer != current.MQTTServer || cfg.ServerPort != current.ServerPort {
+		a.deviceStore.Clear() // Another broker's devices
+	}
+	if err := a.connectMQTT(); err != nil {
+		log.Printf("Failed to reconnect with the reloaded config: %v", err)
+	}
+}
+
+// sameConfig reports whether two configs would be saved identically
+func sameConfig(a, b *config.Config) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(left, right)
+}
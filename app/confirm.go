@@ -0,0 +1,178 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// confirmation is a single-use token authorizing one command on a critical outlet
+type confirmation struct {
+	deviceName   string
+	outletNumber string
+	state        string
+	operator     string
+	firmwareURL  string // set for firmware update tokens, which name no outlet
+	expires      time.Time
+}
+
+// RequestConfirmation issues a confirmation token for a command on a critical
+// outlet. The token is handed to the operator sending the command and is only
+// valid for that outlet and state within the configured confirmation window.
+func (a *App) RequestConfirmation(deviceName, outletNumber, state, operator string) (string, error) {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return "", err
+	}
+
+	if deviceName == "" || outletNumber == "" {
+		return "", fmt.Errorf("device and outlet are required")
+	}
+
+	token, window, err := a.issueConfirmation(&confirmation{
+		deviceName:   deviceName,
+		outletNumber: outletNumber,
+		state:        mqtt.StatusToPayload(state),
+		operator:     operator,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	a.audit("confirmation_issued", operator, deviceName, outletNumber,
+		fmt.Sprintf("state=%s window=%s", strings.ToUpper(state), window))
+
+	return token, nil
+}
+
+// SendConfirmedCommand sends a command to a critical outlet using a token
+// previously issued by RequestConfirmation
+func (a *App) SendConfirmedCommand(deviceName, outletNumber, state, token, operator string) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+
+	// Tokens are single use, even if validation below fails
+	pending, exists := a.takeConfirmation(token)
+
+	reject := func(reason string) error {
+		a.audit("confirmation_rejected", operator, deviceName, outletNumber, reason)
+		return fmt.Errorf("confirmation rejected: %s", reason)
+	}
+
+	if !exists {
+		return reject("unknown or already used token")
+	}
+	if time.Now().After(pending.expires) {
+		return reject("token expired")
+	}
+	if pending.firmwareURL != "" || pending.deviceName != deviceName || pending.outletNumber != outletNumber ||
+		pending.state != mqtt.StatusToPayload(state) {
+		return reject("token was issued for a different command")
+	}
+	if pending.operator != "" && operator != "" && strings.EqualFold(pending.operator, operator) {
+		return reject("confirming operator must differ from sending operator")
+	}
+
+	source := "confirmed"
+	if pending.operator != "" && operator != "" {
+		source = fmt.Sprintf("%s, confirmed by %s", pending.operator, operator)
+	}
+	if err := a.checkLock(deviceName, outletNumber, lockEnforced, ""); err != nil {
+		a.audit("confirmed_command_failed", operator, deviceName, outletNumber, err.Error())
+		return err
+	}
+	if err := a.checkReservation(deviceName, outletNumber, operator); err != nil {
+		a.audit("confirmed_command_failed", operator, deviceName, outletNumber, err.Error())
+		return err
+	}
+	if err := a.sendCommand(deviceName, outletNumber, state, source); err != nil {
+		a.audit("confirmed_command_failed", operator, deviceName, outletNumber, err.Error())
+		return err
+	}
+
+	a.audit("confirmed_command_sent", operator, deviceName, outletNumber,
+		fmt.Sprintf("state=%s confirmedBy=%s", strings.ToUpper(state), pending.operator))
+
+	return nil
+}
+
+// SetOutletCritical marks or unmarks an outlet as requiring two-person confirmation
+func (a *App) SetOutletCritical(deviceName, outletNumber string, critical bool, operator string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	key := deviceName + ":" + outletNumber
+	err := a.updateConfig(func(cfg *config.Config) error {
+		patterns := make([]string, 0, len(cfg.CriticalOutlets)+1)
+		for _, pattern := range cfg.CriticalOutlets {
+			if pattern != key {
+				patterns = append(patterns, pattern)
+			}
+		}
+		if critical {
+			patterns = append(patterns, key)
+		}
+		cfg.CriticalOutlets = patterns
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	a.audit("critical_flag_changed", operator, deviceName, outletNumber, fmt.Sprintf("critical=%t", critical))
+	return nil
+}
+
+// IsOutletCritical reports whether an outlet requires two-person confirmation
+func (a *App) IsOutletCritical(deviceName, outletNumber string) bool {
+	return a.currentConfig().IsCritical(deviceName, outletNumber)
+}
+
+// issueConfirmation stores a pending confirmation under a new token, valid
+// for the configured confirmation window
+func (a *App) issueConfirmation(pending *confirmation) (string, time.Duration, error) {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", 0, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := strings.ToUpper(hex.EncodeToString(buf))
+
+	window := time.Duration(a.currentConfig().ConfirmationWindow) * time.Second
+	pending.expires = time.Now().Add(window)
+
+	a.confirmMu.Lock()
+	a.pruneConfirmations()
+	a.confirmations[token] = pending
+	a.confirmMu.Unlock()
+
+	return token, window, nil
+}
+
+// takeConfirmation removes and returns the pending confirmation for a token
+func (a *App) takeConfirmation(token string) (*confirmation, bool) {
+	token = strings.ToUpper(strings.TrimSpace(token))
+
+	a.confirmMu.Lock()
+	defer a.confirmMu.Unlock()
+	pending, exists := a.confirmations[token]
+	if exists {
+		delete(a.confirmations, token)
+	}
+	return pending, exists
+}
+
+// pruneConfirmations drops expired tokens; caller must hold confirmMu
+func (a *App) pruneConfirmations() {
+	now := time.Now()
+	for token, pending := range a.confirmations {
+		if now.After(pending.expires) {
+			delete(a.confirmations, token)
+		}
+	}
+}
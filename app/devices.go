@@ -0,0 +1,108 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// GetDeviceTree returns every device with its outlets, grouped into banks
+// where the topics name them, and its aggregate status (all-on, all-off,
+// mixed or unknown), so a PDU can be shown as one unit
+func (a *App) GetDeviceTree() []models.Device {
+	if a.isKiosk() {
+		return models.GroupDevices(a.kioskFilter(a.deviceStore.GetAll()))
+	}
+	return a.deviceStore.Devices()
+}
+
+// GetDeviceUnit returns one device with its outlets and aggregate status
+func (a *App) GetDeviceUnit(deviceName string) (models.Device, error) {
+	for _, device := range a.GetDeviceTree() {
+		if device.Name == deviceName {
+			return device, nil
+		}
+	}
+	return models.Device{}, fmt.Errorf("device not found: %s", deviceName)
+}
+
+// RemoveDevice deletes a device's outlets from the device list. A device
+// that reports again, e.g. through a retained message, reappears; hide it
+// to keep it out.
+func (a *App) RemoveDevice(deviceName string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	removed := a.deviceStore.RemoveDevice(deviceName)
+	if len(removed) == 0 {
+		return fmt.Errorf("device not found: %s", deviceName)
+	}
+	a.emitRemoved(removed)
+
+	a.audit("device_removed", "", deviceName, "", fmt.Sprintf("outlets=%d", len(removed)))
+	return nil
+}
+
+// HideDevice hides a device from the device list, or shows it again. Hidden
+// devices are removed from the list and their messages are logged but
+// ignored; an unhidden device reappears when it next reports.
+func (a *App) HideDevice(deviceName string, hidden bool) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if deviceName == "" {
+		return fmt.Errorf("device name is required")
+	}
+
+	changed := false
+	err := a.updateConfig(func(cfg *config.Config) error {
+		if cfg.IsHiddenDevice(deviceName) == hidden {
+			return errConfigUnchanged
+		}
+		names := make([]string, 0, len(cfg.HiddenDevices)+1)
+		for _, name := range cfg.HiddenDevices {
+			if name != deviceName {
+				names = append(names, name)
+			}
+		}
+		if hidden {
+			names = append(names, deviceName)
+		}
+		cfg.HiddenDevices = names
+		changed = true
+		return nil
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	if hidden {
+		a.emitRemoved(a.deviceStore.RemoveDevice(deviceName))
+	}
+
+	a.audit("device_hidden_changed", "", deviceName, "", fmt.Sprintf("hidden=%t", hidden))
+	return nil
+}
+
+// GetHiddenDevices returns the names of the hidden devices
+func (a *App) GetHiddenDevices() []string {
+	return append([]string{}, a.currentConfig().HiddenDevices...)
+}
+
+// removeHiddenDevices drops hidden devices restored from the last session
+func (a *App) removeHiddenDevices() {
+	for _, name := range a.currentConfig().HiddenDevices {
+		a.deviceStore.RemoveDevice(name)
+	}
+}
+
+// emitRemoved tells the frontend about removed outlets
+func (a *App) emitRemoved(outlets []models.DeviceOutlet) {
+	for _, outlet := range outlets {
+		a.emit(events.DeviceRemoved, outlet)
+	}
+}
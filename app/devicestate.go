@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// deviceSaveDelay batches outlet changes into one write of devices.json
+const deviceSaveDelay = 2 * time.Second
+
+// runDeviceSaver saves the device store shortly after it changes, so a busy
+// broker causes one write every couple of seconds rather than one per message
+func (a *App) runDeviceSaver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.deviceStore.Changes():
+		}
+
+		// Let further changes accumulate
+		select {
+		case <-ctx.Done():
+			return // Shutdown saves
+		case <-time.After(deviceSaveDelay):
+		}
+
+		if err := a.deviceStore.Save(); err != nil {
+			log.Printf("Failed to save device states: %v", err)
+		}
+	}
+}
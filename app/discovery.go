@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// Device discovery defaults
+const (
+	defaultDiscoveryFilter  = "#"
+	defaultDiscoverySeconds = 10
+	maxDiscoverySeconds     = 300
+)
+
+// DiscoverySuggestion is an outlet seen during discovery that is neither
+// in the device list nor in the inventory
+type DiscoverySuggestion struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Status       string    `json:"status,omitempty"`
+	Topic        string    `json:"topic"`   // first topic the outlet was seen on
+	Guessed      bool      `json:"guessed"` // found by lenient extraction; the topic does not fit the configured layout
+	Messages     int       `json:"messages"`
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+// StartDiscovery listens on the discovery filter (discoveryFilter, "#" by
+// default) for the given number of seconds (10 if zero, at most 300) over a
+// separate, read-only connection, and returns the outlets it saw that are
+// not known yet. Topics that do not fit the configured layout are guessed
+// at as for lenient topic validation. Nothing is added until the
+// suggestions are passed to AcceptDiscovery.
+func (a *App) StartDiscovery(seconds int) ([]DiscoverySuggestion, error) {
+	if err := a.kioskLocked(); err != nil {
+		return nil, err
+	}
+	if a.IsConfigEmpty() {
+		return nil, fmt.Errorf("broker settings are not configured")
+	}
+
+	if seconds == 0 {
+		seconds = defaultDiscoverySeconds
+	}
+	if seconds < 1 || seconds > maxDiscoverySeconds {
+		return nil, fmt.Errorf("discovery must last 1 to %d seconds", maxDiscoverySeconds)
+	}
+
+	cfg := a.currentConfig()
+	filter := cfg.DiscoveryFilter
+	if filter == "" {
+		filter = defaultDiscoveryFilter
+	}
+	password, err := cfg.GetPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var mu sync.Mutex
+	found := make(map[string]*DiscoverySuggestion) // key: "deviceName:outletNumber"
+	err = mqtt.Collect(ctx, mqtt.ProbeOptions{
+		Server:   cfg.MQTTServer,
+		Port:     cfg.ServerPort,
+		Username: cfg.Username,
+		Password: password,
+		Timeout:  time.Duration(cfg.ConnectTimeout) * time.Second,
+	}, filter, time.Duration(seconds)*time.Second, func(topic string, payload []byte, _ mqtt.MessageFlags) {
+		states, guessed := a.discoverStates(topic, string(payload))
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, state := range states {
+			if state.Status == "" || a.knownOutlet(state.Device, state.Outlet) {
+				continue
+			}
+			key := state.Device + ":" + state.Outlet
+			suggestion, ok := found[key]
+			if !ok {
+				suggestion = &DiscoverySuggestion{DeviceName: state.Device, OutletNumber: state.Outlet, Topic: topic, Guessed: guessed}
+				found[key] = suggestion
+			}
+			suggestion.Status = state.Status
+			suggestion.Messages++
+			suggestion.LastSeen = time.Now()
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run discovery on %s: %w", filter, err)
+	}
+
+	suggestions := make([]DiscoverySuggestion, 0, len(found))
+	for _, suggestion := range found {
+		suggestions = append(suggestions, *suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].DeviceName != suggestions[j].DeviceName {
+			return models.NaturalLess(suggestions[i].DeviceName, suggestions[j].DeviceName)
+		}
+		return models.NaturalLess(suggestions[i].OutletNumber, suggestions[j].OutletNumber)
+	})
+	a.audit("discovery_run", "", "", "", fmt.Sprintf("filter=%s seconds=%d suggestions=%d", filter, seconds, len(suggestions)))
+	return suggestions, nil
+}
+
+// AcceptDiscovery adds discovered outlets to the inventory, returning how
+// many were new
+func (a *App) AcceptDiscovery(suggestions []DiscoverySuggestion) (int, error) {
+	if err := a.kioskLocked(); err != nil {
+		return 0, err
+	}
+
+	outlets := make([]models.OutletMetadata, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if suggestion.DeviceName == "" || suggestion.OutletNumber == "" {
+			return 0, fmt.Errorf("device and outlet are required")
+		}
+		if _, ok := a.inventory.Get(suggestion.DeviceName, suggestion.OutletNumber); ok {
+			continue
+		}
+		outlets = append(outlets, models.OutletMetadata{DeviceName: suggestion.DeviceName, OutletNumber: suggestion.OutletNumber})
+	}
+	if len(outlets) == 0 {
+		return 0, nil
+	}
+
+	created, _, err := a.inventory.Upsert(outlets)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save inventory: %w", err)
+	}
+	a.audit("discovery_accepted", "", "", "", fmt.Sprintf("outlets=%d", created))
+	return created, nil
+}
+
+// discoverStates parses a message seen during discovery with the protocol
+// configured for its topic, falling back to lenient extraction; guessed
+// tells which one found the states
+func (a *App) discoverStates(topic, payload string) (states []mqtt.OutletState, guessed bool) {
+	states, err := a.adapter(a.protocolFor(topic)).ParseState(topic, payload)
+	if err == nil {
+		for i, state := range states {
+			states[i].Outlet = a.quirkFor(state.Device).FromDevice(state.Outlet)
+		}
+		return states, false
+	}
+	states, err = mqtt.ParseLenient(topic, payload)
+	if err != nil {
+		return nil, false
+	}
+	return states, true
+}
+
+// knownOutlet reports whether an outlet is in the device list or inventory
+func (a *App) knownOutlet(deviceName, outletNumber string) bool {
+	if _, ok := a.deviceStore.Get(deviceName, outletNumber); ok {
+		return true
+	}
+	_, ok := a.inventory.Get(deviceName, outletNumber)
+	return ok
+}
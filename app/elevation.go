@@ -0,0 +1,194 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// After pinFreeAttempts incorrect PINs in a row, each further attempt must
+// wait, starting at pinBackoff and doubling up to pinMaxBackoff
+const (
+	pinFreeAttempts = 3
+	pinBackoff      = 5 * time.Second
+	pinMaxBackoff   = 15 * time.Minute
+)
+
+// ElevationStatus describes the current elevated session
+type ElevationStatus struct {
+	Active   bool      `json:"active"`
+	Operator string    `json:"operator"`
+	Expires  time.Time `json:"expires"`
+}
+
+// elevation holds the state of the elevated session
+type elevation struct {
+	operator string
+	expires  time.Time
+	timer    *time.Timer
+}
+
+// pinAttempts tracks incorrect elevation PINs to slow down guessing
+type pinAttempts struct {
+	failures    int       // incorrect PINs in a row
+	lockedUntil time.Time // no PIN is checked before this
+	checking    bool      // a PIN is being checked; attempts are one at a time
+}
+
+// checkPIN verifies the elevation PIN, refusing attempts while locked out
+// after repeated incorrect PINs and auditing refusals as action
+func (a *App) checkPIN(cfg *config.Config, pin, operator, action string) error {
+	a.elevationMu.Lock()
+	if wait := time.Until(a.pinAttempts.lockedUntil); wait > 0 {
+		a.elevationMu.Unlock()
+		a.audit(action, operator, "", "", "locked out after incorrect PINs")
+		return fmt.Errorf("too many incorrect PINs; try again in %s", wait.Round(time.Second))
+	}
+	if a.pinAttempts.checking {
+		a.elevationMu.Unlock()
+		return fmt.Errorf("another PIN is being checked")
+	}
+	a.pinAttempts.checking = true
+	a.elevationMu.Unlock()
+
+	ok := cfg.CheckElevationPIN(pin)
+
+	a.elevationMu.Lock()
+	a.pinAttempts.checking = false
+	if ok {
+		a.pinAttempts = pinAttempts{}
+	} else {
+		a.pinAttempts.failures++
+		if over := a.pinAttempts.failures - pinFreeAttempts; over >= 0 {
+			backoff := pinMaxBackoff
+			if over < 16 && pinBackoff<<over < pinMaxBackoff {
+				backoff = pinBackoff << over
+			}
+			a.pinAttempts.lockedUntil = time.Now().Add(backoff)
+		}
+	}
+	a.elevationMu.Unlock()
+
+	if !ok {
+		a.audit(action, operator, "", "", "incorrect PIN")
+		return fmt.Errorf("incorrect PIN")
+	}
+	return nil
+}
+
+// Elevate starts a time-limited elevated session during which protected
+// outlets can be switched without per-command confirmation
+func (a *App) Elevate(pin string, durationSeconds int, operator string) (ElevationStatus, error) {
+	cfg := a.currentConfig()
+	if cfg.ElevationPINHash == "" {
+		return ElevationStatus{}, fmt.Errorf("no elevation PIN configured")
+	}
+
+	if err := a.checkPIN(cfg, pin, operator, "elevation_denied"); err != nil {
+		return ElevationStatus{}, err
+	}
+
+	// Rehash a PIN stored by an older version with the current key derivation
+	if config.PINHashOutdated(cfg.ElevationPINHash) {
+		err := a.updateConfig(func(cfg *config.Config) error {
+			if !config.PINHashOutdated(cfg.ElevationPINHash) {
+				return errConfigUnchanged
+			}
+			return cfg.SetElevationPIN(pin)
+		})
+		if err != nil {
+			log.Printf("Failed to save the rehashed elevation PIN: %v", err)
+		}
+	}
+
+	if durationSeconds <= 0 || durationSeconds > cfg.MaxElevationDuration {
+		durationSeconds = cfg.MaxElevationDuration
+	}
+	duration := time.Duration(durationSeconds) * time.Second
+
+	a.elevationMu.Lock()
+	if a.elevation != nil {
+		a.elevation.timer.Stop()
+	}
+	session := &elevation{
+		operator: operator,
+		expires:  time.Now().Add(duration),
+	}
+	session.timer = time.AfterFunc(duration, func() {
+		a.endElevation(session, "elevation_expired", operator)
+	})
+	a.elevation = session
+	a.elevationMu.Unlock()
+
+	a.audit("elevation_granted", operator, "", "", fmt.Sprintf("duration=%s", duration))
+
+	status := a.GetElevation()
+	a.emit(events.ElevationChanged, status)
+	return status, nil
+}
+
+// DropElevation ends the elevated session early
+func (a *App) DropElevation(operator string) {
+	a.elevationMu.Lock()
+	session := a.elevation
+	a.elevationMu.Unlock()
+
+	if session != nil {
+		session.timer.Stop()
+		a.endElevation(session, "elevation_dropped", operator)
+	}
+}
+
+// GetElevation returns the current elevated session status
+func (a *App) GetElevation() ElevationStatus {
+	a.elevationMu.Lock()
+	defer a.elevationMu.Unlock()
+
+	if a.elevation == nil || time.Now().After(a.elevation.expires) {
+		return ElevationStatus{}
+	}
+	return ElevationStatus{
+		Active:   true,
+		Operator: a.elevation.operator,
+		Expires:  a.elevation.expires,
+	}
+}
+
+// SetElevationPIN changes the elevation PIN; the current PIN is required once one is set
+func (a *App) SetElevationPIN(currentPIN, newPIN, operator string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	err := a.updateConfig(func(cfg *config.Config) error {
+		if cfg.ElevationPINHash != "" {
+			if err := a.checkPIN(cfg, currentPIN, operator, "elevation_pin_change_denied"); err != nil {
+				return err
+			}
+		}
+		return cfg.SetElevationPIN(newPIN)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.audit("elevation_pin_changed", operator, "", "", "")
+	return nil
+}
+
+// endElevation clears the session if it is still the active one
+func (a *App) endElevation(session *elevation, action, operator string) {
+	a.elevationMu.Lock()
+	if a.elevation != session {
+		a.elevationMu.Unlock()
+		return
+	}
+	a.elevation = nil
+	a.elevationMu.Unlock()
+
+	a.audit(action, operator, "", "", "")
+	a.emit(events.ElevationChanged, ElevationStatus{})
+}
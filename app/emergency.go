@@ -0,0 +1,118 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// EmergencyReport is the outcome of an emergency off
+type EmergencyReport struct {
+	Switched  []string          `json:"switched"`  // "device:outlet" keys acknowledged by the broker
+	Failed    map[string]string `json:"failed"`    // key: "device:outlet"; value: error
+	ElapsedMs float64           `json:"elapsedMs"` // until the last acknowledgement
+}
+
+// EmergencyOff switches off every known outlet matching the "device:outlet"
+// patterns ("*" matches all) through the priority connection, skipping the
+// publish rate limit and queue and ignoring reservations and critical-outlet
+// confirmation. It is audited and raises a critical alert.
+func (a *App) EmergencyOff(patterns []string, operator, reason string) (EmergencyReport, error) {
+	if a.IsReplica() {
+		return EmergencyReport{}, fmt.Errorf("this instance is a read-only replica")
+	}
+	if len(patterns) == 0 {
+		return EmergencyReport{}, fmt.Errorf("no outlets given")
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return EmergencyReport{}, fmt.Errorf("invalid outlet pattern %q", pattern)
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, outlet := range a.deviceStore.GetAll() {
+		if a.kioskAllows(outlet.DeviceName, outlet.OutletNumber) {
+			known[outlet.DeviceName+":"+outlet.OutletNumber] = true
+		}
+	}
+	targets := matchingOutlets(known, patterns)
+	if len(targets) == 0 {
+		return EmergencyReport{}, fmt.Errorf("no known outlets match %s", strings.Join(patterns, ", "))
+	}
+
+	// Publish in parallel; each publish waits for its own acknowledgement
+	start := time.Now()
+	report := EmergencyReport{Switched: make([]string, 0, len(targets)), Failed: make(map[string]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, key := range targets {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			deviceName, outletNumber, _ := strings.Cut(key, ":")
+			err := a.sendPriorityCommand(deviceName, outletNumber, "OFF", SourceEmergency)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Failed[key] = err.Error()
+			} else {
+				report.Switched = append(report.Switched, key)
+			}
+		}(key)
+	}
+	wg.Wait()
+	sort.Strings(report.Switched)
+	report.ElapsedMs = float64(time.Since(start).Microseconds()) / 1000
+
+	detail := fmt.Sprintf("outlets=%d failed=%d elapsed=%.0fms reason=%s", len(targets), len(report.Failed), report.ElapsedMs, reason)
+	a.audit("emergency_off", operator, "", "", detail)
+	message := fmt.Sprintf("emergency off of %d outlets by %s", len(targets), operator)
+	if operator == "" {
+		message = fmt.Sprintf("emergency off of %d outlets", len(targets))
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	if len(report.Failed) > 0 {
+		message += fmt.Sprintf(" (%d failed)", len(report.Failed))
+	}
+	a.raiseAlert(models.Alert{Severity: models.SeverityCritical, Source: "emergency", Message: message})
+
+	if len(report.Failed) > 0 {
+		return report, fmt.Errorf("%d of %d outlets could not be switched off", len(report.Failed), len(targets))
+	}
+	return report, nil
+}
+
+// sendPriorityCommand publishes a command through the priority connection,
+// without policy checks, for emergency and safety commands that must not
+// wait behind other traffic
+func (a *App) sendPriorityCommand(deviceName, outletNumber, state, source string) error {
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+
+	topic, payload, err := a.outletCommand(deviceName, outletNumber, state)
+	if err != nil {
+		return err
+	}
+	if err := a.mqttClient.PublishPriority(topic, payload); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+
+	a.recordCommand(topic, payload, models.TimelineEntry{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		State:        strings.ToUpper(state),
+		Source:       source,
+		Detail:       "set " + strings.ToUpper(state) + " (priority)",
+	})
+	return nil
+}
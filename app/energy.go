@@ -0,0 +1,152 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// driftReadings is the number of consecutive out-of-range readings needed
+// before a drift alert, so a single inrush spike does not trigger it
+const driftReadings = 3
+
+// driftTracker counts consecutive drifting readings per outlet
+type driftTracker struct {
+	mu      sync.Mutex
+	streak  map[string]int
+	alerted map[string]bool
+}
+
+// record updates an outlet's streak and reports whether to alert now
+func (t *driftTracker) record(key string, drifting bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.streak == nil {
+		t.streak = make(map[string]int)
+		t.alerted = make(map[string]bool)
+	}
+
+	if !drifting {
+		delete(t.streak, key)
+		delete(t.alerted, key)
+		return false
+	}
+
+	t.streak[key]++
+	if t.streak[key] < driftReadings || t.alerted[key] {
+		return false
+	}
+	t.alerted[key] = true
+	return true
+}
+
+// updateTelemetry stores an outlet's readings, notifies the frontend and
+// checks the power draw against the outlet's baseline
+func (a *App) updateTelemetry(state mqtt.OutletState) {
+	deviceOutlet := a.deviceStore.SetTelemetry(state.Device, state.Outlet, models.Telemetry{
+		Watts: state.Watts,
+		Volts: state.Volts,
+		Amps:  state.Amps,
+		KWh:   state.KWh,
+	})
+	a.emit(events.DeviceUpdate, deviceOutlet)
+	a.emit(events.DeviceTelemetry, events.TelemetryPayload{
+		DeviceName:   state.Device,
+		OutletNumber: state.Outlet,
+		Watts:        state.Watts,
+		Volts:        state.Volts,
+		Amps:         state.Amps,
+		KWh:          state.KWh,
+		Timestamp:    deviceOutlet.LastUpdate,
+	})
+
+	if state.Watts != nil {
+		a.powerHistory.Observe(state.Device, state.Outlet, *state.Watts, deviceOutlet.LastUpdate)
+		a.updatePower(deviceOutlet, *state.Watts)
+	}
+}
+
+// updatePower learns the outlet's baseline from a power reading and checks drift
+func (a *App) updatePower(deviceOutlet models.DeviceOutlet, watts float64) {
+	device, outlet := deviceOutlet.DeviceName, deviceOutlet.OutletNumber
+
+	// Baselines describe the load while the outlet is powered
+	if deviceOutlet.Status != "ON" {
+		return
+	}
+
+	baseline, err := a.baselines.Observe(device, outlet, watts)
+	if err != nil {
+		log.Printf("Failed to save energy baseline: %v", err)
+	}
+	if !baseline.Complete() || baseline.Watts <= 0 {
+		return
+	}
+
+	threshold := a.currentConfig().DriftThreshold(device, outlet)
+	if threshold <= 0 {
+		return
+	}
+
+	drift := (watts - baseline.Watts) / baseline.Watts * 100
+	if !a.drift.record(device+":"+outlet, math.Abs(drift) > threshold) {
+		return
+	}
+
+	a.raiseAlert(models.Alert{
+		Severity:     models.SeverityWarning,
+		Source:       "energy",
+		DeviceName:   device,
+		OutletNumber: outlet,
+		Message: fmt.Sprintf("power draw %.1f W is %+.0f%% from the %.1f W baseline (limit %.0f%%)",
+			watts, drift, baseline.Watts, threshold),
+	})
+}
+
+// GetEnergyBaselines returns the learned baselines keyed by "device:outlet"
+func (a *App) GetEnergyBaselines() map[string]models.Baseline {
+	return a.baselines.GetAll()
+}
+
+// ResetEnergyBaseline relearns an outlet's baseline, e.g. after its load changed on purpose
+func (a *App) ResetEnergyBaseline(deviceName, outletNumber string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := a.baselines.Reset(deviceName, outletNumber); err != nil {
+		return fmt.Errorf("failed to save energy baselines: %w", err)
+	}
+	a.drift.record(deviceName+":"+outletNumber, false)
+	return nil
+}
+
+// SetEnergyDrift sets the drift percentage for one outlet; a negative value
+// removes the override so the default applies again
+func (a *App) SetEnergyDrift(deviceName, outletNumber string, percent float64) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	key := deviceName + ":" + outletNumber
+	return a.updateConfig(func(cfg *config.Config) error {
+		overrides := make(map[string]float64, len(cfg.EnergyDrift)+1)
+		for pattern, value := range cfg.EnergyDrift {
+			if pattern != key {
+				overrides[pattern] = value
+			}
+		}
+		if percent >= 0 {
+			overrides[key] = percent
+		}
+		cfg.EnergyDrift = overrides
+		return nil
+	})
+}
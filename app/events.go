@@ -0,0 +1,74 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Names of the event bus sinks
+const (
+	frontendSink = "frontend" // the Wails window
+	apiSink      = "api"      // WebSocket clients of the embedded HTTP server
+	logSink      = "log"      // the application log, when logEvents is set
+	pendingSink  = "pending"  // critical events kept while the frontend is absent
+)
+
+// emit publishes an event on the bus and records it in the journal
+func (a *App) emit(name string, data interface{}) {
+	a.bus.Publish(name, data)
+}
+
+// emitTransient publishes an event without journaling it, for periodic
+// snapshots and message traffic that are useless to replay
+func (a *App) emitTransient(name string, data interface{}) {
+	a.bus.PublishTransient(name, data)
+}
+
+// pushToFrontend is the bus sink of the Wails window; it applies kiosk
+// filtering and the per-event throttles and sends the whole envelope, so
+// the window can track the revision it has seen
+func (a *App) pushToFrontend(env events.Envelope) {
+	if a.kioskHides(env.Name, env.Data) {
+		return
+	}
+	a.throttle.submit(env.Name, env, func(latest interface{}) {
+		runtime.EventsEmit(a.ctx, env.Name, latest)
+	})
+}
+
+// logEvent is the bus sink writing events to the application log
+func logEvent(env events.Envelope) {
+	data, err := json.Marshal(env.Data)
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	log.Printf("Event %s (revision %d): %s", env.Name, env.Revision, data)
+}
+
+// ReplayEventsSince returns the events emitted after the given revision so a
+// reloaded frontend can catch up. If Complete is false, some events were
+// evicted and the client should reload its full state instead.
+func (a *App) ReplayEventsSince(revision uint64) events.Replay {
+	replay := a.journal.Since(revision)
+	if a.isKiosk() {
+		visible := make([]events.Envelope, 0, len(replay.Events))
+		for _, env := range replay.Events {
+			if !a.kioskHides(env.Name, env.Data) {
+				visible = append(visible, env)
+			}
+		}
+		replay.Events = visible
+	}
+	return replay
+}
+
+// GetEventRevision returns the latest event revision and contract version
+func (a *App) GetEventRevision() map[string]interface{} {
+	return map[string]interface{}{
+		"revision": a.journal.Revision(),
+		"version":  events.Version,
+	}
+}
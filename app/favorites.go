@@ -0,0 +1,68 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// AddFavorite pins an outlet, so the frontend can show it first
+func (a *App) AddFavorite(deviceName, outletNumber string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+	if deviceName == "" || outletNumber == "" {
+		return fmt.Errorf("device and outlet are required")
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		if cfg.IsFavorite(deviceName, outletNumber) {
+			return errConfigUnchanged
+		}
+		cfg.Favorites = append(append([]string{}, cfg.Favorites...), deviceName+":"+outletNumber)
+		return nil
+	})
+}
+
+// RemoveFavorite unpins an outlet
+func (a *App) RemoveFavorite(deviceName, outletNumber string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	key := deviceName + ":" + outletNumber
+	return a.updateConfig(func(cfg *config.Config) error {
+		favorites := make([]string, 0, len(cfg.Favorites))
+		for _, favorite := range cfg.Favorites {
+			if favorite != key {
+				favorites = append(favorites, favorite)
+			}
+		}
+		if len(favorites) == len(cfg.Favorites) {
+			return fmt.Errorf("outlet %s/%s is not a favorite", deviceName, outletNumber)
+		}
+		cfg.Favorites = favorites
+		return nil
+	})
+}
+
+// GetFavorites returns the pinned outlets in the order they were added.
+// Favorites that have not reported since startup are returned with an
+// UNKNOWN status.
+func (a *App) GetFavorites() []models.DeviceOutlet {
+	favorites := make([]models.DeviceOutlet, 0)
+	for _, key := range a.currentConfig().Favorites {
+		deviceName, outletNumber, ok := strings.Cut(key, ":")
+		if !ok || !a.kioskAllows(deviceName, outletNumber) {
+			continue
+		}
+		outlet, known := a.deviceStore.Get(deviceName, outletNumber)
+		if !known {
+			outlet = models.DeviceOutlet{DeviceName: deviceName, OutletNumber: outletNumber, Status: "UNKNOWN"}
+		}
+		favorites = append(favorites, outlet)
+	}
+	return favorites
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// RequestFirmwareUpdate issues a confirmation token for installing the
+// firmware image at imageURL on a device. The update is only sent once a
+// second operator confirms it with TriggerFirmwareUpdate.
+func (a *App) RequestFirmwareUpdate(deviceName, imageURL, operator string) (string, error) {
+	if err := a.kioskLocked(); err != nil {
+		return "", err
+	}
+
+	imageURL = strings.TrimSpace(imageURL)
+	if _, err := a.firmwareUpdate(deviceName, imageURL); err != nil {
+		return "", err
+	}
+
+	token, window, err := a.issueConfirmation(&confirmation{
+		deviceName:  deviceName,
+		operator:    operator,
+		firmwareURL: imageURL,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	a.audit("firmware_update_requested", operator, deviceName, "",
+		fmt.Sprintf("url=%s window=%s", imageURL, window))
+
+	return token, nil
+}
+
+// TriggerFirmwareUpdate sends a firmware update to a device using a token
+// previously issued by RequestFirmwareUpdate for the same device and URL.
+// The device reboots into the new firmware on its own; its outlets report
+// again once it is back.
+func (a *App) TriggerFirmwareUpdate(deviceName, imageURL, token, operator string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	imageURL = strings.TrimSpace(imageURL)
+	pending, exists := a.takeConfirmation(token)
+
+	reject := func(reason string) error {
+		a.audit("firmware_update_rejected", operator, deviceName, "", reason)
+		return fmt.Errorf("firmware update rejected: %s", reason)
+	}
+
+	if !exists {
+		return reject("unknown or already used token")
+	}
+	if time.Now().After(pending.expires) {
+		return reject("token expired")
+	}
+	if pending.firmwareURL == "" || pending.deviceName != deviceName || pending.firmwareURL != imageURL {
+		return reject("token was issued for a different command")
+	}
+	if pending.operator != "" && operator != "" && strings.EqualFold(pending.operator, operator) {
+		return reject("confirming operator must differ from requesting operator")
+	}
+
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+	command, err := a.firmwareUpdate(deviceName, imageURL)
+	if err != nil {
+		a.audit("firmware_update_failed", operator, deviceName, "", err.Error())
+		return err
+	}
+	if err := a.mqttClient.Publish(command.topic, command.payload); err != nil {
+		a.audit("firmware_update_failed", operator, deviceName, "", err.Error())
+		return fmt.Errorf("failed to send firmware update: %w", err)
+	}
+	a.logMessage(models.MQTTMessage{Direction: models.MessageSent, Topic: command.topic, Payload: []byte(command.payload)})
+
+	a.audit("firmware_update_sent", operator, deviceName, "",
+		fmt.Sprintf("url=%s requestedBy=%s", imageURL, pending.operator))
+
+	return nil
+}
+
+// firmwareCommand is the message that starts a firmware update
+type firmwareCommand struct {
+	topic   string
+	payload string
+}
+
+// firmwareUpdate checks the image URL and device and builds the update
+// message for the device's protocol
+func (a *App) firmwareUpdate(deviceName, imageURL string) (firmwareCommand, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return firmwareCommand{}, fmt.Errorf("firmware URL must be an http or https URL")
+	}
+
+	known := false
+	for _, outlet := range a.deviceStore.GetAll() {
+		if outlet.DeviceName == deviceName {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return firmwareCommand{}, fmt.Errorf("device %s is unknown", deviceName)
+	}
+
+	protocol := a.protocolOf(deviceName)
+	updater, ok := a.adapter(protocol).(mqtt.FirmwareUpdater)
+	if !ok {
+		return firmwareCommand{}, fmt.Errorf("device %s (%s) does not support firmware updates over MQTT", deviceName, protocol)
+	}
+	topic, payload, err := updater.BuildFirmwareUpdate(deviceName, imageURL)
+	if err != nil {
+		return firmwareCommand{}, fmt.Errorf("failed to build firmware update: %w", err)
+	}
+	return firmwareCommand{topic: topic, payload: payload}, nil
+}
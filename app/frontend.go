@@ -0,0 +1,53 @@
+package app
+
+import (
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// The frontend counts as absent when it has not sent a heartbeat for
+// frontendTimeout; pendingEventsSize bounds the events kept for it meanwhile
+const (
+	frontendTimeout   = 15 * time.Second
+	pendingEventsSize = 500
+)
+
+// criticalEvents are kept for the frontend while it is absent
+var criticalEvents = map[string]bool{
+	events.AlertRaised:          true,
+	events.DeviceOffline:        true,
+	events.CommandUnconfirmed:   true,
+	events.ConfigRecoveryNeeded: true,
+}
+
+// FrontendHeartbeat tells the backend the window is open and whether it is
+// visible. The frontend calls it every few seconds; while heartbeats stop
+// (the window is hidden, closed to the tray or crashed) critical events are
+// kept for DrainPendingEvents.
+func (a *App) FrontendHeartbeat(visible bool) {
+	if !visible {
+		a.frontendSeen.Store(0)
+		return
+	}
+	a.frontendSeen.Store(time.Now().UnixNano())
+}
+
+// DrainPendingEvents returns the critical events emitted while the frontend
+// was absent, oldest first, and forgets them
+func (a *App) DrainPendingEvents() events.Pending {
+	return a.pendingEvents.Drain()
+}
+
+// frontendPresent reports whether the frontend sent a heartbeat recently
+func (a *App) frontendPresent() bool {
+	seen := a.frontendSeen.Load()
+	return seen != 0 && time.Since(time.Unix(0, seen)) < frontendTimeout
+}
+
+// keepForFrontend buffers a critical event the frontend is not there to see
+func (a *App) keepForFrontend(env events.Envelope) {
+	if criticalEvents[env.Name] && !a.frontendPresent() && !a.kioskHides(env.Name, env.Data) {
+		a.pendingEvents.Add(env)
+	}
+}
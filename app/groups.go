@@ -0,0 +1,217 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Phases of a group command reported in group:command events
+const (
+	GroupSent   = "sent"   // a member was switched
+	GroupFailed = "failed" // a member could not be switched; see Error
+	GroupDone   = "done"   // every member was tried
+)
+
+// GroupProgress is the payload of group:command
+type GroupProgress struct {
+	Group        string `json:"group"`
+	State        string `json:"state"`
+	DeviceName   string `json:"deviceName,omitempty"` // empty for done
+	OutletNumber string `json:"outletNumber,omitempty"`
+	Phase        string `json:"phase"`
+	Error        string `json:"error,omitempty"`
+	Sent         int    `json:"sent"`   // members switched so far
+	Failed       int    `json:"failed"` // members that failed so far
+	Total        int    `json:"total"`
+}
+
+// runTracker keeps one run per group or scene at a time, keyed by its
+// lower-case name
+type runTracker struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+// start marks a run as started, returning false if one already is
+func (r *runTracker) start(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running == nil {
+		r.running = make(map[string]bool)
+	}
+	if r.running[name] {
+		return false
+	}
+	r.running[name] = true
+	return true
+}
+
+// finish marks a run as over
+func (r *runTracker) finish(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, name)
+}
+
+// ListGroups returns the outlet groups; a kiosk sees only the groups whose
+// outlets are all whitelisted
+func (a *App) ListGroups() []models.Group {
+	groups := a.groups.GetAll()
+	if !a.isKiosk() {
+		return groups
+	}
+
+	allowed := make([]models.Group, 0, len(groups))
+	for _, group := range groups {
+		if a.kioskGroup(group) == nil {
+			allowed = append(allowed, group)
+		}
+	}
+	return allowed
+}
+
+// SaveGroup creates a group or replaces the one with the same name
+func (a *App) SaveGroup(group models.Group) (models.Group, error) {
+	if err := a.kioskLocked(); err != nil {
+		return models.Group{}, err
+	}
+
+	saved, err := a.groups.Put(group)
+	if err != nil {
+		return models.Group{}, fmt.Errorf("failed to save group: %w", err)
+	}
+	a.emit(events.GroupsChanged, a.groups.GetAll())
+	return saved, nil
+}
+
+// DeleteGroup removes a group
+func (a *App) DeleteGroup(name string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := a.groups.Delete(name); err != nil {
+		return err
+	}
+	a.emit(events.GroupsChanged, a.groups.GetAll())
+	return nil
+}
+
+// SendGroupCommand switches every outlet of a group ON or OFF, in order,
+// waiting each member's delay before switching it. Progress is reported as
+// group:command events. A group without delays is switched before the call
+// returns, with an error listing the members that failed; a group with
+// delays is switched in the background.
+func (a *App) SendGroupCommand(name, state string) error {
+	group, ok := a.groups.Get(name)
+	if !ok {
+		return fmt.Errorf("group not found: %s", name)
+	}
+	if err := a.kioskGroup(group); err != nil {
+		return err
+	}
+
+	state = strings.ToUpper(strings.TrimSpace(state))
+	if state != "ON" && state != "OFF" {
+		return fmt.Errorf("group command must be ON or OFF, not %q", state)
+	}
+
+	key := strings.ToLower(group.Name)
+	if !a.groupRuns.start(key) {
+		return fmt.Errorf("group %s is already being switched", group.Name)
+	}
+
+	delayed := false
+	for _, member := range group.Members {
+		if member.Delay > 0 {
+			delayed = true
+			break
+		}
+	}
+	if delayed {
+		go func() {
+			defer a.groupRuns.finish(key)
+			a.runGroupCommand(group, state)
+		}()
+		return nil
+	}
+
+	defer a.groupRuns.finish(key)
+	return a.runGroupCommand(group, state)
+}
+
+// runGroupCommand switches a group's members in order and returns the
+// failures joined
+func (a *App) runGroupCommand(group models.Group, state string) error {
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	progress := GroupProgress{Group: group.Name, State: state, Total: len(group.Members)}
+	source := "group " + group.Name
+	var failures []error
+	cancelled := false
+	for _, member := range group.Members {
+		if member.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				cancelled = true
+			case <-time.After(time.Duration(member.Delay) * time.Millisecond):
+			}
+		}
+		if cancelled {
+			failures = append(failures, errors.New("cancelled; the remaining outlets were not switched"))
+			break
+		}
+
+		progress.DeviceName, progress.OutletNumber = member.DeviceName, member.OutletNumber
+		progress.Error = ""
+		err := a.withCommandPolicy(member.DeviceName, member.OutletNumber, "", source+" state="+state, lockEnforced, func() error {
+			return a.sendCommand(member.DeviceName, member.OutletNumber, state, source)
+		})
+		if err != nil {
+			log.Printf("Group %s: failed to switch %s/%s: %v", group.Name, member.DeviceName, member.OutletNumber, err)
+			failures = append(failures, fmt.Errorf("%s/%s: %w", member.DeviceName, member.OutletNumber, err))
+			progress.Failed++
+			progress.Phase = GroupFailed
+			progress.Error = err.Error()
+		} else {
+			progress.Sent++
+			progress.Phase = GroupSent
+		}
+		a.emit(events.GroupCommand, progress)
+	}
+
+	progress.DeviceName, progress.OutletNumber = "", ""
+	progress.Phase = GroupDone
+	progress.Error = ""
+	if cancelled {
+		progress.Error = "cancelled; the remaining outlets were not switched"
+	}
+	a.emit(events.GroupCommand, progress)
+
+	if len(failures) > 0 {
+		return fmt.Errorf("group %s: %d of %d outlets not switched: %w", group.Name, len(group.Members)-progress.Sent, len(group.Members), errors.Join(failures...))
+	}
+	return nil
+}
+
+// kioskGroup returns an error if any outlet of a group is not whitelisted
+// for the kiosk
+func (a *App) kioskGroup(group models.Group) error {
+	for _, member := range group.Members {
+		if err := a.kioskOutlet(member.DeviceName, member.OutletNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"log"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// discoveryRegistry holds switches learned from Home Assistant discovery
+type discoveryRegistry struct {
+	mu       sync.RWMutex
+	byConfig map[string]*mqtt.HASwitch // key: config topic
+}
+
+// put stores a switch and returns the one it replaced, if any
+func (r *discoveryRegistry) put(sw *mqtt.HASwitch) *mqtt.HASwitch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byConfig == nil {
+		r.byConfig = make(map[string]*mqtt.HASwitch)
+	}
+	previous := r.byConfig[sw.ConfigTopic]
+	r.byConfig[sw.ConfigTopic] = sw
+	return previous
+}
+
+// remove forgets the switch announced on a config topic
+func (r *discoveryRegistry) remove(configTopic string) *mqtt.HASwitch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sw := r.byConfig[configTopic]
+	delete(r.byConfig, configTopic)
+	return sw
+}
+
+// byStateTopic returns the switches reporting on a state topic
+func (r *discoveryRegistry) byStateTopic(topic string) []*mqtt.HASwitch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var switches []*mqtt.HASwitch
+	for _, sw := range r.byConfig {
+		if sw.StateTopic == topic {
+			switches = append(switches, sw)
+		}
+	}
+	return switches
+}
+
+// byOutlet returns the switch shown as the given device/outlet
+func (r *discoveryRegistry) byOutlet(device, outlet string) (*mqtt.HASwitch, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, sw := range r.byConfig {
+		if sw.Device == device && sw.Outlet == outlet {
+			return sw, true
+		}
+	}
+	return nil, false
+}
+
+// list returns all learned switches
+func (r *discoveryRegistry) list() []mqtt.HASwitch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switches := make([]mqtt.HASwitch, 0, len(r.byConfig))
+	for _, sw := range r.byConfig {
+		switches = append(switches, *sw)
+	}
+	return switches
+}
+
+// haPrefix returns the configured discovery prefix
+func (a *App) haPrefix() string {
+	if prefix := a.currentConfig().HADiscoveryPrefix; prefix != "" {
+		return prefix
+	}
+	return mqtt.DefaultHADiscoveryPrefix
+}
+
+// handleDiscovery processes discovery configs and learned state topics,
+// returning true if the message was consumed
+func (a *App) handleDiscovery(topic, payload string) bool {
+	if !a.currentConfig().HADiscovery {
+		return false
+	}
+
+	if mqtt.IsHADiscoveryTopic(a.haPrefix(), topic) {
+		a.learnSwitch(topic, payload)
+		return true
+	}
+
+	switches := a.discovered.byStateTopic(topic)
+	for _, sw := range switches {
+		if !a.currentConfig().IsHiddenDevice(sw.Device) {
+			a.updateOutlet(sw.Device, sw.Outlet, sw.ParseState(payload))
+		}
+	}
+	return len(switches) > 0
+}
+
+// learnSwitch registers, updates or removes a discovered switch
+func (a *App) learnSwitch(topic, payload string) {
+	sw, err := mqtt.ParseHADiscovery(topic, payload)
+	if err != nil {
+		log.Printf("Ignoring discovery config %s: %v", topic, err)
+		return
+	}
+
+	// An empty config removes the switch
+	if sw == nil {
+		if removed := a.discovered.remove(topic); removed != nil {
+			a.deviceStore.Remove(removed.Device, removed.Outlet)
+			go a.unsubscribeStateTopic(removed.StateTopic)
+		}
+		return
+	}
+
+	previous := a.discovered.put(sw)
+	if previous != nil && (previous.Device != sw.Device || previous.Outlet != sw.Outlet) {
+		a.deviceStore.Remove(previous.Device, previous.Outlet)
+	}
+
+	// Hidden devices stay registered, so they come back once unhidden, but
+	// out of the list
+	if !a.currentConfig().IsHiddenDevice(sw.Device) {
+		outlet := models.DeviceOutlet{
+			DeviceName:   sw.Device,
+			OutletNumber: sw.Outlet,
+			Status:       "UNKNOWN",
+			StateTopic:   sw.StateTopic,
+			CommandTopic: sw.CommandTopic,
+		}
+		if existing, ok := a.deviceStore.Get(sw.Device, sw.Outlet); ok {
+			// A discovery config says nothing about the state
+			outlet.Status, outlet.Stale = existing.Status, existing.Stale
+		}
+		a.deviceStore.Add(outlet)
+		a.emit(events.DeviceUpdate, outlet)
+	}
+
+	// Subscribing waits for the broker, which must not happen in the message
+	// handler. The client forgets its subscriptions on disconnect, so check it
+	// rather than the registry.
+	if !a.isSubscribed(sw.StateTopic) {
+		go func() {
+			if err := a.mqttClient.Subscribe(sw.StateTopic); err != nil {
+				log.Printf("Failed to subscribe to %s: %v", sw.StateTopic, err)
+			}
+		}()
+	}
+}
+
+// isSubscribed reports whether the client is subscribed to a topic
+func (a *App) isSubscribed(topic string) bool {
+	for _, subscribed := range a.mqttClient.Subscriptions() {
+		if subscribed == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// unsubscribeStateTopic drops a state topic no learned switch uses any more
+func (a *App) unsubscribeStateTopic(topic string) {
+	if len(a.discovered.byStateTopic(topic)) > 0 {
+		return
+	}
+	if err := a.mqttClient.Unsubscribe(topic); err != nil {
+		log.Printf("Failed to unsubscribe from %s: %v", topic, err)
+	}
+}
+
+// GetDiscoveredSwitches returns the switches learned from Home Assistant discovery
+func (a *App) GetDiscoveredSwitches() []mqtt.HASwitch {
+	return a.discovered.list()
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// handoverTimeFormat is how times are written in handover reports
+const handoverTimeFormat = "2006-01-02 15:04:05"
+
+// overrideActions are the audit actions that bypassed a protection
+var overrideActions = map[string]bool{
+	"reservation_overridden": true,
+	"elevated_command_sent":  true,
+	"confirmed_command_sent": true,
+	"emergency_off":          true,
+}
+
+// reservationActions are the audit actions that changed a reservation
+var reservationActions = map[string]bool{
+	"outlet_reserved":      true,
+	"reservation_released": true,
+	"reservation_expired":  true,
+}
+
+// HandoverReport summarizes what happened during a shift, for the operator
+// taking over
+type HandoverReport struct {
+	Since              time.Time              `json:"since"`
+	GeneratedAt        time.Time              `json:"generatedAt"`
+	StateChanges       []models.TimelineEntry `json:"stateChanges"`
+	Alerts             []models.TimelineEntry `json:"alerts"`
+	Overrides          []models.AuditEntry    `json:"overrides"`
+	ReservationChanges []models.AuditEntry    `json:"reservationChanges"`
+	Reservations       []models.Reservation   `json:"reservations"` // current and upcoming
+}
+
+// GenerateHandover summarizes the state changes, alerts, overrides and
+// reservation changes since the given time, oldest first, along with the
+// reservations in force or upcoming now
+func (a *App) GenerateHandover(since time.Time) (HandoverReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return HandoverReport{}, err
+	}
+
+	now := time.Now()
+	if since.IsZero() || since.After(now) {
+		return HandoverReport{}, fmt.Errorf("handover start must be in the past")
+	}
+
+	entries, err := a.timeline.Range(since, now)
+	if err != nil {
+		return HandoverReport{}, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	report := HandoverReport{
+		Since:              since,
+		GeneratedAt:        now,
+		StateChanges:       make([]models.TimelineEntry, 0),
+		Alerts:             make([]models.TimelineEntry, 0),
+		Overrides:          make([]models.AuditEntry, 0),
+		ReservationChanges: make([]models.AuditEntry, 0),
+		Reservations:       a.reservations.GetAll(),
+	}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case models.TimelineState:
+			report.StateChanges = append(report.StateChanges, entry)
+		case models.TimelineAlert:
+			report.Alerts = append(report.Alerts, entry)
+		}
+	}
+
+	// The audit log is newest first
+	audit := a.auditLog.GetAll()
+	for i := len(audit) - 1; i >= 0; i-- {
+		entry := audit[i]
+		if entry.Timestamp.Before(since) {
+			continue
+		}
+		if overrideActions[entry.Action] {
+			report.Overrides = append(report.Overrides, entry)
+		} else if reservationActions[entry.Action] {
+			report.ReservationChanges = append(report.ReservationChanges, entry)
+		}
+	}
+	sort.SliceStable(report.Overrides, func(i, j int) bool {
+		return report.Overrides[i].Timestamp.Before(report.Overrides[j].Timestamp)
+	})
+	sort.SliceStable(report.ReservationChanges, func(i, j int) bool {
+		return report.ReservationChanges[i].Timestamp.Before(report.ReservationChanges[j].Timestamp)
+	})
+
+	return report, nil
+}
+
+// ExportHandover renders the handover report since the given time as plain
+// text (the default) or as an HTML page for the control-room log
+func (a *App) ExportHandover(since time.Time, format string) (string, error) {
+	report, err := a.GenerateHandover(since)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return report.Text(), nil
+	case "html":
+		var buf bytes.Buffer
+		if err := handoverTemplate.Execute(&buf, report); err != nil {
+			return "", fmt.Errorf("failed to render handover: %w", err)
+		}
+		return buf.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// Text renders the report as plain text
+func (r HandoverReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Shift handover: %s to %s\n",
+		r.Since.Format(handoverTimeFormat), r.GeneratedAt.Format(handoverTimeFormat))
+
+	fmt.Fprintf(&b, "\nState changes (%d)\n", len(r.StateChanges))
+	for _, entry := range r.StateChanges {
+		fmt.Fprintf(&b, "  %s  %s/%s  %s\n", entry.Timestamp.Format(handoverTimeFormat),
+			entry.DeviceName, entry.OutletNumber, entry.Detail)
+	}
+
+	fmt.Fprintf(&b, "\nAlerts (%d)\n", len(r.Alerts))
+	for _, entry := range r.Alerts {
+		fmt.Fprintf(&b, "  %s  [%s] %s\n", entry.Timestamp.Format(handoverTimeFormat),
+			entry.Severity, entry.Detail)
+	}
+
+	fmt.Fprintf(&b, "\nOverrides (%d)\n", len(r.Overrides))
+	for _, entry := range r.Overrides {
+		b.WriteString("  " + auditLine(entry) + "\n")
+	}
+
+	fmt.Fprintf(&b, "\nReservation changes (%d)\n", len(r.ReservationChanges))
+	for _, entry := range r.ReservationChanges {
+		b.WriteString("  " + auditLine(entry) + "\n")
+	}
+
+	fmt.Fprintf(&b, "\nReservations in force or upcoming (%d)\n", len(r.Reservations))
+	for _, reservation := range r.Reservations {
+		fmt.Fprintf(&b, "  %s/%s  %s  %s to %s", reservation.DeviceName, reservation.OutletNumber,
+			reservation.Operator, reservation.From.Format(handoverTimeFormat), reservation.Until.Format(handoverTimeFormat))
+		if reservation.Note != "" {
+			b.WriteString("  " + reservation.Note)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// auditLine formats an audit entry on one line
+func auditLine(entry models.AuditEntry) string {
+	parts := []string{entry.Timestamp.Format(handoverTimeFormat), entry.Action}
+	if entry.Operator != "" {
+		parts = append(parts, "by "+entry.Operator)
+	}
+	if entry.DeviceName != "" {
+		parts = append(parts, entry.DeviceName+"/"+entry.OutletNumber)
+	}
+	if entry.Detail != "" {
+		parts = append(parts, entry.Detail)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// handoverTemplate renders a handover report as a standalone HTML page
+var handoverTemplate = template.Must(template.New("handover").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format(handoverTimeFormat) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Shift handover {{time .Since}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.75em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Shift handover</h1>
+<p>{{time .Since}} to {{time .GeneratedAt}}</p>
+
+<h2>State changes ({{len .StateChanges}})</h2>
+<table>
+<tr><th>Time</th><th>Outlet</th><th>Change</th></tr>
+{{range .StateChanges}}<tr><td>{{time .Timestamp}}</td><td>{{.DeviceName}}/{{.OutletNumber}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+
+<h2>Alerts ({{len .Alerts}})</h2>
+<table>
+<tr><th>Time</th><th>Severity</th><th>Alert</th></tr>
+{{range .Alerts}}<tr><td>{{time .Timestamp}}</td><td>{{.Severity}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+
+<h2>Overrides ({{len .Overrides}})</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Operator</th><th>Outlet</th><th>Detail</th></tr>
+{{range .Overrides}}<tr><td>{{time .Timestamp}}</td><td>{{.Action}}</td><td>{{.Operator}}</td><td>{{.DeviceName}}/{{.OutletNumber}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+
+<h2>Reservation changes ({{len .ReservationChanges}})</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Operator</th><th>Outlet</th><th>Detail</th></tr>
+{{range .ReservationChanges}}<tr><td>{{time .Timestamp}}</td><td>{{.Action}}</td><td>{{.Operator}}</td><td>{{.DeviceName}}/{{.OutletNumber}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+
+<h2>Reservations in force or upcoming ({{len .Reservations}})</h2>
+<table>
+<tr><th>Outlet</th><th>Operator</th><th>From</th><th>Until</th><th>Note</th></tr>
+{{range .Reservations}}<tr><td>{{.DeviceName}}/{{.OutletNumber}}</td><td>{{.Operator}}</td><td>{{time .From}}</td><td>{{time .Until}}</td><td>{{.Note}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// StoreStatus reports whether a persistent store was opened at startup
+type StoreStatus struct {
+	Name   string `json:"name"`
+	Loaded bool   `json:"loaded"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AutoConnectResult reports the outcome of the startup connection attempt
+type AutoConnectResult struct {
+	Attempted bool   `json:"attempted"`
+	Connected bool   `json:"connected"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StartupReport summarizes what happened during startup so the UI can show
+// exactly which step failed
+type StartupReport struct {
+	Timestamp          time.Time         `json:"timestamp"`
+	ConfigLoaded       bool              `json:"configLoaded"`
+	ConfigDefaulted    bool              `json:"configDefaulted"` // no config file, or it failed to load
+	ConfigError        string            `json:"configError,omitempty"`
+	PasswordDecrypted  bool              `json:"passwordDecrypted"`
+	DecryptionError    string            `json:"decryptionError,omitempty"`
+	PasswordInKeychain bool              `json:"passwordInKeychain"` // false if kept encrypted in the config file
+	Stores             []StoreStatus     `json:"stores"`
+	AutoConnect        AutoConnectResult `json:"autoConnect"`
+	Subscriptions      []string          `json:"subscriptions"`
+	Complete           bool              `json:"complete"` // false while auto-connect is still running
+}
+
+// startupReport guards the report built during Startup
+type startupReport struct {
+	mu     sync.Mutex
+	report StartupReport
+}
+
+// update applies a change to the report under lock
+func (r *startupReport) update(change func(*StartupReport)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(&r.report)
+}
+
+// snapshot returns a copy of the report
+func (r *startupReport) snapshot() StartupReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	report.Stores = append([]StoreStatus(nil), r.report.Stores...)
+	report.Subscriptions = append([]string(nil), r.report.Subscriptions...)
+	return report
+}
+
+// addStore records the status of a persistent store
+func (r *startupReport) addStore(name string, err error) {
+	r.update(func(report *StartupReport) {
+		status := StoreStatus{Name: name, Loaded: err == nil}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		report.Stores = append(report.Stores, status)
+	})
+}
+
+// GetStartupReport returns the startup health report
+func (a *App) GetStartupReport() StartupReport {
+	return a.startup.snapshot()
+}
+
+// finishStartupReport marks the report complete and emits it once
+func (a *App) finishStartupReport() {
+	a.startup.update(func(report *StartupReport) {
+		report.Complete = true
+		report.Subscriptions = a.mqttClient.Subscriptions()
+	})
+	a.emit(events.StartupReport, a.startup.snapshot())
+}
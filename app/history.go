@@ -0,0 +1,38 @@
+package app
+
+import (
+	"time"
+)
+
+// StateTransition is one change of an outlet's reported state
+type StateTransition struct {
+	Timestamp time.Time `json:"timestamp"`
+	From      string    `json:"from,omitempty"` // empty for the first state recorded
+	To        string    `json:"to"`
+	Duration  float64   `json:"duration,omitempty"` // seconds spent in From; 0 if unknown
+}
+
+// GetOutletHistory returns the state changes of an outlet since the given
+// time (zero for all recorded), oldest first. They come from the timeline's
+// index of its file, so they span restarts; reports repeating the last
+// state, such as retained messages after a reconnect, are not changes.
+func (a *App) GetOutletHistory(deviceName, outletNumber string, since time.Time) ([]StateTransition, error) {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return nil, err
+	}
+
+	// The change before since gives the first one its From
+	changes, last := a.timeline.StateChanges(deviceName, outletNumber, since)
+	transitions := make([]StateTransition, 0, len(changes))
+	for i := range changes {
+		entry := &changes[i]
+		transition := StateTransition{Timestamp: entry.Timestamp, To: entry.State}
+		if last != nil {
+			transition.From = last.State
+			transition.Duration = entry.Timestamp.Sub(last.Timestamp).Seconds()
+		}
+		transitions = append(transitions, transition)
+		last = entry
+	}
+	return transitions, nil
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/sim"
+)
+
+// simTimeout bounds every wait for the simulated broker and PDU
+const simTimeout = 10 * time.Second
+
+// simulation is an app connected to an in-process broker with one PDU
+type simulation struct {
+	app    *App
+	broker *sim.Broker
+	pdu    *sim.PDU
+	addr   string
+}
+
+// startSimulation starts a broker and a four-outlet PDU, saves a config
+// pointing at the broker in a temporary config directory, connects an app
+// to it and waits until the app shows every outlet
+func startSimulation(t *testing.T) *simulation {
+	t.Helper()
+	config.SetDir(t.TempDir())
+	t.Cleanup(func() { config.SetDir("") })
+
+	broker, err := sim.NewBroker("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &simulation{broker: broker, addr: broker.Addr()}
+	t.Cleanup(func() { s.broker.Close() })
+
+	host, portText, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portText)
+	cfg := config.DefaultConfig()
+	cfg.MQTTServer = host
+	cfg.ServerPort = port
+	cfg.Username = "test"
+	cfg.SubscribeString = "power/#"
+	cfg.AutoConnect = false
+	cfg.ReconnectInitialDelay = 1
+	cfg.MaxReconnectInterval = 1
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.pdu = sim.NewPDU("pdu1", 4)
+	if err := s.pdu.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.pdu.Disconnect)
+
+	s.app = NewApp()
+	s.app.start()
+	t.Cleanup(func() { s.app.Shutdown(context.Background()) })
+	if err := s.app.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, "the app to connect", s.app.GetConnectionStatus)
+	for outlet := 1; outlet <= s.pdu.Outlets(); outlet++ {
+		s.waitForOutlet(t, strconv.Itoa(outlet), "OFF")
+	}
+	return s
+}
+
+// waitFor polls until done returns true, failing the test after simTimeout
+func (s *simulation) waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(simTimeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// waitForOutlet waits until the app shows a PDU outlet in state
+func (s *simulation) waitForOutlet(t *testing.T, outletNumber, state string) {
+	t.Helper()
+	s.waitFor(t, "pdu1/"+outletNumber+" to be "+state+" in the app", func() bool {
+		outlet, ok := s.app.deviceStore.Get("pdu1", outletNumber)
+		return ok && outlet.Status == state && !outlet.Stale
+	})
+}
+
+func TestSimulatedConnect(t *testing.T) {
+	s := startSimulation(t)
+
+	if got := len(s.app.GetDevices("", false)); got != s.pdu.Outlets() {
+		t.Fatalf("app lists %d outlets, want %d", got, s.pdu.Outlets())
+	}
+}
+
+func TestSimulatedToggle(t *testing.T) {
+	s := startSimulation(t)
+
+	if err := s.app.ToggleOutlet("pdu1", "2"); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, "the PDU to switch outlet 2 on", func() bool { return s.pdu.State(2) })
+	s.waitForOutlet(t, "2", "ON")
+
+	if err := s.app.SendCommand("pdu1", "2", "OFF", false); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, "the PDU to switch outlet 2 off", func() bool { return !s.pdu.State(2) })
+	s.waitForOutlet(t, "2", "OFF")
+}
+
+func TestSimulatedStateUpdate(t *testing.T) {
+	s := startSimulation(t)
+
+	// Switched at the unit, as with its button
+	if err := s.pdu.Set(3, true); err != nil {
+		t.Fatal(err)
+	}
+	s.waitForOutlet(t, "3", "ON")
+	if err := s.pdu.Set(3, false); err != nil {
+		t.Fatal(err)
+	}
+	s.waitForOutlet(t, "3", "OFF")
+}
+
+func TestSimulatedReconnect(t *testing.T) {
+	s := startSimulation(t)
+
+	// The broker goes away and comes back on the same address
+	s.broker.Close()
+	s.waitFor(t, "the app to notice the broker is gone", func() bool { return !s.app.GetConnectionStatus() })
+
+	broker, err := sim.NewBroker(s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.broker = broker
+	s.waitFor(t, "the app to reconnect", s.app.GetConnectionStatus)
+
+	// Subscriptions are restored: the PDU's states arrive again and
+	// commands get through
+	if err := s.pdu.Connect(s.addr); err != nil {
+		t.Fatal(err)
+	}
+	s.waitForOutlet(t, "1", "OFF")
+	if err := s.app.SendCommand("pdu1", "1", "ON", false); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFor(t, "the PDU to switch outlet 1 on", func() bool { return s.pdu.State(1) })
+	s.waitForOutlet(t, "1", "ON")
+}
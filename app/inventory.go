@@ -0,0 +1,149 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/inventory"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// InventoryImportReport describes the outcome of an inventory import
+type InventoryImportReport struct {
+	Path     string            `json:"path"`
+	Imported int               `json:"imported"` // rows written to the inventory
+	Created  int               `json:"created"`
+	Updated  int               `json:"updated"`
+	Skipped  int               `json:"skipped"` // rows left out because of errors
+	Issues   []inventory.Issue `json:"issues"`
+}
+
+// ImportInventory reads outlet labels, groups, rated wattage, circuits,
+// tags, notes and locations from a .csv, .xlsx or .json file and merges them
+// into the inventory. Rows with errors are skipped and listed in the report
+// with any warnings.
+func (a *App) ImportInventory(path string) (InventoryImportReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return InventoryImportReport{}, err
+	}
+
+	report := InventoryImportReport{Path: path}
+
+	rows, err := inventory.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+
+	outlets, issues := inventory.Parse(rows)
+	report.Issues = issues
+	if outlets == nil {
+		return report, fmt.Errorf("inventory file has no usable header row")
+	}
+
+	skipped := make(map[int]bool)
+	for _, issue := range issues {
+		if issue.Severity == inventory.SeverityError && issue.Row > 0 {
+			skipped[issue.Row] = true
+		}
+	}
+	report.Skipped = len(skipped)
+
+	// Outlets nothing has reported yet are imported but worth a second look
+	for _, outlet := range outlets {
+		if _, known := a.deviceStore.Get(outlet.DeviceName, outlet.OutletNumber); !known {
+			report.Issues = append(report.Issues, inventory.Issue{
+				Severity: inventory.SeverityWarning,
+				Message:  fmt.Sprintf("%s/%s has not been reported by any device yet", outlet.DeviceName, outlet.OutletNumber),
+			})
+		}
+	}
+
+	// Empty cells and missing columns keep what the inventory already has
+	report.Created, report.Updated, err = a.inventory.Upsert(outlets)
+	if err != nil {
+		return report, fmt.Errorf("failed to save inventory: %w", err)
+	}
+	report.Imported = len(outlets)
+	for _, outlet := range outlets {
+		if metadata, ok := a.inventory.Get(outlet.DeviceName, outlet.OutletNumber); ok {
+			a.applyOutletDetails(metadata)
+		}
+	}
+
+	a.audit("inventory_imported", "", "", "", fmt.Sprintf("path=%s created=%d updated=%d skipped=%d",
+		path, report.Created, report.Updated, report.Skipped))
+	return report, nil
+}
+
+// ImportDevices loads a device inventory written by ExportDevices, or
+// prepared in a spreadsheet, as ImportInventory does
+func (a *App) ImportDevices(path string) (InventoryImportReport, error) {
+	return a.ImportInventory(path)
+}
+
+// ExportDevices writes every known or inventoried outlet with its alias
+// (inventory label), group, rated wattage, circuit, tags, notes and location
+// to path as "csv" or "json" (from the file extension if empty), for
+// editing in a spreadsheet or as a backup. It returns how many outlets were
+// written.
+func (a *App) ExportDevices(path, format string) (int, error) {
+	if err := a.kioskLocked(); err != nil {
+		return 0, err
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	outlets := a.GetInventory()
+	for _, outlet := range a.deviceStore.GetAll() {
+		if _, ok := a.inventory.Get(outlet.DeviceName, outlet.OutletNumber); !ok {
+			outlets = append(outlets, models.OutletMetadata{DeviceName: outlet.DeviceName, OutletNumber: outlet.OutletNumber})
+		}
+	}
+	sort.Slice(outlets, func(i, j int) bool {
+		if outlets[i].DeviceName != outlets[j].DeviceName {
+			return models.NaturalLess(outlets[i].DeviceName, outlets[j].DeviceName)
+		}
+		return models.NaturalLess(outlets[i].OutletNumber, outlets[j].OutletNumber)
+	})
+
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(format) {
+	case "csv":
+		err = inventory.WriteCSV(&buf, outlets)
+	case "json":
+		err = inventory.WriteJSON(&buf, outlets)
+	default:
+		return 0, fmt.Errorf("unsupported export format: %s (use csv or json)", format)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode devices: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write devices: %w", err)
+	}
+	a.audit("devices_exported", "", "", "", fmt.Sprintf("path=%s outlets=%d", path, len(outlets)))
+	return len(outlets), nil
+}
+
+// GetInventory returns the metadata of all inventoried outlets
+func (a *App) GetInventory() []models.OutletMetadata {
+	outlets := a.inventory.GetAll()
+	if !a.isKiosk() {
+		return outlets
+	}
+	allowed := make([]models.OutletMetadata, 0, len(outlets))
+	for _, outlet := range outlets {
+		if a.kioskAllows(outlet.DeviceName, outlet.OutletNumber) {
+			allowed = append(allowed, outlet)
+		}
+	}
+	return allowed
+}
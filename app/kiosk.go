@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// errKiosk is returned by settings and maintenance bindings in kiosk mode
+var errKiosk = fmt.Errorf("not available in kiosk mode")
+
+// kioskHiddenEvents are not sent to a kiosk frontend at all
+var kioskHiddenEvents = map[string]bool{
+	events.MessageNew:           true,
+	events.LogAppend:            true,
+	events.ConnectionStats:      true,
+	events.DeviceTelemetry:      true,
+	events.AlertRaised:          true,
+	events.CommissioningUpdate:  true,
+	events.StatusAuditCompleted: true,
+	events.ConfigRecoveryNeeded: true,
+	events.MessagesUnparsed:     true,
+}
+
+// isKiosk reports whether the app runs as a restricted kiosk
+func (a *App) isKiosk() bool {
+	return a.currentConfig().KioskMode
+}
+
+// kioskLocked returns errKiosk in kiosk mode; settings bindings call it first
+func (a *App) kioskLocked() error {
+	if a.isKiosk() {
+		return errKiosk
+	}
+
+	return nil
+}
+
+// kioskAllows reports whether an outlet may be shown and switched; outside
+// kiosk mode every outlet is allowed
+func (a *App) kioskAllows(deviceName, outletNumber string) bool {
+	cfg := a.currentConfig()
+	return !cfg.KioskMode || cfg.IsKioskOutlet(deviceName, outletNumber)
+}
+
+// kioskOutlet returns an error if an outlet is not whitelisted for the kiosk
+func (a *App) kioskOutlet(deviceName, outletNumber string) error {
+	if !a.kioskAllows(deviceName, outletNumber) {
+		return fmt.Errorf("outlet %s/%s is not available in kiosk mode", deviceName, outletNumber)
+	}
+	return nil
+}
+
+// kioskFilter drops the outlets a kiosk may not show
+func (a *App) kioskFilter(devices []models.DeviceOutlet) []models.DeviceOutlet {
+	if !a.isKiosk() {
+		return devices
+	}
+	allowed := make([]models.DeviceOutlet, 0, len(devices))
+	for _, device := range devices {
+		if a.kioskAllows(device.DeviceName, device.OutletNumber) {
+			allowed = append(allowed, device)
+		}
+	}
+	return allowed
+}
+
+// kioskHides reports whether an event must not reach a kiosk frontend
+func (a *App) kioskHides(name string, data interface{}) bool {
+	if !a.isKiosk() {
+		return false
+	}
+	if kioskHiddenEvents[name] {
+		return true
+	}
+	switch outlet := data.(type) {
+	case models.DeviceOutlet:
+		return !a.kioskAllows(outlet.DeviceName, outlet.OutletNumber)
+	case CycleProgress:
+		return !a.kioskAllows(outlet.DeviceName, outlet.OutletNumber)
+	case events.CommandAckPayload:
+		return !a.kioskAllows(outlet.DeviceName, outlet.OutletNumber)
+	case GroupProgress:
+		return outlet.DeviceName != "" && !a.kioskAllows(outlet.DeviceName, outlet.OutletNumber)
+	case SceneProgress:
+		return outlet.DeviceName != "" && !a.kioskAllows(outlet.DeviceName, outlet.OutletNumber)
+	}
+	return false
+}
+
+// IsKiosk reports whether the frontend should show the kiosk layout
+func (a *App) IsKiosk() bool {
+	return a.isKiosk()
+}
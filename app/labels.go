@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/labels"
+)
+
+// GetLabels returns the printable label data of every known outlet, or of
+// one device's outlets. The alias is the inventory label if there is one,
+// else the name the device publishes.
+func (a *App) GetLabels(deviceName string) []labels.Label {
+	aliases := make(map[string]string)
+	keys := make(map[string][2]string)
+	add := func(device, outlet, alias string) {
+		if (deviceName != "" && device != deviceName) || !a.kioskAllows(device, outlet) {
+			return
+		}
+		key := device + ":" + outlet
+		keys[key] = [2]string{device, outlet}
+		if alias != "" {
+			aliases[key] = alias
+		}
+	}
+
+	for _, outlet := range a.deviceStore.GetAll() {
+		add(outlet.DeviceName, outlet.OutletNumber, outlet.Label)
+	}
+	for _, outlet := range a.inventory.GetAll() {
+		add(outlet.DeviceName, outlet.OutletNumber, outlet.Label)
+	}
+
+	result := make([]labels.Label, 0, len(keys))
+	for key, names := range keys {
+		result = append(result, labels.New(names[0], names[1], aliases[key]))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DeviceName != result[j].DeviceName {
+			return result[i].DeviceName < result[j].DeviceName
+		}
+		return result[i].OutletNumber < result[j].OutletNumber
+	})
+	return result
+}
+
+// ExportLabels writes printable outlet labels to path as a PDF label sheet
+// or as CSV, chosen by the file extension, and returns how many were written
+func (a *App) ExportLabels(path, deviceName string) (int, error) {
+	if err := a.kioskLocked(); err != nil {
+		return 0, err
+	}
+
+	outlets := a.GetLabels(deviceName)
+	if len(outlets) == 0 {
+		return 0, fmt.Errorf("no outlets to label")
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		err = labels.WritePDF(&buf, outlets)
+	case ".csv":
+		err = labels.WriteCSV(&buf, outlets)
+	default:
+		return 0, fmt.Errorf("unsupported label format: %s (use .pdf or .csv)", filepath.Ext(path))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate labels: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write labels: %w", err)
+	}
+	return len(outlets), nil
+}
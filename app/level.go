@@ -0,0 +1,60 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// updateLevel stores a dimmable outlet's level and notifies the frontend
+func (a *App) updateLevel(device, outlet string, level int) {
+	previous, known := a.deviceStore.Get(device, outlet)
+	if !known || previous.Level == nil || *previous.Level != level {
+		detail := "level " + strconv.Itoa(level)
+		if known && previous.Level != nil {
+			detail = fmt.Sprintf("level %d -> %d", *previous.Level, level)
+		}
+		a.recordTimeline(models.TimelineEntry{
+			Kind:         models.TimelineState,
+			DeviceName:   device,
+			OutletNumber: outlet,
+			Detail:       detail,
+		})
+	}
+
+	a.emit(events.DeviceUpdate, a.deviceStore.SetLevel(device, outlet, level))
+}
+
+// SetLevel sets a dimmable outlet (dimmer, variac) to a 0-100 level
+func (a *App) SetLevel(deviceName, outletNumber string, level int) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+
+	if level < 0 || level > 100 {
+		return fmt.Errorf("level must be between 0 and 100")
+	}
+	return a.withCommandPolicy(deviceName, outletNumber, "", "level="+strconv.Itoa(level), lockEnforced, func() error {
+		if a.IsReplica() {
+			return fmt.Errorf("this instance is a read-only replica")
+		}
+
+		setter, ok := a.adapter(a.protocolOf(deviceName)).(mqtt.LevelSetter)
+		if !ok {
+			return fmt.Errorf("outlet %s/%s does not support levels", deviceName, outletNumber)
+		}
+		topic, payload, err := setter.BuildLevelCommand(deviceName, a.quirkFor(deviceName).ToDevice(outletNumber), level)
+		if err != nil {
+			return fmt.Errorf("failed to build command: %w", err)
+		}
+		return a.publishCommand(topic, payload, models.TimelineEntry{
+			DeviceName:   deviceName,
+			OutletNumber: outletNumber,
+			Source:       SourceManual,
+			Detail:       "set level " + strconv.Itoa(level),
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// TopicMute is a topic filter whose messages are left out of the log
+type TopicMute struct {
+	Topic      string    `json:"topic"`
+	Added      time.Time `json:"added"`
+	Suppressed uint64    `json:"suppressed"` // messages left out since the mute was added
+}
+
+// LoggingStatus is the payload of log:suppressed; it tells whether the
+// message log is paused or muted and how many messages were left out
+type LoggingStatus struct {
+	Paused     bool        `json:"paused"`
+	PausedAt   *time.Time  `json:"pausedAt,omitempty"`
+	Suppressed uint64      `json:"suppressed"` // messages left out during the current or last pause
+	Mutes      []TopicMute `json:"mutes"`
+}
+
+// logControl pauses the message log and mutes topics in it. Devices are
+// still updated from the messages left out; only the log skips them.
+type logControl struct {
+	mu         sync.Mutex
+	paused     bool
+	pausedAt   time.Time
+	suppressed uint64
+	mutes      map[string]*TopicMute // key: topic filter
+}
+
+// skip reports whether a message on topic is left out of the log, counting it
+func (c *logControl) skip(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.paused {
+		c.suppressed++
+		return true
+	}
+	for filter, mute := range c.mutes {
+		if models.MatchTopic(filter, topic) {
+			mute.Suppressed++
+			return true
+		}
+	}
+	return false
+}
+
+// active reports whether the log is paused or any topic is muted
+func (c *logControl) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused || len(c.mutes) > 0
+}
+
+// status returns the current pause and mutes
+func (c *logControl) status() LoggingStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := LoggingStatus{Paused: c.paused, Suppressed: c.suppressed, Mutes: make([]TopicMute, 0, len(c.mutes))}
+	if c.paused {
+		pausedAt := c.pausedAt
+		status.PausedAt = &pausedAt
+	}
+	for _, mute := range c.mutes {
+		status.Mutes = append(status.Mutes, *mute)
+	}
+	sort.Slice(status.Mutes, func(i, j int) bool { return status.Mutes[i].Topic < status.Mutes[j].Topic })
+	return status
+}
+
+// PauseLogging stops adding messages to the log, e.g. while a firmware
+// update floods it, counting the messages left out. Devices are still
+// updated from them.
+func (a *App) PauseLogging() error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	a.logControl.mu.Lock()
+	if a.logControl.paused {
+		a.logControl.mu.Unlock()
+		return nil
+	}
+	a.logControl.paused = true
+	a.logControl.pausedAt = time.Now()
+	a.logControl.suppressed = 0
+	a.logControl.mu.Unlock()
+
+	a.emit(events.LogSuppressed, a.logControl.status())
+	return nil
+}
+
+// ResumeLogging adds messages to the log again; the number left out while
+// paused stays in the status until the next pause
+func (a *App) ResumeLogging() error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	a.logControl.mu.Lock()
+	wasPaused := a.logControl.paused
+	a.logControl.paused = false
+	a.logControl.mu.Unlock()
+
+	if wasPaused {
+		a.emit(events.LogSuppressed, a.logControl.status())
+	}
+	return nil
+}
+
+// MuteTopic leaves messages on topics matching filter out of the log until
+// unmuted; filter levels may be "+", a final "#" or glob patterns. Mutes
+// are not saved.
+func (a *App) MuteTopic(filter string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+	if err := models.ValidateTopicPattern(filter); err != nil {
+		return err
+	}
+
+	a.logControl.mu.Lock()
+	if a.logControl.mutes == nil {
+		a.logControl.mutes = make(map[string]*TopicMute)
+	}
+	if _, exists := a.logControl.mutes[filter]; exists {
+		a.logControl.mu.Unlock()
+		return fmt.Errorf("already muted: %s", filter)
+	}
+	a.logControl.mutes[filter] = &TopicMute{Topic: filter, Added: time.Now()}
+	a.logControl.mu.Unlock()
+
+	a.emit(events.LogSuppressed, a.logControl.status())
+	return nil
+}
+
+// UnmuteTopic removes a mute added with MuteTopic
+func (a *App) UnmuteTopic(filter string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	a.logControl.mu.Lock()
+	_, exists := a.logControl.mutes[filter]
+	delete(a.logControl.mutes, filter)
+	a.logControl.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("not muted: %s", filter)
+	}
+
+	a.emit(events.LogSuppressed, a.logControl.status())
+	return nil
+}
+
+// GetLoggingStatus returns whether the log is paused, the muted topics and
+// how many messages each left out
+func (a *App) GetLoggingStatus() LoggingStatus {
+	return a.logControl.status()
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// ExportLog writes the logged messages selected by filter (every message
+// if it is empty; Limit keeps the newest) to path, oldest first, as "csv"
+// or newline-delimited "json" (from the file extension if empty), e.g. to
+// attach broker traffic to a support ticket. It returns how many messages
+// were written.
+func (a *App) ExportLog(path, format string, filter models.MessageQuery) (int, error) {
+	if err := a.kioskLocked(); err != nil {
+		return 0, err
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	format = strings.ToLower(format)
+	switch format {
+	case "csv":
+	case "json", "ndjson", "jsonl":
+		format = "json"
+	default:
+		return 0, fmt.Errorf("unsupported export format: %s (use csv or json)", format)
+	}
+	if err := filter.Compile(); err != nil {
+		return 0, err
+	}
+
+	// Queries return the newest matches first; they are written oldest first,
+	// with their whole payloads
+	selected := a.messageLog.Query(filter)
+	for i, msg := range selected {
+		selected[i] = msg.Whole()
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write message log: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	if format == "csv" {
+		err = writeMessagesCSV(w, selected)
+	} else {
+		err = writeMessagesJSON(w, selected)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write message log: %w", err)
+	}
+
+	a.audit("log_exported", "", "", "", fmt.Sprintf("path=%s format=%s messages=%d", path, format, len(selected)))
+	return len(selected), nil
+}
+
+// writeMessagesCSV writes newest-first messages as CSV, oldest first
+func writeMessagesCSV(w *bufio.Writer, messages []models.MQTTMessage) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "timestamp", "direction", "topic", "qos", "retained", "duplicate", "packet_id", "encoding", "payload", "latency_ms"})
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		latency := ""
+		if msg.LatencyMs != nil {
+			latency = strconv.FormatFloat(*msg.LatencyMs, 'f', 3, 64)
+		}
+		cw.Write([]string{
+			strconv.FormatUint(msg.ID, 10),
+			msg.Timestamp.Format(models.MessageTimeFormat),
+			string(msg.Direction),
+			msg.Topic,
+			strconv.Itoa(int(msg.QoS)),
+			strconv.FormatBool(msg.Retained),
+			strconv.FormatBool(msg.Duplicate),
+			strconv.FormatUint(uint64(msg.PacketID), 10),
+			string(msg.Encoding),
+			msg.Text(),
+			latency,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeMessagesJSON writes newest-first messages as one JSON object per
+// line, oldest first
+func writeMessagesJSON(w *bufio.Writer, messages []models.MQTTMessage) error {
+	enc := json.NewEncoder(w)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if err := enc.Encode(messages[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
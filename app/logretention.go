@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+)
+
+// logPruneInterval is how often old messages are dropped from the log
+const logPruneInterval = time.Minute
+
+// openMessageLog sizes the message log and, if it is persisted, restores
+// the newest messages from the archive, which must already be open
+func (a *App) openMessageLog(cfg *config.Config) {
+	a.messageLog.SetCapacity(cfg.LogCapacity)
+	if cfg.LogPersist {
+		if archive := a.archive.Load(); archive != nil {
+			messages, err := archive.Recent(cfg.LogCapacity)
+			if err != nil {
+				log.Printf("Message log will not be restored: %v", err)
+			} else {
+				a.messageLog.Restore(messages)
+			}
+		}
+	}
+	a.pruneMessageLog(cfg)
+}
+
+// applyLogSettings resizes the message log after the settings changed,
+// keeping the messages that still fit
+func (a *App) applyLogSettings(cfg *config.Config) {
+	a.messageLog.SetCapacity(cfg.LogCapacity)
+	a.pruneMessageLog(cfg)
+}
+
+// pruneMessageLog drops the messages older than the retention, if one is set
+func (a *App) pruneMessageLog(cfg *config.Config) int {
+	if cfg.LogRetentionMinutes == 0 {
+		return 0
+	}
+	return a.messageLog.Prune(time.Now().Add(-time.Duration(cfg.LogRetentionMinutes) * time.Minute))
+}
+
+// runLogPruner drops expired messages from the log every minute
+func (a *App) runLogPruner(ctx context.Context) {
+	ticker := time.NewTicker(logPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.pruneMessageLog(a.currentConfig())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Streaming mode pacing: log:append is emitted at most every
+// logNotifyInterval with up to logAppendBatch messages
+const (
+	logNotifyInterval = 250 * time.Millisecond
+	logAppendBatch    = 200
+)
+
+// FetchMessages returns up to limit logged messages after the given cursor,
+// oldest first. Clients in streaming mode call this to catch up when a
+// log:append batch does not continue from the last sequence number they saw.
+func (a *App) FetchMessages(cursor uint64, limit int) models.MessageBatch {
+	if a.isKiosk() {
+		return models.MessageBatch{From: cursor, Messages: []models.MQTTMessage{}, Cursor: cursor}
+	}
+
+	return a.messageLog.Fetch(cursor, limit)
+}
+
+// GetFullPayload returns the whole payload of a logged message whose payload
+// was truncated, as text or, for binary payloads, base64
+func (a *App) GetFullPayload(id uint64) (string, error) {
+	if err := a.kioskLocked(); err != nil {
+		return "", err
+	}
+
+	msg, ok := a.messageLog.Full(id)
+	if !ok {
+		return "", fmt.Errorf("message %d is no longer in the log", id)
+	}
+	if msg.Truncated {
+		return "", fmt.Errorf("the whole payload of message %d is no longer kept", id)
+	}
+	return msg.Text(), nil
+}
+
+// logMessage writes a message to the traffic log, then adds it to the log
+// and archive, its payload truncated to the payload limit, and tells the
+// frontend, unless the log filters leave out a received message, logging is
+// paused or its topic is muted. Sent commands left out of the log while it
+// is paused or muted are still archived. It returns the logged or archived
+// message's ID, or 0 if it was left out.
+func (a *App) logMessage(msg models.MQTTMessage) uint64 {
+	a.writeTraffic(msg)
+	cfg := a.currentConfig()
+	if msg.Direction == models.MessageReceived && !cfg.LogsTopic(msg.Topic) {
+		return 0
+	}
+	if a.logControl.skip(msg.Topic) {
+		if msg.Direction != models.MessageSent || a.archive.Load() == nil {
+			return 0
+		}
+		msg = a.messageLog.Stamp(msg.Truncate(cfg.LogPayloadLimit))
+		a.archiveMessage(msg)
+		return msg.ID
+	}
+	msg = a.messageLog.Add(msg.Truncate(cfg.LogPayloadLimit))
+	a.archiveMessage(msg)
+	a.publishLogMessage(msg, cfg.LogStreaming)
+	return msg.ID
+}
+
+// publishLogMessage tells the frontend about a newly logged message, either
+// directly or in a batched log:append event in streaming mode. Neither is
+// journaled: message traffic would push the state events out of the
+// journal, and clients catch up on the log with FetchMessages instead.
+func (a *App) publishLogMessage(msg models.MQTTMessage, streaming bool) {
+	if !streaming {
+		a.emitTransient(events.MessageNew, events.MessagePayload{
+			ID:        msg.ID,
+			Direction: string(msg.Direction),
+			Topic:     msg.Topic,
+			Payload:   msg.Text(),
+			Hex:       msg.Hex(),
+			Encoding:  string(msg.Encoding),
+			QoS:       msg.QoS,
+			Retained:  msg.Retained,
+			Duplicate: msg.Duplicate,
+			PacketID:  msg.PacketID,
+		})
+		return
+	}
+
+	// Non-blocking: a pending notification already covers this message
+	select {
+	case a.logNotify <- struct{}{}:
+	default:
+	}
+}
+
+// runLogNotifier sends newly logged messages in log:append batches, at a
+// bounded rate so a busy broker cannot flood the bridge. Each batch carries
+// the sequence number it continues from, so clients can spot batches they
+// missed and catch up with FetchMessages.
+func (a *App) runLogNotifier(ctx context.Context) {
+	cursor := a.messageLog.LastID()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.logNotify:
+		}
+
+		for more := true; more; {
+			batch := a.messageLog.Fetch(cursor, logAppendBatch)
+			cursor, more = batch.Cursor, batch.More
+			if len(batch.Messages) > 0 {
+				a.emitTransient(events.LogAppend, batch)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(logNotifyInterval):
+			}
+		}
+	}
+}
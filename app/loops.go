@@ -0,0 +1,139 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// automaticSources are the command sources that act on their own, as
+// opposed to an operator; only they can get caught in a command loop
+var automaticSources = map[string]bool{
+	SourcePowerCycle:    true,
+	SourceCommissioning: true,
+	SourceStatusAudit:   true,
+}
+
+// loopKey identifies a command source acting on an outlet
+type loopKey struct {
+	device, outlet, source string
+}
+
+// outletKey identifies an outlet
+type outletKey struct {
+	device, outlet string
+}
+
+// loopDetector counts the state transitions of each outlet and suspends
+// automatic sources from switching outlets that change state too often
+type loopDetector struct {
+	mu          sync.Mutex
+	transitions map[outletKey][]time.Time // within the current window
+	suspended   map[loopKey]time.Time     // until when
+}
+
+// recent drops the transitions of an outlet older than window and returns
+// the rest; the caller holds mu
+func (d *loopDetector) recent(key outletKey, now time.Time, window time.Duration) []time.Time {
+	kept := d.transitions[key][:0]
+	for _, changed := range d.transitions[key] {
+		if now.Sub(changed) < window {
+			kept = append(kept, changed)
+		}
+	}
+	if len(kept) == 0 {
+		delete(d.transitions, key)
+		return nil
+	}
+	d.transitions[key] = kept
+	return kept
+}
+
+// transition counts a reported state change of an outlet at now
+func (d *loopDetector) transition(device, outlet string, now time.Time, window time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.transitions == nil {
+		d.transitions = make(map[outletKey][]time.Time)
+	}
+	key := outletKey{device, outlet}
+	d.transitions[key] = append(d.recent(key, now, window), now)
+}
+
+// check decides on a command from a source at now. It returns the end of
+// the suspension if the source is suspended for the outlet, and whether
+// this command is the one that tripped the limit because the outlet
+// changed state more than limit times within window.
+func (d *loopDetector) check(key loopKey, now time.Time, limit int, window time.Duration) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.suspended == nil {
+		d.suspended = make(map[loopKey]time.Time)
+	}
+	if until, ok := d.suspended[key]; ok {
+		if now.Before(until) {
+			return until, false
+		}
+		delete(d.suspended, key)
+	}
+
+	if len(d.recent(outletKey{key.device, key.outlet}, now, window)) > limit {
+		until := now.Add(window)
+		d.suspended[key] = until
+		return until, true
+	}
+	return time.Time{}, false
+}
+
+// loopLimits returns the configured loop limit and window
+func loopLimits(cfg *config.Config) (int, time.Duration) {
+	limit := cfg.LoopMaxCommands
+	if limit <= 0 {
+		limit = config.DefaultLoopMaxCommands
+	}
+	window := time.Duration(cfg.LoopWindow) * time.Second
+	if window <= 0 {
+		window = config.DefaultLoopWindow * time.Second
+	}
+	return limit, window
+}
+
+// observeTransition counts an outlet's reported state change for loop
+// detection
+func (a *App) observeTransition(deviceName, outletNumber string, now time.Time) {
+	_, window := loopLimits(a.currentConfig())
+	a.loops.transition(deviceName, outletNumber, now, window)
+}
+
+// checkLoop refuses a command from an automatic source to an outlet caught
+// in a loop, one that keeps changing state, raising an alert naming the
+// source when the loop is first detected
+func (a *App) checkLoop(deviceName, outletNumber, source string) error {
+	if !automaticSources[source] {
+		return nil
+	}
+
+	limit, window := loopLimits(a.currentConfig())
+	until, tripped := a.loops.check(loopKey{deviceName, outletNumber, source}, time.Now(), limit, window)
+	if until.IsZero() {
+		return nil
+	}
+
+	if tripped {
+		a.raiseAlert(models.Alert{
+			Severity:     models.SeverityWarning,
+			Source:       "loop",
+			DeviceName:   deviceName,
+			OutletNumber: outletNumber,
+			Message: fmt.Sprintf("command loop: the outlet changed state more than %d times in %s; %s is blocked from switching it until %s",
+				limit, window, source, until.Format("15:04:05")),
+		})
+	}
+	return fmt.Errorf("%s is blocked from switching outlet %s/%s until %s: command loop detected",
+		source, deviceName, outletNumber, until.Format("15:04:05"))
+}
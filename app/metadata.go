@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// SetOutletMetadata replaces an outlet's tags, notes and location. They are
+// kept in the inventory, apart from the reported state, and a location set
+// here overrides the location rules; an empty location hands the outlet back
+// to them.
+func (a *App) SetOutletMetadata(deviceName, outletNumber string, tags []string, notes, location string) (models.OutletMetadata, error) {
+	if err := a.kioskLocked(); err != nil {
+		return models.OutletMetadata{}, err
+	}
+
+	if deviceName == "" || outletNumber == "" {
+		return models.OutletMetadata{}, fmt.Errorf("device and outlet are required")
+	}
+	notes = strings.TrimSpace(notes)
+	if len(notes) > models.MaxNotesLength {
+		return models.OutletMetadata{}, fmt.Errorf("notes must be at most %d characters", models.MaxNotesLength)
+	}
+
+	metadata, ok := a.inventory.Get(deviceName, outletNumber)
+	if !ok {
+		metadata = models.OutletMetadata{DeviceName: deviceName, OutletNumber: outletNumber}
+	}
+	metadata.Tags = models.NormalizeTags(tags)
+	metadata.Notes = notes
+	metadata.Location = strings.TrimSpace(location)
+	if err := a.inventory.Put(metadata); err != nil {
+		return models.OutletMetadata{}, fmt.Errorf("failed to save inventory: %w", err)
+	}
+	metadata, _ = a.inventory.Get(deviceName, outletNumber)
+
+	a.applyOutletDetails(metadata)
+	a.audit("metadata_changed", "", deviceName, outletNumber, fmt.Sprintf("tags=%s location=%s notes=%d chars",
+		strings.Join(metadata.Tags, ","), metadata.Location, len(metadata.Notes)))
+	return metadata, nil
+}
+
+// ListTags returns every tag used on an outlet, sorted
+func (a *App) ListTags() []string {
+	seen := make(map[string]bool)
+	tags := make([]string, 0)
+	for _, metadata := range a.GetInventory() {
+		for _, tag := range metadata.Tags {
+			if !seen[strings.ToLower(tag)] {
+				seen[strings.ToLower(tag)] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i]) < strings.ToLower(tags[j]) })
+	return tags
+}
+
+// loadOutletDetails applies the tags, notes and locations in the inventory
+// to the device store
+func (a *App) loadOutletDetails() {
+	for _, metadata := range a.inventory.GetAll() {
+		a.applyOutletDetails(metadata)
+	}
+}
+
+// applyOutletDetails applies an outlet's tags, notes and location to the
+// device store and notifies the frontend if the outlet is known
+func (a *App) applyOutletDetails(metadata models.OutletMetadata) {
+	details := models.OutletDetails{Tags: metadata.Tags, Notes: metadata.Notes, Location: metadata.Location}
+	if device, changed := a.deviceStore.SetDetails(metadata.DeviceName, metadata.OutletNumber, details); changed {
+		a.emit(events.DeviceUpdate, device)
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// ConnectionSettings are broker settings entered in the setup dialog
+type ConnectionSettings struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Server   string `json:"mqttServer"`
+	Port     int    `json:"serverPort"`
+}
+
+// TestConnection attempts a short-lived connection with the given settings
+// without disturbing the active connection, reporting why it failed if it did
+func (a *App) TestConnection(settings ConnectionSettings) mqtt.ProbeResult {
+	if a.isKiosk() {
+		return mqtt.ProbeResult{Message: errKiosk.Error()}
+	}
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return mqtt.Probe(ctx, mqtt.ProbeOptions{
+		Server:   settings.Server,
+		Port:     settings.Port,
+		Username: settings.Username,
+		Password: settings.Password,
+		Timeout:  time.Duration(a.currentConfig().ConnectTimeout) * time.Second,
+	})
+}
+
+// RotateCredentials switches to a new broker username and password. The new
+// credentials are tried with a test connection first, so a typo is reported
+// instead of being saved and locking the app out of the broker.
+func (a *App) RotateCredentials(newUsername, newPassword string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+	if a.IsConfigEmpty() {
+		return fmt.Errorf("broker settings are not configured")
+	}
+	if newUsername == "" {
+		return fmt.Errorf("username is required")
+	}
+
+	cfg := a.currentConfig()
+	result := a.TestConnection(ConnectionSettings{
+		Username: newUsername,
+		Password: newPassword,
+		Server:   cfg.MQTTServer,
+		Port:     cfg.ServerPort,
+	})
+	if !result.Success {
+		return fmt.Errorf("new credentials were not accepted: %s", result.Message)
+	}
+
+	err := a.updateConfig(func(cfg *config.Config) error {
+		cfg.Username = newUsername
+		return cfg.SetPassword(newPassword)
+	})
+	if err != nil {
+		return err
+	}
+	a.audit("credentials_rotated", "", "", "", "username="+newUsername)
+
+	// Swap the live connection; the broker and device list stay the same
+	if a.mqttClient.State() == mqtt.StateDisconnected {
+		return nil
+	}
+	a.disconnectMQTT()
+	if err := a.connectMQTT(); err != nil {
+		return fmt.Errorf("credentials saved but reconnect failed: %w", err)
+	}
+	return nil
+}
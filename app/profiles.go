@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// ProfileInfo describes a saved profile without its password
+type ProfileInfo struct {
+	Name            string `json:"name"`
+	Username        string `json:"username"`
+	MQTTServer      string `json:"mqttServer"`
+	ServerPort      int    `json:"serverPort"`
+	SubscribeString string `json:"subscribeString"`
+}
+
+// ProfileSnapshot is a read-only view of another profile's devices
+type ProfileSnapshot struct {
+	Profile     string                `json:"profile"`
+	Devices     []models.DeviceOutlet `json:"devices"`
+	Summary     models.Summary        `json:"summary"`
+	CollectedAt time.Time             `json:"collectedAt"`
+}
+
+// ListProfiles returns the saved profiles
+func (a *App) ListProfiles() []ProfileInfo {
+	if a.isKiosk() {
+		return []ProfileInfo{}
+	}
+
+	profiles := a.currentConfig().Profiles
+	infos := make([]ProfileInfo, 0, len(profiles))
+	for _, profile := range profiles {
+		infos = append(infos, ProfileInfo{
+			Name:            profile.Name,
+			Username:        profile.Username,
+			MQTTServer:      profile.MQTTServer,
+			ServerPort:      profile.ServerPort,
+			SubscribeString: profile.SubscribeString,
+		})
+	}
+	return infos
+}
+
+// SaveProfile adds or replaces a saved profile
+func (a *App) SaveProfile(name, username, password, server string, port int, subscribeString string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if subscribeString == "" {
+		subscribeString = "power/#"
+	}
+
+	profile := config.Profile{
+		Name:            name,
+		Username:        username,
+		MQTTServer:      server,
+		ServerPort:      port,
+		SubscribeString: subscribeString,
+	}
+	if err := profile.SetPassword(password); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		profiles := make([]config.Profile, 0, len(cfg.Profiles)+1)
+		for _, existing := range cfg.Profiles {
+			if existing.Name != name {
+				profiles = append(profiles, existing)
+			}
+		}
+		cfg.Profiles = append(profiles, profile)
+		return nil
+	})
+}
+
+// DeleteProfile removes a saved profile
+func (a *App) DeleteProfile(name string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	var deleted config.Profile
+	err := a.updateConfig(func(cfg *config.Config) error {
+		profiles := make([]config.Profile, 0, len(cfg.Profiles))
+		for _, existing := range cfg.Profiles {
+			if existing.Name != name {
+				profiles = append(profiles, existing)
+			} else {
+				deleted = existing
+			}
+		}
+		if len(profiles) == len(cfg.Profiles) {
+			return fmt.Errorf("profile not found: %s", name)
+		}
+		cfg.Profiles = profiles
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	deleted.DeletePassword()
+	return nil
+}
+
+// PeekProfile opens a short-lived, read-only connection to another profile's
+// broker and returns the devices it sees within the given number of seconds,
+// without touching the active connection or device list
+func (a *App) PeekProfile(name string, seconds int) (ProfileSnapshot, error) {
+	if err := a.kioskLocked(); err != nil {
+		return ProfileSnapshot{}, err
+	}
+
+	profile, ok := a.currentConfig().FindProfile(name)
+	if !ok {
+		return ProfileSnapshot{}, fmt.Errorf("profile not found: %s", name)
+	}
+
+	password, err := profile.GetPassword()
+	if err != nil {
+		return ProfileSnapshot{}, err
+	}
+
+	if seconds <= 0 || seconds > 30 {
+		seconds = 3
+	}
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	store := models.NewDeviceStore()
+	err = mqtt.Collect(ctx, mqtt.ProbeOptions{
+		Server:   profile.MQTTServer,
+		Port:     profile.ServerPort,
+		Username: profile.Username,
+		Password: password,
+		Timeout:  time.Duration(a.currentConfig().ConnectTimeout) * time.Second,
+	}, profile.SubscribeString, time.Duration(seconds)*time.Second, func(topic string, payload []byte, _ mqtt.MessageFlags) {
+		states, err := a.parseStates(topic, string(payload))
+		if err != nil {
+			return
+		}
+		for _, state := range states {
+			if state.Status == "" {
+				continue // Telemetry only
+			}
+			store.Add(models.DeviceOutlet{
+				DeviceName:   state.Device,
+				OutletNumber: state.Outlet,
+				Status:       state.Status,
+			})
+		}
+	})
+	if err != nil {
+		return ProfileSnapshot{}, fmt.Errorf("failed to read profile %s: %w", name, err)
+	}
+
+	return ProfileSnapshot{
+		Profile:     name,
+		Devices:     store.GetAll(),
+		Summary:     store.Summary(),
+		CollectedAt: time.Now(),
+	}, nil
+}
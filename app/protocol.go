@@ -0,0 +1,353 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// deviceProtocols remembers which protocol each device reported through,
+// so commands go back out in the same dialect
+type deviceProtocols struct {
+	mu        sync.RWMutex
+	protocols map[string]string // key: device name
+}
+
+// set records the protocol a device uses
+func (d *deviceProtocols) set(device, protocol string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.protocols == nil {
+		d.protocols = make(map[string]string)
+	}
+	d.protocols[device] = protocol
+}
+
+// get returns the protocol a device uses
+func (d *deviceProtocols) get(device string) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	protocol, ok := d.protocols[device]
+	return protocol, ok
+}
+
+// protocolCache holds the adapters and payload extractors built from a
+// config, so they are not rebuilt for every message
+type protocolCache struct {
+	adapters   map[string]mqtt.ProtocolAdapter // key: configured protocol name
+	extractors []payloadExtractor
+}
+
+// payloadExtractor is a configured extractor with its compiled path; path
+// is nil if the expression does not compile
+type payloadExtractor struct {
+	topic string
+	path  *mqtt.JSONPath
+}
+
+// buildProtocols builds the adapters of the protocols cfg names, and of the
+// default one, and compiles its payload extractors
+func (a *App) buildProtocols(cfg *config.Config) *protocolCache {
+	cache := &protocolCache{adapters: make(map[string]mqtt.ProtocolAdapter)}
+	names := []string{mqtt.DefaultProtocol, cfg.Protocol}
+	for _, sub := range cfg.ProtocolSubscriptions {
+		names = append(names, sub.Protocol)
+	}
+	for _, name := range names {
+		if _, built := cache.adapters[name]; !built {
+			cache.adapters[name] = a.buildAdapter(name)
+		}
+	}
+
+	for _, extractor := range cfg.PayloadExtractors {
+		path, _ := mqtt.CompileJSONPath(extractor.Path)
+		cache.extractors = append(cache.extractors, payloadExtractor{topic: extractor.Topic, path: path})
+	}
+	return cache
+}
+
+// currentProtocols returns the adapters and extractors of the running
+// config, building them from the defaults before a config is set
+func (a *App) currentProtocols() *protocolCache {
+	if cache := a.protocols.Load(); cache != nil {
+		return cache
+	}
+	return a.buildProtocols(a.currentConfig())
+}
+
+// adapter returns the named protocol adapter, built with the configured
+// topic templates and payload extractors. Unknown names (reported once by
+// checkProtocols) get the default protocol's adapter.
+func (a *App) adapter(name string) mqtt.ProtocolAdapter {
+	if adapter, ok := a.currentProtocols().adapters[name]; ok {
+		return adapter
+	}
+	return a.buildAdapter(name) // e.g. a device's protocol no longer configured
+}
+
+// buildAdapter builds the named protocol adapter, falling back to the
+// default protocol for unknown names
+func (a *App) buildAdapter(name string) mqtt.ProtocolAdapter {
+	opts := mqtt.AdapterOptions{
+		Schema:        a.topicSchema(),
+		PayloadParser: a.parsePayload,
+		Payloads:      a.payloadMapping,
+		Bank:          a.bankFor,
+	}
+
+	adapter, err := mqtt.NewAdapter(name, opts)
+	if err != nil {
+		adapter, _ = mqtt.NewAdapter(mqtt.DefaultProtocol, opts)
+	}
+	return adapter
+}
+
+// bankFor returns the bank an outlet last reported from
+func (a *App) bankFor(device, outlet string) string {
+	deviceOutlet, _ := a.deviceStore.Get(device, outlet)
+	return deviceOutlet.Bank
+}
+
+// checkProtocols logs the configured protocol if it has no adapter;
+// protocol subscriptions are checked by config validation
+func (a *App) checkProtocols() {
+	if _, err := mqtt.NewAdapter(a.currentConfig().Protocol, mqtt.AdapterOptions{}); err != nil {
+		log.Printf("%v, using %s instead", err, mqtt.DefaultProtocol)
+	}
+}
+
+// protocolFor returns the protocol handling a topic: the first protocol
+// subscription whose filter and adapter match, else the configured protocol
+func (a *App) protocolFor(topic string) string {
+	cfg := a.currentConfig()
+	for _, sub := range cfg.ProtocolSubscriptions {
+		if mqtt.TopicMatches(sub.Topic, topic) && a.adapter(sub.Protocol).MatchTopic(topic) {
+			return sub.Protocol
+		}
+	}
+	return cfg.Protocol
+}
+
+// parseStates extracts outlet states from a message using the relay board
+// splitter or the adapter for its topic
+func (a *App) parseStates(topic, payload string) ([]mqtt.OutletState, error) {
+	protocol := a.protocolFor(topic)
+	var states []mqtt.OutletState
+	var err error
+	if board, ok := a.relayBoardFor(topic); ok {
+		states, err = board.Split(topic, payload)
+	} else {
+		states, err = a.adapter(protocol).ParseState(topic, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, state := range states {
+		a.devices.set(state.Device, protocol)
+		states[i].Outlet = a.quirkFor(state.Device).FromDevice(state.Outlet)
+	}
+	return states, nil
+}
+
+// relayBoardFor returns the splitter of the first relay board whose topic
+// filter matches
+func (a *App) relayBoardFor(topic string) (mqtt.BitmaskSplitter, bool) {
+	for _, board := range a.currentConfig().RelayBoards {
+		splitter := mqtt.BitmaskSplitter{
+			Topic:    board.Topic,
+			Device:   board.Device,
+			Channels: board.Channels,
+			LSBFirst: board.LSBFirst,
+		}
+		if splitter.Match(topic) {
+			return splitter, true
+		}
+	}
+	return mqtt.BitmaskSplitter{}, false
+}
+
+// parsePayload extracts the status value using the first payload extractor
+// whose topic filter matches, falling back to the payload itself
+func (a *App) parsePayload(topic, payload string) string {
+	for _, extractor := range a.currentProtocols().extractors {
+		if !mqtt.TopicMatches(extractor.topic, topic) {
+			continue
+		}
+
+		if extractor.path != nil {
+			if status, err := extractor.path.Extract(payload); err == nil {
+				return status
+			}
+		}
+		break // Only the first matching extractor applies
+	}
+	return payload
+}
+
+// payloadMapping returns the ON/OFF payloads configured for a device
+func (a *App) payloadMapping(device string) mqtt.PayloadMapping {
+	mapping, ok := a.currentConfig().PayloadMappingFor(device)
+	if !ok {
+		if quirk := a.quirkFor(device); len(quirk.On) > 0 {
+			return mqtt.PayloadMapping{On: quirk.On, Off: quirk.Off, CaseSensitive: quirk.CaseSensitive}
+		}
+		return mqtt.DefaultPayloadMapping
+	}
+	return mqtt.PayloadMapping{On: mapping.On, Off: mapping.Off, CaseSensitive: mapping.CaseSensitive}
+}
+
+// SetLocationRules replaces the topic-to-location rules; outlets pick up
+// their new location with their next message
+func (a *App) SetLocationRules(rules []config.LocationRule) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.LocationRules = rules
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetRelayBoards replaces the relay boards whose bitmask payloads are split
+// into per-channel updates
+func (a *App) SetRelayBoards(boards []config.RelayBoard) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.RelayBoards = boards
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetPayloadExtractor sets the JSON extraction expression for a topic
+// filter; an empty path removes it
+func (a *App) SetPayloadExtractor(topicFilter, path string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := mqtt.ValidateTopicFilter(topicFilter); err != nil {
+		return err
+	}
+	if path != "" {
+		if _, err := mqtt.CompileJSONPath(path); err != nil {
+			return err
+		}
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		extractors := make([]config.PayloadExtractor, 0, len(cfg.PayloadExtractors)+1)
+		replaced := false
+		for _, extractor := range cfg.PayloadExtractors {
+			if extractor.Topic == topicFilter {
+				if path != "" && !replaced {
+					extractors = append(extractors, config.PayloadExtractor{Topic: topicFilter, Path: path})
+					replaced = true
+				}
+				continue
+			}
+			extractors = append(extractors, extractor)
+		}
+		if path != "" && !replaced {
+			extractors = append(extractors, config.PayloadExtractor{Topic: topicFilter, Path: path})
+		}
+		cfg.PayloadExtractors = extractors
+		return nil
+	})
+}
+
+// protocolOf returns the protocol a device reported through, or the
+// configured protocol for devices not heard from yet
+func (a *App) protocolOf(device string) string {
+	if protocol, ok := a.devices.get(device); ok {
+		return protocol
+	}
+	return a.currentConfig().Protocol
+}
+
+// buildCommand returns the command topic and payload in the protocol the
+// device reported through
+func (a *App) buildCommand(device, outlet, state string) (topic string, payload string, err error) {
+	return a.adapter(a.protocolOf(device)).BuildCommand(device, a.quirkFor(device).ToDevice(outlet), state)
+}
+
+// ListProtocols returns the names of the available protocol adapters
+func (a *App) ListProtocols() []string {
+	return mqtt.Protocols()
+}
+
+// SetProtocolSubscription subscribes to a topic filter handled by the given
+// protocol; an empty protocol removes the subscription
+func (a *App) SetProtocolSubscription(topicFilter, protocol string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := mqtt.ValidateTopicFilter(topicFilter); err != nil {
+		return err
+	}
+	if protocol != "" {
+		if _, err := mqtt.NewAdapter(protocol, mqtt.AdapterOptions{}); err != nil {
+			return err
+		}
+	}
+
+	existed := false
+	err := a.updateConfig(func(cfg *config.Config) error {
+		subs := make([]config.ProtocolSubscription, 0, len(cfg.ProtocolSubscriptions)+1)
+		for _, sub := range cfg.ProtocolSubscriptions {
+			if sub.Topic == topicFilter {
+				existed = true
+				continue
+			}
+			subs = append(subs, sub)
+		}
+		if protocol != "" {
+			subs = append(subs, config.ProtocolSubscription{Topic: topicFilter, Protocol: protocol})
+		}
+		cfg.ProtocolSubscriptions = subs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !a.mqttClient.IsConnected() {
+		return nil
+	}
+	if protocol != "" && !existed {
+		return a.mqttClient.Subscribe(topicFilter)
+	}
+	if protocol == "" && existed {
+		return a.mqttClient.Unsubscribe(topicFilter)
+	}
+	return nil
+}
+
+// SetPayloadMappings replaces the ON/OFF payload mappings
+func (a *App) SetPayloadMappings(mappings []config.PayloadMapping) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.PayloadMappings = mappings
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		return nil
+	})
+}
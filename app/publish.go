@@ -0,0 +1,36 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// PublishPayload publishes a raw message, for devices that take binary
+// commands. format is "text", "hex" or "base64" and says how payload is
+// written; the decoded bytes are sent as-is.
+func (a *App) PublishPayload(topic, payload, format string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("invalid publish topic: %q", topic)
+	}
+
+	data, err := models.DecodePayload(payload, format)
+	if err != nil {
+		return err
+	}
+	if err := a.mqttClient.PublishBytes(topic, data); err != nil {
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+
+	// Log the sent message and notify the frontend
+	a.logMessage(models.MQTTMessage{Direction: models.MessageSent, Topic: topic, Payload: data})
+	return nil
+}
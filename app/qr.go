@@ -0,0 +1,73 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/labels"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// qrHistoryLimit is the number of timeline entries returned with a lookup
+const qrHistoryLimit = 20
+
+// OutletLookup is the outlet behind a scanned QR code
+type OutletLookup struct {
+	DeviceName   string                 `json:"deviceName"`
+	OutletNumber string                 `json:"outletNumber"`
+	Known        bool                   `json:"known"` // the outlet has reported since startup
+	Outlet       models.DeviceOutlet    `json:"outlet"`
+	Metadata     *models.OutletMetadata `json:"metadata,omitempty"`
+	History      []models.TimelineEntry `json:"history"` // newest first
+}
+
+// ResolveQR maps the content of a scanned label, either a
+// powercontrol://outlet/<device>/<outlet> link or a "<device>/<outlet>" or
+// "<device>:<outlet>" token, to the outlet record and its recent history
+func (a *App) ResolveQR(content string) (OutletLookup, error) {
+	deviceName, outletNumber, err := parseQRContent(content)
+	if err != nil {
+		return OutletLookup{}, err
+	}
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return OutletLookup{}, err
+	}
+
+	lookup := OutletLookup{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		History:      make([]models.TimelineEntry, 0),
+	}
+	lookup.Outlet, lookup.Known = a.deviceStore.Get(deviceName, outletNumber)
+	if metadata, ok := a.inventory.Get(deviceName, outletNumber); ok {
+		lookup.Metadata = &metadata
+	}
+	if !lookup.Known && lookup.Metadata == nil {
+		return OutletLookup{}, fmt.Errorf("unknown outlet %s/%s", deviceName, outletNumber)
+	}
+
+	// Entries for the outlet itself and for its whole device, such as
+	// availability alerts
+	entries := a.timeline.Recent()
+	for i := len(entries) - 1; i >= 0 && len(lookup.History) < qrHistoryLimit; i-- {
+		entry := entries[i]
+		if entry.DeviceName == deviceName && (entry.OutletNumber == outletNumber || entry.OutletNumber == "") {
+			lookup.History = append(lookup.History, entry)
+		}
+	}
+	return lookup, nil
+}
+
+// parseQRContent extracts the device and outlet from scanned content
+func parseQRContent(content string) (string, string, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, labels.Scheme+":") {
+		return labels.ParseDeepLink(content)
+	}
+
+	// Outlet numbers never contain separators, device names might
+	if i := strings.LastIndexAny(content, "/:"); i > 0 && i < len(content)-1 {
+		return content[:i], content[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unrecognized QR content: %q", content)
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/quirks"
+)
+
+// quirksDir is the directory, below the config directory, holding quirk
+// files that add to or replace the built-in quirks
+const quirksDir = "quirks"
+
+// ListQuirks returns the quirks that can be assigned to devices
+func (a *App) ListQuirks() []quirks.Quirk {
+	return a.quirks.All()
+}
+
+// ReloadQuirks reads the quirk files again, so updated definitions apply
+// without a restart. Files that cannot be used are skipped and reported.
+func (a *App) ReloadQuirks() error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	err := a.loadQuirks()
+	a.checkQuirks()
+	return err
+}
+
+// SetDeviceQuirks replaces the quirk assignments; every quirk named must
+// be in the library
+func (a *App) SetDeviceQuirks(assignments []config.QuirkAssignment) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	for _, assignment := range assignments {
+		if _, unknown := a.quirks.Resolve(assignment.Quirks); len(unknown) > 0 {
+			return fmt.Errorf("unknown quirks: %s", strings.Join(unknown, ", "))
+		}
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		cfg.DeviceQuirks = assignments
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		return nil
+	})
+}
+
+// loadQuirks loads the built-in quirks and the quirk files
+func (a *App) loadQuirks() error {
+	dir, err := config.DataPath(quirksDir)
+	if err != nil {
+		return a.quirks.Load("")
+	}
+	return a.quirks.Load(dir)
+}
+
+// checkQuirks logs assigned quirks that are not in the library
+func (a *App) checkQuirks() {
+	for _, assignment := range a.currentConfig().DeviceQuirks {
+		if _, unknown := a.quirks.Resolve(assignment.Quirks); len(unknown) > 0 {
+			log.Printf("Unknown quirks %s are ignored", strings.Join(unknown, ", "))
+		}
+	}
+}
+
+// quirkFor returns the merged quirks assigned to a device; unknown quirk
+// names are ignored (reported by checkQuirks)
+func (a *App) quirkFor(device string) quirks.Quirk {
+	names := a.currentConfig().QuirksFor(device)
+	if len(names) == 0 {
+		return quirks.Quirk{}
+	}
+	quirk, _ := a.quirks.Resolve(names)
+	return quirk
+}
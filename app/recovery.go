@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// RecoveryDecrypt is the recovery kind used when the stored password cannot
+// be decrypted on this machine (e.g. the config was copied from elsewhere)
+const RecoveryDecrypt = "decrypt"
+
+// RecoveryState describes a config problem that needs the user's attention
+type RecoveryState struct {
+	Needed          bool   `json:"needed"`
+	Kind            string `json:"kind"` // read, parse, invalid or decrypt
+	Reason          string `json:"reason"`
+	BrokenPath      string `json:"brokenPath,omitempty"` // copy of the unusable file
+	BackupAvailable bool   `json:"backupAvailable"`
+}
+
+// recovery tracks an in-progress config recovery
+type recovery struct {
+	mu    sync.Mutex
+	state RecoveryState
+	base  *config.Config // salvageable settings to keep when re-entering credentials
+}
+
+// beginRecovery preserves the broken config and asks the frontend to recover
+func (a *App) beginRecovery(kind string, reason error, base *config.Config) {
+	brokenPath, err := config.PreserveBroken()
+	if err != nil {
+		log.Printf("Failed to preserve broken config: %v", err)
+	}
+
+	a.recovery.mu.Lock()
+	a.recovery.state = RecoveryState{
+		Needed:          true,
+		Kind:            kind,
+		Reason:          reason.Error(),
+		BrokenPath:      brokenPath,
+		BackupAvailable: config.HasBackup(),
+	}
+	a.recovery.base = base
+	state := a.recovery.state
+	a.recovery.mu.Unlock()
+
+	a.emit(events.ConfigRecoveryNeeded, state)
+}
+
+// GetRecoveryState returns the current config recovery state
+func (a *App) GetRecoveryState() RecoveryState {
+	a.recovery.mu.Lock()
+	defer a.recovery.mu.Unlock()
+	return a.recovery.state
+}
+
+// RetryConfigLoad reloads the config file, e.g. after the user fixed it by hand
+func (a *App) RetryConfigLoad() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.GetPassword(); err != nil {
+		return err
+	}
+
+	return a.finishRecovery(cfg, "retry")
+}
+
+// RestoreConfigBackup replaces the config with the last known good backup
+func (a *App) RestoreConfigBackup() error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	cfg, err := config.RestoreBackup()
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.GetPassword(); err != nil {
+		return fmt.Errorf("backup password cannot be decrypted either: %w", err)
+	}
+
+	return a.finishRecovery(cfg, "restore_backup")
+}
+
+// ReenterCredentials saves new broker credentials, keeping whatever other
+// settings could be salvaged from the broken config
+func (a *App) ReenterCredentials(username, password string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	a.recovery.mu.Lock()
+	cfg := config.DefaultConfig()
+	if a.recovery.base != nil {
+		salvaged := *a.recovery.base
+		cfg = &salvaged
+	}
+	a.recovery.mu.Unlock()
+
+	cfg.Username = username
+	if err := cfg.SetPassword(password); err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return a.finishRecovery(cfg, "reenter_credentials")
+}
+
+// finishRecovery activates a recovered config and reconnects
+func (a *App) finishRecovery(cfg *config.Config, method string) error {
+	a.configMu.Lock()
+	a.setConfig(cfg)
+	a.throttle.setRates(cfg.EventThrottle)
+	a.configMu.Unlock()
+
+	a.recovery.mu.Lock()
+	a.recovery.state = RecoveryState{}
+	a.recovery.base = nil
+	a.recovery.mu.Unlock()
+
+	a.audit("config_recovered", "", "", "", "method="+method)
+	a.emit(events.ConfigRecovered, method)
+
+	if cfg.IsEmpty() {
+		return nil
+	}
+
+	a.disconnectMQTT()
+	if err := a.connectMQTT(); err != nil {
+		return fmt.Errorf("config recovered but failed to connect: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// replicaEnvelope is an event received from the primary
+type replicaEnvelope struct {
+	Name string          `json:"name"`
+	Data json.RawMessage `json:"data"`
+}
+
+// IsReplica reports whether this instance mirrors a primary instead of
+// connecting to the broker
+func (a *App) IsReplica() bool {
+	return a.currentConfig().ReplicaOf != ""
+}
+
+// runReplica keeps the device list in sync with the primary, reconnecting
+// with backoff until ctx is cancelled
+func (a *App) runReplica(ctx context.Context) {
+	cfg := a.currentConfig()
+	backoff := mqtt.Backoff{
+		Initial: time.Duration(cfg.ReconnectInitialDelay) * time.Second,
+		Max:     time.Duration(cfg.MaxReconnectInterval) * time.Second,
+	}
+
+	for attempt := 1; ctx.Err() == nil; attempt++ {
+		err := a.syncReplica(ctx, cfg.ReplicaOf, cfg.ReplicaToken)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			attempt = 0 // The stream ran; start the backoff over
+		} else {
+			log.Printf("Replica sync failed: %v", err)
+		}
+		a.emit(events.ConnectionStatus, false)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff.Delay(attempt + 1)):
+		}
+	}
+}
+
+// syncReplica loads the primary's device list and then applies its events
+// until the stream ends
+func (a *App) syncReplica(ctx context.Context, primary, token string) error {
+	base, err := url.Parse(strings.TrimSuffix(primary, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid primary address: %w", err)
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	// Subscribe before loading the snapshot so no update falls in between
+	wsURL := *base
+	wsURL.Scheme = map[string]string{"https": "wss"}[base.Scheme]
+	if wsURL.Scheme == "" {
+		wsURL.Scheme = "ws"
+	}
+	wsURL.Path += "/api/events"
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL.String(), header)
+	if err != nil {
+		return fmt.Errorf("failed to open event stream: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	devices, err := fetchDevices(ctx, base.String()+"/api/devices", header)
+	if err != nil {
+		return err
+	}
+
+	a.deviceStore.Clear()
+	for _, device := range devices {
+		a.deviceStore.Add(device)
+		a.emit(events.DeviceUpdate, device)
+	}
+	a.emit(events.ConnectionStatus, true)
+
+	for {
+		var env replicaEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			return fmt.Errorf("event stream closed: %w", err)
+		}
+
+		switch env.Name {
+		case events.DeviceUpdate:
+			var device models.DeviceOutlet
+			if err := json.Unmarshal(env.Data, &device); err != nil {
+				continue
+			}
+			a.deviceStore.Add(device)
+			a.emit(events.DeviceUpdate, device)
+		case events.AlertRaised:
+			var alert models.Alert
+			if err := json.Unmarshal(env.Data, &alert); err == nil {
+				a.emit(events.AlertRaised, alert)
+			}
+		}
+	}
+}
+
+// fetchDevices loads the device list from the primary
+func fetchDevices(ctx context.Context, endpoint string, header http.Header) ([]models.DeviceOutlet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load devices from primary: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("primary returned %s", resp.Status)
+	}
+
+	var devices []models.DeviceOutlet
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, fmt.Errorf("invalid device list from primary: %w", err)
+	}
+	return devices, nil
+}
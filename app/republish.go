@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+)
+
+// normalizedState is the payload of the normalized state feed
+type normalizedState struct {
+	Device    string    `json:"device"`
+	Outlet    string    `json:"outlet"`
+	State     string    `json:"state"`  // ON, OFF or the raw status
+	Online    bool      `json:"online"` // false when the outlet reports an unknown status
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// canonicalName lowercases a name and replaces characters that are awkward
+// in topics so every vendor's naming lands in the same shape
+func canonicalName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '/', '+', '#', ':':
+			return '-'
+		}
+		return r
+	}, name)
+	return name
+}
+
+// canonicalOutlet strips leading zeros so "01" and "1" are the same outlet
+func canonicalOutlet(outlet string) string {
+	trimmed := strings.TrimLeft(strings.TrimSpace(outlet), "0")
+	if trimmed == "" && outlet != "" {
+		return "0"
+	}
+	return canonicalName(trimmed)
+}
+
+// republishState queues an outlet's normalized state for republishing when
+// the normalized feed is enabled
+func (a *App) republishState(device, outlet, status string) {
+	if !a.currentConfig().RepublishState {
+		return
+	}
+
+	state := normalizedState{
+		Device:    canonicalName(device),
+		Outlet:    canonicalOutlet(outlet),
+		State:     status,
+		Online:    status == "ON" || status == "OFF",
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case a.republishQueue <- state:
+	default:
+		log.Printf("Republish queue full, dropping state of %s/%s", state.Device, state.Outlet)
+	}
+}
+
+// runRepublisher publishes queued states in order, since publishing from the
+// message handler would block it and separate goroutines could reorder updates
+func (a *App) runRepublisher(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case state := <-a.republishQueue:
+			if !a.mqttClient.IsConnected() {
+				continue
+			}
+
+			data, err := json.Marshal(state)
+			if err != nil {
+				log.Printf("Failed to encode normalized state: %v", err)
+				continue
+			}
+
+			topic := a.currentConfig().RepublishRoot() + "/state/" + state.Device + "/" + state.Outlet
+			if err := a.mqttClient.PublishRetained(topic, string(data)); err != nil {
+				log.Printf("Failed to republish state to %s: %v", topic, err)
+			}
+		}
+	}
+}
+
+// announceAvailability publishes whether this instance is online
+func (a *App) announceAvailability(online bool) {
+	cfg := a.currentConfig()
+	if !cfg.RepublishState || !a.mqttClient.IsConnected() {
+		return
+	}
+
+	payload := "offline"
+	if online {
+		payload = "online"
+	}
+	if err := a.mqttClient.PublishRetained(cfg.AvailabilityTopic(), payload); err != nil {
+		log.Printf("Failed to announce availability: %v", err)
+	}
+}
+
+// disconnectMQTT announces that this instance is going offline and
+// disconnects; the broker only sends the last will on unexpected drops
+func (a *App) disconnectMQTT() {
+	a.announceAvailability(false)
+	a.mqttClient.Disconnect()
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// reservationInterval is how often reservations are started and expired
+const reservationInterval = 15 * time.Second
+
+// sessionOperator returns the operator of the elevated session, the only
+// identity reservations are made, released and honoured for. A named
+// operator must be that operator.
+func (a *App) sessionOperator(operator string) (string, error) {
+	session := a.GetElevation()
+	if !session.Active || strings.TrimSpace(session.Operator) == "" {
+		return "", fmt.Errorf("reservations need an elevated session with an operator name")
+	}
+	if operator = strings.TrimSpace(operator); operator != "" && !strings.EqualFold(operator, session.Operator) {
+		return "", fmt.Errorf("%s is not the operator of the elevated session", operator)
+	}
+	return session.Operator, nil
+}
+
+// checkReservation returns an error if an outlet is reserved by someone
+// other than operator, or operator is not the elevated session's operator
+func (a *App) checkReservation(deviceName, outletNumber, operator string) error {
+	reservation, ok := a.reservations.Active(deviceName, outletNumber, time.Now())
+	if !ok {
+		return nil
+	}
+	if holder, err := a.sessionOperator(operator); err == nil && operator != "" && reservation.HeldBy(holder) {
+		return nil
+	}
+
+	message := fmt.Sprintf("outlet %s/%s is reserved by %s until %s", deviceName, outletNumber,
+		reservation.Operator, reservation.Until.Format("Mon 15:04"))
+	if reservation.Note != "" {
+		message += ": " + reservation.Note
+	}
+	return errors.New(message)
+}
+
+// ReserveOutlet holds an outlet for the elevated session's operator
+// between from (now if zero) and until; meanwhile only that operator can
+// switch it. operator may be empty or must name that operator.
+func (a *App) ReserveOutlet(deviceName, outletNumber, operator, note string, from, until time.Time) (models.Reservation, error) {
+	if err := a.kioskLocked(); err != nil {
+		return models.Reservation{}, err
+	}
+
+	operator, err := a.sessionOperator(operator)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if !until.After(time.Now()) {
+		return models.Reservation{}, fmt.Errorf("reservation must end in the future")
+	}
+
+	reservation := models.Reservation{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Operator:     operator,
+		Note:         strings.TrimSpace(note),
+		From:         from,
+		Until:        until,
+	}
+	if err := a.reservations.Add(reservation); err != nil {
+		return models.Reservation{}, err
+	}
+
+	a.audit("outlet_reserved", operator, deviceName, outletNumber, fmt.Sprintf("from=%s until=%s note=%s",
+		from.Format(time.RFC3339), until.Format(time.RFC3339), reservation.Note))
+	a.syncReservations()
+	return reservation, nil
+}
+
+// ReleaseReservation ends the elevated operator's current reservation of
+// an outlet
+func (a *App) ReleaseReservation(deviceName, outletNumber, operator string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	operator, err := a.sessionOperator(operator)
+	if err != nil {
+		return err
+	}
+
+	reservation, ok := a.reservations.Active(deviceName, outletNumber, time.Now())
+	if !ok {
+		return fmt.Errorf("outlet %s/%s is not reserved", deviceName, outletNumber)
+	}
+	if !reservation.HeldBy(operator) {
+		return fmt.Errorf("outlet %s/%s is reserved by %s; override the reservation instead", deviceName, outletNumber, reservation.Operator)
+	}
+
+	if _, err := a.reservations.Remove(deviceName, outletNumber, time.Now()); err != nil {
+		return fmt.Errorf("failed to release reservation: %w", err)
+	}
+	a.audit("reservation_released", operator, deviceName, outletNumber, "")
+	a.syncReservations()
+	return nil
+}
+
+// OverrideReservation ends another operator's current reservation of an
+// outlet on behalf of the elevated operator; the reason is kept in the
+// audit log
+func (a *App) OverrideReservation(deviceName, outletNumber, operator, reason string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	operator, err := a.sessionOperator(operator)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("a reason is required to override a reservation")
+	}
+
+	reservation, err := a.reservations.Remove(deviceName, outletNumber, time.Now())
+	if err != nil {
+		return err
+	}
+	a.audit("reservation_overridden", operator, deviceName, outletNumber,
+		fmt.Sprintf("holder=%s until=%s reason=%s", reservation.Operator, reservation.Until.Format(time.RFC3339), reason))
+	a.syncReservations()
+	return nil
+}
+
+// GetReservations returns the current and upcoming reservations
+func (a *App) GetReservations() []models.Reservation {
+	return a.reservations.GetAll()
+}
+
+// runReservations periodically starts and expires reservations
+func (a *App) runReservations(ctx context.Context) {
+	a.syncReservations()
+
+	ticker := time.NewTicker(reservationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.syncReservations()
+		}
+	}
+}
+
+// syncReservations drops ended reservations and updates the device list
+// with the reservation holding each outlet now
+func (a *App) syncReservations() {
+	now := time.Now()
+	expired, err := a.reservations.Expire(now)
+	if err != nil {
+		log.Printf("Failed to save reservations: %v", err)
+	}
+	for _, reservation := range expired {
+		a.audit("reservation_expired", reservation.Operator, reservation.DeviceName, reservation.OutletNumber, "")
+	}
+
+	// Outlets reserved now, plus the ones that were until now
+	outlets := make(map[string][2]string)
+	for _, reservation := range a.reservations.GetAll() {
+		outlets[reservation.DeviceName+":"+reservation.OutletNumber] = [2]string{reservation.DeviceName, reservation.OutletNumber}
+	}
+	for _, device := range a.deviceStore.GetAll() {
+		if device.Reservation != nil {
+			outlets[device.DeviceName+":"+device.OutletNumber] = [2]string{device.DeviceName, device.OutletNumber}
+		}
+	}
+
+	for _, outlet := range outlets {
+		var holding *models.Reservation
+		if reservation, ok := a.reservations.Active(outlet[0], outlet[1], now); ok {
+			holding = &reservation
+		}
+		if device, changed := a.deviceStore.SetReservation(outlet[0], outlet[1], holding); changed {
+			a.emit(events.DeviceUpdate, device)
+		}
+	}
+}
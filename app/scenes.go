@@ -0,0 +1,230 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Phases of a scene being applied, reported in scene:progress events
+const (
+	SceneSent    = "sent"    // an outlet was switched
+	SceneSkipped = "skipped" // an outlet was already in the scene's state
+	SceneFailed  = "failed"  // an outlet could not be switched; see Error
+	SceneDone    = "done"    // every outlet was handled
+)
+
+// SceneProgress is the payload of scene:progress
+type SceneProgress struct {
+	Scene        string `json:"scene"`
+	DeviceName   string `json:"deviceName,omitempty"` // empty for done
+	OutletNumber string `json:"outletNumber,omitempty"`
+	State        string `json:"state,omitempty"`
+	Phase        string `json:"phase"`
+	Error        string `json:"error,omitempty"`
+	Sent         int    `json:"sent"`
+	Skipped      int    `json:"skipped"`
+	Failed       int    `json:"failed"`
+	Total        int    `json:"total"`
+}
+
+// ListScenes returns the saved scenes; a kiosk sees only whitelisted scenes
+func (a *App) ListScenes() []models.Scene {
+	scenes := a.scenes.GetAll()
+	if !a.isKiosk() {
+		return scenes
+	}
+
+	cfg := a.currentConfig()
+	allowed := make([]models.Scene, 0, len(scenes))
+	for _, scene := range scenes {
+		if cfg.IsKioskScene(scene.Name) {
+			allowed = append(allowed, scene)
+		}
+	}
+	return allowed
+}
+
+// SaveScene creates a scene, or replaces the one with the same name, from
+// hand-edited outlet states
+func (a *App) SaveScene(scene models.Scene) (models.Scene, error) {
+	if err := a.kioskLocked(); err != nil {
+		return models.Scene{}, err
+	}
+
+	saved, err := a.scenes.Put(scene)
+	if err != nil {
+		return models.Scene{}, fmt.Errorf("failed to save scene: %w", err)
+	}
+	a.emit(events.ScenesChanged, a.scenes.GetAll())
+	return saved, nil
+}
+
+// CaptureScene saves the current states of the outlets matching the
+// "device:outlet" patterns (all outlets if none are given) as a scene.
+// Outlets that are neither ON nor OFF are left out.
+func (a *App) CaptureScene(name string, patterns []string) (models.Scene, error) {
+	if err := a.kioskLocked(); err != nil {
+		return models.Scene{}, err
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	scene := models.Scene{Name: name, Outlets: make([]models.SceneOutlet, 0)}
+	for _, outlet := range a.deviceStore.GetAll() {
+		if outlet.Status != "ON" && outlet.Status != "OFF" {
+			continue
+		}
+		key := outlet.DeviceName + ":" + outlet.OutletNumber
+		for _, pattern := range patterns {
+			matched, err := path.Match(pattern, key)
+			if err != nil {
+				return models.Scene{}, fmt.Errorf("invalid outlet pattern %q", pattern)
+			}
+			if matched {
+				scene.Outlets = append(scene.Outlets, models.SceneOutlet{
+					DeviceName:   outlet.DeviceName,
+					OutletNumber: outlet.OutletNumber,
+					State:        outlet.Status,
+				})
+				break
+			}
+		}
+	}
+
+	return a.SaveScene(scene)
+}
+
+// DeleteScene removes a scene
+func (a *App) DeleteScene(name string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := a.scenes.Delete(name); err != nil {
+		return err
+	}
+	a.emit(events.ScenesChanged, a.scenes.GetAll())
+	return nil
+}
+
+// ApplyScene switches the scene's outlets to their saved states, skipping
+// outlets already in them. Progress is reported as scene:progress events;
+// the error lists the outlets that could not be switched.
+func (a *App) ApplyScene(name string) error {
+	scene, ok := a.scenes.Get(name)
+	if !ok {
+		return fmt.Errorf("scene not found: %s", name)
+	}
+	if a.isKiosk() && !a.currentConfig().IsKioskScene(scene.Name) {
+		return fmt.Errorf("scene %s is not available in kiosk mode", scene.Name)
+	}
+
+	key := strings.ToLower(scene.Name)
+	if !a.sceneRuns.start(key) {
+		return fmt.Errorf("scene %s is already being applied", scene.Name)
+	}
+	defer a.sceneRuns.finish(key)
+
+	progress := SceneProgress{Scene: scene.Name, Total: len(scene.Outlets)}
+	source := "scene " + scene.Name
+	var failures []error
+	for _, outlet := range scene.Outlets {
+		progress.DeviceName, progress.OutletNumber, progress.State = outlet.DeviceName, outlet.OutletNumber, outlet.State
+		progress.Error = ""
+
+		if current, known := a.deviceStore.Get(outlet.DeviceName, outlet.OutletNumber); known && !current.Stale && current.Status == outlet.State {
+			progress.Skipped++
+			progress.Phase = SceneSkipped
+			a.emit(events.SceneProgress, progress)
+			continue
+		}
+
+		err := a.withCommandPolicy(outlet.DeviceName, outlet.OutletNumber, "", source+" state="+outlet.State, lockExempt, func() error {
+			return a.sendCommand(outlet.DeviceName, outlet.OutletNumber, outlet.State, source)
+		})
+		if err != nil {
+			log.Printf("Scene %s: failed to switch %s/%s: %v", scene.Name, outlet.DeviceName, outlet.OutletNumber, err)
+			failures = append(failures, fmt.Errorf("%s/%s: %w", outlet.DeviceName, outlet.OutletNumber, err))
+			progress.Failed++
+			progress.Phase = SceneFailed
+			progress.Error = err.Error()
+		} else {
+			progress.Sent++
+			progress.Phase = SceneSent
+		}
+		a.emit(events.SceneProgress, progress)
+	}
+
+	progress.DeviceName, progress.OutletNumber, progress.State = "", "", ""
+	progress.Phase = SceneDone
+	progress.Error = ""
+	a.emit(events.SceneProgress, progress)
+
+	if len(failures) > 0 {
+		return fmt.Errorf("scene %s: %d of %d outlets failed: %w", scene.Name, len(failures), len(scene.Outlets), errors.Join(failures...))
+	}
+	return nil
+}
+
+// ExportScenes returns the named scenes (all if none are given) as JSON
+func (a *App) ExportScenes(names []string) (string, error) {
+	if err := a.kioskLocked(); err != nil {
+		return "", err
+	}
+
+	scenes := a.scenes.GetAll()
+	if len(names) > 0 {
+		scenes = make([]models.Scene, 0, len(names))
+		for _, name := range names {
+			scene, ok := a.scenes.Get(name)
+			if !ok {
+				return "", fmt.Errorf("scene not found: %s", name)
+			}
+			scenes = append(scenes, scene)
+		}
+	}
+
+	data, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode scenes: %w", err)
+	}
+	return string(data), nil
+}
+
+// ImportScenes adds the scenes in a JSON export, replacing scenes of the
+// same name only if replace is set, and returns how many were imported.
+// Nothing is imported if any scene is invalid.
+func (a *App) ImportScenes(data string, replace bool) (int, error) {
+	if err := a.kioskLocked(); err != nil {
+		return 0, err
+	}
+
+	var scenes []models.Scene
+	if err := json.Unmarshal([]byte(data), &scenes); err != nil {
+		return 0, fmt.Errorf("failed to read scenes: %w", err)
+	}
+	for _, scene := range scenes {
+		if err := scene.Validate(); err != nil {
+			return 0, err
+		}
+		if _, exists := a.scenes.Get(scene.Name); exists && !replace {
+			return 0, fmt.Errorf("scene %s already exists", scene.Name)
+		}
+	}
+
+	for i, scene := range scenes {
+		if _, err := a.scenes.Put(scene); err != nil {
+			return i, fmt.Errorf("failed to save scene: %w", err)
+		}
+	}
+	a.emit(events.ScenesChanged, a.scenes.GetAll())
+	return len(scenes), nil
+}
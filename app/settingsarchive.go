@@ -0,0 +1,246 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// settingsArchiveFormat labels settings archives and their version
+const settingsArchiveFormat = "go-powercontrol-settings/1"
+
+// settingsArchive is the encrypted contents of a settings archive.
+// Passwords are carried in plain text inside it, as the keychain entries
+// and machine-keyed encryption of the config do not move between machines.
+type settingsArchive struct {
+	ExportedAt       time.Time               `json:"exportedAt"`
+	Config           json.RawMessage         `json:"config"` // without passwords
+	BrokerPassword   string                  `json:"brokerPassword,omitempty"`
+	ProfilePasswords map[string]string       `json:"profilePasswords,omitempty"` // key: profile name
+	Inventory        []models.OutletMetadata `json:"inventory"`                  // aliases, groups, circuits and notes of outlets
+	Groups           []models.Group          `json:"groups"`
+	Scenes           []models.Scene          `json:"scenes"`
+}
+
+// SettingsArchiveReport describes a settings archive written or read
+type SettingsArchiveReport struct {
+	Path       string    `json:"path"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Profiles   int       `json:"profiles"`
+	Inventory  int       `json:"inventory"` // outlets with metadata
+	Groups     int       `json:"groups"`
+	Scenes     int       `json:"scenes"`
+}
+
+// report summarises an archive's contents
+func (s settingsArchive) report(path string, profiles int) SettingsArchiveReport {
+	return SettingsArchiveReport{
+		Path:       path,
+		ExportedAt: s.ExportedAt,
+		Profiles:   profiles,
+		Inventory:  len(s.Inventory),
+		Groups:     len(s.Groups),
+		Scenes:     len(s.Scenes),
+	}
+}
+
+// ExportSettings writes the config with its saved profiles and passwords,
+// the outlet inventory, groups and scenes to one file encrypted with a
+// passphrase, for moving to another workstation or provisioning kiosks with
+// ImportSettings
+func (a *App) ExportSettings(path, passphrase string) (SettingsArchiveReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return SettingsArchiveReport{}, err
+	}
+	if len(passphrase) < config.MinPassphraseLength {
+		return SettingsArchiveReport{}, fmt.Errorf("passphrase must be at least %d characters", config.MinPassphraseLength)
+	}
+
+	cfg := a.currentConfig()
+	archive := settingsArchive{
+		ExportedAt:       time.Now(),
+		ProfilePasswords: make(map[string]string),
+		Inventory:        a.inventory.GetAll(),
+		Groups:           a.groups.GetAll(),
+		Scenes:           a.scenes.GetAll(),
+	}
+
+	var err error
+	if archive.BrokerPassword, err = cfg.GetPassword(); err != nil {
+		return SettingsArchiveReport{}, err
+	}
+	cfg.PasswordHash = ""
+	cfg.Profiles = append([]config.Profile(nil), cfg.Profiles...)
+	for i := range cfg.Profiles {
+		profile := &cfg.Profiles[i]
+		password, err := profile.GetPassword()
+		if err != nil {
+			return SettingsArchiveReport{}, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+		if password != "" {
+			archive.ProfilePasswords[profile.Name] = password
+		}
+		profile.PasswordHash = ""
+	}
+	cfg.SchemaVersion = config.SchemaVersion
+	if archive.Config, err = json.Marshal(cfg); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to encode settings: %w", err)
+	}
+	sealed, err := config.SealWithPassphrase(settingsArchiveFormat, data, passphrase)
+	if err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to encrypt settings: %w", err)
+	}
+	if err := os.WriteFile(path, sealed, 0600); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to write settings archive: %w", err)
+	}
+
+	report := archive.report(path, len(cfg.Profiles))
+	a.audit("settings_exported", "", "", "", fmt.Sprintf("path=%s profiles=%d inventory=%d groups=%d scenes=%d",
+		path, report.Profiles, report.Inventory, report.Groups, report.Scenes))
+	return report, nil
+}
+
+// ImportSettings replaces the config, saved profiles, outlet inventory,
+// groups and scenes with those in an archive written by ExportSettings.
+// Passwords are stored in this machine's keychain. The archive is checked
+// as a whole first, so a wrong passphrase or an invalid archive changes
+// nothing, and if saving any part fails the parts already saved are put
+// back. Emits config:changed, reconnecting if the broker differs.
+func (a *App) ImportSettings(path, passphrase string) (SettingsArchiveReport, error) {
+	if err := a.kioskLocked(); err != nil {
+		return SettingsArchiveReport{}, err
+	}
+
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to read settings archive: %w", err)
+	}
+	data, err := config.OpenWithPassphrase(settingsArchiveFormat, sealed, passphrase)
+	if err != nil {
+		return SettingsArchiveReport{}, err
+	}
+	var archive settingsArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("failed to read settings archive: %w", err)
+	}
+
+	cfg, err := config.Parse(archive.Config)
+	if err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("settings archive: %w", err)
+	}
+	if err := models.ValidateInventory(archive.Inventory); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("settings archive: %w", err)
+	}
+	if err := models.ValidateGroups(archive.Groups); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("settings archive: %w", err)
+	}
+	if err := models.ValidateScenes(archive.Scenes); err != nil {
+		return SettingsArchiveReport{}, fmt.Errorf("settings archive: %w", err)
+	}
+
+	// The passwords the import overwrites in the keychain, to put back if
+	// it fails; one that cannot be read now cannot be put back either.
+	// Holding configMu keeps other changes from being lost in between.
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	current := a.currentConfig()
+	currentPassword, currentPasswordErr := current.GetPassword()
+	currentProfilePasswords := make(map[string]string, len(current.Profiles))
+	for i := range current.Profiles {
+		if password, err := current.Profiles[i].GetPassword(); err == nil {
+			currentProfilePasswords[current.Profiles[i].Name] = password
+		}
+	}
+
+	// Each part registers how to undo it before it is saved, as a failed
+	// save may leave the new contents in memory
+	var undo []func()
+	fail := func(err error) (SettingsArchiveReport, error) {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return SettingsArchiveReport{}, err
+	}
+
+	previousInventory := a.inventory.GetAll()
+	undo = append(undo, func() { restoreImported("inventory", a.inventory.Replace(previousInventory)) })
+	if err := a.inventory.Replace(archive.Inventory); err != nil {
+		return fail(fmt.Errorf("failed to save inventory: %w", err))
+	}
+	previousGroups := a.groups.GetAll()
+	undo = append(undo, func() { restoreImported("groups", a.groups.Replace(previousGroups)) })
+	if err := a.groups.Replace(archive.Groups); err != nil {
+		return fail(fmt.Errorf("failed to save groups: %w", err))
+	}
+	previousScenes := a.scenes.GetAll()
+	undo = append(undo, func() { restoreImported("scenes", a.scenes.Replace(previousScenes)) })
+	if err := a.scenes.Replace(archive.Scenes); err != nil {
+		return fail(fmt.Errorf("failed to save scenes: %w", err))
+	}
+
+	undo = append(undo, func() {
+		if currentPasswordErr == nil {
+			restored := *current
+			restoreImported("broker password", restored.SetPassword(currentPassword))
+		}
+		for _, profile := range cfg.Profiles {
+			if password, readable := currentProfilePasswords[profile.Name]; readable {
+				restoreImported("profile "+profile.Name+" password", profile.SetPassword(password))
+			} else if _, existed := current.FindProfile(profile.Name); !existed {
+				profile.DeletePassword()
+			}
+		}
+	})
+	if err := cfg.SetPassword(archive.BrokerPassword); err != nil {
+		return fail(err)
+	}
+	for i := range cfg.Profiles {
+		if err := cfg.Profiles[i].SetPassword(archive.ProfilePasswords[cfg.Profiles[i].Name]); err != nil {
+			return fail(err)
+		}
+	}
+	if err := cfg.Save(); err != nil {
+		return fail(fmt.Errorf("failed to save config: %w", err))
+	}
+
+	// Everything is saved: drop what the archive did not have and tell the
+	// window
+	for _, old := range current.Profiles {
+		if _, kept := cfg.FindProfile(old.Name); !kept {
+			old.DeletePassword()
+		}
+	}
+	for _, outlet := range previousInventory {
+		if _, kept := a.inventory.Get(outlet.DeviceName, outlet.OutletNumber); !kept {
+			a.applyOutletDetails(models.OutletMetadata{DeviceName: outlet.DeviceName, OutletNumber: outlet.OutletNumber})
+		}
+	}
+	a.loadOutletDetails()
+	a.emit(events.GroupsChanged, a.groups.GetAll())
+	a.emit(events.ScenesChanged, a.scenes.GetAll())
+
+	report := archive.report(path, len(cfg.Profiles))
+	a.audit("settings_imported", "", "", "", fmt.Sprintf("path=%s exported=%s profiles=%d inventory=%d groups=%d scenes=%d",
+		path, archive.ExportedAt.Format(time.RFC3339), report.Profiles, report.Inventory, report.Groups, report.Scenes))
+	a.replaceConfig(current, cfg)
+	return report, nil
+}
+
+// restoreImported logs a part of the settings that could not be put back
+// after a failed import
+func restoreImported(part string, err error) {
+	if err != nil {
+		log.Printf("Failed to restore %s after a failed settings import: %v", part, err)
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+)
+
+// staleCheckInterval is how often outlets are checked against the stale
+// and purge windows
+const staleCheckInterval = 10 * time.Second
+
+// runStaleChecker flags outlets that stopped reporting as stale and removes
+// them once the purge window passes, emitting device:stale and
+// device:removed for each
+func (a *App) runStaleChecker(ctx context.Context) {
+	ticker := time.NewTicker(staleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.expireStale()
+		}
+	}
+}
+
+// expireStale applies the configured stale and purge windows once
+func (a *App) expireStale() {
+	cfg := a.currentConfig()
+	if cfg.StaleAfter <= 0 && cfg.PurgeStaleAfter <= 0 {
+		return
+	}
+
+	now := time.Now()
+	var staleBefore, purgeBefore time.Time
+	if cfg.StaleAfter > 0 {
+		staleBefore = now.Add(-time.Duration(cfg.StaleAfter) * time.Second)
+	}
+	if cfg.PurgeStaleAfter > 0 {
+		purgeBefore = now.Add(-time.Duration(cfg.PurgeStaleAfter) * time.Second)
+	}
+
+	stale, purged := a.deviceStore.ExpireStale(staleBefore, purgeBefore)
+	for _, outlet := range stale {
+		a.emit(events.DeviceStale, outlet)
+	}
+	a.emitRemoved(purged)
+}
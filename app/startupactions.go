@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Retained sync detection: the broker sends retained messages right after
+// subscribing, so the sync is over once they stop for a moment
+const (
+	retainedQuiet   = 2 * time.Second
+	retainedSyncMax = 30 * time.Second
+)
+
+// runStartupActions waits for the initial retained sync after the first
+// connection, then asks every device for its state and applies the startup
+// scene, as configured
+func (a *App) runStartupActions(ctx context.Context, connected time.Time) {
+	cfg := a.currentConfig()
+	if cfg.StartupScene == "" && !cfg.StartupStatusRequest {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := a.waitRetainedSync(ctx, connected); err != nil {
+		return
+	}
+
+	if cfg.StartupStatusRequest {
+		queried := a.queryStatus(a.deviceStore.GetAll())
+		log.Printf("Startup status request sent to %d outlets", len(queried))
+
+		// Let the answers arrive, so the scene skips outlets already set
+		if cfg.StartupScene != "" {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(cfg.StatusAuditWait) * time.Second):
+			}
+		}
+	}
+
+	if cfg.StartupScene == "" {
+		return
+	}
+	if err := a.ApplyScene(cfg.StartupScene); err != nil {
+		log.Printf("Failed to apply startup scene: %v", err)
+		a.raiseAlert(models.Alert{
+			Severity: models.SeverityWarning,
+			Source:   "startup",
+			Message:  fmt.Sprintf("startup scene %s was not fully applied: %v", cfg.StartupScene, err),
+		})
+		return
+	}
+	a.audit("startup_scene_applied", "", "", "", "scene="+cfg.StartupScene)
+}
+
+// waitRetainedSync returns once no retained message has arrived for
+// retainedQuiet, or after retainedSyncMax
+func (a *App) waitRetainedSync(ctx context.Context, connected time.Time) error {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		last := connected
+		if retained := time.Unix(0, a.lastRetained.Load()); retained.After(last) {
+			last = retained
+		}
+		if time.Since(last) >= retainedQuiet || time.Since(connected) >= retainedSyncMax {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// statsInterval is how often connection statistics are pushed to the frontend
+const statsInterval = 5 * time.Second
+
+// GetConnectionStats returns connection statistics for the diagnostics panel
+func (a *App) GetConnectionStats() mqtt.Stats {
+	return a.mqttClient.Stats()
+}
+
+// runStatsReporter periodically measures latency and emits connection statistics
+func (a *App) runStatsReporter(ctx context.Context) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.mqttClient.IsConnected() {
+				// Failures are recorded in the stats themselves
+				a.mqttClient.Ping()
+			}
+			a.emitTransient(events.ConnectionStats, a.mqttClient.Stats())
+			if unparsed := a.unparsed.snapshot(); unparsed.Total > 0 {
+				a.emitTransient(events.MessagesUnparsed, unparsed)
+			}
+			if a.logControl.active() {
+				a.emitTransient(events.LogSuppressed, a.logControl.status())
+			}
+		}
+	}
+}
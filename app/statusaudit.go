@@ -0,0 +1,256 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// Outcomes of checking one outlet in a status audit
+const (
+	AuditMatched     = "matched"     // the device confirmed the known state
+	AuditMismatch    = "mismatch"    // the device reported a different state
+	AuditNoResponse  = "no_response" // the device did not answer in time
+	AuditUnsupported = "unsupported" // the protocol cannot query state
+)
+
+// AuditFinding is the result for one outlet
+type AuditFinding struct {
+	DeviceName   string `json:"deviceName"`
+	OutletNumber string `json:"outletNumber"`
+	Outcome      string `json:"outcome"`
+	Expected     string `json:"expected"`
+	Reported     string `json:"reported,omitempty"`
+	Accepted     bool   `json:"accepted,omitempty"`   // the device list took the reported state
+	Reconciled   bool   `json:"reconciled,omitempty"` // the expected state was sent to the outlet
+}
+
+// StatusAuditRun summarizes one status audit
+type StatusAuditRun struct {
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished"`
+	Matched     int            `json:"matched"`
+	Mismatched  int            `json:"mismatched"`
+	NoResponse  int            `json:"noResponse"`
+	Unsupported int            `json:"unsupported"`
+	Findings    []AuditFinding `json:"findings"` // everything but matches
+}
+
+// statusAudit serializes audit runs and keeps the latest result
+type statusAudit struct {
+	run  sync.Mutex // held while an audit runs
+	mu   sync.Mutex
+	last *StatusAuditRun
+}
+
+// RunStatusAudit queries every known outlet and compares the answers with
+// the device list. The list takes the state an outlet reports; the
+// expected state is only sent back with statusAuditReconcile or
+// ReconcileAuditFinding.
+func (a *App) RunStatusAudit() (StatusAuditRun, error) {
+	if err := a.kioskLocked(); err != nil {
+		return StatusAuditRun{}, err
+	}
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return a.runStatusAudit(ctx)
+}
+
+// GetLastStatusAudit returns the most recent audit result, if any
+func (a *App) GetLastStatusAudit() *StatusAuditRun {
+	a.statusAudit.mu.Lock()
+	defer a.statusAudit.mu.Unlock()
+	return a.statusAudit.last
+}
+
+// queryStatus asks every outlet whose protocol supports it to report its
+// state and returns the "device:outlet" keys that were asked. Answers
+// update the device store through the normal message path.
+func (a *App) queryStatus(outlets []models.DeviceOutlet) map[string]bool {
+	queried := make(map[string]bool)
+	sent := make(map[string]bool) // some protocols answer per device, not per outlet
+	for _, outlet := range outlets {
+		querier, ok := a.adapter(a.protocolOf(outlet.DeviceName)).(mqtt.StatusQuerier)
+		if !ok {
+			continue
+		}
+
+		topic, payload := querier.BuildStatusQuery(outlet.DeviceName, a.quirkFor(outlet.DeviceName).ToDevice(outlet.OutletNumber))
+		if !sent[topic+"\x00"+payload] {
+			if err := a.mqttClient.Publish(topic, payload); err != nil {
+				log.Printf("Status query to %s failed: %v", topic, err)
+				continue
+			}
+			sent[topic+"\x00"+payload] = true
+		}
+		queried[outlet.DeviceName+":"+outlet.OutletNumber] = true
+	}
+	return queried
+}
+
+// runStatusAudit performs one audit run
+func (a *App) runStatusAudit(ctx context.Context) (StatusAuditRun, error) {
+	if !a.mqttClient.IsConnected() {
+		return StatusAuditRun{}, fmt.Errorf("not connected to broker")
+	}
+	if !a.statusAudit.run.TryLock() {
+		return StatusAuditRun{}, fmt.Errorf("a status audit is already running")
+	}
+	defer a.statusAudit.run.Unlock()
+
+	cfg := a.currentConfig()
+	run := StatusAuditRun{Started: time.Now(), Findings: make([]AuditFinding, 0)}
+	expected := a.deviceStore.GetAll()
+
+	queried := a.queryStatus(expected)
+
+	// Answers update the device store through the normal message path
+	select {
+	case <-ctx.Done():
+		return StatusAuditRun{}, ctx.Err()
+	case <-time.After(time.Duration(cfg.StatusAuditWait) * time.Second):
+	}
+
+	for _, outlet := range expected {
+		finding := AuditFinding{
+			DeviceName:   outlet.DeviceName,
+			OutletNumber: outlet.OutletNumber,
+			Expected:     outlet.Status,
+		}
+
+		current, _ := a.deviceStore.Get(outlet.DeviceName, outlet.OutletNumber)
+		switch {
+		case !queried[outlet.DeviceName+":"+outlet.OutletNumber]:
+			finding.Outcome = AuditUnsupported
+			run.Unsupported++
+		case !current.LastUpdate.After(run.Started):
+			finding.Outcome = AuditNoResponse
+			run.NoResponse++
+		case current.Status != outlet.Status:
+			finding.Outcome = AuditMismatch
+			finding.Reported = current.Status
+			run.Mismatched++
+		default:
+			run.Matched++
+			continue
+		}
+
+		// The device is right about its own state, which the answer already
+		// put in the device list; pushing the expected state back is opt-in
+		// and refused for locked and critical outlets
+		if finding.Outcome == AuditMismatch {
+			finding.Accepted = true
+			if cfg.StatusAuditReconcile {
+				if err := a.reconcile(finding, lockEnforced); err != nil {
+					log.Printf("Failed to reconcile %s/%s: %v", outlet.DeviceName, outlet.OutletNumber, err)
+				} else {
+					finding.Accepted, finding.Reconciled = false, true
+				}
+			}
+		}
+		run.Findings = append(run.Findings, finding)
+	}
+	run.Finished = time.Now()
+
+	a.audit("status_audit", "", "", "", fmt.Sprintf("matched=%d mismatched=%d no_response=%d unsupported=%d",
+		run.Matched, run.Mismatched, run.NoResponse, run.Unsupported))
+	if run.Mismatched > 0 {
+		a.raiseAlert(models.Alert{
+			Severity: models.SeverityWarning,
+			Source:   "status-audit",
+			Message:  fmt.Sprintf("%d outlet(s) reported a state different from the device list", run.Mismatched),
+		})
+	}
+
+	a.statusAudit.mu.Lock()
+	a.statusAudit.last = &run
+	a.statusAudit.mu.Unlock()
+	a.emit(events.StatusAuditCompleted, run)
+
+	return run, nil
+}
+
+// ReconcileAuditFinding sends the expected state of a mismatched outlet
+// from the last audit back to it, for an operator who decided the device
+// list was right. Locked outlets are refused unless override is set, and
+// critical outlets need an elevated session.
+func (a *App) ReconcileAuditFinding(deviceName, outletNumber string, override bool) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+
+	a.statusAudit.mu.Lock()
+	var finding *AuditFinding
+	if a.statusAudit.last != nil {
+		for i := range a.statusAudit.last.Findings {
+			f := &a.statusAudit.last.Findings[i]
+			if f.DeviceName == deviceName && f.OutletNumber == outletNumber && f.Outcome == AuditMismatch {
+				finding = f
+				break
+			}
+		}
+	}
+	if finding == nil {
+		a.statusAudit.mu.Unlock()
+		return fmt.Errorf("the last status audit found no mismatch on %s/%s", deviceName, outletNumber)
+	}
+	if finding.Reconciled {
+		a.statusAudit.mu.Unlock()
+		return fmt.Errorf("%s/%s was already reconciled", deviceName, outletNumber)
+	}
+	pending := *finding
+	a.statusAudit.mu.Unlock()
+
+	if err := a.reconcile(pending, lockOverride(override)); err != nil {
+		return err
+	}
+
+	a.statusAudit.mu.Lock()
+	finding.Accepted, finding.Reconciled = false, true
+	a.statusAudit.mu.Unlock()
+	a.audit("status_audit_reconciled", "", deviceName, outletNumber, "state="+pending.Expected)
+	return nil
+}
+
+// reconcile sends a finding's expected state to its outlet
+func (a *App) reconcile(finding AuditFinding, lock lockPolicy) error {
+	if finding.Expected != "ON" && finding.Expected != "OFF" {
+		return fmt.Errorf("expected state of %s/%s is %s", finding.DeviceName, finding.OutletNumber, finding.Expected)
+	}
+	return a.withCommandPolicy(finding.DeviceName, finding.OutletNumber, "", "reconcile state="+finding.Expected, lock, func() error {
+		return a.sendCommand(finding.DeviceName, finding.OutletNumber, finding.Expected, SourceStatusAudit)
+	})
+}
+
+// runStatusAuditScheduler runs the audit at the configured interval
+func (a *App) runStatusAuditScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			interval := time.Duration(a.currentConfig().StatusAuditInterval) * time.Minute
+			if interval <= 0 || time.Since(lastRun) < interval || !a.mqttClient.IsConnected() {
+				continue
+			}
+
+			lastRun = time.Now()
+			if _, err := a.runStatusAudit(ctx); err != nil {
+				log.Printf("Scheduled status audit failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// Subscription describes an active topic subscription
+type Subscription struct {
+	Topic   string    `json:"topic"`
+	Primary bool      `json:"primary"` // the configured subscribe string
+	Added   time.Time `json:"added"`
+}
+
+// SubscriptionManager tracks the configured subscription plus temporary
+// extra subscriptions added at runtime. Extras are not persisted.
+type SubscriptionManager struct {
+	mu      sync.Mutex
+	client  *mqtt.Client
+	primary string
+	added   time.Time
+	extras  map[string]time.Time
+}
+
+// NewSubscriptionManager creates a subscription manager for a client
+func NewSubscriptionManager(client *mqtt.Client) *SubscriptionManager {
+	return &SubscriptionManager{
+		client: client,
+		extras: make(map[string]time.Time),
+	}
+}
+
+// Apply subscribes to the primary topic and all extras after a (re)connect
+func (m *SubscriptionManager) Apply(primary string) error {
+	m.mu.Lock()
+	m.primary = primary
+	m.added = time.Now()
+	extras := make([]string, 0, len(m.extras))
+	for topic := range m.extras {
+		extras = append(extras, topic)
+	}
+	m.mu.Unlock()
+
+	if err := m.client.Subscribe(primary); err != nil {
+		return err
+	}
+
+	for _, topic := range extras {
+		if topic == primary {
+			continue
+		}
+		if err := m.client.Subscribe(topic); err != nil {
+			return fmt.Errorf("failed to restore subscription %s: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// List returns all subscriptions, primary first
+func (m *SubscriptionManager) List() []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := make([]Subscription, 0, len(m.extras)+1)
+	if m.primary != "" {
+		subs = append(subs, Subscription{Topic: m.primary, Primary: true, Added: m.added})
+	}
+
+	extras := make([]Subscription, 0, len(m.extras))
+	for topic, added := range m.extras {
+		if topic != m.primary {
+			extras = append(extras, Subscription{Topic: topic, Added: added})
+		}
+	}
+	sort.Slice(extras, func(i, j int) bool { return extras[i].Topic < extras[j].Topic })
+
+	return append(subs, extras...)
+}
+
+// Add subscribes to an extra topic
+func (m *SubscriptionManager) Add(topic string) error {
+	if err := mqtt.ValidateTopicFilter(topic); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	_, exists := m.extras[topic]
+	isPrimary := topic == m.primary
+	m.mu.Unlock()
+
+	if exists || isPrimary {
+		return fmt.Errorf("already subscribed to %s", topic)
+	}
+
+	if m.client.IsConnected() {
+		if err := m.client.Subscribe(topic); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.extras[topic] = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Remove unsubscribes from an extra topic; the primary topic cannot be removed
+func (m *SubscriptionManager) Remove(topic string) error {
+	m.mu.Lock()
+	_, exists := m.extras[topic]
+	isPrimary := topic == m.primary
+	if exists {
+		delete(m.extras, topic)
+	}
+	m.mu.Unlock()
+
+	if isPrimary {
+		return fmt.Errorf("cannot remove the configured subscription; change it in settings instead")
+	}
+	if !exists {
+		return fmt.Errorf("not subscribed to %s", topic)
+	}
+
+	if m.client.IsConnected() {
+		return m.client.Unsubscribe(topic)
+	}
+	return nil
+}
+
+// ListSubscriptions returns the active subscriptions
+func (a *App) ListSubscriptions() []Subscription {
+	return a.subscriptions.List()
+}
+
+// AddSubscription temporarily subscribes to an extra topic
+func (a *App) AddSubscription(topic string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.subscriptions.Add(topic)
+}
+
+// RemoveSubscription removes a previously added extra topic
+func (a *App) RemoveSubscription(topic string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	return a.subscriptions.Remove(topic)
+}
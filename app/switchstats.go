@@ -0,0 +1,38 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// GetDeviceStats returns every outlet's number of ON/OFF transitions and
+// cumulative on-time since tracking began, so relays nearing their rated
+// number of cycles can be spotted
+func (a *App) GetDeviceStats() []models.OutletStats {
+	stats := make([]models.OutletStats, 0)
+	for _, outlet := range a.switchStats.GetAll() {
+		if a.kioskAllows(outlet.DeviceName, outlet.OutletNumber) {
+			stats = append(stats, outlet)
+		}
+	}
+	return stats
+}
+
+// ResetDeviceStats restarts an outlet's switch count and on-time, e.g.
+// after its relay was replaced
+func (a *App) ResetDeviceStats(deviceName, outletNumber string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if !a.switchStats.Reset(deviceName, outletNumber, time.Now()) {
+		return fmt.Errorf("no statistics for outlet %s/%s", deviceName, outletNumber)
+	}
+	if err := a.switchStats.Save(); err != nil {
+		return fmt.Errorf("failed to save switch statistics: %w", err)
+	}
+	a.audit("device_stats_reset", "", deviceName, outletNumber, "")
+	return nil
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// eventThrottle limits how often each event type reaches the frontend.
+// Events over the limit are coalesced: the latest payload is delivered
+// once the interval has passed, so the UI always ends up current. Events
+// about an outlet are limited and coalesced per outlet, so an update to
+// one outlet never replaces another's.
+type eventThrottle struct {
+	mu      sync.Mutex
+	rates   map[string]float64 // events per second, by event name
+	last    map[string]time.Time
+	pending map[string]interface{}
+	timers  map[string]*time.Timer
+}
+
+// newEventThrottle creates a throttle with no limits
+func newEventThrottle() *eventThrottle {
+	return &eventThrottle{
+		rates:   make(map[string]float64),
+		last:    make(map[string]time.Time),
+		pending: make(map[string]interface{}),
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// setRates replaces the configured limits
+func (t *eventThrottle) setRates(rates map[string]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rates = make(map[string]float64, len(rates))
+	for name, rate := range rates {
+		t.rates[name] = rate
+	}
+}
+
+// throttleKey returns the key an event is coalesced under: its name, plus
+// the outlet for events about one outlet
+func throttleKey(name string, data interface{}) string {
+	if env, ok := data.(events.Envelope); ok {
+		data = env.Data
+	}
+	switch payload := data.(type) {
+	case models.DeviceOutlet:
+		return name + "\x00" + payload.DeviceName + ":" + payload.OutletNumber
+	case events.TelemetryPayload:
+		return name + "\x00" + payload.DeviceName + ":" + payload.OutletNumber
+	case CycleProgress:
+		return name + "\x00" + payload.DeviceName + ":" + payload.OutletNumber
+	case events.AvailabilityPayload:
+		return name + "\x00" + payload.DeviceName
+	}
+	return name
+}
+
+// submit delivers data via send now, or schedules the latest payload for later
+func (t *eventThrottle) submit(name string, data interface{}, send func(interface{})) {
+	t.mu.Lock()
+
+	rate := t.rates[name]
+	if rate <= 0 {
+		t.mu.Unlock()
+		send(data)
+		return
+	}
+
+	key := throttleKey(name, data)
+	interval := time.Duration(float64(time.Second) / rate)
+	wait := interval - time.Since(t.last[key])
+
+	if wait <= 0 && t.timers[key] == nil {
+		t.last[key] = time.Now()
+		t.mu.Unlock()
+		send(data)
+		return
+	}
+
+	// Replace any pending payload with the newest one
+	t.pending[key] = data
+	if t.timers[key] == nil {
+		t.timers[key] = time.AfterFunc(wait, func() {
+			t.mu.Lock()
+			latest := t.pending[key]
+			delete(t.pending, key)
+			delete(t.timers, key)
+			t.last[key] = time.Now()
+			t.mu.Unlock()
+
+			send(latest)
+		})
+	}
+	t.mu.Unlock()
+}
+
+// SetEventThrottle sets the maximum events per second for an event type and
+// saves it to the preferences; zero removes the limit
+func (a *App) SetEventThrottle(event string, maxPerSecond float64) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if maxPerSecond < 0 {
+		return fmt.Errorf("invalid throttle rate: %g", maxPerSecond)
+	}
+
+	var rates map[string]float64
+	err := a.updateConfig(func(cfg *config.Config) error {
+		rates = make(map[string]float64, len(cfg.EventThrottle)+1)
+		for name, rate := range cfg.EventThrottle {
+			rates[name] = rate
+		}
+		if maxPerSecond == 0 {
+			delete(rates, event)
+		} else {
+			rates[event] = maxPerSecond
+		}
+		cfg.EventThrottle = rates
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.throttle.setRates(rates)
+
+	return nil
+}
+
+// GetEventThrottle returns the configured event throttle limits
+func (a *App) GetEventThrottle() map[string]float64 {
+	return a.currentConfig().EventThrottle
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// TimelineFilter narrows a timeline export
+type TimelineFilter struct {
+	Kinds  []string `json:"kinds"`  // entry kinds to include; empty includes all
+	Device string   `json:"device"` // case-insensitive substring of the device name
+	Outlet string   `json:"outlet"` // exact outlet number
+	Format string   `json:"format"` // "json" (default) or "csv"
+}
+
+// matches reports whether an entry passes the filter
+func (f TimelineFilter) matches(entry models.TimelineEntry) bool {
+	if len(f.Kinds) > 0 {
+		found := false
+		for _, kind := range f.Kinds {
+			if strings.EqualFold(kind, string(entry.Kind)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Device != "" && !strings.Contains(strings.ToLower(entry.DeviceName), strings.ToLower(f.Device)) {
+		return false
+	}
+	if f.Outlet != "" && entry.OutletNumber != f.Outlet {
+		return false
+	}
+	return true
+}
+
+// ExportTimeline returns a chronological export of state changes, commands,
+// connection events and alerts between from and to (zero times are
+// unbounded), formatted as JSON or CSV
+func (a *App) ExportTimeline(from, to time.Time, filter TimelineFilter) (string, error) {
+	if err := a.kioskLocked(); err != nil {
+		return "", err
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return "", fmt.Errorf("end of range is before its start")
+	}
+
+	entries, err := a.timeline.Range(from, to)
+	if err != nil {
+		return "", fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	selected := make([]models.TimelineEntry, 0, len(entries))
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+
+	switch strings.ToLower(filter.Format) {
+	case "", "json":
+		data, err := json.MarshalIndent(selected, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode timeline: %w", err)
+		}
+		return string(data), nil
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"timestamp", "kind", "severity", "device", "outlet", "detail"})
+		for _, entry := range selected {
+			w.Write([]string{
+				entry.Timestamp.Format(time.RFC3339Nano),
+				string(entry.Kind),
+				string(entry.Severity),
+				entry.DeviceName,
+				entry.OutletNumber,
+				entry.Detail,
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", fmt.Errorf("failed to encode timeline: %w", err)
+		}
+		return buf.String(), nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", filter.Format)
+	}
+}
+
+// timelinePruneInterval is how often old timeline entries are removed
+const timelinePruneInterval = 24 * time.Hour
+
+// runTimelinePruner removes timeline entries older than timelineDays once
+// a day
+func (a *App) runTimelinePruner(ctx context.Context) {
+	ticker := time.NewTicker(timelinePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if days := a.currentConfig().TimelineDays; days > 0 {
+			if _, err := a.timeline.Prune(time.Now().AddDate(0, 0, -days)); err != nil {
+				log.Printf("Failed to prune timeline: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordTimeline adds an entry to the timeline
+func (a *App) recordTimeline(entry models.TimelineEntry) {
+	if err := a.timeline.Record(entry); err != nil {
+		log.Printf("Failed to write timeline entry: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// Phases of a power cycle reported in outlet:cycle events
+const (
+	CycleOff    = "off"    // the outlet was switched off and is waiting
+	CycleDone   = "done"   // the outlet was switched back on
+	CycleFailed = "failed" // the cycle stopped; see Error
+)
+
+// Default and maximum off time of a power cycle, in seconds
+const (
+	defaultPulseSeconds = 5
+	maxPulseSeconds     = 600
+)
+
+// CycleProgress is the payload of outlet:cycle
+type CycleProgress struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Phase        string    `json:"phase"`
+	Until        time.Time `json:"until,omitempty"` // when the outlet is switched back on
+	Error        string    `json:"error,omitempty"`
+}
+
+// pulseTracker keeps one power cycle per outlet at a time
+type pulseTracker struct {
+	mu      sync.Mutex
+	active  map[string]bool
+	pending sync.WaitGroup // outlets waiting to be switched back on
+}
+
+// start marks an outlet as cycling, returning false if it already is
+func (p *pulseTracker) start(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == nil {
+		p.active = make(map[string]bool)
+	}
+	if p.active[key] {
+		return false
+	}
+	p.active[key] = true
+	return true
+}
+
+// finish clears an outlet's cycle
+func (p *pulseTracker) finish(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, key)
+}
+
+// ToggleOutlet flips an outlet. Devices that can toggle themselves get a
+// protocol-level toggle; others are sent the opposite of the known state.
+func (a *App) ToggleOutlet(deviceName, outletNumber string) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+	return a.withCommandPolicy(deviceName, outletNumber, "", "toggle", lockEnforced, func() error {
+		return a.toggleOutlet(deviceName, outletNumber)
+	})
+}
+
+// toggleOutlet flips an outlet without any policy checks
+func (a *App) toggleOutlet(deviceName, outletNumber string) error {
+	if a.IsReplica() {
+		return fmt.Errorf("this instance is a read-only replica")
+	}
+
+	// Discovered switches have their own command topics, so only the
+	// adapter's protocol toggle applies to the rest
+	if _, discovered := a.discovered.byOutlet(deviceName, outletNumber); !discovered {
+		if toggler, ok := a.adapter(a.protocolOf(deviceName)).(mqtt.Toggler); ok {
+			topic, payload, err := toggler.BuildToggle(deviceName, a.quirkFor(deviceName).ToDevice(outletNumber))
+			if err != nil {
+				return fmt.Errorf("failed to build command: %w", err)
+			}
+			return a.publishCommand(topic, payload, models.TimelineEntry{
+				DeviceName:   deviceName,
+				OutletNumber: outletNumber,
+				State:        "TOGGLE",
+				Source:       SourceManual,
+				Detail:       "toggle",
+			})
+		}
+
+		// Devices with a toggle quirk flip on their usual command topic
+		if quirk := a.quirkFor(deviceName); quirk.Toggle != "" {
+			topic, _, err := a.buildCommand(deviceName, outletNumber, "ON")
+			if err != nil {
+				return fmt.Errorf("failed to build command: %w", err)
+			}
+			return a.publishCommand(topic, quirk.Toggle, models.TimelineEntry{
+				DeviceName:   deviceName,
+				OutletNumber: outletNumber,
+				State:        "TOGGLE",
+				Source:       SourceManual,
+				Detail:       "toggle",
+			})
+		}
+	}
+
+	outlet, ok := a.deviceStore.Get(deviceName, outletNumber)
+	if !ok {
+		return fmt.Errorf("outlet %s/%s is unknown", deviceName, outletNumber)
+	}
+
+	switch outlet.Status {
+	case "ON":
+		return a.sendCommand(deviceName, outletNumber, "OFF", SourceManual)
+	case "OFF":
+		return a.sendCommand(deviceName, outletNumber, "ON", SourceManual)
+	default:
+		return fmt.Errorf("state of outlet %s/%s is unknown", deviceName, outletNumber)
+	}
+}
+
+// PulseOutlet power-cycles an outlet: it is switched off now and back on
+// after offSeconds (5 if zero). Progress is reported as outlet:cycle events;
+// the call returns once the outlet is off.
+func (a *App) PulseOutlet(deviceName, outletNumber string, offSeconds int) error {
+	if err := a.kioskOutlet(deviceName, outletNumber); err != nil {
+		return err
+	}
+
+	if offSeconds <= 0 {
+		offSeconds = defaultPulseSeconds
+	}
+	if offSeconds > maxPulseSeconds {
+		return fmt.Errorf("off time must be at most %d seconds", maxPulseSeconds)
+	}
+
+	key := deviceName + ":" + outletNumber
+	if !a.pulses.start(key) {
+		return fmt.Errorf("outlet %s/%s is already cycling", deviceName, outletNumber)
+	}
+
+	offDuration := time.Duration(offSeconds) * time.Second
+	detail := fmt.Sprintf("pulse off=%ds", offSeconds)
+	err := a.withCommandPolicy(deviceName, outletNumber, "", detail, lockEnforced, func() error {
+		return a.sendCommand(deviceName, outletNumber, "OFF", SourcePowerCycle)
+	})
+	if err != nil {
+		a.pulses.finish(key)
+		return err
+	}
+
+	until := time.Now().Add(offDuration)
+	a.emit(events.OutletCycle, CycleProgress{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Phase:        CycleOff,
+		Until:        until,
+	})
+
+	a.pulses.pending.Add(1)
+	go a.finishPulse(deviceName, outletNumber, offDuration)
+	return nil
+}
+
+// finishPulse switches a cycling outlet back on once its off time is over,
+// or early if the app is shutting down, so no outlet is left OFF at exit
+func (a *App) finishPulse(deviceName, outletNumber string, offDuration time.Duration) {
+	defer a.pulses.pending.Done()
+	defer a.pulses.finish(deviceName + ":" + outletNumber)
+
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	progress := CycleProgress{DeviceName: deviceName, OutletNumber: outletNumber, Phase: CycleDone}
+
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down; switching %s/%s back on before its off time is over", deviceName, outletNumber)
+	case <-time.After(offDuration):
+	}
+	if err := a.sendCommand(deviceName, outletNumber, "ON", SourcePowerCycle); err != nil {
+		log.Printf("Power cycle of %s/%s failed: %v", deviceName, outletNumber, err)
+		progress.Phase = CycleFailed
+		progress.Error = err.Error()
+	}
+
+	a.emit(events.OutletCycle, progress)
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"log"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// topicCache holds the schema compiled from the configured templates
+type topicCache struct {
+	mu     sync.Mutex
+	schema *mqtt.TopicSchema
+}
+
+// compileSchema builds a schema from templates, using the defaults for empty ones
+func compileSchema(stateTemplate, commandTemplate string) (*mqtt.TopicSchema, error) {
+	if stateTemplate == "" {
+		stateTemplate = mqtt.DefaultStateTemplate
+	}
+	if commandTemplate == "" {
+		commandTemplate = mqtt.DefaultCommandTemplate
+	}
+	return mqtt.NewTopicSchema(stateTemplate, commandTemplate)
+}
+
+// topicSchema returns the schema for the current config, recompiling it
+// when the templates have changed. Invalid templates fall back to the default.
+func (a *App) topicSchema() *mqtt.TopicSchema {
+	cfg := a.currentConfig()
+	stateTemplate, commandTemplate := cfg.StateTopicTemplate, cfg.CommandTopicTemplate
+	if stateTemplate == "" {
+		stateTemplate = mqtt.DefaultStateTemplate
+	}
+	if commandTemplate == "" {
+		commandTemplate = mqtt.DefaultCommandTemplate
+	}
+
+	a.topics.mu.Lock()
+	defer a.topics.mu.Unlock()
+
+	schema := a.topics.schema
+	if schema != nil && schema.StateTemplate() == stateTemplate && schema.CommandTemplate() == commandTemplate {
+		return schema
+	}
+
+	schema, err := compileSchema(stateTemplate, commandTemplate)
+	if err != nil {
+		log.Printf("Invalid topic templates, using defaults: %v", err)
+		schema = mqtt.DefaultSchema
+	}
+	a.topics.schema = schema
+	return schema
+}
+
+// GetTopicTemplates returns the state and command topic templates in use
+func (a *App) GetTopicTemplates() map[string]string {
+	schema := a.topicSchema()
+	return map[string]string{
+		"state":   schema.StateTemplate(),
+		"command": schema.CommandTemplate(),
+	}
+}
+
+// SetTopicTemplates validates and saves the state and command topic
+// templates; empty strings restore the defaults
+func (a *App) SetTopicTemplates(stateTemplate, commandTemplate string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if _, err := compileSchema(stateTemplate, commandTemplate); err != nil {
+		return err
+	}
+
+	err := a.updateConfig(func(cfg *config.Config) error {
+		cfg.StateTopicTemplate = stateTemplate
+		cfg.CommandTopicTemplate = commandTemplate
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Devices parsed with the old templates may no longer be addressable
+	a.deviceStore.Clear()
+	return nil
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// trafficPruneInterval is how often old traffic log files are removed
+const trafficPruneInterval = time.Hour
+
+// openTrafficLog starts a traffic log file and prunes old ones
+func (a *App) openTrafficLog(cfg *config.Config) error {
+	path, err := config.DataPath("traffic")
+	if err != nil {
+		return err
+	}
+	maxAge := time.Duration(cfg.TrafficLogDays) * 24 * time.Hour
+	maxBytes := int64(cfg.TrafficLogMB) << 20
+	maxTotal := int64(cfg.TrafficLogTotalMB) << 20
+	traffic, err := models.OpenTrafficLog(path, maxBytes, maxTotal, maxAge)
+	if err != nil {
+		return err
+	}
+
+	a.traffic.Store(traffic)
+	go a.runTrafficPruner(a.bgCtx, traffic)
+	return nil
+}
+
+// closeTrafficLog stops logging traffic
+func (a *App) closeTrafficLog() {
+	if traffic := a.traffic.Swap(nil); traffic != nil {
+		traffic.Close()
+	}
+}
+
+// writeTraffic appends a message to the traffic log, if enabled, reporting
+// only the first of a run of failures
+func (a *App) writeTraffic(msg models.MQTTMessage) {
+	traffic := a.traffic.Load()
+	if traffic == nil {
+		return
+	}
+	if err := traffic.Write(msg); err != nil {
+		if !a.trafficFailing.Swap(true) {
+			log.Printf("Failed to write traffic log: %v", err)
+		}
+		return
+	}
+	a.trafficFailing.Store(false)
+}
+
+// runTrafficPruner removes traffic log files past their age or over the
+// total size every hour until the traffic log is closed
+func (a *App) runTrafficPruner(ctx context.Context, traffic *models.TrafficLog) {
+	ticker := time.NewTicker(trafficPruneInterval)
+	defer ticker.Stop()
+
+	for a.traffic.Load() == traffic {
+		if _, err := traffic.Prune(time.Now()); err != nil {
+			log.Printf("Failed to prune traffic log: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
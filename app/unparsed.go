@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// UnparsedStats counts messages whose topic did not fit the expected layout
+type UnparsedStats struct {
+	Total     uint64    `json:"total"`
+	Logged    uint64    `json:"logged"`    // strict mode, or lenient extraction failed
+	Recovered uint64    `json:"recovered"` // lenient extraction found an outlet
+	Ignored   uint64    `json:"ignored"`
+	LastTopic string    `json:"lastTopic,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	LastAt    time.Time `json:"lastAt,omitempty"`
+}
+
+// unparsedCounter keeps the unparsed message statistics
+type unparsedCounter struct {
+	mu    sync.Mutex
+	stats UnparsedStats
+}
+
+// record counts an unparsed message handled in the given mode; lenient
+// messages that could not be recovered count as logged
+func (c *unparsedCounter) record(mode, topic string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Total++
+	switch mode {
+	case mqtt.ValidationIgnore:
+		c.stats.Ignored++
+	case mqtt.ValidationLenient:
+		c.stats.Recovered++
+	default:
+		c.stats.Logged++
+	}
+	c.stats.LastTopic = topic
+	c.stats.LastError = err.Error()
+	c.stats.LastAt = time.Now()
+}
+
+// snapshot returns a copy of the statistics
+func (c *unparsedCounter) snapshot() UnparsedStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// handleUnparsed applies the topic validation mode of the subscription a
+// message arrived on after the adapter failed to parse it, returning the
+// states a lenient extraction found
+func (a *App) handleUnparsed(topic, payload string, parseErr error) []mqtt.OutletState {
+	switch a.currentConfig().ValidationFor(topic) {
+	case mqtt.ValidationIgnore:
+		a.unparsed.record(mqtt.ValidationIgnore, topic, parseErr)
+		return nil
+	case mqtt.ValidationLenient:
+		states, err := mqtt.ParseLenient(topic, payload)
+		if err == nil {
+			a.unparsed.record(mqtt.ValidationLenient, topic, parseErr)
+			for _, state := range states {
+				a.devices.set(state.Device, a.protocolFor(topic))
+			}
+			return states
+		}
+		parseErr = fmt.Errorf("%v; lenient extraction failed: %v", parseErr, err)
+	}
+
+	a.unparsed.record(mqtt.ValidationStrict, topic, parseErr)
+	log.Printf("Failed to parse message on %s: %v", topic, parseErr)
+	return nil
+}
+
+// GetUnparsedStats returns how many messages could not be parsed and how
+// they were handled
+func (a *App) GetUnparsedStats() UnparsedStats {
+	return a.unparsed.snapshot()
+}
+
+// SetTopicValidation sets how unparseable messages arriving through a
+// subscription filter are handled: "strict", "lenient" or "ignore"
+func (a *App) SetTopicValidation(topicFilter, mode string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	if err := mqtt.ValidateTopicFilter(topicFilter); err != nil {
+		return err
+	}
+
+	return a.updateConfig(func(cfg *config.Config) error {
+		validation := make(map[string]string, len(cfg.TopicValidation)+1)
+		for filter, existing := range cfg.TopicValidation {
+			validation[filter] = existing
+		}
+		validation[topicFilter] = mode
+		cfg.TopicValidation = validation
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		return nil
+	})
+}
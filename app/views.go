@@ -0,0 +1,168 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/config"
+	"github.com/levonbragg/go-powercontrol/events"
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// ListViews returns the saved views
+func (a *App) ListViews() []config.View {
+	views := a.currentConfig().Views
+	if views == nil {
+		return []config.View{}
+	}
+	return views
+}
+
+// SaveView adds or replaces a named view
+func (a *App) SaveView(view config.View) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	view.Name = strings.TrimSpace(view.Name)
+	if view.Name == "" {
+		return fmt.Errorf("view name is required")
+	}
+
+	var views []config.View
+	err := a.updateConfig(func(cfg *config.Config) error {
+		views = make([]config.View, 0, len(cfg.Views)+1)
+		for _, existing := range cfg.Views {
+			if existing.Name != view.Name {
+				views = append(views, existing)
+			}
+		}
+		cfg.Views = append(views, view)
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		views = cfg.Views
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.emit(events.ViewsChanged, views)
+	return nil
+}
+
+// DeleteView removes a named view
+func (a *App) DeleteView(name string) error {
+	if err := a.kioskLocked(); err != nil {
+		return err
+	}
+
+	var views []config.View
+	err := a.updateConfig(func(cfg *config.Config) error {
+		views = make([]config.View, 0, len(cfg.Views))
+		for _, existing := range cfg.Views {
+			if existing.Name != name {
+				views = append(views, existing)
+			}
+		}
+		if len(views) == len(cfg.Views) {
+			return fmt.Errorf("view not found: %s", name)
+		}
+		cfg.Views = views
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.emit(events.ViewsChanged, views)
+	return nil
+}
+
+// GetViewDevices returns the outlets selected by a named view, in the
+// view's sort order. Windows showing a view call it on device:update.
+func (a *App) GetViewDevices(name string) ([]models.DeviceOutlet, error) {
+	view, ok := a.currentConfig().FindView(name)
+	if !ok {
+		return nil, fmt.Errorf("view not found: %s", name)
+	}
+	return a.viewDevices(view), nil
+}
+
+// viewDevices applies a view's filter, location, group and outlet
+// selections and sort
+func (a *App) viewDevices(view config.View) []models.DeviceOutlet {
+	groups := make(map[string]bool, len(view.Groups))
+	for _, group := range view.Groups {
+		groups[strings.ToLower(group)] = true
+	}
+	locations := make(map[string]bool, len(view.Locations))
+	for _, location := range view.Locations {
+		locations[strings.ToLower(location)] = true
+	}
+
+	devices := make([]models.DeviceOutlet, 0)
+	for _, device := range a.kioskFilter(a.deviceStore.Filter(view.Filter)) {
+		if !view.MatchesOutlet(device.DeviceName, device.OutletNumber) {
+			continue
+		}
+		if len(locations) > 0 && !locations[strings.ToLower(device.Location)] {
+			continue
+		}
+		if len(groups) > 0 {
+			metadata, ok := a.inventory.Get(device.DeviceName, device.OutletNumber)
+			if !ok || !groups[strings.ToLower(metadata.Group)] {
+				continue
+			}
+		}
+		devices = append(devices, device)
+	}
+
+	sortDevices(devices, view.Sort, view.Descending)
+	return devices
+}
+
+// sortDevices sorts devices by a view sort key. The store returns devices
+// by name, so equal keys stay in that order.
+func sortDevices(devices []models.DeviceOutlet, key string, descending bool) {
+	less := viewOrder(key)
+	sort.SliceStable(devices, func(i, j int) bool {
+		if descending {
+			return less(devices[j], devices[i])
+		}
+		return less(devices[i], devices[j])
+	})
+}
+
+// viewOrder returns the comparison for a view sort key
+func viewOrder(key string) func(a, b models.DeviceOutlet) bool {
+	switch key {
+	case "label":
+		return func(a, b models.DeviceOutlet) bool {
+			return models.NaturalLess(a.Label, b.Label)
+		}
+	case "location":
+		return func(a, b models.DeviceOutlet) bool {
+			return models.NaturalLess(a.Location, b.Location)
+		}
+	case "status":
+		return func(a, b models.DeviceOutlet) bool { return a.Status < b.Status }
+	case "watts":
+		watts := func(d models.DeviceOutlet) float64 {
+			if d.Watts == nil {
+				return -1
+			}
+			return *d.Watts
+		}
+		return func(a, b models.DeviceOutlet) bool { return watts(a) < watts(b) }
+	case "updated":
+		return func(a, b models.DeviceOutlet) bool { return a.LastUpdate.Before(b.LastUpdate) }
+	default:
+		return func(a, b models.DeviceOutlet) bool {
+			if a.DeviceName != b.DeviceName {
+				return models.NaturalLess(a.DeviceName, b.DeviceName)
+			}
+			return models.NaturalLess(a.OutletNumber, b.OutletNumber)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Command powersim runs an MQTT broker with simulated PDUs, so Go
+// PowerControl can be tried and tested without hardware. Point the app at
+// the printed address with "power/#" as the subscribe string.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/levonbragg/go-powercontrol/sim"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:1883", "address the broker listens on")
+	devices := flag.Int("devices", 2, "number of simulated PDUs")
+	outlets := flag.Int("outlets", 8, "outlets per PDU")
+	delay := flag.Duration("delay", 0, "delay before a PDU reports a switched outlet")
+	watts := flag.Float64("watts", 0, "load reported by each ON outlet; 0 sends no telemetry")
+	flag.Parse()
+
+	broker, err := sim.NewBroker(*addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer broker.Close()
+
+	for i := 1; i <= *devices; i++ {
+		pdu := sim.NewPDU(fmt.Sprintf("pdu%d", i), *outlets)
+		pdu.ReplyDelay = *delay
+		pdu.Watts = *watts
+		if err := pdu.Connect(broker.Addr()); err != nil {
+			log.Fatal(err)
+		}
+		defer pdu.Disconnect()
+	}
+	log.Printf("Broker listening on %s with %d PDUs of %d outlets", broker.Addr(), *devices, *outlets)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	log.Printf("Stopping")
+}
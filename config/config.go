@@ -2,43 +2,431 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Profile holds the connection settings of an alternative broker/site
+type Profile struct {
+	Name            string `json:"name"`
+	Username        string `json:"username"`
+	PasswordHash    string `json:"passwordHash"`
+	MQTTServer      string `json:"mqttServer"`
+	ServerPort      int    `json:"serverPort"`
+	SubscribeString string `json:"subscribeString"`
+}
+
+// ProtocolSubscription subscribes to a topic filter whose messages are
+// handled by a specific protocol adapter
+type ProtocolSubscription struct {
+	Topic    string `json:"topic"`
+	Protocol string `json:"protocol"`
+}
+
+var (
+	protocolsMu sync.RWMutex
+	protocols   = make(map[string]bool)
 )
 
+// RegisterProtocol records a protocol name with an adapter, so protocol
+// subscriptions naming it are valid. The mqtt package registers every
+// adapter here.
+func RegisterProtocol(name string) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+	protocols[strings.ToLower(name)] = true
+}
+
+// knownProtocol reports whether a protocol has an adapter
+func knownProtocol(name string) bool {
+	protocolsMu.RLock()
+	defer protocolsMu.RUnlock()
+	return protocols[strings.ToLower(name)]
+}
+
+// PayloadExtractor reads the status from JSON payloads on matching topics
+type PayloadExtractor struct {
+	Topic string `json:"topic"` // MQTT topic filter, wildcards allowed
+	Path  string `json:"path"`  // JSONPath-like expression, e.g. "$.relay.0"
+}
+
+// PayloadMapping sets the ON/OFF payloads used by devices whose names match
+type PayloadMapping struct {
+	Devices       []string `json:"devices,omitempty"` // device name patterns, e.g. "relay-*"; empty matches all
+	On            []string `json:"on"`                // accepted as ON; the first is sent
+	Off           []string `json:"off"`               // accepted as OFF; the first is sent
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+}
+
+// QuirkAssignment applies vendor quirks from the quirks library to devices
+// whose names match
+type QuirkAssignment struct {
+	Devices []string `json:"devices,omitempty"` // device name patterns, e.g. "relay-*"; empty matches all
+	Quirks  []string `json:"quirks"`            // quirk names, applied in order
+}
+
+// RelayBoard describes a multi-channel relay board that publishes the state
+// of all its relays as one bitmask payload, e.g. "10110010"
+type RelayBoard struct {
+	Topic    string `json:"topic"`            // topic filter, e.g. "relays/+/state"
+	Device   string `json:"device,omitempty"` // device name; empty uses the level matched by the first '+'
+	Channels int    `json:"channels"`
+	LSBFirst bool   `json:"lsbFirst,omitempty"` // the last digit is channel 1
+}
+
+// LocationRule assigns a location to outlets whose messages arrive on
+// matching topics
+type LocationRule struct {
+	Topic    string `json:"topic"` // topic filter whose levels may be glob patterns, e.g. "power/rack-*/#"
+	Location string `json:"location"`
+}
+
+// View is a saved selection of outlets, e.g. for a second monitor
+type View struct {
+	Name       string   `json:"name"`
+	Filter     string   `json:"filter,omitempty"`    // search text, as in the search box
+	Groups     []string `json:"groups,omitempty"`    // inventory groups; empty matches all
+	Locations  []string `json:"locations,omitempty"` // outlet locations; empty matches all
+	Outlets    []string `json:"outlets,omitempty"`   // "device:outlet" glob patterns; empty matches all
+	Sort       string   `json:"sort,omitempty"`      // "device" (default), "label", "location", "status", "watts" or "updated"
+	Descending bool     `json:"descending,omitempty"`
+}
+
+// ViewSorts are the sort keys a view may use
+var ViewSorts = []string{"device", "label", "location", "status", "watts", "updated"}
+
 // Config holds the application configuration
 type Config struct {
+	// Shape of the file, see SchemaVersion; older files are migrated on load
+	SchemaVersion int `json:"schemaVersion"`
+
 	Username        string `json:"username"`
 	PasswordHash    string `json:"passwordHash"`
 	MQTTServer      string `json:"mqttServer"`
 	ServerPort      int    `json:"serverPort"`
 	SubscribeString string `json:"subscribeString"`
+
+	// When set, the subscribe string is joined as an MQTT shared subscription
+	// in this group so redundant instances split the traffic between them
+	SharedSubscriptionGroup string `json:"sharedSubscriptionGroup,omitempty"`
+
+	// Device protocol for the subscribe string: "power" (default,
+	// power/<device>/outlets/<n> or the topic templates below), "tasmota" or
+	// "shelly" (Gen2 RPC)
+	Protocol string `json:"protocol,omitempty"`
+
+	// Additional subscriptions, each handled by its own protocol adapter
+	ProtocolSubscriptions []ProtocolSubscription `json:"protocolSubscriptions,omitempty"`
+
+	// Learn switches from Home Assistant discovery configs published under
+	// <HADiscoveryPrefix>/switch/# (default prefix "homeassistant")
+	HADiscovery       bool   `json:"haDiscovery"`
+	HADiscoveryPrefix string `json:"haDiscoveryPrefix,omitempty"`
+
+	// Topic filter StartDiscovery listens on for unknown devices; empty
+	// means "#"
+	DiscoveryFilter string `json:"discoveryFilter,omitempty"`
+
+	// Topic templates for firmwares that do not use power/<device>/outlets/<n>,
+	// e.g. "stat/{device}/POWER{outlet}"; empty means the default layout
+	StateTopicTemplate   string `json:"stateTopicTemplate,omitempty"`
+	CommandTopicTemplate string `json:"commandTopicTemplate,omitempty"`
+
+	// How messages whose topic does not fit the expected layout are handled,
+	// keyed by subscription topic filter: "strict" (default, logged),
+	// "lenient" (best-effort extraction) or "ignore" (dropped silently)
+	TopicValidation map[string]string `json:"topicValidation,omitempty"`
+
+	// Status extraction for JSON payloads; the first matching topic filter
+	// wins and payloads that do not match fall back to plain 0/1 parsing
+	PayloadExtractors []PayloadExtractor `json:"payloadExtractors,omitempty"`
+
+	// ON/OFF payloads for devices that do not use 1/0; the first mapping
+	// whose device patterns match wins
+	PayloadMappings []PayloadMapping `json:"payloadMappings,omitempty"`
+
+	// Vendor quirks per device; the first assignment whose device patterns
+	// match wins, and payload mappings take precedence over quirk payloads
+	DeviceQuirks []QuirkAssignment `json:"deviceQuirks,omitempty"`
+
+	// Relay boards whose state topic carries every channel in one payload;
+	// their messages are split into one update per channel
+	RelayBoards []RelayBoard `json:"relayBoards,omitempty"`
+
+	// Location rules; the first rule whose topic matches wins
+	LocationRules []LocationRule `json:"locationRules,omitempty"`
+
+	// Named device list views that windows can show independently
+	Views []View `json:"views,omitempty"`
+
+	// Saved connection profiles for other sites
+	Profiles []Profile `json:"profiles,omitempty"`
+
+	// Connection timing, in seconds
+	KeepAlive            int `json:"keepAlive"`
+	PingTimeout          int `json:"pingTimeout"`
+	ConnectTimeout       int `json:"connectTimeout"`
+	MaxReconnectInterval int `json:"maxReconnectInterval"`
+
+	// Reconnect backoff: the delay doubles from the initial delay up to
+	// MaxReconnectInterval; zero attempts means retry forever
+	ReconnectInitialDelay int `json:"reconnectInitialDelay"` // seconds
+	ReconnectMaxAttempts  int `json:"reconnectMaxAttempts"`
+
+	// Publish rate limiting; zero rate disables it. Publishes over the limit
+	// wait up to PublishMaxWait, then follow PublishOverflow (error, drop or queue)
+	PublishRate     float64 `json:"publishRate"` // messages per second
+	PublishBurst    int     `json:"publishBurst"`
+	PublishMaxWait  int     `json:"publishMaxWait"` // milliseconds
+	PublishOverflow string  `json:"publishOverflow"`
+
+	// Seconds to wait for an outlet to report the state a command asked for
+	// before the command is reported as unconfirmed
+	CommandAckTimeout int `json:"commandAckTimeout"`
+
+	// Command loop detection: once an outlet changes state more than
+	// LoopMaxCommands times within LoopWindow seconds, an automatic command
+	// source switching it is stopped from doing so for another LoopWindow
+	// seconds
+	LoopMaxCommands int `json:"loopMaxCommands"`
+	LoopWindow      int `json:"loopWindow"` // seconds
+
+	// Milliseconds between the commands of a bulk all-on or all-off
+	BulkCommandDelay int `json:"bulkCommandDelay"`
+
+	// Outlets not reported for StaleAfter seconds are flagged stale, and
+	// removed from the device list after PurgeStaleAfter seconds; zero
+	// disables either step
+	StaleAfter      int `json:"staleAfter"`
+	PurgeStaleAfter int `json:"purgeStaleAfter"`
+
+	// Devices hidden from the device list; their messages are still logged
+	// but do not bring them back
+	HiddenDevices []string `json:"hiddenDevices,omitempty"`
+
+	// Outlets ("device:outlet") pinned by the operator, in the order added
+	Favorites []string `json:"favorites,omitempty"`
+
+	// Outlets ("device:outlet") locked against switching unless a command
+	// explicitly overrides the lock
+	LockedOutlets []string `json:"lockedOutlets,omitempty"`
+
+	// Startup connection behavior
+	AutoConnect        bool `json:"autoConnect"`
+	AutoConnectRetries int  `json:"autoConnectRetries"` // extra attempts if the first one fails
+
+	// After the first connection, once retained messages stop arriving, ask
+	// every device for its state and/or apply a scene
+	StartupStatusRequest bool   `json:"startupStatusRequest,omitempty"`
+	StartupScene         string `json:"startupScene,omitempty"`
+
+	// Outlets ("device:outlet", glob patterns allowed) that need a second
+	// operator's confirmation before they can be switched
+	CriticalOutlets    []string `json:"criticalOutlets,omitempty"`
+	ConfirmationWindow int      `json:"confirmationWindow"` // seconds
+
+	// Alert when an outlet switches at an hour it rarely does, once
+	// AnomalyLearningDays of history are known. Sensitivity is "low",
+	// "medium" or "high"; opted-out outlets use the same patterns as
+	// CriticalOutlets.
+	AnomalyDetection    bool     `json:"anomalyDetection"`
+	AnomalySensitivity  string   `json:"anomalySensitivity,omitempty"`
+	AnomalyLearningDays int      `json:"anomalyLearningDays"`
+	AnomalyOptOut       []string `json:"anomalyOptOut,omitempty"`
+
+	// Alert when an ON outlet's power draw drifts more than this percentage
+	// from its learned baseline; zero disables it. EnergyDrift overrides the
+	// percentage per outlet ("device:outlet", glob patterns allowed).
+	EnergyDriftPercent float64            `json:"energyDriftPercent"`
+	EnergyDrift        map[string]float64 `json:"energyDrift,omitempty"`
+
+	// Capacity of inventory circuits and groups in watts, keyed by name,
+	// for the headroom in capacity reports
+	CircuitCapacity map[string]float64 `json:"circuitCapacity,omitempty"`
+	GroupCapacity   map[string]float64 `json:"groupCapacity,omitempty"`
+
+	// Periodically ask devices for their state and compare it with the
+	// device list, which takes the reported state; zero interval disables
+	// the job. Reconcile instead re-sends the expected state to outlets
+	// that disagree, unless they are locked or critical.
+	StatusAuditInterval  int  `json:"statusAuditInterval"` // minutes
+	StatusAuditWait      int  `json:"statusAuditWait"`     // seconds to wait for answers
+	StatusAuditReconcile bool `json:"statusAuditReconcile"`
+
+	// Elevated sessions allow protected commands without per-command confirmation
+	ElevationPINHash     string `json:"elevationPinHash,omitempty"`
+	MaxElevationDuration int    `json:"maxElevationDuration"` // seconds
+
+	// Republish normalized outlet state, retained, under
+	// <RepublishPrefix>/state/<device>/<outlet>, with this instance's
+	// availability on <RepublishPrefix>/status
+	RepublishState  bool   `json:"republishState"`
+	RepublishPrefix string `json:"republishPrefix,omitempty"`
+
+	// Address of the embedded HTTP server (e.g. "127.0.0.1:8089") serving
+	// Grafana-compatible endpoints; empty disables it
+	APIListenAddress string `json:"apiListenAddress,omitempty"`
+	APIToken         string `json:"apiToken,omitempty"` // bearer token required by the API when set
+
+	// Base URL of a primary instance's API (e.g. "http://10.0.0.5:8089").
+	// When set, this instance is a read-only replica that mirrors the
+	// primary's device list and never connects to the broker.
+	ReplicaOf    string `json:"replicaOf,omitempty"`
+	ReplicaToken string `json:"replicaToken,omitempty"`
+
+	// Alert forwarding to facility monitoring; empty addresses disable a channel
+	SyslogAddress       string `json:"syslogAddress,omitempty"` // host:port
+	SyslogNetwork       string `json:"syslogNetwork,omitempty"` // "udp" or "tcp"
+	SNMPTrapAddress     string `json:"snmpTrapAddress,omitempty"`
+	SNMPCommunity       string `json:"snmpCommunity,omitempty"`
+	SNMPEnterpriseOID   string `json:"snmpEnterpriseOid,omitempty"`
+	AlertForwardMinimum string `json:"alertForwardMinimum,omitempty"` // minimum severity forwarded
+
+	// When set, newly logged messages are sent to the frontend in batched
+	// log:append events instead of a message:new event for every message
+	LogStreaming bool `json:"logStreaming"`
+
+	// Received messages are only logged if their topic matches a filter in
+	// LogInclude (when set) and none in LogExclude; filter levels may be "+",
+	// a final "#" or glob patterns. Devices are updated either way.
+	LogInclude []string `json:"logInclude,omitempty"`
+	LogExclude []string `json:"logExclude,omitempty"`
+
+	// Payloads longer than this many bytes are truncated in the message log
+	// and archive; GetFullPayload returns the whole payload while the
+	// message is in the log. Zero keeps payloads whole.
+	LogPayloadLimit int `json:"logPayloadLimit"`
+
+	// The message log keeps the newest LogCapacity messages, dropping those
+	// older than LogRetentionMinutes (zero keeps them until they are pushed
+	// out). With LogPersist the newest messages are restored from the
+	// message archive at the next start, so it needs MessageArchive.
+	LogCapacity         int  `json:"logCapacity"`
+	LogRetentionMinutes int  `json:"logRetentionMinutes"`
+	LogPersist          bool `json:"logPersist"`
+
+	// Entries of timeline.log older than TimelineDays are removed once a
+	// day; zero keeps them forever
+	TimelineDays int `json:"timelineDays"`
+
+	// Keep every logged message in the messages.db database in the config
+	// directory, dropping messages older than MessageArchiveDays and the
+	// oldest ones once they exceed MessageArchiveMB; zero disables either
+	// limit.
+	MessageArchive     bool `json:"messageArchive"`
+	MessageArchiveDays int  `json:"messageArchiveDays"`
+	MessageArchiveMB   int  `json:"messageArchiveMB"`
+
+	// Write every message sent or received, whatever the log filters, pause
+	// or mutes, to traffic-*.log files in the traffic directory of the config
+	// directory. A new file starts once one reaches TrafficLogMB, files
+	// older than TrafficLogDays are removed and the oldest files are removed
+	// while all of them take more than TrafficLogTotalMB; zero disables any
+	// of the limits.
+	TrafficLog        bool `json:"trafficLog"`
+	TrafficLogMB      int  `json:"trafficLogMB"`
+	TrafficLogDays    int  `json:"trafficLogDays"`
+	TrafficLogTotalMB int  `json:"trafficLogTotalMB"`
+
+	// Maximum events per second pushed to the frontend, keyed by event name
+	// (e.g. "message:new"); missing or zero means unlimited. Events about an
+	// outlet, such as device:update, are limited per outlet.
+	EventThrottle map[string]float64 `json:"eventThrottle,omitempty"`
+
+	// Write every event to the application log, for debugging integrations
+	LogEvents bool `json:"logEvents,omitempty"`
+
+	// Kiosk mode for shared touch panels: only KioskOutlets ("device:outlet",
+	// glob patterns allowed) are shown and switchable, only KioskScenes can
+	// be applied, and settings APIs are disabled. It can only be turned off
+	// by editing the config file.
+	KioskMode    bool     `json:"kioskMode,omitempty"`
+	KioskOutlets []string `json:"kioskOutlets,omitempty"`
+	KioskScenes  []string `json:"kioskScenes,omitempty"` // scene names
 }
 
+// Default connection timing values, in seconds
+const (
+	DefaultKeepAlive            = 5
+	DefaultPingTimeout          = 20
+	DefaultConnectTimeout       = 20
+	DefaultMaxReconnectInterval = 10
+	DefaultReconnectDelay       = 1
+	DefaultAutoConnectRetries   = 3
+	DefaultPublishBurst         = 10
+	DefaultPublishMaxWait       = 1000
+	DefaultAnomalyLearningDays  = 7
+	DefaultStatusAuditWait      = 10
+	DefaultConfirmationWindow   = 60
+	DefaultMaxElevationDuration = 900
+	DefaultCommandAckTimeout    = 10
+	DefaultLoopMaxCommands      = 6
+	DefaultLoopWindow           = 60
+	DefaultBulkCommandDelay     = 250 // milliseconds
+	DefaultMessageArchiveDays   = 7
+	DefaultTimelineDays         = 180
+	DefaultMessageArchiveMB     = 50
+	DefaultTrafficLogMB         = 10
+	DefaultTrafficLogDays       = 14
+	DefaultTrafficLogTotalMB    = 1000
+	DefaultLogPayloadLimit      = 16384 // bytes
+	DefaultLogCapacity          = 1000  // messages
+	MaxLogCapacity              = 100000
+)
+
 // DefaultConfig returns a config with default values
 func DefaultConfig() *Config {
 	return &Config{
-		ServerPort:      1883,
-		SubscribeString: "power/#",
+		SchemaVersion:         SchemaVersion,
+		ServerPort:            1883,
+		SubscribeString:       "power/#",
+		KeepAlive:             DefaultKeepAlive,
+		PingTimeout:           DefaultPingTimeout,
+		ConnectTimeout:        DefaultConnectTimeout,
+		MaxReconnectInterval:  DefaultMaxReconnectInterval,
+		ReconnectInitialDelay: DefaultReconnectDelay,
+		AutoConnect:           true,
+		AutoConnectRetries:    DefaultAutoConnectRetries,
+		PublishBurst:          DefaultPublishBurst,
+		PublishMaxWait:        DefaultPublishMaxWait,
+		PublishOverflow:       "error",
+		AnomalySensitivity:    "medium",
+		AnomalyLearningDays:   DefaultAnomalyLearningDays,
+		StatusAuditWait:       DefaultStatusAuditWait,
+		ConfirmationWindow:    DefaultConfirmationWindow,
+		MaxElevationDuration:  DefaultMaxElevationDuration,
+		CommandAckTimeout:     DefaultCommandAckTimeout,
+		LoopMaxCommands:       DefaultLoopMaxCommands,
+		LoopWindow:            DefaultLoopWindow,
+		BulkCommandDelay:      DefaultBulkCommandDelay,
+		MessageArchiveDays:    DefaultMessageArchiveDays,
+		TimelineDays:          DefaultTimelineDays,
+		MessageArchiveMB:      DefaultMessageArchiveMB,
+		TrafficLogMB:          DefaultTrafficLogMB,
+		TrafficLogDays:        DefaultTrafficLogDays,
+		TrafficLogTotalMB:     DefaultTrafficLogTotalMB,
+		LogPayloadLimit:       DefaultLogPayloadLimit,
+		LogCapacity:           DefaultLogCapacity,
 	}
 }
 
-// getConfigPath returns the OS-specific configuration file path
-func getConfigPath() (string, error) {
-	var configDir string
-
-	// Determine config directory based on OS
-	if os.Getenv("APPDATA") != "" {
-		// Windows
-		configDir = filepath.Join(os.Getenv("APPDATA"), "GoMQTTPowerControl")
-	} else {
-		// Linux/Unix
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		configDir = filepath.Join(home, ".config", "go-mqtt-power-control")
+// getConfigDir returns the configuration directory: the override if one
+// is set, otherwise the OS-specific one
+func getConfigDir() (string, error) {
+	configDir, err := resolveConfigDir()
+	if err != nil {
+		return "", err
 	}
 
 	// Create config directory if it doesn't exist
@@ -46,7 +434,26 @@ func getConfigPath() (string, error) {
 		return "", fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	return filepath.Join(configDir, "config.json"), nil
+	return configDir, nil
+}
+
+// getConfigPath returns the OS-specific configuration file path
+func getConfigPath() (string, error) {
+	return DataPath("config.json")
+}
+
+// Path returns the path of the config file
+func Path() (string, error) {
+	return getConfigPath()
+}
+
+// DataPath returns the path of a named data file stored alongside the config
+func DataPath(name string) (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, name), nil
 }
 
 // Load reads the configuration from disk
@@ -65,21 +472,63 @@ func Load() (*Config, error) {
 	// Read file
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, &LoadError{Kind: LoadErrorRead, Path: configPath, Err: err}
 	}
 
-	// Parse JSON
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	config, version, err := parseVersioned(data, configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upgrade the file in place, keeping the original. A read-only or full
+	// disk must not stop the app: the migrated config is still used, and
+	// the file is migrated again at the next start.
+	if version < SchemaVersion {
+		if err := saveMigrated(config, configPath, data, version); err != nil {
+			log.Printf("Config file not upgraded from schema version %d, using the upgraded settings for now: %v", version, err)
+		}
+	}
+	return config, nil
+}
+
+// Parse decodes, migrates and validates config contents that did not come
+// from the config file, e.g. from a settings archive
+func Parse(data []byte) (*Config, error) {
+	config, _, err := parseVersioned(data, "")
+	return config, err
+}
+
+// parse decodes, migrates and validates config file contents
+func parse(data []byte, configPath string) (*Config, error) {
+	config, _, err := parseVersioned(data, configPath)
+	return config, err
+}
+
+// parseVersioned is parse that also returns the schema version the file
+// was written with
+func parseVersioned(data []byte, configPath string) (*Config, int, error) {
+	var syntax *json.SyntaxError
+	var mistyped *json.UnmarshalTypeError
+	migrated, version, err := migrate(data)
+	if errors.As(err, &syntax) || errors.As(err, &mistyped) {
+		return nil, version, &LoadError{Kind: LoadErrorParse, Path: configPath, Err: err}
+	}
+	if err != nil {
+		return nil, version, &LoadError{Kind: LoadErrorInvalid, Path: configPath, Err: err}
+	}
+
+	// Parse JSON on top of the defaults so fields missing from older files keep their default
+	config := DefaultConfig()
+	if err := json.Unmarshal(migrated, config); err != nil {
+		return nil, version, &LoadError{Kind: LoadErrorParse, Path: configPath, Err: err}
 	}
 
 	// Validate
 	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+		return nil, version, &LoadError{Kind: LoadErrorInvalid, Path: configPath, Err: err, Partial: config}
 	}
 
-	return &config, nil
+	return config, version, nil
 }
 
 // Save writes the configuration to disk
@@ -93,6 +542,7 @@ func (c *Config) Save() error {
 	if err := c.Validate(); err != nil {
 		return fmt.Errorf("invalid config: %w", err)
 	}
+	c.SchemaVersion = SchemaVersion
 
 	// Marshal to JSON with indentation
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -100,8 +550,14 @@ func (c *Config) Save() error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	// Write file with restricted permissions (user read/write only)
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
+	// Keep the previous file so it can be restored if the new one turns out bad
+	if err := backup(configPath); err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+
+	// Swap in a complete file with restricted permissions (user read/write
+	// only), so the config watcher never reads a partial one
+	if err := models.WriteFileAtomic(configPath, data); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
@@ -118,31 +574,695 @@ func (c *Config) Validate() error {
 		c.SubscribeString = "power/#"
 	}
 
+	if strings.ContainsAny(c.RepublishPrefix, "+#") || strings.HasPrefix(c.RepublishPrefix, "/") {
+		return fmt.Errorf("invalid republish prefix: %q", c.RepublishPrefix)
+	}
+
+	if c.StatusAuditInterval < 0 {
+		return fmt.Errorf("invalid status audit interval: %d", c.StatusAuditInterval)
+	}
+	if c.StatusAuditWait == 0 {
+		c.StatusAuditWait = DefaultStatusAuditWait
+	}
+	if c.StatusAuditWait < 1 || c.StatusAuditWait > 300 {
+		return fmt.Errorf("invalid status audit wait: %d", c.StatusAuditWait)
+	}
+
+	for name, watts := range c.CircuitCapacity {
+		if watts <= 0 {
+			return fmt.Errorf("invalid capacity for circuit %s: %g", name, watts)
+		}
+	}
+	for name, watts := range c.GroupCapacity {
+		if watts <= 0 {
+			return fmt.Errorf("invalid capacity for group %s: %g", name, watts)
+		}
+	}
+
+	if c.StaleAfter < 0 {
+		return fmt.Errorf("invalid stale window: %d", c.StaleAfter)
+	}
+	if c.PurgeStaleAfter < 0 || (c.PurgeStaleAfter > 0 && c.PurgeStaleAfter < c.StaleAfter) {
+		return fmt.Errorf("invalid stale purge window: %d (must be at least the stale window)", c.PurgeStaleAfter)
+	}
+
+	if c.EnergyDriftPercent < 0 {
+		return fmt.Errorf("invalid energy drift percentage: %g", c.EnergyDriftPercent)
+	}
+	for pattern, percent := range c.EnergyDrift {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid energy drift pattern %q: %w", pattern, err)
+		}
+		if percent < 0 {
+			return fmt.Errorf("invalid energy drift percentage for %s: %g", pattern, percent)
+		}
+	}
+
+	switch c.AnomalySensitivity {
+	case "":
+		c.AnomalySensitivity = "medium"
+	case "low", "medium", "high":
+	default:
+		return fmt.Errorf("invalid anomaly sensitivity: %s", c.AnomalySensitivity)
+	}
+	if c.AnomalyLearningDays == 0 {
+		c.AnomalyLearningDays = DefaultAnomalyLearningDays
+	}
+	if c.AnomalyLearningDays < 1 || c.AnomalyLearningDays > 365 {
+		return fmt.Errorf("invalid anomaly learning days: %d", c.AnomalyLearningDays)
+	}
+	for _, pattern := range c.AnomalyOptOut {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid anomaly opt-out pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, sub := range c.ProtocolSubscriptions {
+		if sub.Topic == "" || sub.Protocol == "" {
+			return fmt.Errorf("protocol subscriptions need a topic and a protocol")
+		}
+		if !knownProtocol(sub.Protocol) {
+			return fmt.Errorf("unknown protocol for %s: %s", sub.Topic, sub.Protocol)
+		}
+	}
+
+	for filter, mode := range c.TopicValidation {
+		switch mode {
+		case "strict", "lenient", "ignore":
+		default:
+			return fmt.Errorf("invalid topic validation mode for %s: %s", filter, mode)
+		}
+	}
+
+	for _, mapping := range c.PayloadMappings {
+		if err := mapping.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, assignment := range c.DeviceQuirks {
+		if err := assignment.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, board := range c.RelayBoards {
+		if err := board.validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, addr := range map[string]string{"syslog": c.SyslogAddress, "SNMP trap": c.SNMPTrapAddress} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid %s address %q: %w", name, addr, err)
+		}
+	}
+	switch c.SyslogNetwork {
+	case "", "udp", "tcp":
+	default:
+		return fmt.Errorf("invalid syslog network: %s", c.SyslogNetwork)
+	}
+	switch c.AlertForwardMinimum {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("invalid alert severity: %s", c.AlertForwardMinimum)
+	}
+
+	if c.ReplicaOf != "" {
+		u, err := url.Parse(c.ReplicaOf)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid primary address: %q", c.ReplicaOf)
+		}
+	}
+
+	if c.APIListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.APIListenAddress); err != nil {
+			return fmt.Errorf("invalid API listen address %q: %w", c.APIListenAddress, err)
+		}
+	}
+
+	if strings.ContainsAny(c.SharedSubscriptionGroup, "/+#") {
+		return fmt.Errorf("invalid shared subscription group: %q", c.SharedSubscriptionGroup)
+	}
+
+	// Fill in timing defaults for configs saved before these fields existed
+	if c.KeepAlive == 0 {
+		c.KeepAlive = DefaultKeepAlive
+	}
+	if c.PingTimeout == 0 {
+		c.PingTimeout = DefaultPingTimeout
+	}
+	if c.ConnectTimeout == 0 {
+		c.ConnectTimeout = DefaultConnectTimeout
+	}
+	if c.MaxReconnectInterval == 0 {
+		c.MaxReconnectInterval = DefaultMaxReconnectInterval
+	}
+
+	if c.KeepAlive < 1 || c.KeepAlive > 65535 {
+		return fmt.Errorf("invalid keepalive interval: %d", c.KeepAlive)
+	}
+	if c.PingTimeout < 1 || c.PingTimeout > 3600 {
+		return fmt.Errorf("invalid ping timeout: %d", c.PingTimeout)
+	}
+	if c.ConnectTimeout < 1 || c.ConnectTimeout > 3600 {
+		return fmt.Errorf("invalid connect timeout: %d", c.ConnectTimeout)
+	}
+	if c.MaxReconnectInterval < 1 || c.MaxReconnectInterval > 86400 {
+		return fmt.Errorf("invalid max reconnect interval: %d", c.MaxReconnectInterval)
+	}
+
+	if c.ReconnectInitialDelay == 0 {
+		c.ReconnectInitialDelay = DefaultReconnectDelay
+	}
+	if c.ReconnectInitialDelay < 1 || c.ReconnectInitialDelay > c.MaxReconnectInterval {
+		return fmt.Errorf("invalid reconnect initial delay: %d", c.ReconnectInitialDelay)
+	}
+	if c.ReconnectMaxAttempts < 0 {
+		return fmt.Errorf("invalid reconnect max attempts: %d", c.ReconnectMaxAttempts)
+	}
+	if c.AutoConnectRetries < 0 || c.AutoConnectRetries > 100 {
+		return fmt.Errorf("invalid auto-connect retries: %d", c.AutoConnectRetries)
+	}
+
+	if c.PublishRate < 0 {
+		return fmt.Errorf("invalid publish rate: %g", c.PublishRate)
+	}
+	if c.PublishBurst == 0 {
+		c.PublishBurst = DefaultPublishBurst
+	}
+	if c.PublishBurst < 1 {
+		return fmt.Errorf("invalid publish burst: %d", c.PublishBurst)
+	}
+	if c.PublishMaxWait < 0 || c.PublishMaxWait > 60000 {
+		return fmt.Errorf("invalid publish max wait: %d", c.PublishMaxWait)
+	}
+	if c.BulkCommandDelay < 0 || c.BulkCommandDelay > 60000 {
+		return fmt.Errorf("invalid bulk command delay: %d", c.BulkCommandDelay)
+	}
+	if c.TimelineDays < 0 || c.TimelineDays > 3650 {
+		return fmt.Errorf("invalid timeline days: %d", c.TimelineDays)
+	}
+	if c.MessageArchiveDays < 0 || c.MessageArchiveDays > 3650 {
+		return fmt.Errorf("invalid message archive days: %d", c.MessageArchiveDays)
+	}
+	if c.MessageArchiveMB < 0 || c.MessageArchiveMB > 100000 {
+		return fmt.Errorf("invalid message archive size: %d MB", c.MessageArchiveMB)
+	}
+	if c.LogPayloadLimit < 0 {
+		return fmt.Errorf("invalid log payload limit: %d", c.LogPayloadLimit)
+	}
+	if c.LogCapacity < 10 || c.LogCapacity > MaxLogCapacity {
+		return fmt.Errorf("message log capacity must be 10 to %d messages, not %d", MaxLogCapacity, c.LogCapacity)
+	}
+	if c.LogRetentionMinutes < 0 || c.LogRetentionMinutes > 525600 {
+		return fmt.Errorf("invalid message log retention: %d minutes", c.LogRetentionMinutes)
+	}
+	if c.LogPersist && !c.MessageArchive {
+		return fmt.Errorf("logPersist restores the message log from the archive; enable messageArchive")
+	}
+	if c.TrafficLogMB < 0 || c.TrafficLogMB > 100000 {
+		return fmt.Errorf("invalid traffic log file size: %d MB", c.TrafficLogMB)
+	}
+	if c.TrafficLogDays < 0 || c.TrafficLogDays > 3650 {
+		return fmt.Errorf("invalid traffic log days: %d", c.TrafficLogDays)
+	}
+	if c.TrafficLogTotalMB < 0 || c.TrafficLogTotalMB > 10000000 {
+		return fmt.Errorf("invalid traffic log total size: %d MB", c.TrafficLogTotalMB)
+	}
+	switch c.PublishOverflow {
+	case "":
+		c.PublishOverflow = "error"
+	case "error", "drop", "queue":
+	default:
+		return fmt.Errorf("invalid publish overflow policy: %s", c.PublishOverflow)
+	}
+
+	if c.CommandAckTimeout == 0 {
+		c.CommandAckTimeout = DefaultCommandAckTimeout
+	}
+	if c.CommandAckTimeout < 1 || c.CommandAckTimeout > 600 {
+		return fmt.Errorf("invalid command acknowledgement timeout: %d", c.CommandAckTimeout)
+	}
+
+	if c.LoopMaxCommands == 0 {
+		c.LoopMaxCommands = DefaultLoopMaxCommands
+	}
+	if c.LoopMaxCommands < 2 || c.LoopMaxCommands > 1000 {
+		return fmt.Errorf("invalid loop command limit: %d", c.LoopMaxCommands)
+	}
+	if c.LoopWindow == 0 {
+		c.LoopWindow = DefaultLoopWindow
+	}
+	if c.LoopWindow < 1 || c.LoopWindow > 3600 {
+		return fmt.Errorf("invalid loop window: %d", c.LoopWindow)
+	}
+
+	if c.ConfirmationWindow == 0 {
+		c.ConfirmationWindow = DefaultConfirmationWindow
+	}
+	if c.ConfirmationWindow < 1 || c.ConfirmationWindow > 3600 {
+		return fmt.Errorf("invalid confirmation window: %d", c.ConfirmationWindow)
+	}
+
+	if c.MaxElevationDuration == 0 {
+		c.MaxElevationDuration = DefaultMaxElevationDuration
+	}
+	if c.MaxElevationDuration < 1 || c.MaxElevationDuration > 86400 {
+		return fmt.Errorf("invalid max elevation duration: %d", c.MaxElevationDuration)
+	}
+
+	names := make(map[string]bool)
+	for _, profile := range c.Profiles {
+		if profile.Name == "" || names[profile.Name] {
+			return fmt.Errorf("profile names must be unique and non-empty: %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.ServerPort < 1 || profile.ServerPort > 65535 {
+			return fmt.Errorf("invalid server port for profile %s: %d", profile.Name, profile.ServerPort)
+		}
+	}
+
+	for _, rule := range c.LocationRules {
+		if rule.Location == "" {
+			return fmt.Errorf("location rule %s needs a location", rule.Topic)
+		}
+		if err := models.ValidateTopicPattern(rule.Topic); err != nil {
+			return fmt.Errorf("invalid location rule topic %q: %w", rule.Topic, err)
+		}
+	}
+
+	views := make(map[string]bool)
+	for i, view := range c.Views {
+		if view.Name == "" || views[view.Name] {
+			return fmt.Errorf("view names must be unique and non-empty: %q", view.Name)
+		}
+		views[view.Name] = true
+		if err := view.validate(); err != nil {
+			return err
+		}
+		if view.Sort == "" {
+			c.Views[i].Sort = ViewSorts[0]
+		}
+	}
+
+	for event, rate := range c.EventThrottle {
+		if rate < 0 {
+			return fmt.Errorf("invalid throttle rate for %s: %g", event, rate)
+		}
+	}
+
+	for _, filter := range c.LogInclude {
+		if err := models.ValidateTopicPattern(filter); err != nil {
+			return fmt.Errorf("invalid log include filter %q: %w", filter, err)
+		}
+	}
+	for _, filter := range c.LogExclude {
+		if err := models.ValidateTopicPattern(filter); err != nil {
+			return fmt.Errorf("invalid log exclude filter %q: %w", filter, err)
+		}
+	}
+
+	for _, pattern := range c.CriticalOutlets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid critical outlet pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range c.KioskOutlets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid kiosk outlet pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// LogsTopic reports whether received messages on a topic pass the log
+// include and exclude filters
+func (c *Config) LogsTopic(topic string) bool {
+	if len(c.LogInclude) > 0 {
+		included := false
+		for _, filter := range c.LogInclude {
+			if models.MatchTopic(filter, topic) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, filter := range c.LogExclude {
+		if models.MatchTopic(filter, topic) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidationFor returns the handling mode for unparseable messages on a
+// topic: that of the most specific matching filter, else "strict"
+func (c *Config) ValidationFor(topic string) string {
+	mode, best := "strict", ""
+	for filter, filterMode := range c.TopicValidation {
+		if !models.MatchTopic(filter, topic) {
+			continue
+		}
+		if best == "" || len(filter) > len(best) || (len(filter) == len(best) && filter < best) {
+			mode, best = filterMode, filter
+		}
+	}
+	return mode
+}
+
+// LocationFor returns the location of the first rule matching a topic, or
+// an empty string if none does
+func (c *Config) LocationFor(topic string) string {
+	for _, rule := range c.LocationRules {
+		if models.MatchTopic(rule.Topic, topic) {
+			return rule.Location
+		}
+	}
+	return ""
+}
+
+// FindView returns the view with the given name
+func (c *Config) FindView(name string) (View, bool) {
+	for _, view := range c.Views {
+		if view.Name == name {
+			return view, true
+		}
+	}
+	return View{}, false
+}
+
+// FindProfile returns the profile with the given name
+func (c *Config) FindProfile(name string) (Profile, bool) {
+	for _, profile := range c.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// SetPassword stores the profile password in the OS keychain, or encrypted
+// if there is none
+func (p *Profile) SetPassword(plaintext string) error {
+	stored, err := storePassword(profileAccount+p.Name, plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	p.PasswordHash = stored
 	return nil
 }
 
+// GetPassword returns the profile password
+func (p *Profile) GetPassword() (string, error) {
+	plaintext, err := loadPassword(p.PasswordHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return plaintext, nil
+}
+
+// DeletePassword removes the profile password from the OS keychain
+func (p *Profile) DeletePassword() {
+	deletePassword(p.PasswordHash)
+}
+
+// DefaultRepublishPrefix roots the normalized state feed
+const DefaultRepublishPrefix = "powercontrol"
+
+// RepublishRoot returns the prefix of the normalized state feed
+func (c *Config) RepublishRoot() string {
+	if c.RepublishPrefix == "" {
+		return DefaultRepublishPrefix
+	}
+	return strings.TrimSuffix(c.RepublishPrefix, "/")
+}
+
+// AvailabilityTopic returns the topic announcing whether this instance is online
+func (c *Config) AvailabilityTopic() string {
+	return c.RepublishRoot() + "/status"
+}
+
+// SubscriptionTopic returns the topic filter to subscribe to, including the
+// shared subscription prefix when a group is configured
+func (c *Config) SubscriptionTopic() string {
+	if c.SharedSubscriptionGroup == "" {
+		return c.SubscribeString
+	}
+	return "$share/" + c.SharedSubscriptionGroup + "/" + c.SubscribeString
+}
+
+// IsCritical reports whether the given outlet requires two-person confirmation
+func (c *Config) IsCritical(deviceName, outletNumber string) bool {
+	return matchOutlet(c.CriticalOutlets, deviceName, outletNumber)
+}
+
+// IsHiddenDevice reports whether a device is hidden from the device list
+func (c *Config) IsHiddenDevice(deviceName string) bool {
+	for _, name := range c.HiddenDevices {
+		if name == deviceName {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFavorite reports whether an outlet is pinned as a favorite
+func (c *Config) IsFavorite(deviceName, outletNumber string) bool {
+	key := deviceName + ":" + outletNumber
+	for _, favorite := range c.Favorites {
+		if favorite == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocked reports whether an outlet is locked against switching
+func (c *Config) IsLocked(deviceName, outletNumber string) bool {
+	key := deviceName + ":" + outletNumber
+	for _, locked := range c.LockedOutlets {
+		if locked == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKioskOutlet reports whether an outlet is whitelisted for kiosk mode
+func (c *Config) IsKioskOutlet(deviceName, outletNumber string) bool {
+	return matchOutlet(c.KioskOutlets, deviceName, outletNumber)
+}
+
+// IsKioskScene reports whether a scene is whitelisted for kiosk mode
+func (c *Config) IsKioskScene(name string) bool {
+	for _, scene := range c.KioskScenes {
+		if strings.EqualFold(scene, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAnomalyOptOut reports whether an outlet is excluded from anomaly detection
+func (c *Config) IsAnomalyOptOut(deviceName, outletNumber string) bool {
+	return matchOutlet(c.AnomalyOptOut, deviceName, outletNumber)
+}
+
+// DriftThreshold returns the energy drift percentage that triggers an alert
+// for an outlet; zero means drift is not checked
+func (c *Config) DriftThreshold(deviceName, outletNumber string) float64 {
+	key := deviceName + ":" + outletNumber
+	if percent, ok := c.EnergyDrift[key]; ok {
+		return percent
+	}
+
+	// Fall back to the patterns in a stable order
+	patterns := make([]string, 0, len(c.EnergyDrift))
+	for pattern := range c.EnergyDrift {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return c.EnergyDrift[pattern]
+		}
+	}
+
+	return c.EnergyDriftPercent
+}
+
+// matchOutlet reports whether "device:outlet" matches any of the glob patterns
+func matchOutlet(patterns []string, deviceName, outletNumber string) bool {
+	key := deviceName + ":" + outletNumber
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// PayloadMappingFor returns the first payload mapping matching a device
+func (c *Config) PayloadMappingFor(deviceName string) (PayloadMapping, bool) {
+	for _, mapping := range c.PayloadMappings {
+		if len(mapping.Devices) == 0 {
+			return mapping, true
+		}
+		for _, pattern := range mapping.Devices {
+			if matched, _ := path.Match(pattern, deviceName); matched {
+				return mapping, true
+			}
+		}
+	}
+	return PayloadMapping{}, false
+}
+
+// QuirksFor returns the quirks of the first assignment matching a device
+func (c *Config) QuirksFor(deviceName string) []string {
+	for _, assignment := range c.DeviceQuirks {
+		if len(assignment.Devices) == 0 {
+			return assignment.Quirks
+		}
+		for _, pattern := range assignment.Devices {
+			if matched, _ := path.Match(pattern, deviceName); matched {
+				return assignment.Quirks
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a quirk assignment's device patterns
+func (q QuirkAssignment) validate() error {
+	if len(q.Quirks) == 0 {
+		return fmt.Errorf("quirk assignments need at least one quirk")
+	}
+	for _, pattern := range q.Devices {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid device pattern in quirk assignment: %q", pattern)
+		}
+	}
+	return nil
+}
+
+// validate checks that a payload mapping is usable and unambiguous
+func (m PayloadMapping) validate() error {
+	if len(m.On) == 0 || len(m.Off) == 0 {
+		return fmt.Errorf("payload mappings need at least one ON and one OFF payload")
+	}
+	for _, pattern := range m.Devices {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid device pattern in payload mapping: %q", pattern)
+		}
+	}
+	for _, on := range m.On {
+		for _, off := range m.Off {
+			if on == off || (!m.CaseSensitive && strings.EqualFold(on, off)) {
+				return fmt.Errorf("payload %q is mapped to both ON and OFF", on)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks a view's sort key and outlet patterns
+func (v View) validate() error {
+	valid := v.Sort == ""
+	for _, sort := range ViewSorts {
+		valid = valid || v.Sort == sort
+	}
+	if !valid {
+		return fmt.Errorf("invalid sort for view %s: %s", v.Name, v.Sort)
+	}
+	for _, pattern := range v.Outlets {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid outlet pattern in view %s: %q", v.Name, pattern)
+		}
+	}
+	return nil
+}
+
+// MatchesOutlet reports whether an outlet is selected by the view's patterns
+func (v View) MatchesOutlet(deviceName, outletNumber string) bool {
+	return len(v.Outlets) == 0 || matchOutlet(v.Outlets, deviceName, outletNumber)
+}
+
+// validate checks that a relay board's topic yields a device name and that
+// its channel count fits in a bitmask
+func (b RelayBoard) validate() error {
+	if b.Topic == "" {
+		return fmt.Errorf("relay boards need a topic")
+	}
+	levels := strings.Split(b.Topic, "/")
+	for i, level := range levels {
+		if (strings.Contains(level, "#") && (level != "#" || i != len(levels)-1)) ||
+			(strings.Contains(level, "+") && level != "+") {
+			return fmt.Errorf("invalid relay board topic: %s", b.Topic)
+		}
+	}
+	if b.Device == "" && !strings.Contains(b.Topic, "+") {
+		return fmt.Errorf("relay board %s needs a device name or a '+' level", b.Topic)
+	}
+	if strings.ContainsAny(b.Device, "/+#") {
+		return fmt.Errorf("invalid relay board device name: %q", b.Device)
+	}
+	if b.Channels < 1 || b.Channels > 64 {
+		return fmt.Errorf("invalid channel count for relay board %s: %d", b.Topic, b.Channels)
+	}
+	return nil
+}
+
+// SetElevationPIN hashes and stores the elevation PIN; an empty PIN disables elevation
+func (c *Config) SetElevationPIN(pin string) error {
+	if pin == "" {
+		c.ElevationPINHash = ""
+		return nil
+	}
+
+	hashed, err := HashPIN(pin)
+	if err != nil {
+		return fmt.Errorf("failed to hash PIN: %w", err)
+	}
+	c.ElevationPINHash = hashed
+	return nil
+}
+
+// CheckElevationPIN verifies a PIN against the stored elevation PIN
+func (c *Config) CheckElevationPIN(pin string) bool {
+	return c.ElevationPINHash != "" && VerifyPIN(pin, c.ElevationPINHash)
+}
+
 // IsEmpty checks if the config has required fields set
 func (c *Config) IsEmpty() bool {
 	return c.MQTTServer == "" || c.Username == ""
 }
 
-// SetPassword encrypts and stores the password
+// SetPassword stores the broker password in the OS keychain, or encrypted
+// if there is none
 func (c *Config) SetPassword(plaintext string) error {
-	encrypted, err := EncryptPassword(plaintext)
+	stored, err := storePassword(brokerAccount, plaintext)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
-	c.PasswordHash = encrypted
+	c.PasswordHash = stored
 	return nil
 }
 
-// GetPassword decrypts and returns the password
+// GetPassword returns the broker password
 func (c *Config) GetPassword() (string, error) {
 	if c.PasswordHash == "" {
 		return "", nil
 	}
 
-	plaintext, err := DecryptPassword(c.PasswordHash)
+	plaintext, err := loadPassword(c.PasswordHash)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt password: %w", err)
 	}
@@ -3,13 +3,18 @@ package config
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // getEncryptionKey generates a machine-specific encryption key
@@ -124,3 +129,160 @@ func DecryptPassword(ciphertext string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// pinIterations is the PBKDF2 iteration count of new PIN hashes. PINs are
+// short, so only a slow key derivation keeps a leaked config file from
+// giving them away.
+const pinIterations = 600000
+
+// HashPIN derives a salted PBKDF2-SHA256 hash of a PIN
+// Returns "pbkdf2-sha256$iterations$salt$hash" with salt and hash base64-encoded
+func HashPIN(pin string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	hash, err := pbkdf2.Key(sha256.New, pin, salt, pinIterations, 32)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive key: %w", err)
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passphraseKDF, pinIterations,
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPIN checks a PIN against a hash produced by HashPIN, or by older
+// versions, which stored "salt$hash" of a single salted SHA-256
+func VerifyPIN(pin, hashed string) bool {
+	parts := strings.Split(hashed, "$")
+	var saltPart, hashPart string
+	iterations := 0
+	switch {
+	case len(parts) == 4 && parts[0] == passphraseKDF:
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 || n > maxPassphraseIterations {
+			return false
+		}
+		iterations, saltPart, hashPart = n, parts[2], parts[3]
+	case len(parts) == 2:
+		saltPart, hashPart = parts[0], parts[1]
+	default:
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(saltPart)
+	if err != nil {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(hashPart)
+	if err != nil || len(expected) != sha256.Size {
+		return false
+	}
+
+	var hash []byte
+	if iterations == 0 {
+		sum := sha256.Sum256(append(salt, []byte(pin)...))
+		hash = sum[:]
+	} else if hash, err = pbkdf2.Key(sha256.New, pin, salt, iterations, len(expected)); err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, expected) == 1
+}
+
+// PINHashOutdated reports whether a PIN hash was made by an older version
+// and should be replaced by a new hash of the PIN once it is verified
+func PINHashOutdated(hashed string) bool {
+	return !strings.HasPrefix(hashed, fmt.Sprintf("%s$%d$", passphraseKDF, pinIterations))
+}
+
+// Passphrase-sealed files are keyed with PBKDF2-SHA256, unlike passwords in
+// the config, so they can be opened on another machine
+const (
+	passphraseKDF        = "pbkdf2-sha256"
+	passphraseIterations = 600000
+	MinPassphraseLength  = 8
+
+	// Iteration counts accepted when opening a file: fewer would be weak,
+	// more would let a crafted file stall the app deriving the key
+	minPassphraseIterations = 100000
+	maxPassphraseIterations = 10000000
+)
+
+// sealedFile is the JSON envelope of a passphrase-sealed file
+type sealedFile struct {
+	Format     string `json:"format"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// passphraseGCM derives the AES-256-GCM cipher of a passphrase and salt
+func passphraseGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealWithPassphrase encrypts data with a passphrase into a JSON envelope
+// labelled with format, which OpenWithPassphrase checks
+func SealWithPassphrase(format string, data []byte, passphrase string) ([]byte, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return nil, fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLength)
+	}
+
+	sealed := sealedFile{Format: format, KDF: passphraseKDF, Iterations: passphraseIterations, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, sealed.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := passphraseGCM(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed.Data = gcm.Seal(nil, sealed.Nonce, data, []byte(format))
+
+	return json.MarshalIndent(sealed, "", "  ")
+}
+
+// OpenWithPassphrase decrypts a file written by SealWithPassphrase with the
+// same format
+func OpenWithPassphrase(format string, file []byte, passphrase string) ([]byte, error) {
+	var sealed sealedFile
+	if err := json.Unmarshal(file, &sealed); err != nil || sealed.Format == "" {
+		return nil, fmt.Errorf("not an encrypted %s file", format)
+	}
+	if sealed.Format != format {
+		return nil, fmt.Errorf("unsupported file format %q, expected %q", sealed.Format, format)
+	}
+	if sealed.KDF != passphraseKDF {
+		return nil, fmt.Errorf("unsupported key derivation %q", sealed.KDF)
+	}
+	if sealed.Iterations < minPassphraseIterations || sealed.Iterations > maxPassphraseIterations {
+		return nil, fmt.Errorf("unsupported key derivation iterations: %d (must be %d to %d)",
+			sealed.Iterations, minPassphraseIterations, maxPassphraseIterations)
+	}
+
+	gcm, err := passphraseGCM(passphrase, sealed.Salt, sealed.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("damaged file: invalid nonce")
+	}
+	data, err := gcm.Open(nil, sealed.Nonce, sealed.Data, []byte(format))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or damaged file")
+	}
+	return data, nil
+}
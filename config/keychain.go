@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Passwords are kept in the OS keychain (Windows Credential Manager, macOS
+// Keychain or the Secret Service on Linux) under keychainService. The config
+// file then holds keychainRef followed by the account name instead of the
+// AES ciphertext, which remains the fallback where no keychain is available.
+const (
+	keychainService = "go-powercontrol"
+	keychainRef     = "keychain:"
+	brokerAccount   = "broker"
+	profileAccount  = "profile:"
+)
+
+// storePassword saves a password under an account in the OS keychain and
+// returns the reference to keep in the config, falling back to encrypting it
+// if the keychain cannot be used. An empty password removes the entry.
+func storePassword(account, plaintext string) (string, error) {
+	if plaintext == "" {
+		deletePassword(keychainRef + account)
+		return "", nil
+	}
+	if err := keyring.Set(keychainService, account, plaintext); err == nil {
+		return keychainRef + account, nil
+	}
+	return EncryptPassword(plaintext)
+}
+
+// loadPassword returns the password a stored value refers to: a keychain
+// entry or an encrypted password
+func loadPassword(stored string) (string, error) {
+	account, ok := strings.CutPrefix(stored, keychainRef)
+	if !ok {
+		return DecryptPassword(stored)
+	}
+	plaintext, err := keyring.Get(keychainService, account)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password from the OS keychain: %w", err)
+	}
+	return plaintext, nil
+}
+
+// deletePassword removes the keychain entry a stored value refers to, if any
+func deletePassword(stored string) {
+	if account, ok := strings.CutPrefix(stored, keychainRef); ok {
+		keyring.Delete(keychainService, account) // Already gone is fine
+	}
+}
+
+// migratePassword moves an encrypted password into the OS keychain,
+// returning the new stored value and whether it changed. Passwords that
+// cannot be decrypted, or a keychain that cannot be used, leave it as is.
+func migratePassword(account, stored string) (string, bool) {
+	if stored == "" || strings.HasPrefix(stored, keychainRef) {
+		return stored, false
+	}
+	plaintext, err := DecryptPassword(stored)
+	if err != nil {
+		return stored, false
+	}
+	if err := keyring.Set(keychainService, account, plaintext); err != nil {
+		return stored, false
+	}
+	return keychainRef + account, true
+}
+
+// InKeychain reports whether the broker password is kept in the OS keychain
+func (c *Config) InKeychain() bool {
+	return strings.HasPrefix(c.PasswordHash, keychainRef)
+}
+
+// MigrateToKeychain moves the broker and profile passwords still stored
+// encrypted in the config into the OS keychain, reporting whether any moved
+// so the caller can save the config
+func (c *Config) MigrateToKeychain() bool {
+	var migrated, moved bool
+	c.PasswordHash, moved = migratePassword(brokerAccount, c.PasswordHash)
+	migrated = migrated || moved
+	for i := range c.Profiles {
+		profile := &c.Profiles[i]
+		profile.PasswordHash, moved = migratePassword(profileAccount+profile.Name, profile.PasswordHash)
+		migrated = migrated || moved
+	}
+	return migrated
+}
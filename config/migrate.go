@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SchemaVersion is the shape of the config file written by this version.
+// Bump it with each change older files cannot be read as, and add the
+// migration from the previous version to migrations.
+const SchemaVersion = 1
+
+// migration upgrades the raw fields of a config file by one schema version
+type migration struct {
+	to          int
+	description string
+	apply       func(fields map[string]json.RawMessage) error
+}
+
+// migrations upgrade config files in order, each from version to-1
+var migrations = []migration{
+	{
+		to:          1,
+		description: "add the schema version",
+		apply:       func(map[string]json.RawMessage) error { return nil }, // Unversioned files already have the version 1 shape
+	},
+}
+
+// fileVersion returns the schema version a config file was written with;
+// files from before versioning are version 0
+func fileVersion(fields map[string]json.RawMessage) (int, error) {
+	raw, ok := fields["schemaVersion"]
+	if !ok {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate upgrades config file contents to SchemaVersion, returning the
+// upgraded contents and the version the file had
+func migrate(data []byte) ([]byte, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, err
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage) // "null"
+	}
+	version, err := fileVersion(fields)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf("config schema version %d is newer than this version of the app supports (%d)", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return data, version, nil
+	}
+
+	for _, m := range migrations {
+		if m.to <= version {
+			continue
+		}
+		if err := m.apply(fields); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate config to schema version %d (%s): %w", m.to, m.description, err)
+		}
+	}
+	fields["schemaVersion"] = json.RawMessage(fmt.Sprint(SchemaVersion))
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, version, err
+	}
+	return migrated, version, nil
+}
+
+// saveMigrated keeps a copy of a config file as it was before migration,
+// next to it as config.json.v<version>.bak, and saves the migrated config
+func saveMigrated(cfg *Config, configPath string, original []byte, version int) error {
+	backupPath := fmt.Sprintf("%s.v%d.bak", configPath, version)
+	if err := os.WriteFile(backupPath, original, 0600); err != nil {
+		return fmt.Errorf("failed to back up config file before migration: %w", err)
+	}
+	return cfg.Save()
+}
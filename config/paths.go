@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// DirEnv names the environment variable that overrides the config
+// directory, like SetDir
+const DirEnv = "POWERCONTROL_CONFIG_DIR"
+
+var (
+	dirOverride atomic.Pointer[string] // set by SetDir
+
+	osDirOnce sync.Once
+	osDir     string
+	osDirErr  error
+)
+
+// SetDir keeps the config and data files in dir instead of the OS config
+// directory; call it before anything else uses the config package
+func SetDir(dir string) {
+	dirOverride.Store(&dir)
+}
+
+// resolveConfigDir returns the override directory or, moving the files of
+// an older version over on first use, the OS config directory
+func resolveConfigDir() (string, error) {
+	if dir := dirOverride.Load(); dir != nil && *dir != "" {
+		return *dir, nil
+	}
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+
+	osDirOnce.Do(func() {
+		var base string
+		base, osDirErr = os.UserConfigDir()
+		if osDirErr != nil {
+			osDirErr = fmt.Errorf("failed to get config directory: %w", osDirErr)
+			return
+		}
+		osDir = migrateLegacyDir(filepath.Join(base, appDirName()))
+	})
+	return osDir, osDirErr
+}
+
+// appDirName is the name of the app's directory in the OS config directory
+func appDirName() string {
+	if runtime.GOOS == "windows" {
+		return "GoMQTTPowerControl"
+	}
+	return "go-mqtt-power-control"
+}
+
+// legacyDirs are the config directories of older versions, which used
+// %APPDATA% when set and ~/.config otherwise, whatever the OS
+func legacyDirs() []string {
+	dirs := make([]string, 0, 2)
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		dirs = append(dirs, filepath.Join(appData, "GoMQTTPowerControl"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "go-mqtt-power-control"))
+	}
+	return dirs
+}
+
+// migrateLegacyDir moves an older version's config directory to dir if dir
+// does not exist yet, and returns the directory to use: dir, or the old one
+// if it could not be moved
+func migrateLegacyDir(dir string) string {
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	for _, legacy := range legacyDirs() {
+		if legacy == dir {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(legacy, "config.json")); err != nil {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return legacy
+		}
+		if err := os.Rename(legacy, dir); err == nil {
+			return dir
+		}
+		// Another volume: copy, leaving the old directory as it was
+		if err := copyDir(legacy, dir); err != nil {
+			os.RemoveAll(dir)
+			return legacy
+		}
+		return dir
+	}
+	return dir
+}
+
+// copyDir copies a directory tree, keeping file permissions
+func copyDir(from, to string) error {
+	return filepath.WalkDir(from, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+// copyFile copies one file
+func copyFile(from, to string, mode os.FileMode) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// LoadErrorKind classifies why the config file could not be loaded
+type LoadErrorKind string
+
+const (
+	LoadErrorRead    LoadErrorKind = "read"
+	LoadErrorParse   LoadErrorKind = "parse"
+	LoadErrorInvalid LoadErrorKind = "invalid"
+)
+
+// LoadError is returned by Load when the config file exists but is unusable
+type LoadError struct {
+	Kind    LoadErrorKind
+	Path    string
+	Err     error
+	Partial *Config // parsed but invalid config, if parsing got that far
+}
+
+// Error implements the error interface
+func (e *LoadError) Error() string {
+	switch e.Kind {
+	case LoadErrorRead:
+		return fmt.Sprintf("failed to read config file: %v", e.Err)
+	case LoadErrorParse:
+		return fmt.Sprintf("failed to parse config file: %v", e.Err)
+	default:
+		return fmt.Sprintf("invalid config: %v", e.Err)
+	}
+}
+
+// Unwrap returns the underlying error
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// AsLoadError extracts a *LoadError from err, if there is one
+func AsLoadError(err error) (*LoadError, bool) {
+	var loadErr *LoadError
+	ok := errors.As(err, &loadErr)
+	return loadErr, ok
+}
+
+// backup copies the config file to its .bak sibling, if it exists
+func backup(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Never replace a good backup with a file that does not load
+	if _, err := parse(data, configPath); err != nil {
+		return nil
+	}
+
+	return os.WriteFile(configPath+".bak", data, 0600)
+}
+
+// PreserveBroken copies an unusable config file aside so it is not lost
+// when the user recovers, and returns the path of the copy
+func PreserveBroken() (string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	brokenPath := configPath + ".broken"
+	if err := os.WriteFile(brokenPath, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to preserve config file: %w", err)
+	}
+
+	return brokenPath, nil
+}
+
+// HasBackup reports whether a backup of a previously working config exists
+func HasBackup() bool {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(configPath + ".bak")
+	return err == nil
+}
+
+// RestoreBackup replaces the config file with the last known good backup
+func RestoreBackup() (*Config, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(configPath + ".bak")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	cfg, err := parse(data, configPath+".bak")
+	if err != nil {
+		return nil, fmt.Errorf("backup is unusable: %w", err)
+	}
+
+	if err := models.WriteFileAtomic(configPath, data); err != nil {
+		return nil, fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return cfg, nil
+}
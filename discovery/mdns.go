@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MQTTService is the DNS-SD service type advertised by MQTT brokers
+const MQTTService = "_mqtt._tcp"
+
+// mdnsAddr is the IPv4 multicast group used by mDNS
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Broker describes a broker found on the local network
+type Broker struct {
+	Instance  string   `json:"instance"`  // advertised service instance name
+	Host      string   `json:"host"`      // target host name
+	Port      int      `json:"port"`      // advertised port
+	Addresses []string `json:"addresses"` // resolved IP addresses
+	TXT       []string `json:"txt"`       // TXT record key=value pairs
+}
+
+// service accumulates records for a single service instance
+type service struct {
+	target string
+	port   int
+	txt    []string
+}
+
+// Browse sends a DNS-SD query for the given service type (e.g. "_mqtt._tcp")
+// and collects answers until the timeout elapses or ctx is cancelled
+func Browse(ctx context.Context, serviceType string, timeout time.Duration) ([]Broker, error) {
+	serviceName := strings.TrimSuffix(serviceType, ".") + ".local."
+
+	// Listen on an ephemeral port; responders answer such legacy queries via unicast
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	query, err := buildQuery(serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := conn.WriteToUDP(query, mdnsAddr); err != nil {
+		return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	// Unblock the read loop if the caller cancels early
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	instances := make(map[string]bool)
+	services := make(map[string]*service)
+	addresses := make(map[string][]string)
+
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("failed to read mDNS response: %w", err)
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			continue // Ignore malformed packets
+		}
+
+		records := append(append(msg.Answers, msg.Authorities...), msg.Additionals...)
+		for _, rr := range records {
+			name := strings.ToLower(rr.Header.Name.String())
+
+			switch body := rr.Body.(type) {
+			case *dnsmessage.PTRResource:
+				if name == strings.ToLower(serviceName) {
+					instances[strings.ToLower(body.PTR.String())] = true
+				}
+			case *dnsmessage.SRVResource:
+				svc := getService(services, name)
+				svc.target = strings.ToLower(body.Target.String())
+				svc.port = int(body.Port)
+			case *dnsmessage.TXTResource:
+				svc := getService(services, name)
+				svc.txt = body.TXT
+			case *dnsmessage.AResource:
+				addresses[name] = appendUnique(addresses[name], net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				addresses[name] = appendUnique(addresses[name], net.IP(body.AAAA[:]).String())
+			}
+		}
+	}
+
+	brokers := make([]Broker, 0, len(instances))
+	for instance := range instances {
+		svc, ok := services[instance]
+		if !ok || svc.port == 0 {
+			continue // Instance announced without an SRV record
+		}
+
+		brokers = append(brokers, Broker{
+			Instance:  strings.TrimSuffix(strings.TrimSuffix(instance, "."+strings.ToLower(serviceName)), "."),
+			Host:      strings.TrimSuffix(svc.target, "."),
+			Port:      svc.port,
+			Addresses: addresses[svc.target],
+			TXT:       svc.txt,
+		})
+	}
+
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].Instance < brokers[j].Instance })
+	return brokers, nil
+}
+
+// buildQuery builds a PTR query for a service name
+func buildQuery(serviceName string) ([]byte, error) {
+	name, err := dnsmessage.NewName(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	return msg.Pack()
+}
+
+// getService returns the accumulator for an instance, creating it if needed
+func getService(services map[string]*service, name string) *service {
+	svc, ok := services[name]
+	if !ok {
+		svc = &service{}
+		services[name] = svc
+	}
+	return svc
+}
+
+// appendUnique appends a value if it is not already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sink consumes published events. Transient events, which are not
+// journaled, arrive with a zero revision.
+type Sink func(env Envelope)
+
+// Bus journals events and fans them out to the registered sinks, so the
+// frontend, the remote API and headless consumers see the same stream
+type Bus struct {
+	mu      sync.RWMutex
+	journal *Journal
+	sinks   map[string]Sink
+}
+
+// NewBus creates a bus that records events in journal
+func NewBus(journal *Journal) *Bus {
+	return &Bus{journal: journal, sinks: make(map[string]Sink)}
+}
+
+// Subscribe registers a sink under a name, replacing any sink of that name
+func (b *Bus) Subscribe(name string, sink Sink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sinks[name] = sink
+}
+
+// Unsubscribe removes the named sink
+func (b *Bus) Unsubscribe(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sinks, name)
+}
+
+// Sinks returns the names of the registered sinks
+func (b *Bus) Sinks() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make([]string, 0, len(b.sinks))
+	for name := range b.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Publish journals an event and delivers it to every sink
+func (b *Bus) Publish(name string, data interface{}) Envelope {
+	env := b.journal.Append(name, data)
+	b.deliver(env)
+	return env
+}
+
+// PublishTransient delivers an event without journaling it, for periodic
+// snapshots and message traffic that are useless to replay and would push
+// state events out of the journal
+func (b *Bus) PublishTransient(name string, data interface{}) {
+	b.deliver(Envelope{Version: Version, Name: name, Timestamp: time.Now(), Data: data})
+}
+
+// deliver calls every sink in turn
+func (b *Bus) deliver(env Envelope) {
+	b.mu.RLock()
+	sinks := make([]Sink, 0, len(b.sinks))
+	for _, sink := range b.sinks {
+		sinks = append(sinks, sink)
+	}
+	b.mu.RUnlock()
+
+	for _, sink := range sinks {
+		sink(env)
+	}
+}
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Version is the version of the event payload contract. Bump it whenever a
+// payload struct changes shape so clients can detect incompatible backends.
+const Version = 1
+
+// Event names emitted to the frontend
+const (
+	MessageNew       = "message:new"
+	DeviceUpdate     = "device:update"
+	ConnectionStatus = "connection:status" // bool, kept for simple clients
+	ConnectionState  = "connection:state"  // detailed mqtt.ConnectionStatus
+	ConnectionStats  = "connection:stats"
+	LogCleared       = "log:cleared"
+	LogAppend        = "log:append"
+	ElevationChanged = "elevation:changed"
+	StartupReport    = "startup:report"
+	AlertRaised      = "alert:raised"
+	DeviceTelemetry  = "device:telemetry"
+	DeviceOffline    = "device:offline"
+	DeviceStale      = "device:stale"
+	DeviceRemoved    = "device:removed"
+
+	StatusAuditCompleted = "status-audit:completed"
+	OutletCycle          = "outlet:cycle"
+	CommissioningUpdate  = "commissioning:update"
+	ViewsChanged         = "views:changed"
+	MessagesUnparsed     = "messages:unparsed"
+	CommandConfirmed     = "command:confirmed"
+	CommandUnconfirmed   = "command:unconfirmed"
+	OutletDrifted        = "outlet:drifted"
+	GroupsChanged        = "groups:changed"
+	GroupCommand         = "group:command"
+	LogSuppressed        = "log:suppressed"
+	MessageLatency       = "message:latency"
+	BulkCommand          = "bulk:command"
+	ScenesChanged        = "scenes:changed"
+	SceneProgress        = "scene:progress"
+
+	ConfigRecoveryNeeded = "config:recovery-needed"
+	ConfigRecovered      = "config:recovered"
+	ConfigChanged        = "config:changed"
+)
+
+// Envelope wraps an event payload with its contract version and revision
+type Envelope struct {
+	Version   int         `json:"version"`
+	Revision  uint64      `json:"revision"`
+	Name      string      `json:"name"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// MessagePayload is the payload of message:new
+type MessagePayload struct {
+	ID        uint64 `json:"id"` // sequence number, as in the message log and archive
+	Direction string `json:"direction"`
+	Topic     string `json:"topic"`
+	Payload   string `json:"payload"`       // base64 if Encoding is "binary"
+	Hex       string `json:"hex,omitempty"` // hex dump if Encoding is "binary"
+	Encoding  string `json:"encoding"`      // "text" or "binary"
+	QoS       byte   `json:"qos"`
+	Retained  bool   `json:"retained"`
+	Duplicate bool   `json:"duplicate"`
+	PacketID  uint16 `json:"packetId"` // 0 for QoS 0 and sent messages
+}
+
+// TelemetryPayload is the payload of device:telemetry; nil readings were
+// not included in the report
+type TelemetryPayload struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Watts        *float64  `json:"watts,omitempty"`
+	Volts        *float64  `json:"volts,omitempty"`
+	Amps         *float64  `json:"amps,omitempty"`
+	KWh          *float64  `json:"kwh,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// CommandAckPayload is the payload of command:confirmed and
+// command:unconfirmed
+type CommandAckPayload struct {
+	ID           uint64     `json:"id"`
+	DeviceName   string     `json:"deviceName"`
+	OutletNumber string     `json:"outletNumber"`
+	State        string     `json:"state"`            // requested state, or TOGGLE
+	Reported     string     `json:"reported"`         // last state the outlet reported
+	Source       string     `json:"source,omitempty"` // who or what sent the command
+	SentAt       time.Time  `json:"sentAt"`
+	ConfirmedAt  *time.Time `json:"confirmedAt,omitempty"`
+	LatencyMs    float64    `json:"latencyMs,omitempty"` // from sending to confirmation
+	MessageID    uint64     `json:"messageId,omitempty"` // logged command message; 0 if it was not logged
+}
+
+// ConfigChangedPayload is the payload of config:changed, sent when the
+// config file was changed by another program and reloaded
+type ConfigChangedPayload struct {
+	Reconnect     bool     `json:"reconnect"`               // broker settings changed, so the connection is remade
+	KioskChanged  bool     `json:"kioskChanged"`            // kiosk mode was turned on or off; the window reloads
+	RestartNeeded []string `json:"restartNeeded,omitempty"` // changed settings only applied at the next start
+}
+
+// MessageLatencyPayload is the payload of message:latency, sent when the
+// state report confirming a logged command arrives
+type MessageLatencyPayload struct {
+	ID        uint64  `json:"id"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// DriftPayload is the payload of outlet:drifted
+type DriftPayload struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Desired      string    `json:"desired"` // state the last command asked for
+	Actual       string    `json:"actual"`  // state the outlet reports
+	Source       string    `json:"source,omitempty"`
+	SentAt       time.Time `json:"sentAt"`
+}
+
+// AvailabilityPayload is the payload of device:offline
+type AvailabilityPayload struct {
+	DeviceName   string `json:"deviceName"`
+	Availability string `json:"availability"`
+}
+
+// Replay is the result of a replay request
+type Replay struct {
+	Events   []Envelope `json:"events"`
+	Revision uint64     `json:"revision"` // latest revision at the time of the call
+	Complete bool       `json:"complete"` // false if events were evicted and a full reload is needed
+}
+
+// Journal keeps the most recent events so clients can catch up after a reload
+type Journal struct {
+	mu       sync.RWMutex
+	events   []Envelope // oldest first
+	maxSize  int
+	revision uint64
+}
+
+// NewJournal creates a journal holding at most maxSize events
+func NewJournal(maxSize int) *Journal {
+	if maxSize <= 0 {
+		maxSize = 1000 // Default max size
+	}
+	return &Journal{
+		events:  make([]Envelope, 0, maxSize),
+		maxSize: maxSize,
+	}
+}
+
+// Append records an event and returns its envelope
+func (j *Journal) Append(name string, data interface{}) Envelope {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.revision++
+	env := Envelope{
+		Version:   Version,
+		Revision:  j.revision,
+		Name:      name,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	j.events = append(j.events, env)
+	if len(j.events) > j.maxSize {
+		j.events = j.events[len(j.events)-j.maxSize:]
+	}
+
+	return env
+}
+
+// Since returns all events with a revision greater than the given one
+func (j *Journal) Since(revision uint64) Replay {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	replay := Replay{
+		Events:   make([]Envelope, 0),
+		Revision: j.revision,
+		Complete: true,
+	}
+
+	// A revision beyond the latest one was seen before a restart and says
+	// nothing about what the client has missed
+	if revision > j.revision {
+		replay.Complete = false
+		return replay
+	}
+
+	// Events between the requested revision and the oldest retained one were evicted
+	if len(j.events) > 0 && j.events[0].Revision > revision+1 {
+		replay.Complete = false
+	}
+
+	for _, env := range j.events {
+		if env.Revision > revision {
+			replay.Events = append(replay.Events, env)
+		}
+	}
+
+	return replay
+}
+
+// Revision returns the latest revision
+func (j *Journal) Revision() uint64 {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.revision
+}
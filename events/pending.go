@@ -0,0 +1,58 @@
+package events
+
+import "sync"
+
+// Pending is the result of draining a pending buffer
+type Pending struct {
+	Events  []Envelope `json:"events"`  // oldest first
+	Dropped int        `json:"dropped"` // events evicted because the buffer was full
+}
+
+// PendingBuffer holds events that could not reach their consumer, dropping
+// the oldest once full
+type PendingBuffer struct {
+	mu      sync.Mutex
+	events  []Envelope
+	maxSize int
+	dropped int
+}
+
+// NewPendingBuffer creates a buffer holding at most maxSize events
+func NewPendingBuffer(maxSize int) *PendingBuffer {
+	if maxSize <= 0 {
+		maxSize = 500 // Default max size
+	}
+	return &PendingBuffer{maxSize: maxSize}
+}
+
+// Add buffers an event
+func (p *PendingBuffer) Add(env Envelope) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, env)
+	if len(p.events) > p.maxSize {
+		p.dropped += len(p.events) - p.maxSize
+		p.events = p.events[len(p.events)-p.maxSize:]
+	}
+}
+
+// Len returns the number of buffered events
+func (p *PendingBuffer) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+// Drain returns the buffered events and empties the buffer
+func (p *PendingBuffer) Drain() Pending {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending := Pending{Events: p.events, Dropped: p.dropped}
+	if pending.Events == nil {
+		pending.Events = make([]Envelope, 0)
+	}
+	p.events, p.dropped = nil, 0
+	return pending
+}
@@ -1,7 +1,13 @@
 // Go PowerControl - Vanilla JavaScript Application
 const app = {
     devices: [],
+    favorites: new Set(), // "device:outlet" keys of pinned outlets
+    locked: new Set(), // "device:outlet" keys of locked outlets
+    logFilter: '', // text the message log is filtered by, server side
+    logRegex: false, // logFilter is a regular expression
+    binaryView: 'hex', // how binary payloads are shown: 'hex' or 'base64'
     messages: [],
+    logCursor: 0, // sequence number of the newest message received in streaming mode
     selectedDevice: null,
     connected: false,
     currentSearchText: '',
@@ -22,50 +28,291 @@ const app = {
         }
 
         // Subscribe to events
-        window.runtime.EventsOn('device:update', () => {
+        this.onEvent('device:update', () => {
             this.loadDevices();
         });
 
-        window.runtime.EventsOn('message:new', () => {
+        this.onEvent('device:stale', () => {
+            this.loadDevices();
+        });
+
+        this.onEvent('device:removed', () => {
+            this.loadDevices();
+        });
+
+        this.onEvent('message:new', () => {
             this.loadMessages();
         });
 
-        window.runtime.EventsOn('connection:status', (isConnected) => {
+        this.onEvent('log:append', (batch) => {
+            this.appendMessages(batch);
+        });
+
+        this.onEvent('message:latency', (update) => {
+            const msg = this.messages.find(m => m.id === update.id);
+            if (msg) {
+                msg.latencyMs = update.latencyMs;
+                this.renderMessages();
+            }
+        });
+
+        this.onEvent('connection:status', (isConnected) => {
             this.connected = isConnected;
             this.updateConnectionStatus(isConnected);
         });
 
-        window.runtime.EventsOn('log:cleared', () => {
+        this.onEvent('bulk:command', (summary) => {
+            this.showBulkSummary(summary);
+        });
+
+        this.onEvent('log:suppressed', (status) => {
+            this.showLogSuppression(status);
+        });
+
+        this.onEvent('config:changed', (change) => {
+            if (change && change.kioskChanged) {
+                window.location.reload(); // Kiosk mode shows a different window
+                return;
+            }
+            this.loadDevices(); // Favorites, locks and hidden devices may have changed
+        });
+
+        this.onEvent('log:cleared', () => {
             this.messages = [];
             this.renderMessages();
         });
 
+        // Tell the backend the window is here, so it keeps critical
+        // events while it is hidden or closed
+        this.sendHeartbeat();
+        setInterval(() => this.sendHeartbeat(), 5000);
+        document.addEventListener('visibilitychange', () => this.sendHeartbeat());
+
         console.log('App initialized');
     },
 
+    // onEvent subscribes to a backend event; events arrive in their revision
+    // envelope, so the handler is given the payload in data
+    onEvent(name, handler) {
+        window.runtime.EventsOn(name, (env) => handler(env.data));
+    },
+
+    async sendHeartbeat() {
+        const visible = !document.hidden;
+        try {
+            await window.go.app.App.FrontendHeartbeat(visible);
+            if (visible) {
+                await this.showPendingEvents();
+            }
+        } catch (error) {
+            console.error('Failed to send heartbeat:', error);
+        }
+    },
+
+    async showPendingEvents() {
+        const pending = await window.go.app.App.DrainPendingEvents();
+        if (pending.events.length === 0 && pending.dropped === 0) {
+            return;
+        }
+
+        const lines = pending.events
+            .filter(env => env.name === 'alert:raised')
+            .map(env => `${new Date(env.timestamp).toLocaleString()} [${env.data.severity}] ${env.data.message}`);
+        if (pending.dropped > 0) {
+            lines.push(`${pending.dropped} older events were dropped`);
+        }
+        pending.events.forEach(env => console.warn('Missed event', env.name, env.data));
+        this.loadDevices();
+        if (lines.length > 0) {
+            alert('While the window was away:\n' + lines.join('\n'));
+        }
+    },
+
     async loadDevices() {
         try {
             // Reapply search filter if one is active
             if (this.currentSearchText) {
                 this.devices = await window.go.app.App.SearchDevices(this.currentSearchText);
             } else {
-                this.devices = await window.go.app.App.GetDevices();
+                this.devices = await window.go.app.App.GetDevices('device', false);
             }
+            await this.loadFavorites();
+            await this.loadLocks();
             this.renderDevices();
         } catch (error) {
             console.error('Failed to load devices:', error);
         }
     },
 
+    async loadFavorites() {
+        const favorites = await window.go.app.App.GetFavorites();
+        this.favorites = new Set(favorites.map(f => `${f.deviceName}:${f.outletNumber}`));
+
+        // Pinned outlets first, keeping the order within each part
+        const isFavorite = d => this.favorites.has(`${d.deviceName}:${d.outletNumber}`);
+        this.devices = [...this.devices.filter(isFavorite), ...this.devices.filter(d => !isFavorite(d))];
+    },
+
+    async toggleFavorite() {
+        if (!this.selectedDevice) {
+            return;
+        }
+        const { deviceName, outletNumber } = this.selectedDevice;
+        try {
+            if (this.favorites.has(`${deviceName}:${outletNumber}`)) {
+                await window.go.app.App.RemoveFavorite(deviceName, outletNumber);
+            } else {
+                await window.go.app.App.AddFavorite(deviceName, outletNumber);
+            }
+            await this.loadDevices();
+        } catch (error) {
+            console.error('Failed to change favorite:', error);
+            alert('Failed to change favorite: ' + error);
+        }
+    },
+
+    async loadLocks() {
+        const locked = await window.go.app.App.GetLockedOutlets();
+        this.locked = new Set(locked.map(l => `${l.deviceName}:${l.outletNumber}`));
+    },
+
+    async toggleLock() {
+        if (!this.selectedDevice) {
+            return;
+        }
+        const { deviceName, outletNumber } = this.selectedDevice;
+        try {
+            if (this.locked.has(`${deviceName}:${outletNumber}`)) {
+                await window.go.app.App.UnlockOutlet(deviceName, outletNumber);
+            } else {
+                await window.go.app.App.LockOutlet(deviceName, outletNumber);
+            }
+            await this.loadDevices();
+        } catch (error) {
+            console.error('Failed to change lock:', error);
+            alert('Failed to change lock: ' + error);
+        }
+    },
+
     async loadMessages() {
         try {
-            this.messages = await window.go.app.App.GetMessages();
+            const status = document.getElementById('logSearchStatus');
+            status.textContent = '';
+            if (this.logFilter) {
+                const search = await window.go.app.App.SearchMessages({ text: this.logFilter, regex: this.logRegex, limit: 500 });
+                this.messages = search.messages;
+                status.textContent = `${search.matches} matching message${search.matches === 1 ? '' : 's'}`
+                    + (search.matches > search.messages.length ? `, newest ${search.messages.length} shown` : '');
+            } else {
+                this.messages = await window.go.app.App.GetMessages();
+                this.logCursor = this.messages.length ? this.messages[0].id : this.logCursor;
+            }
             this.renderMessages();
         } catch (error) {
+            if (this.logFilter && this.logRegex) {
+                document.getElementById('logSearchStatus').textContent = String(error);
+                return;
+            }
             console.error('Failed to load messages:', error);
         }
     },
 
+    toggleBinaryView() {
+        this.binaryView = this.binaryView === 'hex' ? 'base64' : 'hex';
+        document.getElementById('binaryViewButton').textContent = `Binary: ${this.binaryView}`;
+        this.renderMessages();
+    },
+
+    base64ToHex(data) {
+        return Array.from(atob(data), c => c.charCodeAt(0).toString(16).padStart(2, '0')).join(' ');
+    },
+
+    // showFullPayload replaces a truncated payload with the whole one
+    async showFullPayload(id) {
+        try {
+            const payload = await window.go.app.App.GetFullPayload(id);
+            const msg = this.messages.find(m => m.id === id);
+            if (msg) {
+                msg.payload = payload;
+                msg.hex = ''; // rendered from the whole base64 payload
+                msg.truncated = false;
+                this.renderMessages();
+            }
+        } catch (error) {
+            alert('Failed to load payload: ' + error);
+        }
+    },
+
+    // appendMessages adds a log:append batch, first fetching any messages
+    // between the last batch and this one
+    async appendMessages(batch) {
+        if (this.logFilter) {
+            this.loadMessages();
+            return;
+        }
+        try {
+            let added = batch.messages;
+            if (this.logCursor && batch.from > this.logCursor) {
+                added = [];
+                let cursor = this.logCursor;
+                let more = true;
+                while (more) {
+                    const missed = await window.go.app.App.FetchMessages(cursor, 500);
+                    added = added.concat(missed.messages);
+                    cursor = missed.cursor;
+                    more = missed.more;
+                }
+            }
+            added = added.filter(msg => msg.id > this.logCursor);
+            if (added.length === 0) {
+                return;
+            }
+            this.logCursor = added[added.length - 1].id;
+            this.messages = added.reverse().concat(this.messages).slice(0, 1000);
+            this.renderMessages();
+        } catch (error) {
+            console.error('Failed to append messages:', error);
+        }
+    },
+
+    async togglePauseLog() {
+        try {
+            const status = await window.go.app.App.GetLoggingStatus();
+            if (status.paused) {
+                await window.go.app.App.ResumeLogging();
+            } else {
+                await window.go.app.App.PauseLogging();
+            }
+        } catch (error) {
+            alert('Failed to change logging: ' + error);
+        }
+    },
+
+    showLogSuppression(status) {
+        document.getElementById('pauseLogButton').textContent = status.paused ? 'Resume' : 'Pause';
+
+        const parts = [];
+        if (status.paused) {
+            parts.push(`Paused, ${status.suppressed} messages skipped`);
+        } else if (status.suppressed > 0) {
+            parts.push(`${status.suppressed} messages skipped during the last pause`);
+        }
+        status.mutes.forEach(mute => parts.push(`${mute.topic} muted, ${mute.suppressed} skipped`));
+        document.getElementById('logSuppression').textContent = parts.join(' · ');
+    },
+
+    async handleLogFilter(text) {
+        this.logFilter = text.trim();
+        await this.loadMessages();
+    },
+
+    async handleLogRegex(enabled) {
+        this.logRegex = enabled;
+        if (this.logFilter) {
+            await this.loadMessages();
+        }
+    },
+
     renderDevices() {
         const tbody = document.getElementById('deviceTableBody');
 
@@ -78,15 +325,21 @@ const app = {
         let lastDevice = '';
 
         this.devices.forEach((device, index) => {
-            const showDevice = device.deviceName !== lastDevice;
-            lastDevice = device.deviceName;
-
-            const statusClass = device.status === 'ON' ? 'status-on' : 'status-off';
+            const favorite = this.favorites.has(`${device.deviceName}:${device.outletNumber}`);
+            const showDevice = favorite || device.deviceName !== lastDevice;
+            lastDevice = favorite ? '' : device.deviceName;
+
+            const unreachable = device.availability === 'offline';
+            const statusClass = unreachable ? 'status-unreachable' : (device.status === 'ON' ? 'status-on' : 'status-off');
+            let statusText = unreachable ? 'UNREACHABLE' : (device.stale ? `${device.status} (stale)` : device.status);
+            if (device.desired) {
+                statusText += ` ⚠ drifted, ${device.desired} requested`;
+            }
 
-            html += `<tr onclick="app.selectDevice(${index})">
-                <td>${showDevice ? device.deviceName : ''}</td>
-                <td>${device.outletNumber}</td>
-                <td class="${statusClass}">${device.status}</td>
+            html += `<tr onclick="app.selectDevice(${index})"${device.stale ? ' class="device-stale"' : ''}>
+                <td>${favorite ? '★ ' : ''}${showDevice ? device.deviceName : ''}</td>
+                <td>${this.locked.has(`${device.deviceName}:${device.outletNumber}`) ? '🔒 ' : ''}${device.label ? `${device.outletNumber} – ${device.label}` : device.outletNumber}${device.tags && device.tags.length ? ` <span class="outlet-tags">[${device.tags.join(', ')}]</span>` : ''}</td>
+                <td class="${statusClass}">${statusText}</td>
             </tr>`;
         });
 
@@ -103,11 +356,23 @@ const app = {
 
         let html = '';
         this.messages.forEach(msg => {
-            const time = new Date(msg.timestamp).toLocaleTimeString();
+            const stamp = new Date(msg.timestamp);
+            const time = `${stamp.toLocaleTimeString()}.${String(stamp.getMilliseconds()).padStart(3, '0')}`;
             const direction = msg.direction === 'Send' ? '>>' : '<<';
             const className = msg.direction === 'Send' ? 'message-send' : 'message-recv';
 
-            html += `<div class="message-item ${className}">[${time}] ${direction} ${msg.direction}: ${msg.topic} ${msg.payload}</div>`;
+            let payload = msg.payload;
+            if (msg.encoding === 'binary') {
+                payload = this.binaryView === 'hex' ? `[hex] ${msg.hex || this.base64ToHex(msg.payload)}` : `[base64] ${msg.payload}`;
+            }
+            if (msg.truncated) {
+                payload += ` <a href="#" onclick="app.showFullPayload(${msg.id}); return false;">… [truncated, show all ${msg.fullSize} bytes]</a>`;
+            }
+            const flags = msg.direction === 'Recv'
+                ? ` (QoS ${msg.qos}${msg.retained ? ', retained' : ''}${msg.duplicate ? ', dup' : ''}${msg.packetId ? `, id ${msg.packetId}` : ''})`
+                : (msg.latencyMs !== undefined ? ` (confirmed in ${Math.round(msg.latencyMs)} ms)` : '');
+
+            html += `<div class="message-item ${className}">[${time}] ${direction} ${msg.direction}: ${msg.topic}${flags} ${payload}</div>`;
         });
 
         messageList.innerHTML = html;
@@ -122,6 +387,12 @@ const app = {
         document.getElementById('stateSelector').value = this.selectedDevice.status;
         document.getElementById('stateSelector').disabled = false;
         document.getElementById('sendButton').disabled = false;
+        const favorite = this.favorites.has(`${this.selectedDevice.deviceName}:${this.selectedDevice.outletNumber}`);
+        document.getElementById('favoriteButton').textContent = favorite ? '★ Unfavorite' : '☆ Favorite';
+        document.getElementById('favoriteButton').disabled = false;
+        const locked = this.locked.has(`${this.selectedDevice.deviceName}:${this.selectedDevice.outletNumber}`);
+        document.getElementById('lockButton').textContent = locked ? '🔒 Unlock' : '🔓 Lock';
+        document.getElementById('lockButton').disabled = false;
 
         const rows = document.querySelectorAll('#deviceTableBody tr');
         rows.forEach((row, i) => {
@@ -141,8 +412,9 @@ const app = {
             if (searchText) {
                 this.devices = await window.go.app.App.SearchDevices(searchText);
             } else {
-                this.devices = await window.go.app.App.GetDevices();
+                this.devices = await window.go.app.App.GetDevices('device', false);
             }
+            await this.loadFavorites();
             this.renderDevices();
         } catch (error) {
             console.error('Search failed:', error);
@@ -153,18 +425,56 @@ const app = {
         if (!this.selectedDevice) return;
 
         const state = document.getElementById('stateSelector').value;
+        const { deviceName, outletNumber } = this.selectedDevice;
+
+        // Locked outlets need an explicit confirmation to switch
+        let override = false;
+        if (this.locked.has(`${deviceName}:${outletNumber}`)) {
+            if (!confirm(`${deviceName}/${outletNumber} is locked. Switch it ${state} anyway?`)) {
+                return;
+            }
+            override = true;
+        }
 
         try {
-            await window.go.app.App.SendCommand(
-                this.selectedDevice.deviceName,
-                this.selectedDevice.outletNumber,
-                state
-            );
+            await window.go.app.App.SendCommand(deviceName, outletNumber, state, override);
         } catch (error) {
             alert('Failed to send command: ' + error);
         }
     },
 
+    async sendBulkCommand(state) {
+        const filter = { search: this.currentSearchText || '' };
+        try {
+            const preview = await window.go.app.App.PreviewBulkCommand(filter);
+            if (preview.outlets.length === 0) {
+                alert('No outlets to switch');
+                return;
+            }
+            const scope = filter.search ? ` matching "${filter.search}"` : '';
+            if (!confirm(`Switch all ${preview.outlets.length} outlets${scope} ${state}?`)) {
+                return;
+            }
+            await window.go.app.App.SendBulkCommand(filter, state, preview.token);
+        } catch (error) {
+            alert('Failed to send bulk command: ' + error);
+        }
+    },
+
+    showBulkSummary(summary) {
+        if (summary.failed === 0 && !summary.cancelled) {
+            return;
+        }
+        const failures = summary.outlets
+            .filter(o => o.error)
+            .map(o => `${o.deviceName}/${o.outletNumber}: ${o.error}`);
+        let message = `${summary.succeeded} of ${summary.total} outlets switched ${summary.state}`;
+        if (summary.cancelled) {
+            message += ' (cancelled)';
+        }
+        alert([message, ...failures].join('\n'));
+    },
+
     async disconnect() {
         try {
             await window.go.app.App.Disconnect();
@@ -188,12 +498,18 @@ const app = {
     async showSetup() {
         try {
             const config = await window.go.app.App.GetConfig();
+            if (config.kioskMode) {
+                return;
+            }
 
             document.getElementById('setupUsername').value = config.username || '';
             document.getElementById('setupServer').value = config.mqttServer || '';
             document.getElementById('setupPort').value = config.serverPort || 1883;
             document.getElementById('setupSubscribe').value = config.subscribeString || 'power/#';
             document.getElementById('setupPassword').value = '';
+            document.getElementById('setupLogCapacity').value = config.logCapacity || 1000;
+            document.getElementById('setupLogRetention').value = config.logRetentionMinutes || 0;
+            document.getElementById('setupLogPersist').checked = !!config.logPersist;
 
             document.getElementById('setupDialog').style.display = 'flex';
         } catch (error) {
@@ -206,14 +522,19 @@ const app = {
     },
 
     async saveSettings() {
-        const username = document.getElementById('setupUsername').value;
-        const password = document.getElementById('setupPassword').value;
-        const server = document.getElementById('setupServer').value;
-        const port = parseInt(document.getElementById('setupPort').value);
-        const subscribeString = document.getElementById('setupSubscribe').value;
+        const settings = {
+            username: document.getElementById('setupUsername').value,
+            password: document.getElementById('setupPassword').value,
+            mqttServer: document.getElementById('setupServer').value,
+            serverPort: parseInt(document.getElementById('setupPort').value),
+            subscribeString: document.getElementById('setupSubscribe').value,
+            logCapacity: parseInt(document.getElementById('setupLogCapacity').value),
+            logRetentionMinutes: parseInt(document.getElementById('setupLogRetention').value) || 0,
+            logPersist: document.getElementById('setupLogPersist').checked,
+        };
 
         try {
-            await window.go.app.App.SaveSettings(username, password, server, port, subscribeString);
+            await window.go.app.App.SaveSettings(settings);
             this.closeSetup();
             this.connected = await window.go.app.App.GetConnectionStatus();
             this.updateConnectionStatus(this.connected);
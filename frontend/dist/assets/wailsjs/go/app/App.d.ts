@@ -1,5 +1,6 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {app} from '../models';
 import {models} from '../models';
 
 export function ClearLog():Promise<void>;
@@ -10,14 +11,14 @@ export function GetConfig():Promise<Record<string, any>>;
 
 export function GetConnectionStatus():Promise<boolean>;
 
-export function GetDevices():Promise<Array<models.DeviceOutlet>>;
+export function GetDevices(arg1:string,arg2:boolean):Promise<Array<models.DeviceOutlet>>;
 
 export function GetMessages():Promise<Array<models.MQTTMessage>>;
 
 export function IsConfigEmpty():Promise<boolean>;
 
-export function SaveSettings(arg1:string,arg2:string,arg3:string,arg4:number,arg5:string):Promise<void>;
+export function SaveSettings(arg1:app.Settings):Promise<void>;
 
 export function SearchDevices(arg1:string):Promise<Array<models.DeviceOutlet>>;
 
-export function SendCommand(arg1:string,arg2:string,arg3:string):Promise<void>;
+export function SendCommand(arg1:string,arg2:string,arg3:string,arg4:boolean):Promise<void>;
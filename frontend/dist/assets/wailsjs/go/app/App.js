@@ -18,8 +18,8 @@ export function GetConnectionStatus() {
   return window['go']['app']['App']['GetConnectionStatus']();
 }
 
-export function GetDevices() {
-  return window['go']['app']['App']['GetDevices']();
+export function GetDevices(arg1, arg2) {
+  return window['go']['app']['App']['GetDevices'](arg1, arg2);
 }
 
 export function GetMessages() {
@@ -30,14 +30,14 @@ export function IsConfigEmpty() {
   return window['go']['app']['App']['IsConfigEmpty']();
 }
 
-export function SaveSettings(arg1, arg2, arg3, arg4, arg5) {
-  return window['go']['app']['App']['SaveSettings'](arg1, arg2, arg3, arg4, arg5);
+export function SaveSettings(arg1) {
+  return window['go']['app']['App']['SaveSettings'](arg1);
 }
 
 export function SearchDevices(arg1) {
   return window['go']['app']['App']['SearchDevices'](arg1);
 }
 
-export function SendCommand(arg1, arg2, arg3) {
-  return window['go']['app']['App']['SendCommand'](arg1, arg2, arg3);
+export function SendCommand(arg1, arg2, arg3, arg4) {
+  return window['go']['app']['App']['SendCommand'](arg1, arg2, arg3, arg4);
 }
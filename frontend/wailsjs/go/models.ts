@@ -1,3 +1,34 @@
+export namespace app {
+	
+	export class Settings {
+	    username: string;
+	    password: string;
+	    mqttServer: string;
+	    serverPort: number;
+	    subscribeString: string;
+	    logCapacity: number;
+	    logRetentionMinutes: number;
+	    logPersist: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Settings(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.username = source["username"];
+	        this.password = source["password"];
+	        this.mqttServer = source["mqttServer"];
+	        this.serverPort = source["serverPort"];
+	        this.subscribeString = source["subscribeString"];
+	        this.logCapacity = source["logCapacity"];
+	        this.logRetentionMinutes = source["logRetentionMinutes"];
+	        this.logPersist = source["logPersist"];
+	    }
+	}
+
+}
+
 export namespace models {
 	
 	export class DeviceOutlet {
@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// exportColumns are the columns written by WriteCSV and read back by Parse
+var exportColumns = []string{"device", "outlet", "label", "group", "wattage", "circuit", "tags", "notes", "location"}
+
+// Record is one outlet in a JSON inventory file
+type Record struct {
+	Device     string   `json:"device"`
+	Outlet     string   `json:"outlet"`
+	Label      string   `json:"label,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	RatedWatts *float64 `json:"ratedWatts,omitempty"`
+	Circuit    string   `json:"circuit,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Notes      string   `json:"notes,omitempty"`
+	Location   string   `json:"location,omitempty"`
+}
+
+// WriteCSV writes outlets with a header row naming the columns
+func WriteCSV(w io.Writer, outlets []models.OutletMetadata) error {
+	writer := csv.NewWriter(w)
+	writer.Write(exportColumns)
+	for _, outlet := range outlets {
+		wattage := ""
+		if outlet.RatedWatts != nil {
+			wattage = strconv.FormatFloat(*outlet.RatedWatts, 'f', -1, 64)
+		}
+		writer.Write([]string{
+			outlet.DeviceName,
+			outlet.OutletNumber,
+			outlet.Label,
+			outlet.Group,
+			wattage,
+			outlet.Circuit,
+			strings.Join(outlet.Tags, ", "),
+			outlet.Notes,
+			outlet.Location,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes outlets as an indented array of records
+func WriteJSON(w io.Writer, outlets []models.OutletMetadata) error {
+	records := make([]Record, 0, len(outlets))
+	for _, outlet := range outlets {
+		records = append(records, Record{
+			Device:     outlet.DeviceName,
+			Outlet:     outlet.OutletNumber,
+			Label:      outlet.Label,
+			Group:      outlet.Group,
+			RatedWatts: outlet.RatedWatts,
+			Circuit:    outlet.Circuit,
+			Tags:       outlet.Tags,
+			Notes:      outlet.Notes,
+			Location:   outlet.Location,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+// readJSON reads an array of records as rows with a header, so they are
+// checked like a sheet. Record i is reported as row i+2.
+func readJSON(filename string) ([][]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	rows := [][]string{exportColumns}
+	for _, record := range records {
+		wattage := ""
+		if record.RatedWatts != nil {
+			wattage = strconv.FormatFloat(*record.RatedWatts, 'f', -1, 64)
+		}
+		rows = append(rows, []string{
+			record.Device,
+			record.Outlet,
+			record.Label,
+			record.Group,
+			wattage,
+			record.Circuit,
+			strings.Join(record.Tags, ","),
+			record.Notes,
+			record.Location,
+		})
+	}
+	return rows, nil
+}
+
+// splitTags splits a tags cell on commas or semicolons
+func splitTags(value string) []string {
+	return models.NormalizeTags(strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }))
+}
@@ -0,0 +1,263 @@
+// Package inventory reads and writes outlet inventories kept in
+// spreadsheets or JSON files
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Severity tells whether an issue stopped a row from being imported
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // the row was skipped
+	SeverityWarning Severity = "warning" // the row was imported
+)
+
+// Issue is a problem found in the sheet
+type Issue struct {
+	Row      int      `json:"row"` // 1-based sheet row; 0 for the whole file
+	Column   string   `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Column names recognized in the header row, matched case-insensitively
+var columns = map[string][]string{
+	"device":   {"device", "device name", "devicename", "pdu"},
+	"outlet":   {"outlet", "outlet number", "outletnumber", "port"},
+	"label":    {"label", "name", "alias", "description"},
+	"group":    {"group", "groups"},
+	"wattage":  {"wattage", "watts", "rated watts", "load"},
+	"circuit":  {"circuit", "breaker", "feed"},
+	"tags":     {"tags", "tag"},
+	"notes":    {"notes", "note", "comments"},
+	"location": {"location", "room", "rack"},
+}
+
+// ReadFile returns the rows of a .csv, .xlsx or .json file; for workbooks
+// the first worksheet is read, and JSON records become rows below a header
+func ReadFile(filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return readCSV(filename)
+	case ".xlsx":
+		return readXLSX(filename)
+	case ".json":
+		return readJSON(filename)
+	default:
+		return nil, fmt.Errorf("unsupported inventory file type: %s (use .csv, .xlsx or .json)", filepath.Ext(filename))
+	}
+}
+
+// readCSV reads a comma- or semicolon-separated file
+func readCSV(filename string) ([][]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Excel writes a BOM
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	// Spreadsheets in many locales export with semicolons
+	firstLine, _ := bufio.NewReader(bytes.NewReader(data)).ReadString('\n')
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		reader.Comma = ';'
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// Parse reads outlet metadata from rows whose first non-empty row is a
+// header. Rows with errors are left out; every problem is reported.
+func Parse(rows [][]string) ([]models.OutletMetadata, []Issue) {
+	issues := make([]Issue, 0)
+
+	header := -1
+	for i, row := range rows {
+		if !blank(row) {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, append(issues, Issue{Severity: SeverityError, Message: "the sheet is empty"})
+	}
+
+	index := make(map[string]int)
+	for i, name := range rows[header] {
+		column, ok := columnFor(name)
+		if !ok {
+			if strings.TrimSpace(name) != "" {
+				issues = append(issues, Issue{Row: header + 1, Column: name, Severity: SeverityWarning, Message: "unknown column ignored"})
+			}
+			continue
+		}
+		if _, dup := index[column]; dup {
+			issues = append(issues, Issue{Row: header + 1, Column: name, Severity: SeverityWarning, Message: "duplicate " + column + " column ignored"})
+			continue
+		}
+		index[column] = i
+	}
+	for _, required := range []string{"device", "outlet"} {
+		if _, ok := index[required]; !ok {
+			issues = append(issues, Issue{Row: header + 1, Column: required, Severity: SeverityError, Message: "required column is missing"})
+		}
+	}
+	if len(index) == 0 || hasErrors(issues) {
+		return nil, issues
+	}
+
+	cell := func(row []string, column string) string {
+		i, ok := index[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	outlets := make([]models.OutletMetadata, 0, len(rows)-header-1)
+	seen := make(map[string]int) // key: device:outlet, value: row
+	for i := header + 1; i < len(rows); i++ {
+		row, line := rows[i], i+1
+		if blank(row) {
+			continue
+		}
+
+		outlet := models.OutletMetadata{
+			DeviceName:   cell(row, "device"),
+			OutletNumber: cell(row, "outlet"),
+			Label:        cell(row, "label"),
+			Group:        cell(row, "group"),
+			Circuit:      cell(row, "circuit"),
+			Tags:         splitTags(cell(row, "tags")),
+			Notes:        cell(row, "notes"),
+			Location:     cell(row, "location"),
+		}
+
+		rowIssues := make([]Issue, 0)
+		if msg := checkName(outlet.DeviceName); msg != "" {
+			rowIssues = append(rowIssues, Issue{Row: line, Column: "device", Severity: SeverityError, Message: msg})
+		}
+		if msg := checkName(outlet.OutletNumber); msg != "" {
+			rowIssues = append(rowIssues, Issue{Row: line, Column: "outlet", Severity: SeverityError, Message: msg})
+		}
+		if len(outlet.Notes) > models.MaxNotesLength {
+			rowIssues = append(rowIssues, Issue{Row: line, Column: "notes", Severity: SeverityError, Message: fmt.Sprintf("notes must be at most %d characters", models.MaxNotesLength)})
+		}
+		if wattage := cell(row, "wattage"); wattage != "" {
+			watts, err := parseWatts(wattage)
+			if err != nil {
+				rowIssues = append(rowIssues, Issue{Row: line, Column: "wattage", Severity: SeverityError, Message: err.Error()})
+			} else {
+				outlet.RatedWatts = &watts
+			}
+		}
+
+		key := outlet.DeviceName + ":" + outlet.OutletNumber
+		if first, dup := seen[key]; dup && !hasErrors(rowIssues) {
+			rowIssues = append(rowIssues, Issue{Row: line, Severity: SeverityError, Message: fmt.Sprintf("duplicate of row %d", first)})
+		}
+
+		issues = append(issues, rowIssues...)
+		if hasErrors(rowIssues) {
+			continue
+		}
+		seen[key] = line
+		outlets = append(outlets, outlet)
+	}
+
+	return outlets, issues
+}
+
+// columnFor maps a header cell to a known column
+func columnFor(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for column, names := range columns {
+		for _, candidate := range names {
+			if name == candidate {
+				return column, true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkName validates a device name or outlet number, which end up in topics
+func checkName(name string) string {
+	switch {
+	case name == "":
+		return "value is required"
+	case strings.ContainsAny(name, "/+#"):
+		return "must not contain '/', '+' or '#'"
+	default:
+		return ""
+	}
+}
+
+// thousandsGrouped matches numbers grouped in thousands by commas, e.g. 1,500
+var thousandsGrouped = regexp.MustCompile(`^\d{1,3}(,\d{3})+$`)
+
+// parseWatts accepts numbers with an optional "W" unit, thousands separators
+// and a decimal point or comma, e.g. "1,500 W", "1.500,5" or "2,5"
+func parseWatts(value string) (float64, error) {
+	trimmed := strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(value, "W"), "w"))
+	trimmed = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(trimmed)
+
+	// With both separators the last one is the decimal separator; a comma
+	// alone is one unless it groups thousands
+	lastComma, lastPoint := strings.LastIndex(trimmed, ","), strings.LastIndex(trimmed, ".")
+	switch {
+	case lastComma >= 0 && lastPoint >= 0 && lastComma > lastPoint:
+		trimmed = strings.ReplaceAll(strings.ReplaceAll(trimmed, ".", ""), ",", ".")
+	case lastComma >= 0 && lastPoint >= 0:
+		trimmed = strings.ReplaceAll(trimmed, ",", "")
+	case thousandsGrouped.MatchString(trimmed):
+		trimmed = strings.ReplaceAll(trimmed, ",", "")
+	default:
+		trimmed = strings.ReplaceAll(trimmed, ",", ".")
+	}
+
+	watts, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || watts < 0 {
+		return 0, fmt.Errorf("invalid wattage: %q", value)
+	}
+	return watts, nil
+}
+
+// blank reports whether every cell of a row is empty
+func blank(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// hasErrors reports whether any issue is an error
+func hasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
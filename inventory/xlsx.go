@@ -0,0 +1,207 @@
+package inventory
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// xlsxWorkbook lists the sheets of a workbook
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships maps relationship ids to part names
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a string item: plain text, or runs of rich text
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+// String joins the text of all runs
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// xlsxSheet holds the cells of a worksheet
+type xlsxSheet struct {
+	Rows []struct {
+		Number int `xml:"r,attr"` // 1-based; rows without cells are omitted
+		Cells  []struct {
+			Ref    string    `xml:"r,attr"`
+			Type   string    `xml:"t,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the cell text of the first worksheet of a workbook.
+// Only values are read; formulas contribute their cached result.
+func readXLSX(filename string) ([][]string, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+	defer archive.Close()
+
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		parts[file.Name] = file
+	}
+
+	sheetPart, err := firstSheetPart(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if file, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(file, &shared); err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+	}
+
+	file, ok := parts[sheetPart]
+	if !ok {
+		return nil, fmt.Errorf("workbook has no worksheet %s", sheetPart)
+	}
+	var sheet xlsxSheet
+	if err := decodePart(file, &sheet); err != nil {
+		return nil, fmt.Errorf("failed to read worksheet: %w", err)
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		// Keep row numbers aligned with the sheet so issues point at the right row
+		for row.Number > len(rows)+1 && row.Number <= len(sheet.Rows)+maxGapRows {
+			rows = append(rows, nil)
+		}
+
+		values := make([]string, 0, len(row.Cells))
+		for _, cell := range row.Cells {
+			column := len(values)
+			if index := columnIndex(cell.Ref); index >= 0 {
+				column = index
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				var index int
+				if _, err := fmt.Sscanf(cell.Value, "%d", &index); err == nil && index >= 0 && index < len(shared.Items) {
+					values[column] = shared.Items[index].String()
+				}
+			case "inlineStr":
+				if cell.Inline != nil {
+					values[column] = cell.Inline.String()
+				}
+			case "b":
+				values[column] = map[string]string{"1": "TRUE", "0": "FALSE"}[cell.Value]
+			default:
+				values[column] = cell.Value
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheetPart resolves the part name of the workbook's first sheet
+func firstSheetPart(parts map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	workbookFile, ok := parts["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("not an XLSX workbook")
+	}
+	var workbook xlsxWorkbook
+	if err := decodePart(workbookFile, &workbook); err != nil {
+		return "", fmt.Errorf("failed to read workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+
+	relsFile, ok := parts["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels xlsxRelationships
+	if err := decodePart(relsFile, &rels); err != nil {
+		return fallback, nil
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// decodePart unmarshals an XML part of the archive
+func decodePart(file *zip.File, v interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// maxGapRows limits how many omitted empty rows are filled in
+const maxGapRows = 100000
+
+// maxColumns is the widest sheet Excel can produce (column XFD)
+const maxColumns = 16384
+
+// columnIndex converts the column letters of a cell reference such as
+// "AB12" to a zero-based index, or -1 if there are none
+func columnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		if index > maxColumns {
+			return -1
+		}
+	}
+	return index - 1
+}
@@ -0,0 +1,79 @@
+// Package labels produces printable outlet labels that link back to the app
+package labels
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Scheme is the URL scheme of deep links printed on labels
+const Scheme = "powercontrol"
+
+// Label is the printable data for one outlet
+type Label struct {
+	DeviceName   string `json:"deviceName"`
+	OutletNumber string `json:"outletNumber"`
+	Alias        string `json:"alias,omitempty"`
+	Link         string `json:"link"`
+}
+
+// New builds the label for an outlet
+func New(deviceName, outletNumber, alias string) Label {
+	return Label{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Alias:        alias,
+		Link:         DeepLink(deviceName, outletNumber),
+	}
+}
+
+// DeepLink returns the link encoded in an outlet's QR code,
+// e.g. powercontrol://outlet/rack-a-pdu/3
+func DeepLink(deviceName, outletNumber string) string {
+	return fmt.Sprintf("%s://outlet/%s/%s", Scheme, url.PathEscape(deviceName), url.PathEscape(outletNumber))
+}
+
+// ParseDeepLink extracts the device and outlet from a deep link
+func ParseDeepLink(link string) (deviceName, outletNumber string, err error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid link: %w", err)
+	}
+	if u.Scheme != Scheme || u.Host != "outlet" {
+		return "", "", fmt.Errorf("not an outlet link: %s", link)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("not an outlet link: %s", link)
+	}
+	if deviceName, err = url.PathUnescape(parts[0]); err != nil {
+		return "", "", fmt.Errorf("invalid link: %w", err)
+	}
+	if outletNumber, err = url.PathUnescape(parts[1]); err != nil {
+		return "", "", fmt.Errorf("invalid link: %w", err)
+	}
+	if deviceName == "" || outletNumber == "" {
+		return "", "", fmt.Errorf("not an outlet link: %s", link)
+	}
+	return deviceName, outletNumber, nil
+}
+
+// WriteCSV writes labels as CSV for label printer software that renders
+// its own QR codes from the link column
+func WriteCSV(w io.Writer, labels []Label) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"device", "outlet", "alias", "link"}); err != nil {
+		return err
+	}
+	for _, label := range labels {
+		if err := writer.Write([]string{label.DeviceName, label.OutletNumber, label.Alias, label.Link}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,165 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Sheet layout in PDF points (1/72 inch): A4 with 3 x 8 labels of
+// 70 x 37 mm, the common layout of adhesive label sheets
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	labelColumns = 3
+	labelRows    = 8
+	labelWidth   = 198.43 // 70 mm
+	labelHeight  = 104.88 // 37 mm
+	labelPadding = 8.0
+	marginTop    = (pageHeight - labelRows*labelHeight) / 2
+	marginLeft   = (pageWidth - labelColumns*labelWidth) / 2
+)
+
+// WritePDF writes an A4 label sheet with a QR code, alias, device and
+// outlet number on every label
+func WritePDF(w io.Writer, labels []Label) error {
+	perPage := labelColumns * labelRows
+	var pages []string
+	for start := 0; start < len(labels) || start == 0; start += perPage {
+		end := start + perPage
+		if end > len(labels) {
+			end = len(labels)
+		}
+
+		var content strings.Builder
+		for i, label := range labels[start:end] {
+			x := marginLeft + float64(i%labelColumns)*labelWidth
+			y := pageHeight - marginTop - float64(i/labelColumns+1)*labelHeight
+			if err := drawLabel(&content, label, x, y); err != nil {
+				return err
+			}
+		}
+		pages = append(pages, content.String())
+	}
+
+	return writeDocument(w, pages)
+}
+
+// drawLabel draws one label whose bottom-left corner is at x, y
+func drawLabel(content *strings.Builder, label Label, x, y float64) error {
+	code, err := qrcode.New(label.Link, qrcode.Medium)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code for %s/%s: %w", label.DeviceName, label.OutletNumber, err)
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	// QR code on the left, filling the label height
+	size := labelHeight - 2*labelPadding
+	module := size / float64(len(modules))
+	qrX, qrY := x+labelPadding, y+labelPadding
+	content.WriteString("0 g\n")
+	for row, line := range modules {
+		for col, dark := range line {
+			if dark {
+				fmt.Fprintf(content, "%.2f %.2f %.2f %.2f re\n",
+					qrX+float64(col)*module, qrY+size-float64(row+1)*module, module, module)
+			}
+		}
+	}
+	content.WriteString("f\n")
+
+	// Text to the right of the code
+	textX := qrX + size + labelPadding
+	maxChars := int((x + labelWidth - labelPadding - textX) / 5.5)
+	title := label.Alias
+	if title == "" {
+		title = "Outlet " + label.OutletNumber
+	}
+	lines := []struct {
+		font string
+		size float64
+		text string
+	}{
+		{"F2", 11, title},
+		{"F1", 9, label.DeviceName},
+		{"F1", 9, "Outlet " + label.OutletNumber},
+	}
+	lineY := y + labelHeight - labelPadding - 14
+	for _, line := range lines {
+		fmt.Fprintf(content, "BT /%s %.0f Tf %.2f %.2f Td (%s) Tj ET\n",
+			line.font, line.size, textX, lineY, pdfString(truncate(line.text, maxChars)))
+		lineY -= line.size + 6
+	}
+	return nil
+}
+
+// writeDocument writes the PDF objects, cross-reference table and trailer
+func writeDocument(w io.Writer, pages []string) error {
+	var doc bytes.Buffer
+	offsets := []int{0}
+	object := func(body string) {
+		offsets = append(offsets, doc.Len())
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+
+	// Objects 1-4: catalog, page tree and fonts; then a page and its
+	// content stream for every page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	doc.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+
+	_, err := w.Write(doc.Bytes())
+	return err
+}
+
+// pdfString escapes text for a PDF literal string; characters outside
+// Latin-1 are replaced since the standard fonts cannot show them
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		case r >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// truncate shortens text to at most n characters, marking the cut
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if n < 2 || len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "~"
+}
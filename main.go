@@ -2,8 +2,11 @@ package main
 
 import (
 	"embed"
+	"os"
+	"strings"
 
 	"github.com/levonbragg/go-powercontrol/app"
+	"github.com/levonbragg/go-powercontrol/config"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
@@ -14,6 +17,10 @@ import (
 var assets embed.FS
 
 func main() {
+	if configDir := configDirArg(os.Args[1:]); configDir != "" {
+		config.SetDir(configDir)
+	}
+
 	// Create an instance of the app structure
 	appInstance := app.NewApp()
 
@@ -44,3 +51,27 @@ func main() {
 		println("Error:", err.Error())
 	}
 }
+
+// configDirArg returns the value of --config-dir (or -config-dir), given as
+// "--config-dir=<path>" or "--config-dir <path>". The arguments are scanned
+// rather than parsed with the flag package, which stops at the first
+// argument it does not know, e.g. the -psn_ one macOS passes to app
+// bundles. Other arguments are ignored; the last --config-dir wins.
+func configDirArg(args []string) string {
+	dir := ""
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--config-dir" && name != "-config-dir" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+		dir = value
+	}
+	return dir
+}
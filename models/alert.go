@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AlertSeverity ranks how urgent an alert is
+type AlertSeverity string
+
+const (
+	SeverityInfo     AlertSeverity = "info"
+	SeverityWarning  AlertSeverity = "warning"
+	SeverityCritical AlertSeverity = "critical"
+)
+
+// Alert is a condition an operator should know about
+type Alert struct {
+	Timestamp    time.Time     `json:"timestamp"`
+	Severity     AlertSeverity `json:"severity"`
+	Source       string        `json:"source"` // what raised the alert, e.g. "connection"
+	DeviceName   string        `json:"deviceName,omitempty"`
+	OutletNumber string        `json:"outletNumber,omitempty"`
+	Message      string        `json:"message"`
+}
@@ -0,0 +1,426 @@
+package models
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// Archive write queue: messages are written in batches by a background
+// writer, so the message path never waits for the disk
+const (
+	archiveQueueSize  = 4096
+	archiveBatchSize  = 256
+	archiveBatchDelay = 250 * time.Millisecond
+	archiveRowBytes   = 64 // estimated storage of a message besides its topic and payload
+)
+
+// ErrArchiveBusy is returned by Append when the writer has fallen so far
+// behind that the message is dropped
+var ErrArchiveBusy = errors.New("message archive write queue is full")
+
+// archiveSchema creates the messages table; size is the estimated storage
+// of a message, summed to enforce the size limit
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id         INTEGER PRIMARY KEY,
+	ts         INTEGER NOT NULL,
+	direction  TEXT    NOT NULL,
+	topic      TEXT    NOT NULL,
+	payload    BLOB,
+	encoding   TEXT    NOT NULL,
+	qos        INTEGER NOT NULL,
+	retained   INTEGER NOT NULL,
+	duplicate  INTEGER NOT NULL,
+	packet_id  INTEGER NOT NULL,
+	latency_ms REAL,
+	truncated  INTEGER NOT NULL,
+	full_size  INTEGER NOT NULL,
+	size       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_ts ON messages (ts);`
+
+// archiveOp is a write waiting in the queue: a message to insert, or the
+// latency of an archived command
+type archiveOp struct {
+	msg       *MQTTMessage
+	latencyID uint64
+	latencyMs float64
+}
+
+// MessageArchive keeps logged messages in an SQLite database, so history
+// outlives the in-memory log and restarts. Writes are queued and batched by
+// a background writer; Prune enforces the retention limits.
+type MessageArchive struct {
+	db       *sql.DB
+	maxAge   time.Duration // zero keeps messages regardless of age
+	maxBytes int64         // zero keeps messages regardless of size
+
+	mu     sync.Mutex // guards queue against Close
+	queue  chan archiveOp
+	done   chan struct{} // closed when the writer has finished
+	closed bool
+
+	lastMu   sync.Mutex
+	lastID   uint64
+	writeErr error // the writer's last failure, reported by the next Append
+}
+
+// OpenMessageArchive opens or creates the archive database at path
+func OpenMessageArchive(path string, maxAge time.Duration, maxBytes int64) (*MessageArchive, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=auto_vacuum(incremental)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(archiveSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create archive tables: %w", err)
+	}
+	os.Chmod(path, 0600)
+
+	a := &MessageArchive{
+		db:       db,
+		maxAge:   maxAge,
+		maxBytes: maxBytes,
+		queue:    make(chan archiveOp, archiveQueueSize),
+		done:     make(chan struct{}),
+	}
+	var lastID sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(id) FROM messages`).Scan(&lastID); err != nil {
+		db.Close()
+		return nil, err
+	}
+	a.lastID = uint64(lastID.Int64)
+
+	go a.write()
+	return a, nil
+}
+
+// ImportLegacy moves the messages of a JSON-lines archive written by older
+// versions into the database and removes the file. A missing file is fine.
+func (a *MessageArchive) ImportLegacy(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []MQTTMessage
+	imported := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg MQTTMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue // Skip a torn or corrupt line
+		}
+		batch = append(batch, msg)
+		if len(batch) == archiveBatchSize {
+			if err := a.insert(batch, nil); err != nil {
+				f.Close()
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	err = scanner.Err()
+	f.Close()
+	if err != nil {
+		return imported, err
+	}
+	if err := a.insert(batch, nil); err != nil {
+		return imported, err
+	}
+	imported += len(batch)
+
+	a.lastMu.Lock()
+	if err := a.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM messages`).Scan(&a.lastID); err != nil {
+		a.lastMu.Unlock()
+		return imported, err
+	}
+	a.lastMu.Unlock()
+	return imported, os.Remove(path)
+}
+
+// LastID returns the ID of the newest archived message, so the in-memory
+// log can continue numbering after a restart
+func (a *MessageArchive) LastID() uint64 {
+	a.lastMu.Lock()
+	defer a.lastMu.Unlock()
+	return a.lastID
+}
+
+// Append queues a message to be archived. It never waits for the disk: if
+// the writer is too far behind, the message is dropped with ErrArchiveBusy.
+func (a *MessageArchive) Append(msg MQTTMessage) error {
+	a.lastMu.Lock()
+	if msg.ID > a.lastID {
+		a.lastID = msg.ID
+	}
+	writeErr := a.writeErr
+	a.writeErr = nil
+	a.lastMu.Unlock()
+
+	if err := a.enqueue(archiveOp{msg: &msg}); err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// SetLatency queues the confirmation latency of an archived command
+func (a *MessageArchive) SetLatency(id uint64, latencyMs float64) error {
+	return a.enqueue(archiveOp{latencyID: id, latencyMs: latencyMs})
+}
+
+// enqueue hands a write to the writer without blocking
+func (a *MessageArchive) enqueue(op archiveOp) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return os.ErrClosed
+	}
+	select {
+	case a.queue <- op:
+		return nil
+	default:
+		return ErrArchiveBusy
+	}
+}
+
+// write writes queued operations in batches until the queue is closed
+func (a *MessageArchive) write() {
+	defer close(a.done)
+
+	for {
+		op, ok := <-a.queue
+		if !ok {
+			return
+		}
+		ops := []archiveOp{op}
+		timer := time.NewTimer(archiveBatchDelay)
+	collect:
+		for len(ops) < archiveBatchSize {
+			select {
+			case op, ok := <-a.queue:
+				if !ok {
+					break collect
+				}
+				ops = append(ops, op)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		var messages []MQTTMessage
+		var latencies []archiveOp
+		for _, op := range ops {
+			if op.msg != nil {
+				messages = append(messages, *op.msg)
+			} else {
+				latencies = append(latencies, op)
+			}
+		}
+		if err := a.insert(messages, latencies); err != nil {
+			a.lastMu.Lock()
+			a.writeErr = fmt.Errorf("failed to write %d messages: %w", len(messages), err)
+			a.lastMu.Unlock()
+		}
+	}
+}
+
+// insert writes messages and latencies in one transaction
+func (a *MessageArchive) insert(messages []MQTTMessage, latencies []archiveOp) error {
+	if len(messages) == 0 && len(latencies) == 0 {
+		return nil
+	}
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(messages) > 0 {
+		stmt, err := tx.Prepare(`INSERT OR REPLACE INTO messages
+			(id, ts, direction, topic, payload, encoding, qos, retained, duplicate, packet_id, latency_ms, truncated, full_size, size)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, msg := range messages {
+			var latency sql.NullFloat64
+			if msg.LatencyMs != nil {
+				latency = sql.NullFloat64{Float64: *msg.LatencyMs, Valid: true}
+			}
+			size := len(msg.Topic) + len(msg.Payload) + archiveRowBytes
+			if _, err := stmt.Exec(msg.ID, msg.Timestamp.UnixNano(), string(msg.Direction), msg.Topic, msg.Payload,
+				string(msg.Encoding), msg.QoS, msg.Retained, msg.Duplicate, msg.PacketID, latency,
+				msg.Truncated, msg.FullSize, size); err != nil {
+				return err
+			}
+		}
+	}
+	for _, op := range latencies {
+		if _, err := tx.Exec(`UPDATE messages SET latency_ms = ? WHERE id = ?`, op.latencyMs, op.latencyID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Query returns the archived messages selected by the query, newest first.
+// The direction, time range and ID cursor are applied by the database;
+// rows are then read newest first only until the limit is reached.
+func (a *MessageArchive) Query(query MessageQuery) ([]MQTTMessage, error) {
+	if err := query.Compile(); err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []any
+	if query.Direction != "" {
+		where, args = append(where, "direction = ?"), append(args, string(query.Direction))
+	}
+	if !query.Since.IsZero() {
+		where, args = append(where, "ts >= ?"), append(args, query.Since.UnixNano())
+	}
+	if !query.Until.IsZero() {
+		where, args = append(where, "ts <= ?"), append(args, query.Until.UnixNano())
+	}
+	if query.BeforeID != 0 {
+		where, args = append(where, "id < ?"), append(args, query.BeforeID)
+	}
+	statement := `SELECT id, ts, direction, topic, payload, encoding, qos, retained, duplicate, packet_id, latency_ms, truncated, full_size
+		FROM messages`
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	statement += " ORDER BY id DESC"
+
+	rows, err := a.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]MQTTMessage, 0)
+	for rows.Next() {
+		if query.Limit > 0 && len(result) == query.Limit {
+			break
+		}
+		msg, err := scanArchived(rows)
+		if err != nil {
+			return nil, err
+		}
+		if query.Matches(msg) {
+			result = append(result, msg)
+		}
+	}
+	return result, rows.Err()
+}
+
+// Recent returns up to limit of the newest archived messages, newest first
+func (a *MessageArchive) Recent(limit int) ([]MQTTMessage, error) {
+	return a.Query(MessageQuery{Limit: limit})
+}
+
+// scanArchived reads one message row
+func scanArchived(rows *sql.Rows) (MQTTMessage, error) {
+	var msg MQTTMessage
+	var ts int64
+	var direction, encoding string
+	var latency sql.NullFloat64
+	if err := rows.Scan(&msg.ID, &ts, &direction, &msg.Topic, &msg.Payload, &encoding, &msg.QoS,
+		&msg.Retained, &msg.Duplicate, &msg.PacketID, &latency, &msg.Truncated, &msg.FullSize); err != nil {
+		return MQTTMessage{}, err
+	}
+	msg.Timestamp = time.Unix(0, ts)
+	msg.Direction = MessageDirection(direction)
+	msg.Encoding = PayloadEncoding(encoding)
+	if latency.Valid {
+		msg.LatencyMs = &latency.Float64
+	}
+	return msg, nil
+}
+
+// Prune drops messages older than the maximum age and, while the archive
+// is over the maximum size, the oldest messages, returning how many were
+// dropped. Over the size limit it shrinks to three quarters of it, so the
+// next messages do not trigger another prune straight away.
+func (a *MessageArchive) Prune(now time.Time) (int, error) {
+	var dropped int64
+	if a.maxAge > 0 {
+		result, err := a.db.Exec(`DELETE FROM messages WHERE ts < ?`, now.Add(-a.maxAge).UnixNano())
+		if err != nil {
+			return 0, err
+		}
+		dropped, _ = result.RowsAffected()
+	}
+
+	if a.maxBytes > 0 {
+		var size int64
+		if err := a.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM messages`).Scan(&size); err != nil {
+			return int(dropped), err
+		}
+		if size > a.maxBytes {
+			// The newest message that no longer fits in three quarters of the limit
+			var cutoff sql.NullInt64
+			err := a.db.QueryRow(`SELECT MAX(id) FROM (
+				SELECT id, SUM(size) OVER (ORDER BY id DESC) AS kept FROM messages
+			) WHERE kept > ?`, a.maxBytes/4*3).Scan(&cutoff)
+			if err != nil {
+				return int(dropped), err
+			}
+			if cutoff.Valid {
+				result, err := a.db.Exec(`DELETE FROM messages WHERE id <= ?`, cutoff.Int64)
+				if err != nil {
+					return int(dropped), err
+				}
+				n, _ := result.RowsAffected()
+				dropped += n
+			}
+		}
+	}
+
+	if dropped > 0 {
+		a.db.Exec(`PRAGMA incremental_vacuum`) // Give the freed pages back to the file system
+	}
+	return int(dropped), nil
+}
+
+// Clear removes every archived message
+func (a *MessageArchive) Clear() error {
+	if _, err := a.db.Exec(`DELETE FROM messages`); err != nil {
+		return err
+	}
+	a.db.Exec(`PRAGMA incremental_vacuum`)
+	return nil
+}
+
+// Close writes the queued messages and closes the database
+func (a *MessageArchive) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.db.Close()
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a security-relevant action
+type AuditEntry struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Action       string    `json:"action"`
+	Operator     string    `json:"operator,omitempty"`
+	DeviceName   string    `json:"deviceName,omitempty"`
+	OutletNumber string    `json:"outletNumber,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+}
+
+// AuditLog keeps recent audit entries in memory and appends every entry
+// to a JSON-lines file when a path is configured
+type AuditLog struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+	maxSize int
+	path    string
+}
+
+// NewAuditLog creates a new audit log; path may be empty for memory-only logging
+func NewAuditLog(maxSize int, path string) *AuditLog {
+	if maxSize <= 0 {
+		maxSize = 1000 // Default max size
+	}
+	return &AuditLog{
+		entries: make([]AuditEntry, 0),
+		maxSize: maxSize,
+		path:    path,
+	}
+}
+
+// SetPath sets the file that new entries are appended to
+func (l *AuditLog) SetPath(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path = path
+}
+
+// Record adds an entry to the log (newest at front) and appends it to disk
+func (l *AuditLog) Record(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	// Insert at beginning (newest first)
+	l.entries = append([]AuditEntry{entry}, l.entries...)
+
+	// Trim to max size
+	if len(l.entries) > l.maxSize {
+		l.entries = l.entries[:l.maxSize]
+	}
+
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Append with restricted permissions (user read/write only)
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// GetAll returns all entries held in memory
+func (l *AuditLog) GetAll() []AuditEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make([]AuditEntry, len(l.entries))
+	copy(result, l.entries)
+	return result
+}
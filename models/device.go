@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -8,22 +12,125 @@ import (
 
 // DeviceOutlet represents a single outlet on a power device
 type DeviceOutlet struct {
-	DeviceName   string    `json:"deviceName"`
-	OutletNumber string    `json:"outletNumber"`
-	Status       string    `json:"status"` // "ON" or "OFF"
-	LastUpdate   time.Time `json:"lastUpdate"`
+	DeviceName   string       `json:"deviceName"`
+	OutletNumber string       `json:"outletNumber"`
+	Bank         string       `json:"bank,omitempty"`         // bank or section of the PDU, from topics that name one
+	Status       string       `json:"status"`                 // "ON" or "OFF"
+	LastUpdate   time.Time    `json:"lastUpdate"`             // when the outlet last reported, changed or not
+	Reports      uint64       `json:"reports,omitempty"`      // state reports since startup, including repeats
+	Watts        *float64     `json:"watts,omitempty"`        // active power, for outlets with telemetry
+	Volts        *float64     `json:"volts,omitempty"`        // supply voltage
+	Amps         *float64     `json:"amps,omitempty"`         // load current
+	KWh          *float64     `json:"kwh,omitempty"`          // energy meter reading
+	StateTopic   string       `json:"stateTopic,omitempty"`   // set for devices learned from discovery
+	CommandTopic string       `json:"commandTopic,omitempty"` // set for devices learned from discovery
+	Availability string       `json:"availability,omitempty"` // from the device's LWT; empty if never reported
+	Label        string       `json:"label,omitempty"`        // friendly name published by the device
+	Level        *int         `json:"level,omitempty"`        // 0-100, for dimmable outlets
+	Location     string       `json:"location,omitempty"`     // set by the operator, or from the location rule matching its topics
+	Tags         []string     `json:"tags,omitempty"`         // set by the operator
+	Notes        string       `json:"notes,omitempty"`        // set by the operator
+	Reservation  *Reservation `json:"reservation,omitempty"`  // the reservation holding the outlet now
+	Stale        bool         `json:"stale,omitempty"`        // not reported within the stale window, or since before a restart
+	Desired      string       `json:"desired,omitempty"`      // state a command asked for that the outlet has not reached; set while drifted
+}
+
+// Device availability reported through LWT topics
+const (
+	AvailabilityOnline  = "online"
+	AvailabilityOffline = "offline"
+)
+
+// Drifted reports whether the outlet did not reach the state last
+// commanded within the acknowledgement timeout and has not since
+func (d DeviceOutlet) Drifted() bool {
+	return d.Desired != ""
+}
+
+// Unreachable reports whether the outlet's device is known to be offline;
+// its status is then the last one reported, not the current one
+func (d DeviceOutlet) Unreachable() bool {
+	return d.Availability == AvailabilityOffline
+}
+
+// Summary aggregates outlet states across the store
+type Summary struct {
+	Devices int `json:"devices"`
+	Outlets int `json:"outlets"`
+	On      int `json:"on"`
+	Off     int `json:"off"`
+	Other   int `json:"other"` // outlets reporting anything but ON or OFF
+
+	Unreachable int `json:"unreachable"` // outlets of offline devices, not counted above
 }
 
 // DeviceStore manages the collection of devices and outlets
 type DeviceStore struct {
-	mu      sync.RWMutex
-	devices map[string]*DeviceOutlet // key: "deviceName:outletNumber"
+	mu           sync.RWMutex
+	devices      map[string]*DeviceOutlet // key: "deviceName:outletNumber"
+	order        []outletKey              // keys of devices, sorted naturally
+	availability map[string]string        // key: device name
+	locations    map[string]string        // key: "deviceName:outletNumber"; from location rules
+	banks        map[string]string        // key: "deviceName:outletNumber"; from state topics
+	details      map[string]OutletDetails // key: "deviceName:outletNumber"; edited by operators
+	reservations map[string]*Reservation  // key: "deviceName:outletNumber"
+	drift        map[string]string        // key: "deviceName:outletNumber"; desired state of drifted outlets
+	path         string                   // where Save writes; empty for memory only
+	saveMu       sync.Mutex               // serializes writes to path
+	changes      chan struct{}            // signalled when outlets change
 }
 
 // NewDeviceStore creates a new device store
 func NewDeviceStore() *DeviceStore {
 	return &DeviceStore{
-		devices: make(map[string]*DeviceOutlet),
+		devices:      make(map[string]*DeviceOutlet),
+		availability: make(map[string]string),
+		locations:    make(map[string]string),
+		banks:        make(map[string]string),
+		details:      make(map[string]OutletDetails),
+		reservations: make(map[string]*Reservation),
+		drift:        make(map[string]string),
+		changes:      make(chan struct{}, 1),
+	}
+}
+
+// OutletDetails are the operator-edited fields of an outlet, kept in the
+// inventory rather than with its reported state
+type OutletDetails struct {
+	Tags     []string
+	Notes    string
+	Location string // overrides the location rules if set
+}
+
+// applyDetails copies an outlet's operator-edited fields onto it; the caller
+// must hold the lock
+func (s *DeviceStore) applyDetails(device *DeviceOutlet) {
+	key := makeKey(device.DeviceName, device.OutletNumber)
+	details := s.details[key]
+	device.Tags = details.Tags
+	device.Notes = details.Notes
+	if bank := s.banks[key]; bank != "" {
+		device.Bank = bank
+	}
+	switch {
+	case details.Location != "":
+		device.Location = details.Location
+	case s.locations[key] != "":
+		device.Location = s.locations[key]
+	}
+}
+
+// Changes returns a channel signalled after outlets change, so they can be
+// saved; signals are coalesced while nobody is reading
+func (s *DeviceStore) Changes() <-chan struct{} {
+	return s.changes
+}
+
+// changed signals that the stored outlets changed
+func (s *DeviceStore) changed() {
+	select {
+	case s.changes <- struct{}{}:
+	default:
 	}
 }
 
@@ -32,14 +139,315 @@ func makeKey(deviceName, outletNumber string) string {
 	return deviceName + ":" + outletNumber
 }
 
-// Add adds or updates a device outlet
-func (s *DeviceStore) Add(device DeviceOutlet) {
+// outletKey identifies an outlet in the sorted index
+type outletKey struct {
+	deviceName   string
+	outletNumber string
+}
+
+// search returns the position of a key in the sorted index, or where it
+// would be inserted; the caller must hold the lock
+func (s *DeviceStore) search(key outletKey) int {
+	return sort.Search(len(s.order), func(i int) bool { return !s.order[i].less(key) })
+}
+
+// put stores an outlet, adding it to the sorted index if it is new; the
+// caller must hold the write lock
+func (s *DeviceStore) put(device *DeviceOutlet) {
+	key := makeKey(device.DeviceName, device.OutletNumber)
+	if _, exists := s.devices[key]; !exists {
+		index := outletKey{device.DeviceName, device.OutletNumber}
+		s.order = slices.Insert(s.order, s.search(index), index)
+	}
+	s.devices[key] = device
+}
+
+// delete removes an outlet and its place in the sorted index; the caller
+// must hold the write lock
+func (s *DeviceStore) delete(deviceName, outletNumber string) {
+	key := makeKey(deviceName, outletNumber)
+	if _, exists := s.devices[key]; !exists {
+		return
+	}
+	delete(s.devices, key)
+	index := outletKey{deviceName, outletNumber}
+	if i := s.search(index); i < len(s.order) && s.order[i] == index {
+		s.order = slices.Delete(s.order, i, i+1)
+	}
+}
+
+// Add adds or updates a device outlet, counting the report. It returns the
+// stored outlet and whether anything but its last report time changed, so
+// repeated reports need not be passed on. The outlet's Stale flag is kept
+// as given: only reports from the device (state, telemetry, level) clear it.
+func (s *DeviceStore) Add(device DeviceOutlet) (DeviceOutlet, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	device.LastUpdate = time.Now()
+	if availability, ok := s.availability[device.DeviceName]; ok {
+		device.Availability = availability
+	}
 	key := makeKey(device.DeviceName, device.OutletNumber)
-	s.devices[key] = &device
+	s.applyDetails(&device)
+	device.Reservation = s.reservations[key]
+	device.Desired = s.drift[key]
+	if device.Desired == device.Status {
+		delete(s.drift, key) // Converged
+		device.Desired = ""
+	}
+
+	previous, exists := s.devices[key]
+	device.Reports = 1
+	if exists {
+		device.Reports = previous.Reports + 1
+	}
+	changed := !exists || !sameOutlet(*previous, device)
+	s.put(&device)
+	if changed {
+		s.changed()
+	}
+	return device, changed
+}
+
+// sameOutlet reports whether two outlets only differ in their reports
+func sameOutlet(a, b DeviceOutlet) bool {
+	a.LastUpdate, b.LastUpdate = time.Time{}, time.Time{}
+	a.Reports, b.Reports = 0, 0
+	return reflect.DeepEqual(a, b)
+}
+
+// newOutlet adds an outlet that has not reported a status yet; the caller
+// must hold the lock
+func (s *DeviceStore) newOutlet(deviceName, outletNumber string) *DeviceOutlet {
+	key := makeKey(deviceName, outletNumber)
+	device := &DeviceOutlet{
+		DeviceName:   deviceName,
+		OutletNumber: outletNumber,
+		Status:       "UNKNOWN",
+		Availability: s.availability[deviceName],
+		Reservation:  s.reservations[key],
+	}
+	s.applyDetails(device)
+	s.put(device)
+	return device
+}
+
+// SetLocation records the location given by the location rules, applying it to the outlet now
+// or once it is added. It returns the outlet and true if a stored outlet's
+// location changed.
+func (s *DeviceStore) SetLocation(deviceName, outletNumber, location string) (DeviceOutlet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	if location == "" {
+		delete(s.locations, key)
+	} else {
+		s.locations[key] = location
+	}
+
+	device, exists := s.devices[key]
+	if !exists || s.details[key].Location != "" || device.Location == location {
+		return DeviceOutlet{}, false
+	}
+	device.Location = location
+	s.changed()
+	return *device, true
+}
+
+// SetBank records the bank an outlet reported from, applying it to the
+// outlet now or once it is added. It returns the outlet and true if a
+// stored outlet's bank changed.
+func (s *DeviceStore) SetBank(deviceName, outletNumber, bank string) (DeviceOutlet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	s.banks[key] = bank
+
+	device, exists := s.devices[key]
+	if !exists || device.Bank == bank {
+		return DeviceOutlet{}, false
+	}
+	device.Bank = bank
+	s.changed()
+	return *device, true
+}
+
+// SetDetails records an outlet's operator-edited fields, applying them to
+// the outlet now or once it is added. It returns the outlet and true if a
+// stored outlet changed.
+func (s *DeviceStore) SetDetails(deviceName, outletNumber string, details OutletDetails) (DeviceOutlet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	previous := s.details[key]
+	if len(details.Tags) == 0 && details.Notes == "" && details.Location == "" {
+		delete(s.details, key)
+	} else {
+		s.details[key] = details
+	}
+
+	device, exists := s.devices[key]
+	if !exists {
+		return DeviceOutlet{}, false
+	}
+	if previous.Location != "" && details.Location == "" {
+		device.Location = s.locations[key] // Back to the location rules
+	}
+	s.applyDetails(device)
+	s.changed()
+	return *device, true
+}
+
+// SetAvailability records whether a device is reachable, applying it to the
+// device's outlets (including ones reported later), and returns the previous
+// availability and the updated outlets
+func (s *DeviceStore) SetAvailability(deviceName, availability string) (string, []DeviceOutlet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.availability[deviceName]
+	s.availability[deviceName] = availability
+
+	updated := make([]DeviceOutlet, 0)
+	for _, device := range s.devices {
+		if device.DeviceName == deviceName {
+			device.Availability = availability
+			updated = append(updated, *device)
+		}
+	}
+	return previous, updated
+}
+
+// SetReservation records the reservation holding an outlet, nil if none,
+// applying it to the outlet now or once it is added. It returns the outlet
+// and true if a stored outlet's reservation changed.
+func (s *DeviceStore) SetReservation(deviceName, outletNumber string, reservation *Reservation) (DeviceOutlet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	previous := s.reservations[key]
+	if reservation == nil {
+		delete(s.reservations, key)
+	} else {
+		s.reservations[key] = reservation
+	}
+
+	device, exists := s.devices[key]
+	if !exists || sameReservation(previous, reservation) {
+		return DeviceOutlet{}, false
+	}
+	device.Reservation = reservation
+	return *device, true
+}
+
+// SetDrift flags an outlet as drifted from the desired state, or clears the
+// flag if desired is empty. It returns the outlet and true if a stored
+// outlet's flag changed.
+func (s *DeviceStore) SetDrift(deviceName, outletNumber, desired string) (DeviceOutlet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	device, exists := s.devices[key]
+	if !exists || device.Status == desired {
+		delete(s.drift, key)
+		return DeviceOutlet{}, false
+	}
+	if desired == "" {
+		delete(s.drift, key)
+	} else {
+		s.drift[key] = desired
+	}
+	if device.Desired == desired {
+		return DeviceOutlet{}, false
+	}
+	device.Desired = desired
+	return *device, true
+}
+
+// sameReservation reports whether two reservation pointers describe the
+// same reservation
+func sameReservation(a, b *Reservation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Telemetry is a set of electrical readings; nil fields were not reported
+type Telemetry struct {
+	Watts *float64
+	Volts *float64
+	Amps  *float64
+	KWh   *float64
+}
+
+// SetTelemetry records an outlet's reported readings, keeping earlier
+// values for readings not included, and adds the outlet if needed. Like a
+// state report, it counts as the outlet reporting.
+func (s *DeviceStore) SetTelemetry(deviceName, outletNumber string, telemetry Telemetry) DeviceOutlet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	device, exists := s.devices[key]
+	if !exists {
+		device = s.newOutlet(deviceName, outletNumber)
+	}
+	if telemetry.Watts != nil {
+		device.Watts = telemetry.Watts
+	}
+	if telemetry.Volts != nil {
+		device.Volts = telemetry.Volts
+	}
+	if telemetry.Amps != nil {
+		device.Amps = telemetry.Amps
+	}
+	if telemetry.KWh != nil {
+		device.KWh = telemetry.KWh
+	}
+	device.LastUpdate = time.Now()
+	device.Stale = false // The device is reporting again
+	s.changed()
+	return *device
+}
+
+// SetLabel records an outlet's friendly name, adding the outlet if needed
+func (s *DeviceStore) SetLabel(deviceName, outletNumber, label string) DeviceOutlet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	device, exists := s.devices[key]
+	if !exists {
+		device = s.newOutlet(deviceName, outletNumber)
+	}
+	device.Label = label
+	s.changed()
+	return *device
+}
+
+// SetLevel records a dimmable outlet's reported level, adding the outlet if
+// needed
+func (s *DeviceStore) SetLevel(deviceName, outletNumber string, level int) DeviceOutlet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	device, exists := s.devices[key]
+	if !exists {
+		device = s.newOutlet(deviceName, outletNumber)
+	}
+	device.Level = &level
+	device.LastUpdate = time.Now()
+	device.Stale = false
+	s.changed()
+	return *device
 }
 
 // Get retrieves a device outlet
@@ -55,31 +463,40 @@ func (s *DeviceStore) Get(deviceName, outletNumber string) (DeviceOutlet, bool)
 	return *device, true
 }
 
-// GetAll returns all devices sorted by device name, then outlet number
+// GetAll returns all devices sorted naturally by device name, then outlet
+// number, so outlet 2 comes before outlet 10
 func (s *DeviceStore) GetAll() []DeviceOutlet {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	devices := make([]DeviceOutlet, 0, len(s.devices))
-	for _, device := range s.devices {
-		devices = append(devices, *device)
-	}
-
-	// Sort by device name, then outlet number
-	// Simple bubble sort for simplicity
-	for i := 0; i < len(devices); i++ {
-		for j := i + 1; j < len(devices); j++ {
-			if devices[i].DeviceName > devices[j].DeviceName ||
-				(devices[i].DeviceName == devices[j].DeviceName &&
-					devices[i].OutletNumber > devices[j].OutletNumber) {
-				devices[i], devices[j] = devices[j], devices[i]
-			}
-		}
+	devices := make([]DeviceOutlet, 0, len(s.order))
+	for _, key := range s.order {
+		devices = append(devices, *s.devices[makeKey(key.deviceName, key.outletNumber)])
 	}
-
 	return devices
 }
 
+// DevicePage is one page of the sorted device list
+type DevicePage struct {
+	Devices []DeviceOutlet `json:"devices"`
+	Offset  int            `json:"offset"`
+	Total   int            `json:"total"` // outlets in the whole list
+}
+
+// GetPage returns up to limit devices starting at offset, in GetAll order,
+// copying only the outlets on the page
+func (s *DeviceStore) GetPage(offset, limit int) DevicePage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	page := DevicePage{Devices: make([]DeviceOutlet, 0), Offset: offset, Total: len(s.order)}
+	for i := offset; i >= 0 && i < len(s.order) && i < offset+limit; i++ {
+		key := s.order[i]
+		page.Devices = append(page.Devices, *s.devices[makeKey(key.deviceName, key.outletNumber)])
+	}
+	return page
+}
+
 // Filter returns devices matching the search text (case-insensitive)
 func (s *DeviceStore) Filter(searchText string) []DeviceOutlet {
 	if searchText == "" {
@@ -92,26 +509,106 @@ func (s *DeviceStore) Filter(searchText string) []DeviceOutlet {
 	searchText = strings.ToLower(searchText)
 	filtered := make([]DeviceOutlet, 0)
 
-	for _, device := range s.devices {
+	for _, key := range s.order {
+		device := s.devices[makeKey(key.deviceName, key.outletNumber)]
 		if strings.Contains(strings.ToLower(device.DeviceName), searchText) ||
 			strings.Contains(strings.ToLower(device.OutletNumber), searchText) ||
-			strings.Contains(strings.ToLower(device.Status), searchText) {
+			strings.Contains(strings.ToLower(device.Label), searchText) ||
+			strings.Contains(strings.ToLower(device.Location), searchText) ||
+			strings.Contains(strings.ToLower(device.Status), searchText) ||
+			matchesTag(device.Tags, searchText) {
 			filtered = append(filtered, *device)
 		}
 	}
+	return filtered
+}
 
-	// Sort results
-	for i := 0; i < len(filtered); i++ {
-		for j := i + 1; j < len(filtered); j++ {
-			if filtered[i].DeviceName > filtered[j].DeviceName ||
-				(filtered[i].DeviceName == filtered[j].DeviceName &&
-					filtered[i].OutletNumber > filtered[j].OutletNumber) {
-				filtered[i], filtered[j] = filtered[j], filtered[i]
-			}
+// matchesTag reports whether any tag contains the lower-case search text
+func matchesTag(tags []string, searchText string) bool {
+	for _, tag := range tags {
+		if strings.Contains(strings.ToLower(tag), searchText) {
+			return true
 		}
 	}
+	return false
+}
 
-	return filtered
+// Summary returns aggregate counts of devices and outlet states
+func (s *DeviceStore) Summary() Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summary := Summary{Outlets: len(s.devices)}
+	names := make(map[string]bool)
+	for _, device := range s.devices {
+		names[device.DeviceName] = true
+		if device.Unreachable() {
+			summary.Unreachable++
+			continue
+		}
+		switch device.Status {
+		case "ON":
+			summary.On++
+		case "OFF":
+			summary.Off++
+		default:
+			summary.Other++
+		}
+	}
+	summary.Devices = len(names)
+
+	return summary
+}
+
+// Remove deletes a device outlet
+func (s *DeviceStore) Remove(deviceName, outletNumber string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delete(deviceName, outletNumber)
+	s.changed()
+}
+
+// ExpireStale flags outlets last reported before staleBefore as stale and
+// removes those last reported before purgeBefore; a zero time skips either
+// step. It returns the newly stale and the removed outlets.
+func (s *DeviceStore) ExpireStale(staleBefore, purgeBefore time.Time) (stale, purged []DeviceOutlet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, device := range s.devices {
+		switch {
+		case device.LastUpdate.IsZero():
+			continue // Never reported a state
+		case !purgeBefore.IsZero() && device.LastUpdate.Before(purgeBefore):
+			s.delete(device.DeviceName, device.OutletNumber)
+			purged = append(purged, *device)
+		case !staleBefore.IsZero() && !device.Stale && device.LastUpdate.Before(staleBefore):
+			device.Stale = true
+			stale = append(stale, *device)
+		}
+	}
+	if len(stale) > 0 || len(purged) > 0 {
+		s.changed()
+	}
+	return stale, purged
+}
+
+// RemoveDevice deletes all outlets of a device and returns them
+func (s *DeviceStore) RemoveDevice(deviceName string) []DeviceOutlet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := make([]DeviceOutlet, 0)
+	for _, device := range s.devices {
+		if device.DeviceName == deviceName {
+			removed = append(removed, *device)
+			s.delete(device.DeviceName, device.OutletNumber)
+		}
+	}
+	if len(removed) > 0 {
+		s.changed()
+	}
+	return removed
 }
 
 // Count returns the total number of devices
@@ -121,9 +618,75 @@ func (s *DeviceStore) Count() int {
 	return len(s.devices)
 }
 
-// Clear removes all devices
+// Clear removes all devices; operator-edited details are kept
 func (s *DeviceStore) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.devices = make(map[string]*DeviceOutlet)
+	s.order = nil
+	s.availability = make(map[string]string)
+	s.locations = make(map[string]string)
+	s.banks = make(map[string]string)
+	s.reservations = make(map[string]*Reservation)
+	s.drift = make(map[string]string)
+	s.changed()
+}
+
+// Load reads the outlets saved by Save from path, marking them stale until
+// they report again, and saves future changes there
+func (s *DeviceStore) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+	var stored []DeviceOutlet
+	if err := readJSON(path, &stored); err != nil {
+		return err
+	}
+	for i := range stored {
+		device := stored[i]
+		key := makeKey(device.DeviceName, device.OutletNumber)
+		if _, exists := s.devices[key]; exists {
+			continue // Already reported
+		}
+		device.Stale = true
+		if device.Bank != "" && s.banks[key] == "" {
+			s.banks[key] = device.Bank // Commands need it before the outlet reports
+		}
+		device.Availability = s.availability[device.DeviceName]
+		device.Reservation = s.reservations[key]
+		s.applyDetails(&device)
+		s.put(&device)
+	}
+	return nil
+}
+
+// Save writes the outlets to the path given to Load; availability,
+// reservations, tags and notes are left out as they are tracked elsewhere,
+// and report counts and drift as they restart with the app
+func (s *DeviceStore) Save() error {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	devices := s.GetAll()
+	for i := range devices {
+		devices[i].Availability = ""
+		devices[i].Reservation = nil
+		devices[i].Reports = 0
+		devices[i].Desired = ""
+		devices[i].Tags = nil
+		devices[i].Notes = ""
+	}
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	return WriteFileAtomic(path, data)
 }
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PayloadEncoding declares how a message payload should be read
+type PayloadEncoding string
+
+const (
+	EncodingText   PayloadEncoding = "text"   // UTF-8 text
+	EncodingBinary PayloadEncoding = "binary" // e.g. CBOR or protobuf telemetry
+)
+
+// Payload input formats accepted by DecodePayload
+const (
+	FormatText   = "text"
+	FormatHex    = "hex"
+	FormatBase64 = "base64"
+)
+
+// DetectEncoding classifies a payload as text if it is valid UTF-8 without
+// control characters other than whitespace, and as binary otherwise
+func DetectEncoding(payload []byte) PayloadEncoding {
+	if !utf8.Valid(payload) {
+		return EncodingBinary
+	}
+	for _, r := range string(payload) {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return EncodingBinary
+		}
+	}
+	return EncodingText
+}
+
+// RenderHex formats a payload as space-separated hex bytes, e.g. "a1 00 ff"
+func RenderHex(payload []byte) string {
+	var b strings.Builder
+	for i, c := range payload {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02x", c)
+	}
+	return b.String()
+}
+
+// RenderBase64 formats a payload as standard base64
+func RenderBase64(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(payload)
+}
+
+// RenderPayload formats a payload for display: text as-is, binary as base64
+func RenderPayload(payload []byte, encoding PayloadEncoding) string {
+	if encoding == EncodingBinary {
+		return RenderBase64(payload)
+	}
+	return string(payload)
+}
+
+// DecodePayload converts text, hex or base64 input to the bytes to publish.
+// Hex input may separate bytes with spaces or colons.
+func DecodePayload(input, format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return []byte(input), nil
+	case FormatHex:
+		cleaned := strings.NewReplacer(" ", "", ":", "", "\n", "", "\t", "").Replace(input)
+		cleaned = strings.TrimPrefix(strings.TrimPrefix(cleaned, "0x"), "0X")
+		payload, err := hex.DecodeString(cleaned)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload: %w", err)
+		}
+		return payload, nil
+	case FormatBase64:
+		payload, err := base64.StdEncoding.DecodeString(strings.TrimSpace(input))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("unknown payload format %q", format)
+	}
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// BaselineSamples is the number of ON readings averaged into a baseline
+const BaselineSamples = 10
+
+// Baseline is the typical power draw of an outlet while it is ON
+type Baseline struct {
+	Watts      float64   `json:"watts"`
+	Samples    int       `json:"samples"`
+	RecordedAt time.Time `json:"recordedAt,omitempty"` // zero while still learning
+}
+
+// Complete reports whether enough samples were averaged
+func (b Baseline) Complete() bool {
+	return b.Samples >= BaselineSamples
+}
+
+// EnergyBaselines learns a baseline per outlet from its first ON readings
+// and keeps completed baselines in a JSON file when a path is configured
+type EnergyBaselines struct {
+	mu        sync.RWMutex
+	baselines map[string]*Baseline // key: "deviceName:outletNumber"
+	path      string
+}
+
+// NewEnergyBaselines creates an empty baseline store
+func NewEnergyBaselines() *EnergyBaselines {
+	return &EnergyBaselines{
+		baselines: make(map[string]*Baseline),
+	}
+}
+
+// Load reads stored baselines from path and saves future changes there
+func (e *EnergyBaselines) Load(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.path = path
+	baselines := make(map[string]*Baseline)
+	if err := readJSON(path, &baselines); err != nil {
+		return err
+	}
+	e.baselines = baselines
+	return nil
+}
+
+// Observe adds an ON reading to an outlet's baseline while it is still being
+// learned and returns the baseline
+func (e *EnergyBaselines) Observe(deviceName, outletNumber string, watts float64) (Baseline, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	baseline, ok := e.baselines[key]
+	if !ok {
+		baseline = &Baseline{}
+		e.baselines[key] = baseline
+	}
+	if baseline.Complete() {
+		return *baseline, nil
+	}
+
+	// Running mean of the readings so far
+	baseline.Samples++
+	baseline.Watts += (watts - baseline.Watts) / float64(baseline.Samples)
+	if !baseline.Complete() {
+		return *baseline, nil
+	}
+
+	baseline.RecordedAt = time.Now()
+	return *baseline, e.save()
+}
+
+// Reset forgets an outlet's baseline so it is learned again
+func (e *EnergyBaselines) Reset(deviceName, outletNumber string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.baselines, makeKey(deviceName, outletNumber))
+	return e.save()
+}
+
+// GetAll returns all baselines keyed by "deviceName:outletNumber"
+func (e *EnergyBaselines) GetAll() map[string]Baseline {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make(map[string]Baseline, len(e.baselines))
+	for key, baseline := range e.baselines {
+		result[key] = *baseline
+	}
+	return result
+}
+
+// save writes the completed baselines to disk; caller must hold mu
+func (e *EnergyBaselines) save() error {
+	if e.path == "" {
+		return nil
+	}
+
+	complete := make(map[string]*Baseline)
+	for key, baseline := range e.baselines {
+		if baseline.Complete() {
+			complete[key] = baseline
+		}
+	}
+	return writeJSON(e.path, complete)
+}
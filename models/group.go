@@ -0,0 +1,204 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxGroupDelay is the longest a group member may be delayed, in milliseconds
+const MaxGroupDelay = 600000
+
+// GroupMember is an outlet in a group
+type GroupMember struct {
+	DeviceName   string `json:"deviceName"`
+	OutletNumber string `json:"outletNumber"`
+	Delay        int    `json:"delay,omitempty"` // milliseconds to wait after the previous member
+}
+
+// Group is a named set of outlets switched together, e.g. "AV Rack". Unlike
+// the inventory group of an outlet, which only labels it, a group is
+// commanded as a whole and members are switched in order.
+type Group struct {
+	Name      string        `json:"name"`
+	Members   []GroupMember `json:"members"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// Validate checks a group's name and members
+func (g Group) Validate() error {
+	if strings.TrimSpace(g.Name) == "" {
+		return fmt.Errorf("group name is required")
+	}
+	if len(g.Members) == 0 {
+		return fmt.Errorf("group %s has no outlets", g.Name)
+	}
+
+	seen := make(map[string]bool, len(g.Members))
+	for _, member := range g.Members {
+		if member.DeviceName == "" || member.OutletNumber == "" {
+			return fmt.Errorf("group %s has a member without device or outlet", g.Name)
+		}
+		key := makeKey(member.DeviceName, member.OutletNumber)
+		if seen[key] {
+			return fmt.Errorf("group %s lists outlet %s/%s twice", g.Name, member.DeviceName, member.OutletNumber)
+		}
+		seen[key] = true
+		if member.Delay < 0 || member.Delay > MaxGroupDelay {
+			return fmt.Errorf("invalid delay for %s/%s: %d", member.DeviceName, member.OutletNumber, member.Delay)
+		}
+	}
+	return nil
+}
+
+// Groups keeps outlet groups, in a JSON file when a path is configured
+type Groups struct {
+	mu     sync.RWMutex
+	groups map[string]*Group // key: lower-case name
+	path   string
+}
+
+// NewGroups creates an empty group list
+func NewGroups() *Groups {
+	return &Groups{groups: make(map[string]*Group)}
+}
+
+// Load reads the stored groups from path and saves future changes there
+func (g *Groups) Load(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.path = path
+	var stored []*Group
+	if err := readJSON(path, &stored); err != nil {
+		return err
+	}
+
+	groups := make(map[string]*Group, len(stored))
+	for _, group := range stored {
+		groups[strings.ToLower(group.Name)] = group
+	}
+	g.groups = groups
+	return nil
+}
+
+// Put adds a group or replaces the one with the same name (ignoring case)
+func (g *Groups) Put(group Group) (Group, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	if err := group.Validate(); err != nil {
+		return Group{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	group.UpdatedAt = time.Now()
+	groups := maps.Clone(g.groups)
+	groups[strings.ToLower(group.Name)] = &group
+	if err := g.save(groups); err != nil {
+		return Group{}, err
+	}
+	g.groups = groups
+	return group, nil
+}
+
+// Replace swaps every group for the given ones, e.g. from a settings
+// archive, keeping their update times. Nothing changes if any is invalid
+// or two have the same name.
+func (g *Groups) Replace(list []Group) error {
+	groups, err := groupMap(list)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.save(groups); err != nil {
+		return err
+	}
+	g.groups = groups
+	return nil
+}
+
+// ValidateGroups checks groups as Replace does, without replacing anything
+func ValidateGroups(list []Group) error {
+	_, err := groupMap(list)
+	return err
+}
+
+// groupMap indexes groups by name, ignoring case
+func groupMap(list []Group) (map[string]*Group, error) {
+	groups := make(map[string]*Group, len(list))
+	for _, group := range list {
+		group.Name = strings.TrimSpace(group.Name)
+		if err := group.Validate(); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(group.Name)
+		if _, exists := groups[key]; exists {
+			return nil, fmt.Errorf("duplicate group name: %s", group.Name)
+		}
+		groups[key] = &group
+	}
+	return groups, nil
+}
+
+// Delete removes a group
+func (g *Groups) Delete(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(name))
+	if _, ok := g.groups[key]; !ok {
+		return fmt.Errorf("group not found: %s", name)
+	}
+	groups := maps.Clone(g.groups)
+	delete(groups, key)
+	if err := g.save(groups); err != nil {
+		return err
+	}
+	g.groups = groups
+	return nil
+}
+
+// Get returns a group by name, ignoring case
+func (g *Groups) Get(name string) (Group, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	group, ok := g.groups[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Group{}, false
+	}
+	return *group, true
+}
+
+// GetAll returns all groups sorted by name
+func (g *Groups) GetAll() []Group {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return sortedGroups(g.groups)
+}
+
+// sortedGroups returns copies of the groups sorted by name
+func sortedGroups(byName map[string]*Group) []Group {
+	groups := make([]Group, 0, len(byName))
+	for _, group := range byName {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		return strings.ToLower(groups[a].Name) < strings.ToLower(groups[b].Name)
+	})
+	return groups
+}
+
+// save writes groups to disk before the caller swaps them in, so a failed
+// write changes nothing; caller must hold mu
+func (g *Groups) save(groups map[string]*Group) error {
+	return writeJSON(g.path, sortedGroups(groups))
+}
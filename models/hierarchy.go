@@ -0,0 +1,145 @@
+package models
+
+import "sort"
+
+// Aggregate statuses of a device or bank
+const (
+	AggregateAllOn   = "all-on"
+	AggregateAllOff  = "all-off"
+	AggregateMixed   = "mixed"
+	AggregateUnknown = "unknown" // no outlet reports ON or OFF
+)
+
+// Device is a PDU or other unit with its outlets, grouped into banks where
+// its topics name them
+type Device struct {
+	Name         string         `json:"name"`
+	Availability string         `json:"availability,omitempty"`
+	Status       string         `json:"status"` // aggregate of the outlet states
+	On           int            `json:"on"`
+	Off          int            `json:"off"`
+	Other        int            `json:"other"` // unknown, other or unreachable
+	Outlets      []DeviceOutlet `json:"outlets"`
+	Banks        []Bank         `json:"banks,omitempty"`
+}
+
+// Bank is a bank or section of a device's outlets
+type Bank struct {
+	Name    string   `json:"name"` // empty for outlets not on a bank
+	Status  string   `json:"status"`
+	On      int      `json:"on"`
+	Off     int      `json:"off"`
+	Other   int      `json:"other"`
+	Outlets []string `json:"outlets"` // outlet numbers
+}
+
+// tally counts outlet states and derives the aggregate status
+type tally struct {
+	on, off, other int
+}
+
+// add counts one outlet
+func (t *tally) add(outlet DeviceOutlet) {
+	switch {
+	case outlet.Unreachable():
+		t.other++
+	case outlet.Status == "ON":
+		t.on++
+	case outlet.Status == "OFF":
+		t.off++
+	default:
+		t.other++
+	}
+}
+
+// status returns the aggregate status
+func (t tally) status() string {
+	switch {
+	case t.on == 0 && t.off == 0:
+		return AggregateUnknown
+	case t.off == 0 && t.other == 0:
+		return AggregateAllOn
+	case t.on == 0 && t.other == 0:
+		return AggregateAllOff
+	}
+	return AggregateMixed
+}
+
+// GroupDevices groups sorted outlets by device and bank, keeping their order
+func GroupDevices(outlets []DeviceOutlet) []Device {
+	devices := make([]Device, 0)
+	index := make(map[string]int) // device name to position in devices
+	tallies := make([]tally, 0)
+	bankIndex := make([]map[string]int, 0) // per device: bank name to position in Banks
+	bankTallies := make([][]tally, 0)
+
+	for _, outlet := range outlets {
+		i, ok := index[outlet.DeviceName]
+		if !ok {
+			i = len(devices)
+			index[outlet.DeviceName] = i
+			devices = append(devices, Device{Name: outlet.DeviceName, Outlets: make([]DeviceOutlet, 0)})
+			tallies = append(tallies, tally{})
+			bankIndex = append(bankIndex, make(map[string]int))
+			bankTallies = append(bankTallies, nil)
+		}
+
+		device := &devices[i]
+		device.Outlets = append(device.Outlets, outlet)
+		if outlet.Availability != "" {
+			device.Availability = outlet.Availability
+		}
+		tallies[i].add(outlet)
+
+		b, ok := bankIndex[i][outlet.Bank]
+		if !ok {
+			b = len(device.Banks)
+			bankIndex[i][outlet.Bank] = b
+			device.Banks = append(device.Banks, Bank{Name: outlet.Bank})
+			bankTallies[i] = append(bankTallies[i], tally{})
+		}
+		device.Banks[b].Outlets = append(device.Banks[b].Outlets, outlet.OutletNumber)
+		bankTallies[i][b].add(outlet)
+	}
+
+	for i := range devices {
+		device := &devices[i]
+		device.On, device.Off, device.Other = tallies[i].on, tallies[i].off, tallies[i].other
+		device.Status = tallies[i].status()
+
+		// Banks are only worth showing if the topics name them
+		if len(device.Banks) == 1 && device.Banks[0].Name == "" {
+			device.Banks = nil
+			continue
+		}
+		for b := range device.Banks {
+			bank, t := &device.Banks[b], bankTallies[i][b]
+			bank.On, bank.Off, bank.Other = t.on, t.off, t.other
+			bank.Status = t.status()
+		}
+		sort.SliceStable(device.Banks, func(a, b int) bool {
+			return NaturalLess(device.Banks[a].Name, device.Banks[b].Name)
+		})
+	}
+	return devices
+}
+
+// Devices returns every device with its outlets and aggregate status,
+// sorted naturally by name
+func (s *DeviceStore) Devices() []Device {
+	return GroupDevices(s.GetAll())
+}
+
+// Device returns one device with its outlets and aggregate status
+func (s *DeviceStore) Device(name string) (Device, bool) {
+	outlets := make([]DeviceOutlet, 0)
+	for _, outlet := range s.GetAll() {
+		if outlet.DeviceName == name {
+			outlets = append(outlets, outlet)
+		}
+	}
+	if len(outlets) == 0 {
+		return Device{}, false
+	}
+	return GroupDevices(outlets)[0], true
+}
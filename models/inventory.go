@@ -0,0 +1,235 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutletMetadata is operator-maintained information about an outlet that
+// devices do not report themselves
+type OutletMetadata struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Label        string    `json:"label,omitempty"`
+	Group        string    `json:"group,omitempty"`
+	RatedWatts   *float64  `json:"ratedWatts,omitempty"` // expected load of the connected equipment
+	Circuit      string    `json:"circuit,omitempty"`    // upstream breaker or feed
+	Tags         []string  `json:"tags,omitempty"`
+	Notes        string    `json:"notes,omitempty"`
+	Location     string    `json:"location,omitempty"` // overrides the location rules
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// MaxNotesLength caps an outlet's notes, in characters
+const MaxNotesLength = 4000
+
+// NormalizeTags trims tags and drops empty and duplicate ones (ignoring
+// case), keeping the first spelling of each
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// Inventory keeps outlet metadata, in a JSON file when a path is configured
+type Inventory struct {
+	mu      sync.RWMutex
+	outlets map[string]*OutletMetadata // key: "deviceName:outletNumber"
+	path    string
+}
+
+// NewInventory creates an empty inventory
+func NewInventory() *Inventory {
+	return &Inventory{
+		outlets: make(map[string]*OutletMetadata),
+	}
+}
+
+// Load reads the stored inventory from path and saves future changes there
+func (i *Inventory) Load(path string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.path = path
+	var stored []*OutletMetadata
+	if err := readJSON(path, &stored); err != nil {
+		return err
+	}
+
+	outlets := make(map[string]*OutletMetadata, len(stored))
+	for _, outlet := range stored {
+		outlets[makeKey(outlet.DeviceName, outlet.OutletNumber)] = outlet
+	}
+	i.outlets = outlets
+	return nil
+}
+
+// Get returns an outlet's metadata
+func (i *Inventory) Get(deviceName, outletNumber string) (OutletMetadata, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	outlet, ok := i.outlets[makeKey(deviceName, outletNumber)]
+	if !ok {
+		return OutletMetadata{}, false
+	}
+	return *outlet, true
+}
+
+// GetAll returns all outlet metadata sorted by device name, then outlet number
+func (i *Inventory) GetAll() []OutletMetadata {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	outlets := make([]OutletMetadata, 0, len(i.outlets))
+	for _, outlet := range i.outlets {
+		outlets = append(outlets, *outlet)
+	}
+	sort.Slice(outlets, func(a, b int) bool {
+		if outlets[a].DeviceName != outlets[b].DeviceName {
+			return outlets[a].DeviceName < outlets[b].DeviceName
+		}
+		return outlets[a].OutletNumber < outlets[b].OutletNumber
+	})
+	return outlets
+}
+
+// Upsert adds the metadata of several outlets in one write, merging it into
+// that of outlets already in the inventory: only the fields set in outlets
+// are changed. Returns how many were created and updated.
+func (i *Inventory) Upsert(outlets []OutletMetadata) (created, updated int, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	merged := maps.Clone(i.outlets)
+	for _, outlet := range outlets {
+		key := makeKey(outlet.DeviceName, outlet.OutletNumber)
+		if existing, exists := merged[key]; exists {
+			outlet = existing.merge(outlet)
+			updated++
+		} else {
+			created++
+		}
+		outlet.UpdatedAt = now
+		merged[key] = &outlet
+	}
+	if err := i.save(merged); err != nil {
+		return 0, 0, err
+	}
+	i.outlets = merged
+	return created, updated, nil
+}
+
+// Put replaces the whole metadata of an outlet, clearing the fields that
+// are not set
+func (i *Inventory) Put(outlet OutletMetadata) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	outlet.UpdatedAt = time.Now()
+	outlets := maps.Clone(i.outlets)
+	outlets[makeKey(outlet.DeviceName, outlet.OutletNumber)] = &outlet
+	if err := i.save(outlets); err != nil {
+		return err
+	}
+	i.outlets = outlets
+	return nil
+}
+
+// merge returns the metadata with the fields set in update replacing its own
+func (m OutletMetadata) merge(update OutletMetadata) OutletMetadata {
+	if update.Label != "" {
+		m.Label = update.Label
+	}
+	if update.Group != "" {
+		m.Group = update.Group
+	}
+	if update.RatedWatts != nil {
+		m.RatedWatts = update.RatedWatts
+	}
+	if update.Circuit != "" {
+		m.Circuit = update.Circuit
+	}
+	if len(update.Tags) > 0 {
+		m.Tags = update.Tags
+	}
+	if update.Notes != "" {
+		m.Notes = update.Notes
+	}
+	if update.Location != "" {
+		m.Location = update.Location
+	}
+	return m
+}
+
+// Replace swaps the whole inventory for the given outlets, e.g. from a
+// settings archive, keeping their update times. Nothing changes if an entry
+// has no device or outlet or two are for the same outlet.
+func (i *Inventory) Replace(list []OutletMetadata) error {
+	outlets, err := inventoryMap(list)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if err := i.save(outlets); err != nil {
+		return err
+	}
+	i.outlets = outlets
+	return nil
+}
+
+// ValidateInventory checks inventory entries as Replace does, without
+// replacing anything
+func ValidateInventory(list []OutletMetadata) error {
+	_, err := inventoryMap(list)
+	return err
+}
+
+// inventoryMap indexes inventory entries by outlet
+func inventoryMap(list []OutletMetadata) (map[string]*OutletMetadata, error) {
+	outlets := make(map[string]*OutletMetadata, len(list))
+	for _, outlet := range list {
+		if outlet.DeviceName == "" || outlet.OutletNumber == "" {
+			return nil, fmt.Errorf("inventory entry without device or outlet")
+		}
+		key := makeKey(outlet.DeviceName, outlet.OutletNumber)
+		if _, exists := outlets[key]; exists {
+			return nil, fmt.Errorf("duplicate inventory entry: %s/%s", outlet.DeviceName, outlet.OutletNumber)
+		}
+		outlets[key] = &outlet
+	}
+	return outlets, nil
+}
+
+// save writes byOutlet to disk before the caller swaps it in, so a failed
+// write changes nothing; caller must hold mu
+func (i *Inventory) save(byOutlet map[string]*OutletMetadata) error {
+	if i.path == "" {
+		return nil
+	}
+
+	outlets := make([]*OutletMetadata, 0, len(byOutlet))
+	for _, outlet := range byOutlet {
+		outlets = append(outlets, outlet)
+	}
+	sort.Slice(outlets, func(a, b int) bool {
+		return makeKey(outlets[a].DeviceName, outlets[a].OutletNumber) < makeKey(outlets[b].DeviceName, outlets[b].OutletNumber)
+	})
+	return writeJSON(i.path, outlets)
+}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"sort"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // MessageDirection indicates if message was sent or received
@@ -15,17 +18,177 @@ const (
 
 // MQTTMessage represents a logged MQTT message
 type MQTTMessage struct {
+	ID        uint64           `json:"id"` // monotonically increasing sequence number
+	Direction MessageDirection `json:"direction"`
+	Topic     string           `json:"topic"`
+	Payload   []byte           `json:"payload"` // rendered per Encoding in JSON
+	Encoding  PayloadEncoding  `json:"encoding"`
+	QoS       byte             `json:"qos"`
+	Retained  bool             `json:"retained"`            // delivered from the broker's retained store
+	Duplicate bool             `json:"duplicate"`           // redelivery of a QoS 1 or 2 message
+	PacketID  uint16           `json:"packetId"`            // MQTT packet identifier; 0 for QoS 0 and sent messages
+	Timestamp time.Time        `json:"timestamp"`           // in JSON with millisecond precision
+	LatencyMs *float64         `json:"latencyMs,omitempty"` // Send only: until the state report confirming the command
+	Truncated bool             `json:"truncated,omitempty"` // Payload was cut to the log's payload limit
+	FullSize  int              `json:"fullSize,omitempty"`  // size of the whole payload when truncated
+
+	full []byte // whole payload when truncated; kept in memory only, see MaxFullPayloadBytes
+}
+
+// MessageTimeFormat is RFC 3339 with fixed millisecond precision, used for
+// message timestamps in JSON and exports
+const MessageTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// mqttMessageJSON is the wire form of MQTTMessage, with the payload as text
+// or, for binary payloads, base64 and a hex dump
+type mqttMessageJSON struct {
+	ID        uint64           `json:"id"`
 	Direction MessageDirection `json:"direction"`
 	Topic     string           `json:"topic"`
 	Payload   string           `json:"payload"`
-	Timestamp time.Time        `json:"timestamp"`
+	Hex       string           `json:"hex,omitempty"` // binary payloads only; ignored when read back
+	Encoding  PayloadEncoding  `json:"encoding"`
+	QoS       byte             `json:"qos"`
+	Retained  bool             `json:"retained"`
+	Duplicate bool             `json:"duplicate"`
+	PacketID  uint16           `json:"packetId"`
+	Timestamp string           `json:"timestamp"`
+	LatencyMs *float64         `json:"latencyMs,omitempty"`
+	Truncated bool             `json:"truncated,omitempty"`
+	FullSize  int              `json:"fullSize,omitempty"`
+}
+
+// Text returns the payload rendered for display
+func (m MQTTMessage) Text() string {
+	return RenderPayload(m.Payload, m.Encoding)
+}
+
+// Truncate cuts the payload to at most limit bytes, without splitting a
+// UTF-8 character of a text payload, and marks the message truncated. The
+// whole payload stays available from the log's Full while the log has room
+// for it. A limit of zero or less leaves the payload whole.
+func (m MQTTMessage) Truncate(limit int) MQTTMessage {
+	if limit <= 0 || len(m.Payload) <= limit {
+		return m
+	}
+
+	cut := limit
+	if DetectEncoding(m.Payload) == EncodingText {
+		for cut > 0 && !utf8.RuneStart(m.Payload[cut]) {
+			cut--
+		}
+	}
+	m.full = m.Payload
+	m.Payload = m.Payload[:cut]
+	m.Truncated = true
+	m.FullSize = len(m.full)
+	return m
+}
+
+// Whole returns the message with the payload it had before Truncate; a
+// message read back from JSON keeps its truncated payload
+func (m MQTTMessage) Whole() MQTTMessage {
+	if m.full == nil {
+		return m
+	}
+	m.Payload, m.full = m.full, nil
+	m.Truncated, m.FullSize = false, 0
+	return m
 }
 
-// MessageLog stores MQTT messages with a maximum size limit
+// Hex returns a hex dump of a binary payload, or "" for text
+func (m MQTTMessage) Hex() string {
+	if m.Encoding != EncodingBinary {
+		return ""
+	}
+	return RenderHex(m.Payload)
+}
+
+// MarshalJSON renders the payload as text, or as base64 with a hex dump if
+// it is binary, so it can be shown safely
+func (m MQTTMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mqttMessageJSON{
+		ID:        m.ID,
+		Direction: m.Direction,
+		Topic:     m.Topic,
+		Payload:   m.Text(),
+		Hex:       m.Hex(),
+		Encoding:  m.Encoding,
+		QoS:       m.QoS,
+		Retained:  m.Retained,
+		Duplicate: m.Duplicate,
+		PacketID:  m.PacketID,
+		Timestamp: m.Timestamp.Format(MessageTimeFormat),
+		LatencyMs: m.LatencyMs,
+		Truncated: m.Truncated,
+		FullSize:  m.FullSize,
+	})
+}
+
+// UnmarshalJSON reads a message written by MarshalJSON
+func (m *MQTTMessage) UnmarshalJSON(data []byte) error {
+	var wire mqttMessageJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, wire.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	payload := []byte(wire.Payload)
+	if wire.Encoding == EncodingBinary {
+		decoded, err := DecodePayload(wire.Payload, FormatBase64)
+		if err != nil {
+			return err
+		}
+		payload = decoded
+	} else {
+		wire.Encoding = EncodingText
+	}
+
+	*m = MQTTMessage{
+		ID:        wire.ID,
+		Direction: wire.Direction,
+		Topic:     wire.Topic,
+		Payload:   payload,
+		Encoding:  wire.Encoding,
+		QoS:       wire.QoS,
+		Retained:  wire.Retained,
+		Duplicate: wire.Duplicate,
+		PacketID:  wire.PacketID,
+		Timestamp: timestamp,
+		LatencyMs: wire.LatencyMs,
+		Truncated: wire.Truncated,
+		FullSize:  wire.FullSize,
+	}
+	return nil
+}
+
+// MaxFullPayloadBytes bounds the whole payloads of truncated messages the
+// log keeps for Full; past it, the oldest are dropped and those messages
+// keep only their truncated payload
+const MaxFullPayloadBytes = 32 << 20
+
+// MessageLog stores MQTT messages with a maximum size limit. Messages are
+// kept in a ring buffer, so adding one never copies the others.
 type MessageLog struct {
-	mu       sync.RWMutex
-	messages []MQTTMessage
-	maxSize  int
+	mu        sync.RWMutex
+	messages  []MQTTMessage // ring buffer; grows to maxSize, then wraps
+	start     int           // index of the oldest message once the buffer is full
+	maxSize   int
+	lastID    uint64
+	fullBytes int      // size of the whole payloads kept
+	fullIDs   []uint64 // messages that may keep a whole payload, oldest first
+}
+
+// MessageBatch is a page of messages returned by Fetch
+type MessageBatch struct {
+	From     uint64        `json:"from"`     // cursor the batch continues from
+	Messages []MQTTMessage `json:"messages"` // oldest first
+	Cursor   uint64        `json:"cursor"`   // pass to the next Fetch call
+	More     bool          `json:"more"`     // more messages are available after Cursor
+	Missed   uint64        `json:"missed"`   // messages evicted before they could be fetched
 }
 
 // NewMessageLog creates a new message log with a maximum size
@@ -33,33 +196,203 @@ func NewMessageLog(maxSize int) *MessageLog {
 	if maxSize <= 0 {
 		maxSize = 1000 // Default max size
 	}
-	return &MessageLog{
-		messages: make([]MQTTMessage, 0, maxSize),
-		maxSize:  maxSize,
+	return &MessageLog{maxSize: maxSize}
+}
+
+// at returns the i-th newest message; the caller holds the lock
+func (l *MessageLog) at(i int) *MQTTMessage {
+	n := len(l.messages)
+	return &l.messages[(l.start+n-1-i)%n]
+}
+
+// indexOf returns the position of a message as passed to at, or -1 if it
+// is not in the log; IDs grow from the oldest message to the newest, so it
+// is found by binary search. The caller holds the lock.
+func (l *MessageLog) indexOf(id uint64) int {
+	n := len(l.messages)
+	// Search the positions oldest first
+	p := sort.Search(n, func(p int) bool { return l.messages[(l.start+p)%n].ID >= id })
+	if p == n || l.messages[(l.start+p)%n].ID != id {
+		return -1
 	}
+	return n - 1 - p
+}
+
+// keepFull accounts for the whole payload of a message being added and
+// drops the oldest whole payloads past MaxFullPayloadBytes; the caller
+// holds the lock
+func (l *MessageLog) keepFull(msg MQTTMessage) {
+	if msg.full != nil {
+		l.fullBytes += len(msg.full)
+		l.fullIDs = append(l.fullIDs, msg.ID)
+	}
+	oldest := l.at(len(l.messages) - 1).ID
+	for len(l.fullIDs) > 0 && (l.fullBytes > MaxFullPayloadBytes || l.fullIDs[0] < oldest) {
+		if i := l.indexOf(l.fullIDs[0]); i >= 0 {
+			held := l.at(i)
+			l.fullBytes -= len(held.full)
+			held.full = nil
+		}
+		l.fullIDs = l.fullIDs[1:]
+	}
+}
+
+// recountFull recounts the whole payloads kept after messages were dropped;
+// the caller holds the lock
+func (l *MessageLog) recountFull() {
+	l.fullBytes, l.fullIDs = 0, nil
+	for i := len(l.messages) - 1; i >= 0; i-- {
+		if msg := l.at(i); msg.full != nil {
+			l.fullBytes += len(msg.full)
+			l.fullIDs = append(l.fullIDs, msg.ID)
+		}
+	}
+}
+
+// oldestFirst copies the messages, oldest first; the caller holds the lock
+func (l *MessageLog) oldestFirst() []MQTTMessage {
+	result := make([]MQTTMessage, 0, len(l.messages))
+	result = append(result, l.messages[l.start:]...)
+	return append(result, l.messages[:l.start]...)
 }
 
 // AddMessage adds a message to the log (newest at front)
-func (l *MessageLog) AddMessage(direction MessageDirection, topic, payload string) {
+func (l *MessageLog) AddMessage(direction MessageDirection, topic string, payload []byte) MQTTMessage {
+	return l.Add(MQTTMessage{Direction: direction, Topic: topic, Payload: payload})
+}
+
+// Add adds a message with its delivery flags to the log, assigning its ID,
+// encoding and timestamp
+func (l *MessageLog) Add(msg MQTTMessage) MQTTMessage {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	msg := MQTTMessage{
-		Direction: direction,
-		Topic:     topic,
-		Payload:   payload,
-		Timestamp: time.Now(),
+	msg = l.stamp(msg)
+
+	// Grow until full, then overwrite the oldest
+	if len(l.messages) < l.maxSize {
+		l.messages = append(l.messages, msg)
+	} else {
+		l.fullBytes -= len(l.messages[l.start].full)
+		l.messages[l.start] = msg
+		l.start = (l.start + 1) % len(l.messages)
+	}
+	l.keepFull(msg)
+
+	return msg
+}
+
+// Stamp gives a message an ID, encoding and timestamp as Add does, without
+// keeping it in the log, for messages recorded only elsewhere
+func (l *MessageLog) Stamp(msg MQTTMessage) MQTTMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stamp(msg)
+}
+
+// stamp numbers a message; the caller holds mu
+func (l *MessageLog) stamp(msg MQTTMessage) MQTTMessage {
+	l.lastID++
+	msg.ID = l.lastID
+	if msg.full != nil {
+		msg.Encoding = DetectEncoding(msg.full)
+	} else {
+		msg.Encoding = DetectEncoding(msg.Payload)
+	}
+	msg.Timestamp = time.Now()
+	return msg
+}
+
+// Fetch returns up to limit messages newer than cursor, oldest first
+func (l *MessageLog) Fetch(cursor uint64, limit int) MessageBatch {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	batch := MessageBatch{
+		From:     cursor,
+		Messages: make([]MQTTMessage, 0),
+		Cursor:   cursor,
+	}
+
+	for i := len(l.messages) - 1; i >= 0; i-- {
+		msg := *l.at(i)
+		if msg.ID <= cursor {
+			continue
+		}
+		if len(batch.Messages) == 0 && msg.ID > cursor+1 {
+			batch.Missed = msg.ID - cursor - 1
+		}
+		if len(batch.Messages) == limit {
+			batch.More = true
+			break
+		}
+		batch.Messages = append(batch.Messages, msg)
+		batch.Cursor = msg.ID
 	}
 
-	// Insert at beginning (newest first)
-	l.messages = append([]MQTTMessage{msg}, l.messages...)
+	return batch
+}
+
+// LastID returns the sequence number of the newest message
+func (l *MessageLog) LastID() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastID
+}
 
-	// Trim to max size
-	if len(l.messages) > l.maxSize {
-		l.messages = l.messages[:l.maxSize]
+// SetLastID continues numbering after id, e.g. after the messages archived
+// before a restart
+func (l *MessageLog) SetLastID(id uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id > l.lastID {
+		l.lastID = id
 	}
 }
 
+// Query returns the messages selected by the query, newest first
+func (l *MessageLog) Query(query MessageQuery) []MQTTMessage {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	query.Compile()
+	result := make([]MQTTMessage, 0)
+	for i := range l.messages {
+		if query.Limit > 0 && len(result) == query.Limit {
+			break
+		}
+		if msg := l.at(i); query.Matches(*msg) {
+			result = append(result, *msg)
+		}
+	}
+	return result
+}
+
+// Search returns the messages selected by the query, newest first, and
+// counts every message it matches beyond the limit
+func (l *MessageLog) Search(query MessageQuery) MessageSearch {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	query.Compile()
+	search := MessageSearch{Messages: make([]MQTTMessage, 0)}
+	for i := range l.messages {
+		msg := l.at(i)
+		if !query.Matches(*msg) {
+			continue
+		}
+		search.Matches++
+		if query.Limit <= 0 || len(search.Messages) < query.Limit {
+			search.Messages = append(search.Messages, *msg)
+		}
+	}
+	return search
+}
+
 // GetRecent returns the n most recent messages
 func (l *MessageLog) GetRecent(n int) []MQTTMessage {
 	l.mu.RLock()
@@ -70,25 +403,108 @@ func (l *MessageLog) GetRecent(n int) []MQTTMessage {
 	}
 
 	result := make([]MQTTMessage, n)
-	copy(result, l.messages[:n])
+	for i := range result {
+		result[i] = *l.at(i)
+	}
 	return result
 }
 
 // GetAll returns all messages
 func (l *MessageLog) GetAll() []MQTTMessage {
+	return l.GetRecent(0)
+}
+
+// Full returns a logged message with its whole payload, even if it was
+// truncated, and false if it is no longer in the log
+func (l *MessageLog) Full(id uint64) (MQTTMessage, bool) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
-	result := make([]MQTTMessage, len(l.messages))
-	copy(result, l.messages)
-	return result
+	i := l.indexOf(id)
+	if i < 0 {
+		return MQTTMessage{}, false
+	}
+	return l.at(i).Whole(), true
+}
+
+// SetLatency records the time until a logged command was confirmed,
+// returning false if the message is no longer in the log
+func (l *MessageLog) SetLatency(id uint64, latencyMs float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := l.indexOf(id)
+	if i < 0 {
+		return false
+	}
+	l.at(i).LatencyMs = &latencyMs
+	return true
 }
 
 // Clear removes all messages from the log
 func (l *MessageLog) Clear() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.messages = make([]MQTTMessage, 0, l.maxSize)
+	l.messages, l.start = nil, 0
+	l.fullBytes, l.fullIDs = 0, nil
+}
+
+// SetCapacity changes how many messages the log keeps, dropping the oldest
+// ones if there are more
+func (l *MessageLog) SetCapacity(maxSize int) {
+	if maxSize <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := l.oldestFirst()
+	if len(kept) > maxSize {
+		kept = kept[len(kept)-maxSize:]
+	}
+	l.messages, l.start = kept, 0
+	l.maxSize = maxSize
+	l.recountFull()
+}
+
+// Prune drops the messages logged before cutoff and returns how many
+func (l *MessageLog) Prune(cutoff time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dropped := 0
+	for dropped < len(l.messages) && l.at(len(l.messages)-1-dropped).Timestamp.Before(cutoff) {
+		dropped++
+	}
+	if dropped > 0 {
+		l.messages, l.start = l.oldestFirst()[dropped:], 0
+		l.recountFull()
+	}
+	return dropped
+}
+
+// Restore fills the log with earlier messages, newest first, e.g. from the
+// archive at startup, keeping the newest that fit alongside those already
+// logged. Numbering continues after them.
+func (l *MessageLog) Restore(earlier []MQTTMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.oldestFirst()
+	room := l.maxSize - len(current)
+	if room > len(earlier) {
+		room = len(earlier)
+	}
+	messages := make([]MQTTMessage, 0, room+len(current))
+	for i := room - 1; i >= 0; i-- {
+		messages = append(messages, earlier[i])
+		if earlier[i].ID > l.lastID {
+			l.lastID = earlier[i].ID
+		}
+	}
+	l.messages, l.start = append(messages, current...), 0
+	l.recountFull()
 }
 
 // Count returns the number of messages in the log
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MessageQuery selects logged messages; zero fields match everything
+type MessageQuery struct {
+	Topic     string           `json:"topic"`     // MQTT filter whose levels may also be glob patterns, e.g. "power/+/outlets/#"
+	Direction MessageDirection `json:"direction"` // "Send" or "Recv"
+	Text      string           `json:"text"`      // case-insensitive substring of the topic or payload, as logged (truncated)
+	Regex     bool             `json:"regex"`     // Text is a regular expression (RE2 syntax, case-sensitive)
+	Since     time.Time        `json:"since"`
+	Until     time.Time        `json:"until"`
+	BeforeID  uint64           `json:"beforeId"` // only messages older than this ID, to page backwards
+	Limit     int              `json:"limit"`    // most messages returned, newest first
+
+	re *regexp.Regexp // compiled Text in regex mode
+}
+
+// MessageSearch is the result of a message query with the number of
+// messages it matched, which may exceed the limit
+type MessageSearch struct {
+	Messages []MQTTMessage `json:"messages"` // newest first
+	Matches  int           `json:"matches"`
+}
+
+// Compile checks and compiles the regular expression of a query in regex
+// mode, so Matches need not compile it for every message
+func (q *MessageQuery) Compile() error {
+	if !q.Regex || q.re != nil {
+		return nil
+	}
+	re, err := regexp.Compile(q.Text)
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %w", err)
+	}
+	q.re = re
+	return nil
+}
+
+// Matches reports whether a message is selected by the query
+func (q MessageQuery) Matches(msg MQTTMessage) bool {
+	if q.Direction != "" && msg.Direction != q.Direction {
+		return false
+	}
+	if !q.Since.IsZero() && msg.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && msg.Timestamp.After(q.Until) {
+		return false
+	}
+	if q.BeforeID != 0 && msg.ID >= q.BeforeID {
+		return false
+	}
+	if q.Topic != "" && !MatchTopic(q.Topic, msg.Topic) {
+		return false
+	}
+	if q.Regex {
+		if q.re == nil && q.Compile() != nil {
+			return false
+		}
+		return q.re.MatchString(msg.Topic) || q.re.MatchString(msg.Text())
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		return strings.Contains(strings.ToLower(msg.Topic), text) || strings.Contains(strings.ToLower(msg.Text()), text)
+	}
+	return true
+}
+
+// MatchTopic reports whether a topic matches a filter whose levels are "+",
+// a final "#" or glob patterns
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level == "+" {
+			continue
+		}
+		if matched, _ := path.Match(level, topicLevels[i]); !matched {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// ValidateTopicPattern checks a filter for MatchTopic
+func ValidateTopicPattern(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter is empty")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("'#' must be the last level of the filter: %s", filter)
+		}
+		if _, err := path.Match(level, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q in filter %s: %w", level, filter, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// PowerHistoryDays is how long hourly power samples are kept
+const PowerHistoryDays = 90
+
+// PowerSample aggregates an outlet's power readings over one hour
+type PowerSample struct {
+	Hour     time.Time `json:"hour"` // start of the hour
+	Watts    float64   `json:"watts"`
+	MaxWatts float64   `json:"maxWatts"`
+	Readings int       `json:"readings"`
+}
+
+// PowerHistory keeps hourly power samples per outlet, in a JSON file when a
+// path is configured. The file is only rewritten when an hour is complete,
+// and holds no sample older than PowerHistoryDays, of any outlet.
+type PowerHistory struct {
+	mu       sync.RWMutex
+	outlets  map[string][]PowerSample // key: "deviceName:outletNumber"; oldest first
+	path     string
+	dirty    bool       // a completed hour is not saved yet
+	partial  bool       // the current hour changed since the last save
+	lastHour time.Time  // newest hour observed, to notice a new one starting
+	saveMu   sync.Mutex // serializes writes to path
+}
+
+// NewPowerHistory creates an empty power history
+func NewPowerHistory() *PowerHistory {
+	return &PowerHistory{outlets: make(map[string][]PowerSample)}
+}
+
+// Load reads the stored samples from path and saves future changes there
+func (p *PowerHistory) Load(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.path = path
+	outlets := make(map[string][]PowerSample)
+	if err := readJSON(path, &outlets); err != nil {
+		return err
+	}
+	p.outlets = outlets
+	return nil
+}
+
+// Observe adds a power reading to the outlet's sample for the hour of at.
+// When a new hour starts, the previous ones are complete and due to be
+// saved, and samples older than PowerHistoryDays are dropped from every
+// outlet, so outlets that stopped reporting age out too.
+func (p *PowerHistory) Observe(deviceName, outletNumber string, watts float64, at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hour := at.Truncate(time.Hour)
+	if hour.After(p.lastHour) {
+		if !p.lastHour.IsZero() {
+			p.dirty = p.dirty || p.partial
+			p.partial = false
+		}
+		p.lastHour = hour
+		p.prune(hour.AddDate(0, 0, -PowerHistoryDays))
+	}
+
+	key := makeKey(deviceName, outletNumber)
+	samples := p.outlets[key]
+	if n := len(samples); n > 0 && samples[n-1].Hour.Equal(hour) {
+		sample := &samples[n-1]
+		sample.Readings++
+		sample.Watts += (watts - sample.Watts) / float64(sample.Readings)
+		if watts > sample.MaxWatts {
+			sample.MaxWatts = watts
+		}
+	} else {
+		p.outlets[key] = append(samples, PowerSample{Hour: hour, Watts: watts, MaxWatts: watts, Readings: 1})
+	}
+	if hour.Equal(p.lastHour) {
+		p.partial = true
+	} else {
+		p.dirty = true // A late reading for a completed hour
+	}
+}
+
+// prune drops the samples before cutoff and outlets left without any; the
+// caller must hold the lock
+func (p *PowerHistory) prune(cutoff time.Time) {
+	for key, samples := range p.outlets {
+		first := 0
+		for first < len(samples) && samples[first].Hour.Before(cutoff) {
+			first++
+		}
+		switch {
+		case first == len(samples):
+			delete(p.outlets, key)
+			p.dirty = true
+		case first > 0:
+			p.outlets[key] = append([]PowerSample(nil), samples[first:]...)
+			p.dirty = true
+		}
+	}
+}
+
+// Range returns the samples of every outlet for the hours starting between
+// from and to, keyed by "deviceName:outletNumber"
+func (p *PowerHistory) Range(from, to time.Time) map[string][]PowerSample {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make(map[string][]PowerSample)
+	for key, samples := range p.outlets {
+		for _, sample := range samples {
+			if !sample.Hour.Before(from.Truncate(time.Hour)) && !sample.Hour.After(to) {
+				result[key] = append(result[key], sample)
+			}
+		}
+	}
+	return result
+}
+
+// Samples returns an outlet's samples for the hours starting between from
+// and to (zero means unbounded), oldest first
+func (p *PowerHistory) Samples(deviceName, outletNumber string, from, to time.Time) []PowerSample {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]PowerSample, 0)
+	for _, sample := range p.outlets[makeKey(deviceName, outletNumber)] {
+		if !sample.Hour.Before(from.Truncate(time.Hour)) && (to.IsZero() || !sample.Hour.After(to)) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// Save writes the samples to the path given to Load if a completed hour
+// changed since the last save
+func (p *PowerHistory) Save() error {
+	return p.save(false)
+}
+
+// Flush writes the samples to the path given to Load if anything changed,
+// including the current hour, e.g. at shutdown
+func (p *PowerHistory) Flush() error {
+	return p.save(true)
+}
+
+// save writes the samples if there are changes to write
+func (p *PowerHistory) save(partial bool) error {
+	p.mu.Lock()
+	if p.path == "" || !(p.dirty || partial && p.partial) {
+		p.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(p.outlets)
+	path := p.path
+	dirty, wasPartial := p.dirty, p.partial
+	p.dirty = false
+	if partial {
+		p.partial = false
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+	if err := WriteFileAtomic(path, data); err != nil {
+		p.mu.Lock()
+		p.dirty = p.dirty || dirty // Retry on the next save
+		p.partial = p.partial || wasPartial
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
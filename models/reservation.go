@@ -0,0 +1,165 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reservation holds an outlet for an operator during a time window; other
+// operators and automatic commands cannot switch it meanwhile
+type Reservation struct {
+	DeviceName   string    `json:"deviceName"`
+	OutletNumber string    `json:"outletNumber"`
+	Operator     string    `json:"operator"`
+	Note         string    `json:"note,omitempty"` // e.g. "FOH desk - do not touch until Sunday"
+	From         time.Time `json:"from"`
+	Until        time.Time `json:"until"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// ActiveAt reports whether the reservation covers the given time
+func (r Reservation) ActiveAt(t time.Time) bool {
+	return !t.Before(r.From) && t.Before(r.Until)
+}
+
+// HeldBy reports whether an operator holds the reservation
+func (r Reservation) HeldBy(operator string) bool {
+	return operator != "" && strings.EqualFold(r.Operator, operator)
+}
+
+// Reservations keeps outlet reservations, in a JSON file when a path is
+// configured
+type Reservations struct {
+	mu           sync.RWMutex
+	reservations []Reservation // sorted by start
+	path         string
+}
+
+// NewReservations creates an empty reservation list
+func NewReservations() *Reservations {
+	return &Reservations{reservations: make([]Reservation, 0)}
+}
+
+// Load reads the stored reservations from path and saves future changes there
+func (r *Reservations) Load(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.path = path
+	stored := make([]Reservation, 0)
+	if err := readJSON(path, &stored); err != nil {
+		return err
+	}
+	sortReservations(stored)
+	r.reservations = stored
+	return nil
+}
+
+// Add stores a reservation unless it overlaps another one of the same outlet
+func (r *Reservations) Add(reservation Reservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !reservation.Until.After(reservation.From) {
+		return fmt.Errorf("reservation must end after it starts")
+	}
+	for _, existing := range r.reservations {
+		if existing.DeviceName == reservation.DeviceName && existing.OutletNumber == reservation.OutletNumber &&
+			reservation.From.Before(existing.Until) && existing.From.Before(reservation.Until) {
+			return fmt.Errorf("outlet %s/%s is already reserved by %s from %s until %s",
+				reservation.DeviceName, reservation.OutletNumber, existing.Operator,
+				existing.From.Format(time.RFC3339), existing.Until.Format(time.RFC3339))
+		}
+	}
+
+	reservation.CreatedAt = time.Now()
+	reservations := append(slices.Clone(r.reservations), reservation)
+	sortReservations(reservations)
+	if err := r.save(reservations); err != nil {
+		return err
+	}
+	r.reservations = reservations
+	return nil
+}
+
+// Active returns the reservation covering an outlet at the given time
+func (r *Reservations) Active(deviceName, outletNumber string, t time.Time) (Reservation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, reservation := range r.reservations {
+		if reservation.DeviceName == deviceName && reservation.OutletNumber == outletNumber && reservation.ActiveAt(t) {
+			return reservation, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// Remove deletes the reservation of an outlet covering the given time
+func (r *Reservations) Remove(deviceName, outletNumber string, t time.Time) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, reservation := range r.reservations {
+		if reservation.DeviceName == deviceName && reservation.OutletNumber == outletNumber && reservation.ActiveAt(t) {
+			reservations := slices.Delete(slices.Clone(r.reservations), i, i+1)
+			if err := r.save(reservations); err != nil {
+				return Reservation{}, err
+			}
+			r.reservations = reservations
+			return reservation, nil
+		}
+	}
+	return Reservation{}, fmt.Errorf("outlet %s/%s is not reserved", deviceName, outletNumber)
+}
+
+// Expire deletes the reservations that ended before the given time and
+// returns them
+func (r *Reservations) Expire(t time.Time) ([]Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expired := make([]Reservation, 0)
+	kept := make([]Reservation, 0, len(r.reservations))
+	for _, reservation := range r.reservations {
+		if reservation.Until.After(t) {
+			kept = append(kept, reservation)
+		} else {
+			expired = append(expired, reservation)
+		}
+	}
+	if len(expired) == 0 {
+		return expired, nil
+	}
+	// Expired ones are dropped even if the write fails; they no longer
+	// restrict anything
+	r.reservations = kept
+	return expired, r.save(kept)
+}
+
+// GetAll returns all current and upcoming reservations, earliest first
+func (r *Reservations) GetAll() []Reservation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reservations := make([]Reservation, len(r.reservations))
+	copy(reservations, r.reservations)
+	return reservations
+}
+
+// sortReservations orders reservations by start
+func sortReservations(reservations []Reservation) {
+	sort.SliceStable(reservations, func(a, b int) bool {
+		return reservations[a].From.Before(reservations[b].From)
+	})
+}
+
+// save writes reservations to disk before the caller swaps them in, so a
+// failed write changes nothing; caller must hold mu
+func (r *Reservations) save(reservations []Reservation) error {
+	return writeJSON(r.path, reservations)
+}
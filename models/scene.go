@@ -0,0 +1,208 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SceneOutlet is the state a scene sets an outlet to
+type SceneOutlet struct {
+	DeviceName   string `json:"deviceName"`
+	OutletNumber string `json:"outletNumber"`
+	State        string `json:"state"` // ON or OFF
+}
+
+// Scene is a named snapshot of outlet states that can be applied again,
+// e.g. "Evening" or "Presentation"
+type Scene struct {
+	Name      string        `json:"name"`
+	Outlets   []SceneOutlet `json:"outlets"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+// Validate checks a scene's name and outlet states
+func (s Scene) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("scene name is required")
+	}
+	if len(s.Outlets) == 0 {
+		return fmt.Errorf("scene %s has no outlets", s.Name)
+	}
+
+	seen := make(map[string]bool, len(s.Outlets))
+	for _, outlet := range s.Outlets {
+		if outlet.DeviceName == "" || outlet.OutletNumber == "" {
+			return fmt.Errorf("scene %s has an outlet without device or outlet number", s.Name)
+		}
+		key := makeKey(outlet.DeviceName, outlet.OutletNumber)
+		if seen[key] {
+			return fmt.Errorf("scene %s lists outlet %s/%s twice", s.Name, outlet.DeviceName, outlet.OutletNumber)
+		}
+		seen[key] = true
+		if state := strings.ToUpper(outlet.State); state != "ON" && state != "OFF" {
+			return fmt.Errorf("scene %s: state of %s/%s must be ON or OFF", s.Name, outlet.DeviceName, outlet.OutletNumber)
+		}
+	}
+	return nil
+}
+
+// Scenes keeps saved scenes, in a JSON file when a path is configured
+type Scenes struct {
+	mu     sync.RWMutex
+	scenes map[string]*Scene // key: lower-case name
+	path   string
+}
+
+// NewScenes creates an empty scene list
+func NewScenes() *Scenes {
+	return &Scenes{scenes: make(map[string]*Scene)}
+}
+
+// Load reads the stored scenes from path and saves future changes there
+func (s *Scenes) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+	var stored []*Scene
+	if err := readJSON(path, &stored); err != nil {
+		return err
+	}
+
+	scenes := make(map[string]*Scene, len(stored))
+	for _, scene := range stored {
+		scenes[strings.ToLower(scene.Name)] = scene
+	}
+	s.scenes = scenes
+	return nil
+}
+
+// Put adds a scene or replaces the one with the same name (ignoring case)
+func (s *Scenes) Put(scene Scene) (Scene, error) {
+	scene.Name = strings.TrimSpace(scene.Name)
+	if err := scene.Validate(); err != nil {
+		return Scene{}, err
+	}
+	scene.Outlets = append([]SceneOutlet(nil), scene.Outlets...)
+	for i := range scene.Outlets {
+		scene.Outlets[i].State = strings.ToUpper(scene.Outlets[i].State)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scene.UpdatedAt = time.Now()
+	scenes := maps.Clone(s.scenes)
+	scenes[strings.ToLower(scene.Name)] = &scene
+	if err := s.save(scenes); err != nil {
+		return Scene{}, err
+	}
+	s.scenes = scenes
+	return scene, nil
+}
+
+// Replace swaps every scene for the given ones, e.g. from a settings
+// archive, keeping their update times. Nothing changes if any is invalid
+// or two have the same name.
+func (s *Scenes) Replace(list []Scene) error {
+	scenes, err := sceneMap(list)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.save(scenes); err != nil {
+		return err
+	}
+	s.scenes = scenes
+	return nil
+}
+
+// ValidateScenes checks scenes as Replace does, without replacing anything
+func ValidateScenes(list []Scene) error {
+	_, err := sceneMap(list)
+	return err
+}
+
+// sceneMap indexes scenes by name, ignoring case
+func sceneMap(list []Scene) (map[string]*Scene, error) {
+	scenes := make(map[string]*Scene, len(list))
+	for _, scene := range list {
+		scene.Name = strings.TrimSpace(scene.Name)
+		if err := scene.Validate(); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(scene.Name)
+		if _, exists := scenes[key]; exists {
+			return nil, fmt.Errorf("duplicate scene name: %s", scene.Name)
+		}
+		scene.Outlets = append([]SceneOutlet(nil), scene.Outlets...)
+		for i := range scene.Outlets {
+			scene.Outlets[i].State = strings.ToUpper(scene.Outlets[i].State)
+		}
+		scenes[key] = &scene
+	}
+	return scenes, nil
+}
+
+// Delete removes a scene
+func (s *Scenes) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(name))
+	if _, ok := s.scenes[key]; !ok {
+		return fmt.Errorf("scene not found: %s", name)
+	}
+	scenes := maps.Clone(s.scenes)
+	delete(scenes, key)
+	if err := s.save(scenes); err != nil {
+		return err
+	}
+	s.scenes = scenes
+	return nil
+}
+
+// Get returns a scene by name, ignoring case
+func (s *Scenes) Get(name string) (Scene, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scene, ok := s.scenes[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Scene{}, false
+	}
+	return *scene, true
+}
+
+// GetAll returns all scenes sorted by name
+func (s *Scenes) GetAll() []Scene {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedScenes(s.scenes)
+}
+
+// sortedScenes returns copies of the scenes sorted by name
+func sortedScenes(byName map[string]*Scene) []Scene {
+	scenes := make([]Scene, 0, len(byName))
+	for _, scene := range byName {
+		scenes = append(scenes, *scene)
+	}
+	sort.Slice(scenes, func(a, b int) bool {
+		return strings.ToLower(scenes[a].Name) < strings.ToLower(scenes[b].Name)
+	})
+	return scenes
+}
+
+// save writes scenes to disk before the caller swaps them in, so a failed
+// write changes nothing; caller must hold mu
+func (s *Scenes) save(scenes map[string]*Scene) error {
+	return writeJSON(s.path, sortedScenes(scenes))
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NaturalLess orders strings with embedded numbers by their value, so
+// "outlet2" sorts before "outlet10"; other text compares ignoring case.
+// Strings that only differ in case or leading zeros fall back to byte order.
+func NaturalLess(a, b string) bool {
+	if c := naturalCompare(a, b); c != 0 {
+		return c < 0
+	}
+	return a < b
+}
+
+// naturalCompare returns -1, 0 or 1 as a sorts before, with or after b
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, nb := leadingDigits(a), leadingDigits(b)
+			a, b = a[len(na):], b[len(nb):]
+
+			// Compare by value without parsing, so long runs cannot overflow
+			na, nb = strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(na) != len(nb) {
+				return compareInts(len(na), len(nb))
+			}
+			if na != nb {
+				return strings.Compare(na, nb)
+			}
+			continue
+		}
+
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		a, b = a[sizeA:], b[sizeB:]
+		if ra, rb = unicode.ToLower(ra), unicode.ToLower(rb); ra != rb {
+			return compareInts(int(ra), int(rb))
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// leadingDigits returns the run of ASCII digits at the start of s
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compareInts returns -1, 0 or 1 as a is less than, equal to or greater than b
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// less orders outlet keys naturally by device name, then outlet number
+func (k outletKey) less(other outletKey) bool {
+	if k.deviceName != other.deviceName {
+		return NaturalLess(k.deviceName, other.deviceName)
+	}
+	return NaturalLess(k.outletNumber, other.outletNumber)
+}
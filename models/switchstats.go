@@ -0,0 +1,153 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutletStats counts an outlet's switching since tracking began
+type OutletStats struct {
+	DeviceName   string     `json:"deviceName"`
+	OutletNumber string     `json:"outletNumber"`
+	Since        time.Time  `json:"since"`    // when tracking began
+	Switches     uint64     `json:"switches"` // ON to OFF and OFF to ON transitions
+	OnSeconds    float64    `json:"onSeconds"`
+	State        string     `json:"state"`             // last reported state
+	OnSince      *time.Time `json:"onSince,omitempty"` // set while ON
+	LastSwitch   *time.Time `json:"lastSwitch,omitempty"`
+}
+
+// SwitchStats keeps switch counts and on-time per outlet, in a JSON file
+// when a path is configured
+type SwitchStats struct {
+	mu      sync.RWMutex
+	outlets map[string]*OutletStats // key: "deviceName:outletNumber"
+	path    string
+	dirty   bool
+	saveMu  sync.Mutex // serializes writes to path
+}
+
+// NewSwitchStats creates empty switch statistics
+func NewSwitchStats() *SwitchStats {
+	return &SwitchStats{outlets: make(map[string]*OutletStats)}
+}
+
+// Load reads the stored statistics from path and saves future changes there
+func (s *SwitchStats) Load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+	var stats []*OutletStats
+	if err := readJSON(path, &stats); err != nil {
+		return err
+	}
+	outlets := make(map[string]*OutletStats, len(stats))
+	for _, outlet := range stats {
+		outlets[makeKey(outlet.DeviceName, outlet.OutletNumber)] = outlet
+	}
+	s.outlets = outlets
+	return nil
+}
+
+// Observe records an outlet's reported state at the given time, counting a
+// switch when it moves between ON and OFF. The first report of an outlet
+// starts its tracking.
+func (s *SwitchStats) Observe(deviceName, outletNumber, status string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := makeKey(deviceName, outletNumber)
+	outlet, ok := s.outlets[key]
+	if !ok {
+		outlet = &OutletStats{DeviceName: deviceName, OutletNumber: outletNumber, Since: at}
+		s.outlets[key] = outlet
+	} else if outlet.State == status {
+		return
+	}
+
+	if outlet.OnSince != nil {
+		outlet.OnSeconds += at.Sub(*outlet.OnSince).Seconds()
+		outlet.OnSince = nil
+	}
+	if (outlet.State == "ON" && status == "OFF") || (outlet.State == "OFF" && status == "ON") {
+		outlet.Switches++
+		outlet.LastSwitch = &at
+	}
+	if status == "ON" {
+		outlet.OnSince = &at
+	}
+	outlet.State = status
+	s.dirty = true
+}
+
+// GetAll returns the statistics of every outlet as of now, with the time an
+// outlet has been ON so far included in its on-time, sorted naturally
+func (s *SwitchStats) GetAll() []OutletStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	stats := make([]OutletStats, 0, len(s.outlets))
+	for _, outlet := range s.outlets {
+		current := *outlet
+		if current.OnSince != nil {
+			current.OnSeconds += now.Sub(*current.OnSince).Seconds()
+		}
+		stats = append(stats, current)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return outletKey{stats[i].DeviceName, stats[i].OutletNumber}.less(outletKey{stats[j].DeviceName, stats[j].OutletNumber})
+	})
+	return stats
+}
+
+// Reset restarts an outlet's tracking from its current state, e.g. after
+// its relay was replaced; it returns false if the outlet is not tracked
+func (s *SwitchStats) Reset(deviceName, outletNumber string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outlet, ok := s.outlets[makeKey(deviceName, outletNumber)]
+	if !ok {
+		return false
+	}
+	*outlet = OutletStats{DeviceName: deviceName, OutletNumber: outletNumber, Since: at, State: outlet.State}
+	if outlet.State == "ON" {
+		outlet.OnSince = &at
+	}
+	s.dirty = true
+	return true
+}
+
+// Save writes the statistics to the path given to Load if they changed
+func (s *SwitchStats) Save() error {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	stats := make([]*OutletStats, 0, len(s.outlets))
+	for _, outlet := range s.outlets {
+		stats = append(stats, outlet)
+	}
+	data, err := json.Marshal(stats)
+	path := s.path
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if err := WriteFileAtomic(path, data); err != nil {
+		s.mu.Lock()
+		s.dirty = true // Retry on the next save
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TimelineKind classifies a timeline entry
+type TimelineKind string
+
+const (
+	TimelineState      TimelineKind = "state"      // an outlet reported a new state
+	TimelineCommand    TimelineKind = "command"    // a command was sent to an outlet
+	TimelineConnection TimelineKind = "connection" // the broker connection changed state
+	TimelineAlert      TimelineKind = "alert"      // an alert was raised
+)
+
+// TimelineEntry is a single event in the timeline
+type TimelineEntry struct {
+	Timestamp    time.Time     `json:"timestamp"`
+	Kind         TimelineKind  `json:"kind"`
+	Severity     AlertSeverity `json:"severity,omitempty"` // alerts only
+	DeviceName   string        `json:"deviceName,omitempty"`
+	OutletNumber string        `json:"outletNumber,omitempty"`
+	State        string        `json:"state,omitempty"`  // new outlet or connection state
+	Source       string        `json:"source,omitempty"` // commands only: who or what sent it
+	Detail       string        `json:"detail"`
+}
+
+// Timeline keeps recent events in memory and appends every entry to a
+// JSON-lines file when a path is configured, so older events can be
+// reviewed after they leave memory. The state changes of each outlet in the
+// file are indexed in memory, so an outlet's history needs no file read.
+type Timeline struct {
+	mu      sync.RWMutex
+	entries []TimelineEntry // oldest first
+	maxSize int
+	path    string
+	changes map[string][]TimelineEntry // state changes by outlet key, oldest first
+}
+
+// NewTimeline creates a new timeline; path may be empty for memory-only storage
+func NewTimeline(maxSize int, path string) *Timeline {
+	if maxSize <= 0 {
+		maxSize = 5000 // Default max size
+	}
+	return &Timeline{
+		entries: make([]TimelineEntry, 0),
+		maxSize: maxSize,
+		path:    path,
+		changes: make(map[string][]TimelineEntry),
+	}
+}
+
+// SetPath sets the file that new entries are appended to and indexes the
+// state changes already in it
+func (t *Timeline) SetPath(path string) {
+	entries, _ := readTimeline(path) // A missing or unreadable file starts an empty index
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.path = path
+	t.changes = make(map[string][]TimelineEntry)
+	for _, entry := range entries {
+		t.index(entry)
+	}
+	for _, entry := range t.entries {
+		t.index(entry)
+	}
+}
+
+// index adds a state entry to the outlet's changes unless it repeats the
+// last state; the caller must hold the lock
+func (t *Timeline) index(entry TimelineEntry) {
+	if entry.Kind != TimelineState || entry.State == "" {
+		return
+	}
+	key := makeKey(entry.DeviceName, entry.OutletNumber)
+	changes := t.changes[key]
+	if n := len(changes); n > 0 && (changes[n-1].State == entry.State || entry.Timestamp.Before(changes[n-1].Timestamp)) {
+		return
+	}
+	t.changes[key] = append(changes, entry)
+}
+
+// StateChanges returns the state changes of an outlet from since on (zero
+// for all), oldest first, and the last change before since, if any
+func (t *Timeline) StateChanges(deviceName, outletNumber string, since time.Time) ([]TimelineEntry, *TimelineEntry) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	changes := t.changes[makeKey(deviceName, outletNumber)]
+	start := sort.Search(len(changes), func(i int) bool { return !changes[i].Timestamp.Before(since) })
+
+	result := make([]TimelineEntry, len(changes)-start)
+	copy(result, changes[start:])
+	if start == 0 {
+		return result, nil
+	}
+	before := changes[start-1]
+	return result, &before
+}
+
+// Record adds an entry to the timeline and appends it to disk
+func (t *Timeline) Record(entry TimelineEntry) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	t.entries = append(t.entries, entry)
+	if len(t.entries) > t.maxSize {
+		t.entries = t.entries[len(t.entries)-t.maxSize:]
+	}
+	t.index(entry)
+
+	if t.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Append with restricted permissions (user read/write only)
+	f, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Recent returns the entries held in memory, oldest first
+func (t *Timeline) Recent() []TimelineEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]TimelineEntry, len(t.entries))
+	copy(result, t.entries)
+	return result
+}
+
+// Range returns the entries between from and to (inclusive, zero means
+// unbounded) in chronological order. The file on disk is read when
+// available so the range is not limited to what is held in memory.
+func (t *Timeline) Range(from, to time.Time) ([]TimelineEntry, error) {
+	t.mu.RLock()
+	path := t.path
+	t.mu.RUnlock()
+
+	var source []TimelineEntry
+	if path == "" {
+		source = t.Recent()
+	} else {
+		var err error
+		source, err = readTimeline(path)
+		if os.IsNotExist(err) {
+			source = t.Recent()
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]TimelineEntry, 0)
+	for _, entry := range source {
+		if !from.IsZero() && entry.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && entry.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Prune drops the entries older than before from memory, the index and
+// the file, which is rewritten, returning how many were dropped from it
+func (t *Timeline) Prune(before time.Time) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	kept := 0
+	for kept < len(t.entries) && t.entries[kept].Timestamp.Before(before) {
+		kept++
+	}
+	t.entries = append([]TimelineEntry(nil), t.entries[kept:]...)
+	for key, changes := range t.changes {
+		start := sort.Search(len(changes), func(i int) bool { return !changes[i].Timestamp.Before(before) })
+		if start == len(changes) {
+			delete(t.changes, key)
+		} else if start > 0 {
+			t.changes[key] = append([]TimelineEntry(nil), changes[start:]...)
+		}
+	}
+
+	if t.path == "" {
+		return 0, nil
+	}
+	entries, err := readTimeline(t.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var buf bytes.Buffer
+	dropped := 0
+	for _, entry := range entries {
+		if entry.Timestamp.Before(before) {
+			dropped++
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return 0, err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+
+	if err := WriteFileAtomic(t.path, buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return dropped, nil
+}
+
+// readTimeline reads all entries from a JSON-lines file, skipping bad lines
+func readTimeline(path string) ([]TimelineEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := make([]TimelineEntry, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry TimelineEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a torn or corrupt line
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
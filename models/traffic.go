@@ -0,0 +1,225 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Traffic log file names: traffic-<start time>.log
+const (
+	trafficPrefix     = "traffic-"
+	trafficSuffix     = ".log"
+	trafficTimeLayout = "20060102-150405.000"
+)
+
+// trafficRecord is one line of a traffic log, with the payload as text or,
+// for binary payloads, base64
+type trafficRecord struct {
+	Timestamp string           `json:"timestamp"`
+	Direction MessageDirection `json:"direction"`
+	Topic     string           `json:"topic"`
+	Payload   string           `json:"payload"`
+	Encoding  PayloadEncoding  `json:"encoding"`
+	QoS       byte             `json:"qos"`
+	Retained  bool             `json:"retained"`
+	Duplicate bool             `json:"duplicate"`
+	PacketID  uint16           `json:"packetId"`
+}
+
+// TrafficLog appends every message to JSON-lines files in a directory,
+// starting a new file when the current one reaches the maximum size and
+// removing files older than the maximum age, and the oldest files while all
+// of them are over the maximum total size
+type TrafficLog struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64         // zero never rotates
+	maxTotal int64         // zero does not limit the total size
+	maxAge   time.Duration // zero keeps files forever
+	file     *os.File
+	size     int64
+}
+
+// OpenTrafficLog starts a new traffic log file in dir, creating it if
+// needed, and removes the oldest files if they are over maxTotal
+func OpenTrafficLog(dir string, maxBytes, maxTotal int64, maxAge time.Duration) (*TrafficLog, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	t := &TrafficLog{dir: dir, maxBytes: maxBytes, maxTotal: maxTotal, maxAge: maxAge}
+	if err := t.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	if _, err := t.pruneTotal(t.file.Name()); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// rotate closes the current file and starts a new one; the caller must hold
+// the lock or own the log exclusively
+func (t *TrafficLog) rotate(now time.Time) error {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+	name := trafficPrefix + now.Format(trafficTimeLayout) + trafficSuffix
+	file, err := os.OpenFile(filepath.Join(t.dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file, t.size = file, info.Size()
+	return nil
+}
+
+// Write appends a message stamped with the current time, rotating first if
+// the current file is full
+func (t *TrafficLog) Write(msg MQTTMessage) error {
+	msg.Encoding = DetectEncoding(msg.Payload)
+	data, err := json.Marshal(trafficRecord{
+		Timestamp: time.Now().Format(MessageTimeFormat),
+		Direction: msg.Direction,
+		Topic:     msg.Topic,
+		Payload:   msg.Text(),
+		Encoding:  msg.Encoding,
+		QoS:       msg.QoS,
+		Retained:  msg.Retained,
+		Duplicate: msg.Duplicate,
+		PacketID:  msg.PacketID,
+	})
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxBytes > 0 && t.size > 0 && t.size+int64(len(data))+1 > t.maxBytes {
+		if err := t.rotate(time.Now()); err != nil {
+			return err
+		}
+		if _, err := t.pruneTotal(t.file.Name()); err != nil {
+			return err
+		}
+	}
+	if t.file == nil {
+		return os.ErrClosed
+	}
+	n, err := t.file.Write(append(data, '\n'))
+	t.size += int64(n)
+	return err
+}
+
+// Files returns the paths of the traffic log files, oldest first
+func (t *TrafficLog) Files() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, trafficPrefix) && strings.HasSuffix(name, trafficSuffix) {
+			files = append(files, filepath.Join(t.dir, name))
+		}
+	}
+	sort.Strings(files) // The names sort by start time
+	return files, nil
+}
+
+// Prune removes the files last written before the maximum age, then the
+// oldest files while all of them are over the maximum total size, apart
+// from the current one, returning how many were removed
+func (t *TrafficLog) Prune(now time.Time) (int, error) {
+	t.mu.Lock()
+	current := ""
+	if t.file != nil {
+		current = t.file.Name()
+	}
+	t.mu.Unlock()
+
+	removed := 0
+	if t.maxAge > 0 {
+		files, err := t.Files()
+		if err != nil {
+			return 0, err
+		}
+		cutoff := now.Add(-t.maxAge)
+		for _, path := range files {
+			if path == current {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed++
+		}
+	}
+
+	n, err := t.pruneTotal(current)
+	return removed + n, err
+}
+
+// pruneTotal removes the oldest files, apart from current, until all of
+// them take no more than the maximum total size
+func (t *TrafficLog) pruneTotal(current string) (int, error) {
+	if t.maxTotal <= 0 {
+		return 0, nil
+	}
+	files, err := t.Files()
+	if err != nil {
+		return 0, err
+	}
+
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	removed := 0
+	for i, path := range files {
+		if total <= t.maxTotal {
+			break
+		}
+		if path == current {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		total -= sizes[i]
+		removed++
+	}
+	return removed, nil
+}
+
+// Close closes the current file
+func (t *TrafficLog) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
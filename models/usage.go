@@ -0,0 +1,73 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// UsageModel learns how often each outlet switches to each state in every
+// hour of the day, so switching at an unusual hour can be flagged
+type UsageModel struct {
+	mu       sync.RWMutex
+	profiles map[string]*usageProfile // key: "device:outlet:STATE"
+}
+
+// usageProfile counts transitions into one state per hour of the day
+type usageProfile struct {
+	hours     [24]int
+	firstSeen time.Time
+}
+
+// NewUsageModel creates an empty usage model
+func NewUsageModel() *UsageModel {
+	return &UsageModel{
+		profiles: make(map[string]*usageProfile),
+	}
+}
+
+// usageKey creates the profile key for an outlet and target state
+func usageKey(deviceName, outletNumber, status string) string {
+	return deviceName + ":" + outletNumber + ":" + status
+}
+
+// Observe records that an outlet switched to a state at the given time
+func (m *UsageModel) Observe(deviceName, outletNumber, status string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := usageKey(deviceName, outletNumber, status)
+	profile, ok := m.profiles[key]
+	if !ok {
+		profile = &usageProfile{firstSeen: at}
+		m.profiles[key] = profile
+	}
+	if at.Before(profile.firstSeen) {
+		profile.firstSeen = at
+	}
+	profile.hours[at.Hour()]++
+}
+
+// Rate returns how many times per day the outlet has switched to the state
+// in the hour of at, and over how many days of history the rate was learned
+func (m *UsageModel) Rate(deviceName, outletNumber, status string, at time.Time) (rate float64, days float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profile, ok := m.profiles[usageKey(deviceName, outletNumber, status)]
+	if !ok {
+		return 0, 0
+	}
+
+	days = at.Sub(profile.firstSeen).Hours() / 24
+	if days < 1 {
+		return float64(profile.hours[at.Hour()]), days
+	}
+	return float64(profile.hours[at.Hour()]) / days, days
+}
+
+// Clear forgets everything learned
+func (m *UsageModel) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles = make(map[string]*usageProfile)
+}
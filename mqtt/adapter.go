@@ -0,0 +1,268 @@
+package mqtt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/config"
+)
+
+// ProtocolAdapter translates between a vendor's topics and payloads and
+// outlet states and commands
+type ProtocolAdapter interface {
+	// MatchTopic reports whether the adapter understands a topic
+	MatchTopic(topic string) bool
+	// ParseState extracts the outlet states carried by a message
+	ParseState(topic, payload string) ([]OutletState, error)
+	// BuildCommand returns the topic and payload that switch an outlet
+	BuildCommand(device, outlet, state string) (topic string, payload string, err error)
+}
+
+// AdapterOptions carries the settings an adapter may be built with
+type AdapterOptions struct {
+	Schema        *TopicSchema                       // topic layout for template-driven adapters
+	PayloadParser func(topic, payload string) string // extracts the status value; the payload itself if nil
+	Payloads      func(device string) PayloadMapping // ON/OFF payloads; DefaultPayloadMapping if nil
+	Bank          func(device, outlet string) string // bank an outlet reported from, for templates naming one
+}
+
+// AdapterFactory builds an adapter from options
+type AdapterFactory func(opts AdapterOptions) ProtocolAdapter
+
+// DefaultProtocol is the adapter used when none is configured
+const DefaultProtocol = "power"
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = make(map[string]AdapterFactory)
+)
+
+func init() {
+	RegisterAdapter(DefaultProtocol, NewPowerAdapter)
+	RegisterAdapter("tasmota", func(AdapterOptions) ProtocolAdapter { return TasmotaAdapter{} })
+	RegisterAdapter("shelly", func(AdapterOptions) ProtocolAdapter { return ShellyAdapter{} })
+}
+
+// RegisterAdapter makes an adapter available under a protocol name
+func RegisterAdapter(name string, factory AdapterFactory) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	adapters[strings.ToLower(name)] = factory
+	config.RegisterProtocol(name)
+}
+
+// NewAdapter builds the adapter registered under a protocol name
+func NewAdapter(name string, opts AdapterOptions) (ProtocolAdapter, error) {
+	if name == "" {
+		name = DefaultProtocol
+	}
+
+	adaptersMu.RLock()
+	factory, ok := adapters[strings.ToLower(name)]
+	adaptersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol: %s", name)
+	}
+	return factory(opts), nil
+}
+
+// Protocols returns the registered protocol names
+func Protocols() []string {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+
+	names := make([]string, 0, len(adapters))
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PowerAdapter handles the stock power/<device>/outlets/<n> layout, or any
+// layout described by topic templates
+type PowerAdapter struct {
+	schema        *TopicSchema
+	payloadParser func(topic, payload string) string
+	payloads      func(device string) PayloadMapping
+	bank          func(device, outlet string) string
+}
+
+// NewPowerAdapter creates the template-driven adapter
+func NewPowerAdapter(opts AdapterOptions) ProtocolAdapter {
+	schema := opts.Schema
+	if schema == nil {
+		schema = DefaultSchema
+	}
+	parser := opts.PayloadParser
+	if parser == nil {
+		parser = func(_, payload string) string { return payload }
+	}
+	payloads := opts.Payloads
+	if payloads == nil {
+		payloads = func(string) PayloadMapping { return DefaultPayloadMapping }
+	}
+	bank := opts.Bank
+	if bank == nil {
+		bank = func(string, string) string { return "" }
+	}
+	return &PowerAdapter{schema: schema, payloadParser: parser, payloads: payloads, bank: bank}
+}
+
+// MatchTopic reports whether the topic fits the state template or is the
+// telemetry topic below it
+func (p *PowerAdapter) MatchTopic(topic string) bool {
+	_, _, _, err := p.parseTopic(topic)
+	return err == nil
+}
+
+// ParseState extracts the device, outlet and status from a state message,
+// the readings from a telemetry message, the level of a dimmable outlet or
+// the name from a label message
+func (p *PowerAdapter) ParseState(topic, payload string) ([]OutletState, error) {
+	device, outlet, bank, err := p.parseTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case IsTelemetryTopic(topic):
+		state, err := ParseTelemetry(device, outlet, payload)
+		if err != nil {
+			return nil, err
+		}
+		state.Bank = bank
+		return []OutletState{state}, nil
+	case IsLevelTopic(topic):
+		level, err := ParseLevel(payload)
+		if err != nil {
+			return nil, err
+		}
+		return []OutletState{{Device: device, Outlet: outlet, Level: &level, Bank: bank}}, nil
+	case IsLabelTopic(topic):
+		label := strings.TrimSpace(payload)
+		if label == "" {
+			return nil, fmt.Errorf("empty outlet name on %s", topic)
+		}
+		return []OutletState{{Device: device, Outlet: outlet, Label: label, Bank: bank}}, nil
+	}
+	status := p.payloads(device).Parse(p.payloadParser(topic, payload))
+	return []OutletState{{Device: device, Outlet: outlet, Status: status, Bank: bank}}, nil
+}
+
+// parseTopic extracts the device, outlet and bank from a state topic or one
+// of the telemetry, level and label topics below it
+func (p *PowerAdapter) parseTopic(topic string) (string, string, string, error) {
+	for _, level := range []string{TelemetryLevel, LevelLevel, LevelLevel + "/set", LabelLevel} {
+		if !strings.HasSuffix(topic, "/"+level) {
+			continue
+		}
+		// Templates ending in "/#" already cover the extra level
+		if device, outlet, bank, err := p.schema.ParseBank(strings.TrimSuffix(topic, "/"+level)); err == nil {
+			return device, outlet, bank, nil
+		}
+	}
+	return p.schema.ParseBank(topic)
+}
+
+// BuildCommand fills in the command template with the device's ON/OFF payload
+func (p *PowerAdapter) BuildCommand(device, outlet, state string) (string, string, error) {
+	return p.commandTopic(device, outlet), p.payloads(device).Format(state), nil
+}
+
+// commandTopic fills in the command template, with the outlet's bank if known
+func (p *PowerAdapter) commandTopic(device, outlet string) string {
+	return p.schema.BankCommandTopic(device, outlet, p.bank(device, outlet))
+}
+
+// TasmotaAdapter handles Tasmota firmware
+type TasmotaAdapter struct{}
+
+// MatchTopic reports whether the topic is a Tasmota stat or tele topic
+func (TasmotaAdapter) MatchTopic(topic string) bool {
+	parts := strings.Split(topic, "/")
+	return len(parts) == 3 && (parts[0] == TasmotaStatPrefix || parts[0] == TasmotaTelePrefix)
+}
+
+// ParseState extracts relay states and energy readings
+func (TasmotaAdapter) ParseState(topic, payload string) ([]OutletState, error) {
+	return ParseTasmota(topic, payload)
+}
+
+// BuildCommand returns a cmnd/<device>/POWER<n> command
+func (TasmotaAdapter) BuildCommand(device, outlet, state string) (string, string, error) {
+	topic, payload := TasmotaCommand(device, outlet, state)
+	return topic, payload, nil
+}
+
+// ShellyAdapter handles Shelly Gen2 devices
+type ShellyAdapter struct{}
+
+// MatchTopic reports whether the topic is a Shelly switch status or RPC event
+func (ShellyAdapter) MatchTopic(topic string) bool {
+	return strings.Contains(topic, "/status/switch:") || strings.HasSuffix(topic, "/events/rpc")
+}
+
+// ParseState extracts switch states and power readings
+func (ShellyAdapter) ParseState(topic, payload string) ([]OutletState, error) {
+	return ParseShelly(topic, payload)
+}
+
+// BuildCommand returns a Switch.Set RPC request
+func (ShellyAdapter) BuildCommand(device, outlet, state string) (string, string, error) {
+	return ShellyCommand(device, outlet, state)
+}
+
+// StatusQuerier is implemented by adapters that can ask a device to report
+// its current state
+type StatusQuerier interface {
+	BuildStatusQuery(device, outlet string) (topic string, payload string)
+}
+
+// BuildStatusQuery asks for a relay's state; an empty POWER<n> command
+// makes Tasmota report it on stat/<device>/POWER<n>
+func (TasmotaAdapter) BuildStatusQuery(device, outlet string) (string, string) {
+	return fmt.Sprintf("%s/%s/POWER%s", TasmotaCmndPrefix, device, outlet), ""
+}
+
+// BuildStatusQuery asks the device to publish all component statuses
+func (ShellyAdapter) BuildStatusQuery(device, outlet string) (string, string) {
+	return device + "/command", "status_update"
+}
+
+// Toggler is implemented by adapters whose devices flip a relay themselves,
+// so a toggle does not depend on the last known state being current
+type Toggler interface {
+	BuildToggle(device, outlet string) (topic string, payload string, err error)
+}
+
+// BuildToggle returns a POWER<n> TOGGLE command
+func (TasmotaAdapter) BuildToggle(device, outlet string) (string, string, error) {
+	topic, payload := TasmotaCommand(device, outlet, "TOGGLE")
+	return topic, payload, nil
+}
+
+// BuildToggle returns a Switch.Toggle RPC request
+func (ShellyAdapter) BuildToggle(device, outlet string) (string, string, error) {
+	return ShellyToggle(device, outlet)
+}
+
+// FirmwareUpdater is implemented by adapters whose devices can be told to
+// download and install firmware from a URL
+type FirmwareUpdater interface {
+	BuildFirmwareUpdate(device, url string) (topic string, payload string, err error)
+}
+
+// BuildFirmwareUpdate sets the device's OtaUrl and starts the upgrade in
+// one Backlog command
+func (TasmotaAdapter) BuildFirmwareUpdate(device, url string) (string, string, error) {
+	return TasmotaUpgrade(device, url)
+}
+
+// BuildFirmwareUpdate returns a Shelly.Update RPC request
+func (ShellyAdapter) BuildFirmwareUpdate(device, url string) (string, string, error) {
+	return ShellyUpdate(device, url)
+}
@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxBitmaskChannels is the largest relay board a bitmask payload can describe
+const MaxBitmaskChannels = 64
+
+// BitmaskSplitter fans out the single-topic payload of a multi-channel relay
+// board, e.g. "10110010" for eight relays, into one state per channel
+type BitmaskSplitter struct {
+	Topic    string // topic filter, e.g. "relays/+/state"
+	Device   string // device name; empty uses the level matched by the first '+'
+	Channels int    // number of relays on the board
+	LSBFirst bool   // in digit strings, the last digit is channel 1
+}
+
+// Match reports whether the splitter handles a topic
+func (s BitmaskSplitter) Match(topic string) bool {
+	return TopicMatches(s.Topic, topic)
+}
+
+// Split returns the states of all channels, numbered from 1. The payload is
+// either a string of Channels '0'/'1' digits (first digit is channel 1
+// unless LSBFirst is set) or an integer, decimal or 0x-prefixed hex, whose
+// lowest bit is channel 1.
+func (s BitmaskSplitter) Split(topic, payload string) ([]OutletState, error) {
+	device := s.deviceName(topic)
+	if device == "" {
+		return nil, fmt.Errorf("no device name for %s", topic)
+	}
+
+	bits, err := s.parseBits(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]OutletState, s.Channels)
+	for i := range states {
+		status := "OFF"
+		if bits&(1<<uint(i)) != 0 {
+			status = "ON"
+		}
+		states[i] = OutletState{Device: device, Outlet: strconv.Itoa(i + 1), Status: status}
+	}
+	return states, nil
+}
+
+// parseBits returns the payload as a mask whose bit 0 is channel 1
+func (s BitmaskSplitter) parseBits(payload string) (uint64, error) {
+	if s.Channels < 1 || s.Channels > MaxBitmaskChannels {
+		return 0, fmt.Errorf("invalid channel count: %d", s.Channels)
+	}
+
+	if len(payload) == s.Channels && strings.Trim(payload, "01") == "" {
+		var bits uint64
+		for i := 0; i < s.Channels; i++ {
+			digit := payload[i]
+			if s.LSBFirst {
+				digit = payload[s.Channels-1-i]
+			}
+			if digit == '1' {
+				bits |= 1 << uint(i)
+			}
+		}
+		return bits, nil
+	}
+
+	bits, err := strconv.ParseUint(payload, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bitmask payload: %q", payload)
+	}
+	if s.Channels < 64 && bits>>uint(s.Channels) != 0 {
+		return 0, fmt.Errorf("bitmask %q has more than %d channels", payload, s.Channels)
+	}
+	return bits, nil
+}
+
+// deviceName returns the configured device or the first wildcard level
+func (s BitmaskSplitter) deviceName(topic string) string {
+	if s.Device != "" {
+		return s.Device
+	}
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range strings.Split(s.Topic, "/") {
+		if level == "+" && i < len(topicLevels) {
+			return topicLevels[i]
+		}
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package mqtt
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,29 +13,55 @@ import (
 	"github.com/google/uuid"
 )
 
-// MessageCallback is called when a message is received
-type MessageCallback func(topic string, payload string)
+// MessageCallback is called when a message is received; the payload is
+// passed as received, which may be binary
+type MessageCallback func(topic string, payload []byte, flags MessageFlags)
+
+// MessageFlags are the delivery flags of a received message. The broker
+// connection speaks MQTT 3.1.1, so there are no MQTT 5 properties.
+type MessageFlags struct {
+	QoS       byte
+	Retained  bool
+	Duplicate bool
+	PacketID  uint16 // 0 for QoS 0 deliveries
+}
+
+// flagsOf returns the delivery flags of a paho message
+func flagsOf(msg mqtt.Message) MessageFlags {
+	return MessageFlags{QoS: msg.Qos(), Retained: msg.Retained(), Duplicate: msg.Duplicate(), PacketID: msg.MessageID()}
+}
 
 // ConnectionCallback is called when connection status changes
-type ConnectionCallback func(connected bool)
+type ConnectionCallback func(status ConnectionStatus)
 
 // Client wraps the MQTT client with auto-reconnect functionality
 type Client struct {
 	client             mqtt.Client
-	connected          bool
+	state              ConnectionState
 	mu                 sync.RWMutex
+	statusMu           sync.Mutex // orders state changes and their callbacks
 	messageCallback    MessageCallback
 	connectionCallback ConnectionCallback
-	ctx                context.Context
-	cancel             context.CancelFunc
+	subscriptions      map[string]bool // topics to restore on reconnect
+	clientID           string
+	stats              Stats
+	everConnected      bool // distinguishes reconnects from the first connect
+	backoff            Backoff
+	connectTimeout     time.Duration
+	reconnectCancel    context.CancelFunc
+	rateLimit          RateLimit
+	limiter            *tokenBucket
+	publishQueue       chan queuedPublish
+	queueCancel        context.CancelFunc
+	requests           requestRouter // replies awaited by Request
+	priority           mqtt.Client   // emergency publishes only; see PublishPriority
 }
 
 // NewClient creates a new MQTT client
 func NewClient() *Client {
-	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		ctx:    ctx,
-		cancel: cancel,
+		state:         StateDisconnected,
+		subscriptions: make(map[string]bool),
 	}
 }
 
@@ -52,6 +79,41 @@ func (c *Client) SetConnectionCallback(callback ConnectionCallback) {
 	c.connectionCallback = callback
 }
 
+// backoffOf returns the reconnect backoff configured in cfg
+func backoffOf(cfg *config.Config) Backoff {
+	return Backoff{
+		Initial:     time.Duration(cfg.ReconnectInitialDelay) * time.Second,
+		Max:         time.Duration(cfg.MaxReconnectInterval) * time.Second,
+		MaxAttempts: cfg.ReconnectMaxAttempts,
+	}
+}
+
+// rateLimitOf returns the publish rate limit configured in cfg
+func rateLimitOf(cfg *config.Config) RateLimit {
+	return RateLimit{
+		Rate:     cfg.PublishRate,
+		Burst:    cfg.PublishBurst,
+		MaxWait:  time.Duration(cfg.PublishMaxWait) * time.Millisecond,
+		Overflow: OverflowPolicy(cfg.PublishOverflow),
+	}
+}
+
+// UpdateSettings applies the reconnect backoff and publish rate limit of
+// cfg without reconnecting. A reconnect cycle already running keeps its
+// backoff; the next one uses the new one. The rate limiter, and with it
+// any queued publishes, is only replaced if the limit changed.
+func (c *Client) UpdateSettings(cfg *config.Config) {
+	limit := rateLimitOf(cfg)
+	c.mu.Lock()
+	c.backoff = backoffOf(cfg)
+	changed := c.rateLimit != limit
+	c.mu.Unlock()
+
+	if changed {
+		c.configureRateLimit(limit)
+	}
+}
+
 // Connect establishes connection to the MQTT broker
 func (c *Client) Connect(cfg *config.Config) error {
 	// Validate config
@@ -68,6 +130,33 @@ func (c *Client) Connect(cfg *config.Config) error {
 	// Generate client ID
 	clientID := "go-powercontrol-" + uuid.New().String()
 
+	// Each call makes a new paho client; the previous one, e.g. from an
+	// attempt that failed or timed out, is closed so it cannot linger or
+	// reconnect behind the new one
+	c.mu.Lock()
+	previous := c.client
+	cancelReconnect := c.reconnectCancel
+	c.reconnectCancel = nil
+	c.mu.Unlock()
+	if cancelReconnect != nil {
+		cancelReconnect()
+	}
+	if previous != nil {
+		previous.Disconnect(250)
+	}
+
+	c.mu.Lock()
+	c.clientID = clientID
+	c.stats = Stats{}
+	c.everConnected = false
+	c.connectTimeout = time.Duration(cfg.ConnectTimeout) * time.Second
+	c.backoff = backoffOf(cfg)
+	c.mu.Unlock()
+
+	c.setStatus(ConnectionStatus{State: StateConnecting})
+
+	c.configureRateLimit(rateLimitOf(cfg))
+
 	// Build broker URL
 	brokerURL := fmt.Sprintf("tcp://%s:%d", cfg.MQTTServer, cfg.ServerPort)
 
@@ -77,38 +166,49 @@ func (c *Client) Connect(cfg *config.Config) error {
 	opts.SetClientID(clientID)
 	opts.SetUsername(cfg.Username)
 	opts.SetPassword(password)
-	opts.SetKeepAlive(5 * time.Second)
-	opts.SetPingTimeout(20 * time.Second)
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(10 * time.Second)
+	opts.SetKeepAlive(time.Duration(cfg.KeepAlive) * time.Second)
+	opts.SetPingTimeout(time.Duration(cfg.PingTimeout) * time.Second)
+	opts.SetConnectTimeout(time.Duration(cfg.ConnectTimeout) * time.Second)
+	opts.SetAutoReconnect(false) // Reconnects are driven by reconnectLoop
 	opts.SetCleanSession(true)
 
+	// Let consumers of the normalized feed know when this instance goes away
+	if cfg.RepublishState {
+		opts.SetWill(cfg.AvailabilityTopic(), "offline", 0, true)
+	}
+
 	// Set connection callbacks
 	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		// paho runs this handler in its own goroutine, so the connection
+		// may already have been lost or closed again
+		connected := c.setStatusIf(client.IsConnectionOpen, ConnectionStatus{State: StateConnected})
+		if !connected {
+			return
+		}
+
 		c.mu.Lock()
-		c.connected = true
-		callback := c.connectionCallback
+		if c.everConnected {
+			c.stats.ReconnectCount++
+		}
+		c.everConnected = true
+		c.stats.ConnectedSince = time.Now()
+		cancel := c.reconnectCancel
+		c.reconnectCancel = nil
 		c.mu.Unlock()
 
-		if callback != nil {
-			callback(true)
+		if cancel != nil {
+			cancel()
 		}
 
 		// Resubscribe on reconnect
-		if cfg.SubscribeString != "" {
-			c.Subscribe(cfg.SubscribeString)
+		for _, topic := range c.Subscriptions() {
+			c.Subscribe(topic)
 		}
 	})
 
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
-		c.mu.Lock()
-		c.connected = false
-		callback := c.connectionCallback
-		c.mu.Unlock()
-
-		if callback != nil {
-			callback(false)
-		}
+		c.recordError(err)
+		c.startReconnect(false)
 	})
 
 	// Create and connect client
@@ -116,18 +216,21 @@ func (c *Client) Connect(cfg *config.Config) error {
 	token := c.client.Connect()
 
 	// Wait for connection with timeout
-	if !token.WaitTimeout(20 * time.Second) {
+	if !token.WaitTimeout(time.Duration(cfg.ConnectTimeout) * time.Second) {
+		// Abort the attempt so it cannot connect behind the caller's back
+		c.client.Disconnect(0)
+		c.recordError(fmt.Errorf("connection timeout"))
+		c.setStatus(ConnectionStatus{State: StateDisconnected, LastError: "connection timeout"})
 		return fmt.Errorf("connection timeout")
 	}
 
 	if err := token.Error(); err != nil {
+		c.recordError(err)
+		c.setStatus(ConnectionStatus{State: StateDisconnected, LastError: err.Error()})
 		return fmt.Errorf("connection failed: %w", err)
 	}
 
-	c.mu.Lock()
-	c.connected = true
-	c.mu.Unlock()
-
+	c.connectPriority(opts)
 	return nil
 }
 
@@ -139,12 +242,14 @@ func (c *Client) Subscribe(topic string) error {
 
 	// Set message handler
 	token := c.client.Subscribe(topic, 0, func(client mqtt.Client, msg mqtt.Message) {
-		c.mu.RLock()
+		c.mu.Lock()
 		callback := c.messageCallback
-		c.mu.RUnlock()
+		c.stats.MessagesReceived++
+		c.stats.BytesReceived += uint64(len(msg.Payload()))
+		c.mu.Unlock()
 
 		if callback != nil {
-			callback(msg.Topic(), string(msg.Payload()))
+			callback(msg.Topic(), msg.Payload(), flagsOf(msg))
 		}
 	})
 
@@ -153,36 +258,133 @@ func (c *Client) Subscribe(topic string) error {
 	}
 
 	if err := token.Error(); err != nil {
+		c.recordError(err)
 		return fmt.Errorf("subscribe failed: %w", err)
 	}
 
+	c.mu.Lock()
+	c.subscriptions[topic] = true
+	c.mu.Unlock()
+
 	return nil
 }
 
-// Publish publishes a message to a topic
-func (c *Client) Publish(topic string, payload string) error {
+// Unsubscribe removes a subscription
+func (c *Client) Unsubscribe(topic string) error {
 	if c.client == nil {
 		return fmt.Errorf("client not initialized")
 	}
 
+	// Forget the topic first so it is not restored by a reconnect in between
+	c.mu.Lock()
+	delete(c.subscriptions, topic)
+	c.mu.Unlock()
+
+	token := c.client.Unsubscribe(topic)
+
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("unsubscribe timeout")
+	}
+
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("unsubscribe failed: %w", err)
+	}
+
+	return nil
+}
+
+// Subscriptions returns the topics currently subscribed to
+func (c *Client) Subscriptions() []string {
 	c.mu.RLock()
-	connected := c.connected
-	c.mu.RUnlock()
+	defer c.mu.RUnlock()
+
+	topics := make([]string, 0, len(c.subscriptions))
+	for topic := range c.subscriptions {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Publish publishes a message to a topic, subject to the publish rate limit
+func (c *Client) Publish(topic string, payload string) error {
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to broker")
+	}
 
-	if !connected {
+	publishNow, err := c.throttle(topic, []byte(payload), false)
+	if !publishNow {
+		return err
+	}
+
+	return c.publish(topic, []byte(payload), false)
+}
+
+// PublishBytes publishes a raw, possibly binary payload, subject to the
+// publish rate limit
+func (c *Client) PublishBytes(topic string, payload []byte) error {
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+
+	if !c.IsConnected() {
 		return fmt.Errorf("not connected to broker")
 	}
 
-	token := c.client.Publish(topic, 0, false, payload)
+	publishNow, err := c.throttle(topic, payload, false)
+	if !publishNow {
+		return err
+	}
+
+	return c.publish(topic, payload, false)
+}
+
+// PublishRetained publishes a message the broker keeps for new subscribers,
+// subject to the publish rate limit
+func (c *Client) PublishRetained(topic string, payload string) error {
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to broker")
+	}
+
+	publishNow, err := c.throttle(topic, []byte(payload), true)
+	if !publishNow {
+		return err
+	}
+
+	return c.publish(topic, []byte(payload), true)
+}
+
+// publish sends a message without rate limiting
+func (c *Client) publish(topic string, payload []byte, retained bool) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("not connected to broker")
+	}
+
+	token := c.client.Publish(topic, 0, retained, payload)
 
 	if !token.WaitTimeout(10 * time.Second) {
+		c.recordError(fmt.Errorf("publish timeout"))
 		return fmt.Errorf("publish timeout")
 	}
 
 	if err := token.Error(); err != nil {
+		c.recordError(err)
 		return fmt.Errorf("publish failed: %w", err)
 	}
 
+	c.mu.Lock()
+	c.stats.MessagesSent++
+	c.stats.BytesSent += uint64(len(payload))
+	c.mu.Unlock()
+
 	return nil
 }
 
@@ -190,18 +392,35 @@ func (c *Client) Publish(topic string, payload string) error {
 func (c *Client) IsConnected() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.connected
+	return c.state == StateConnected
+}
+
+// State returns the current connection state
+func (c *Client) State() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
 }
 
 // Disconnect disconnects from the MQTT broker
 func (c *Client) Disconnect() {
-	if c.client != nil && c.client.IsConnected() {
-		c.client.Disconnect(250)
-	}
-
 	c.mu.Lock()
-	c.connected = false
+	if c.reconnectCancel != nil {
+		c.reconnectCancel()
+		c.reconnectCancel = nil
+	}
+	if c.queueCancel != nil {
+		c.queueCancel()
+		c.queueCancel = nil
+	}
+	c.subscriptions = make(map[string]bool)
 	c.mu.Unlock()
 
-	c.cancel()
+	// Also aborts a connection attempt in flight
+	if c.client != nil {
+		c.client.Disconnect(250)
+	}
+	c.disconnectPriority()
+
+	c.setStatus(ConnectionStatus{State: StateDisconnected})
 }
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// Collect opens a short-lived, read-only connection, subscribes to filter and
+// passes every message received within duration to callback. Retained
+// messages make this a quick way to snapshot another broker's state.
+func Collect(ctx context.Context, opts ProbeOptions, filter string, duration time.Duration, callback MessageCallback) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if err := ValidateTopicFilter(filter); err != nil {
+		return err
+	}
+
+	clientOpts := mqtt.NewClientOptions()
+	clientOpts.AddBroker(fmt.Sprintf("tcp://%s", net.JoinHostPort(opts.Server, strconv.Itoa(opts.Port))))
+	clientOpts.SetClientID("go-powercontrol-peek-" + uuid.New().String())
+	clientOpts.SetUsername(opts.Username)
+	clientOpts.SetPassword(opts.Password)
+	clientOpts.SetConnectTimeout(opts.Timeout)
+	clientOpts.SetAutoReconnect(false)
+	clientOpts.SetCleanSession(true)
+
+	client := mqtt.NewClient(clientOpts)
+	token := client.Connect()
+	if !token.WaitTimeout(opts.Timeout) {
+		return fmt.Errorf("connection timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer client.Disconnect(250)
+
+	token = client.Subscribe(filter, 0, func(client mqtt.Client, msg mqtt.Message) {
+		callback(msg.Topic(), msg.Payload(), flagsOf(msg))
+	})
+	if !token.WaitTimeout(opts.Timeout) {
+		return fmt.Errorf("subscribe timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("subscribe failed: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+	}
+
+	return nil
+}
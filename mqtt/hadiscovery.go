@@ -0,0 +1,229 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultHADiscoveryPrefix is Home Assistant's default discovery prefix
+const DefaultHADiscoveryPrefix = "homeassistant"
+
+// HASwitch is a switch learned from a Home Assistant discovery config
+type HASwitch struct {
+	ConfigTopic   string `json:"configTopic"`
+	UniqueID      string `json:"uniqueId,omitempty"`
+	Device        string `json:"device"`
+	Outlet        string `json:"outlet"`
+	StateTopic    string `json:"stateTopic"`
+	CommandTopic  string `json:"commandTopic"`
+	PayloadOn     string `json:"payloadOn"`
+	PayloadOff    string `json:"payloadOff"`
+	StateOn       string `json:"stateOn"`
+	StateOff      string `json:"stateOff"`
+	ValueTemplate string `json:"valueTemplate,omitempty"`
+}
+
+// haConfig is the subset of a switch discovery payload we use. Discovery
+// payloads may use abbreviated keys, which are expanded before decoding.
+type haConfig struct {
+	Name          string `json:"name"`
+	UniqueID      string `json:"unique_id"`
+	ObjectID      string `json:"object_id"`
+	StateTopic    string `json:"state_topic"`
+	CommandTopic  string `json:"command_topic"`
+	PayloadOn     string `json:"payload_on"`
+	PayloadOff    string `json:"payload_off"`
+	StateOn       string `json:"state_on"`
+	StateOff      string `json:"state_off"`
+	ValueTemplate string `json:"value_template"`
+	Device        struct {
+		Name string `json:"name"`
+	} `json:"device"`
+}
+
+// haAbbreviations maps the abbreviated discovery keys we use to full keys
+var haAbbreviations = map[string]string{
+	"name":     "name",
+	"uniq_id":  "unique_id",
+	"obj_id":   "object_id",
+	"stat_t":   "state_topic",
+	"cmd_t":    "command_topic",
+	"pl_on":    "payload_on",
+	"pl_off":   "payload_off",
+	"stat_on":  "state_on",
+	"stat_off": "state_off",
+	"val_tpl":  "value_template",
+	"dev":      "device",
+}
+
+// IsHADiscoveryTopic reports whether a topic is a switch discovery config
+// (<prefix>/switch/[<node_id>/]<object_id>/config)
+func IsHADiscoveryTopic(prefix, topic string) bool {
+	parts := strings.Split(topic, "/")
+	return (len(parts) == 4 || len(parts) == 5) &&
+		parts[0] == prefix && parts[1] == "switch" && parts[len(parts)-1] == "config"
+}
+
+// ParseHADiscovery parses a switch discovery config. It returns nil and no
+// error for an empty payload, which removes a previously discovered switch.
+func ParseHADiscovery(topic, payload string) (*HASwitch, error) {
+	if strings.TrimSpace(payload) == "" {
+		return nil, nil
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &raw); err != nil {
+		return nil, fmt.Errorf("invalid discovery payload: %w", err)
+	}
+	expanded, err := json.Marshal(expandHAConfig(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg haConfig
+	if err := json.Unmarshal(expanded, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid discovery payload: %w", err)
+	}
+	if cfg.StateTopic == "" || cfg.CommandTopic == "" {
+		return nil, fmt.Errorf("discovery config has no state or command topic")
+	}
+
+	// The topic is <prefix>/switch/[<node_id>/]<object_id>/config
+	parts := strings.Split(topic, "/")
+	objectID := parts[len(parts)-2]
+	nodeID := ""
+	if len(parts) == 5 {
+		nodeID = parts[2]
+	}
+
+	sw := &HASwitch{
+		ConfigTopic:   topic,
+		UniqueID:      cfg.UniqueID,
+		Device:        firstNonEmpty(cfg.Device.Name, nodeID, objectID),
+		Outlet:        firstNonEmpty(cfg.Name, cfg.ObjectID, objectID),
+		StateTopic:    cfg.StateTopic,
+		CommandTopic:  cfg.CommandTopic,
+		PayloadOn:     firstNonEmpty(cfg.PayloadOn, "ON"),
+		PayloadOff:    firstNonEmpty(cfg.PayloadOff, "OFF"),
+		ValueTemplate: cfg.ValueTemplate,
+	}
+	sw.StateOn = firstNonEmpty(cfg.StateOn, sw.PayloadOn)
+	sw.StateOff = firstNonEmpty(cfg.StateOff, sw.PayloadOff)
+
+	return sw, nil
+}
+
+// ParseState converts a state topic payload to ON/OFF
+func (s *HASwitch) ParseState(payload string) string {
+	value, err := applyValueTemplate(s.ValueTemplate, payload)
+	if err != nil {
+		return ParsePayload(payload)
+	}
+
+	switch value {
+	case s.StateOn:
+		return "ON"
+	case s.StateOff:
+		return "OFF"
+	default:
+		return ParsePayload(value)
+	}
+}
+
+// CommandPayload returns the payload that switches the device to a state
+func (s *HASwitch) CommandPayload(state string) string {
+	switch strings.ToUpper(strings.TrimSpace(state)) {
+	case "ON", "1":
+		return s.PayloadOn
+	case "OFF", "0":
+		return s.PayloadOff
+	default:
+		return state
+	}
+}
+
+// expandHAConfig expands abbreviated keys and the "~" base topic
+func expandHAConfig(raw map[string]interface{}) map[string]interface{} {
+	base, _ := raw["~"].(string)
+
+	expanded := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		if full, ok := haAbbreviations[key]; ok {
+			key = full
+		}
+		if s, ok := value.(string); ok && base != "" && strings.HasSuffix(key, "_topic") {
+			if strings.HasPrefix(s, "~") {
+				s = base + s[1:]
+			} else if strings.HasSuffix(s, "~") {
+				s = s[:len(s)-1] + base
+			}
+			value = s
+		}
+		if obj, ok := value.(map[string]interface{}); ok && key == "device" {
+			value = expandHAConfig(obj)
+		}
+		expanded[key] = value
+	}
+	return expanded
+}
+
+// valueTemplatePattern matches the common "{{ value_json.a.b }}" and
+// "{{ value }}" templates; anything more elaborate is not evaluated
+var valueTemplatePattern = regexp.MustCompile(`^\{\{\s*value(?:_json((?:\.[A-Za-z0-9_]+|\['[^']+'\])+))?\s*\}\}$`)
+
+// applyValueTemplate evaluates a simple value template against a payload
+func applyValueTemplate(template, payload string) (string, error) {
+	template = strings.TrimSpace(template)
+	if template == "" {
+		return payload, nil
+	}
+
+	match := valueTemplatePattern.FindStringSubmatch(template)
+	if match == nil {
+		return "", fmt.Errorf("unsupported value template: %s", template)
+	}
+	if match[1] == "" {
+		return payload, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return "", fmt.Errorf("payload is not JSON: %w", err)
+	}
+
+	path := strings.NewReplacer("['", ".", "']", "").Replace(match[1])
+	for _, key := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("no %s in payload", key)
+		}
+		value, ok = obj[key]
+		if !ok {
+			return "", fmt.Errorf("no %s in payload", key)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return "ON", nil
+		}
+		return "OFF", nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// firstNonEmpty returns the first non-empty value
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -5,66 +5,104 @@ import (
 	"strings"
 )
 
-// ParseTopic extracts device name and outlet number from MQTT topic
-// Expected format: power/<device-name>/outlets/<outlet-number>
-// Returns device name, outlet number, and error if parsing fails
-func ParseTopic(topic string) (device string, outlet string, err error) {
-	parts := strings.Split(topic, "/")
-
-	// Expected: ["power", "<device>", "outlets", "<number>"] or
-	//           ["power", "<device>", "outlets", "<number>", "set"]
-	if len(parts) < 4 {
-		return "", "", fmt.Errorf("invalid topic format: %s", topic)
-	}
-
-	if parts[0] != "power" {
-		return "", "", fmt.Errorf("topic does not start with 'power': %s", topic)
-	}
+// OutletState is an outlet status extracted from a message
+type OutletState struct {
+	Device string
+	Outlet string
+	Status string   // empty if the message only carried telemetry
+	Watts  *float64 // active power, if reported
+	Volts  *float64 // supply voltage, if reported
+	Amps   *float64 // load current, if reported
+	KWh    *float64 // energy meter reading, if reported
+	Label  string   // friendly outlet name, if the message carried one
+	Level  *int     // 0-100 level of a dimmable outlet, if reported
+	Bank   string   // bank or section of the PDU, if the topic names one
+}
 
-	if parts[2] != "outlets" {
-		return "", "", fmt.Errorf("invalid topic structure: %s", topic)
-	}
+// HasTelemetry reports whether any electrical reading was extracted
+func (s OutletState) HasTelemetry() bool {
+	return s.Watts != nil || s.Volts != nil || s.Amps != nil || s.KWh != nil
+}
 
-	device = parts[1]
-	outlet = parts[3]
+// LabelLevel is the topic level below an outlet's state topic on which PDUs
+// publish the outlet's friendly name, e.g. power/<device>/outlets/<n>/name
+const LabelLevel = "name"
 
-	if device == "" || outlet == "" {
-		return "", "", fmt.Errorf("empty device or outlet in topic: %s", topic)
-	}
+// ParseTopic extracts device name and outlet number from MQTT topic
+// Expected format: power/<device-name>/outlets/<outlet-number>, optionally
+// followed by a level such as /name or /energy
+// Returns device name, outlet number, and error if parsing fails
+func ParseTopic(topic string) (device string, outlet string, err error) {
+	return DefaultSchema.Parse(topic)
+}
 
-	return device, outlet, nil
+// IsLabelTopic reports whether a topic carries an outlet's friendly name
+func IsLabelTopic(topic string) bool {
+	return strings.HasSuffix(topic, "/"+LabelLevel)
 }
 
 // ParsePayload converts payload string to human-readable status
 // "0" -> "OFF", "1" -> "ON"
 func ParsePayload(payload string) string {
-	payload = strings.TrimSpace(payload)
-	switch payload {
-	case "0":
-		return "OFF"
-	case "1":
-		return "ON"
-	default:
-		return payload // Return as-is if not 0 or 1
-	}
+	return DefaultPayloadMapping.Parse(payload)
 }
 
 // MakeCommandTopic creates the command topic for a device/outlet
 // Format: power/<device>/outlets/<outlet>/set
 func MakeCommandTopic(device, outlet string) string {
-	return fmt.Sprintf("power/%s/outlets/%s/set", device, outlet)
+	return DefaultSchema.CommandTopic(device, outlet)
 }
 
 // StatusToPayload converts status string to MQTT payload
 // "OFF" -> "0", "ON" -> "1"
 func StatusToPayload(status string) string {
-	status = strings.ToUpper(strings.TrimSpace(status))
-	switch status {
-	case "OFF":
-		return "0"
-	case "ON":
-		return "1"
+	return DefaultPayloadMapping.Format(status)
+}
+
+// ValidateTopicFilter checks that a subscription filter is well formed
+// Wildcards must occupy a whole level and '#' may only appear last
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter is empty")
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("'#' must be the last level of the filter: %s", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("'+' must occupy an entire level: %s", filter)
+		}
+	}
+
+	return nil
+}
+
+// AvailabilityLevel is the last topic level of a device's LWT topic,
+// e.g. power/<device>/availability
+const AvailabilityLevel = "availability"
+
+// ParseAvailability extracts the device and its availability ("online" or
+// "offline") from a power/<device>/availability message
+func ParseAvailability(topic, payload string) (device string, availability string, err error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 || parts[0] != "power" || parts[2] != AvailabilityLevel || parts[1] == "" {
+		return "", "", fmt.Errorf("not an availability topic: %s", topic)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(payload)) {
+	case "online", "1", "true":
+		return parts[1], "online", nil
+	case "offline", "0", "false":
+		return parts[1], "offline", nil
 	default:
-		return status
+		return "", "", fmt.Errorf("invalid availability payload: %q", payload)
 	}
 }
+
+// IsAvailabilityTopic reports whether a topic is a device's LWT topic
+func IsAvailabilityTopic(topic string) bool {
+	_, _, err := ParseAvailability(topic, "online")
+	return err == nil
+}
@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a compiled extraction expression such as "$.POWER",
+// "$.relay.0", "$.relays[0].ison" or "$['switch:0'].output"
+type JSONPath struct {
+	expr  string
+	steps []string
+}
+
+// CompileJSONPath parses an extraction expression
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	rest := strings.TrimSpace(expr)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("expression must start with $: %s", expr)
+	}
+	rest = rest[1:]
+
+	var steps []string
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in %s", expr)
+			}
+			steps = append(steps, rest[2:end])
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in %s", expr)
+			}
+			if _, err := strconv.Atoi(rest[1:end]); err != nil {
+				return nil, fmt.Errorf("invalid index %q in %s", rest[1:end], expr)
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in %s", expr)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		default:
+			return nil, fmt.Errorf("unexpected %q in %s", rest, expr)
+		}
+	}
+
+	return &JSONPath{expr: expr, steps: steps}, nil
+}
+
+// String returns the original expression
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Extract evaluates the expression against a JSON payload and returns the
+// value as a status: booleans become ON/OFF and numbers and strings go
+// through ParsePayload
+func (p *JSONPath) Extract(payload string) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return "", fmt.Errorf("payload is not JSON: %w", err)
+	}
+
+	for _, step := range p.steps {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[step]
+			if !ok {
+				return "", fmt.Errorf("no %q in payload", step)
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(step)
+			if err != nil || index < 0 || index >= len(v) {
+				return "", fmt.Errorf("no index %s in payload", step)
+			}
+			value = v[index]
+		default:
+			return "", fmt.Errorf("cannot descend into %q", step)
+		}
+	}
+
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "ON", nil
+		}
+		return "OFF", nil
+	case string:
+		return ParsePayload(v), nil
+	case float64:
+		return ParsePayload(strconv.FormatFloat(v, 'f', -1, 64)), nil
+	case nil:
+		return "", fmt.Errorf("value is null")
+	default:
+		return "", fmt.Errorf("value is not a scalar")
+	}
+}
+
+// TopicMatches reports whether a topic matches a subscription filter
+func TopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
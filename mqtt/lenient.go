@@ -0,0 +1,69 @@
+package mqtt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Handling of messages whose topic does not fit the expected layout
+const (
+	ValidationStrict  = "strict"  // log the message and drop it
+	ValidationLenient = "lenient" // try ParseLenient, log if that fails too
+	ValidationIgnore  = "ignore"  // drop the message silently
+)
+
+// outletLevel matches a topic level naming an outlet, e.g. "3", "POWER2",
+// "relay_1" or "switch:0"
+var outletLevel = regexp.MustCompile(`(?i)^(?:outlets?|relays?|power|switch|channel|ch|port|socket)?[:_-]?(\d+)$`)
+
+// genericLevels are topic levels that never name a device
+var genericLevels = map[string]bool{
+	"power": true, "outlets": true, "outlet": true, "relay": true, "relays": true,
+	"switch": true, "state": true, "status": true, "stat": true, "tele": true,
+	"cmnd": true, "set": true, "get": true, "channel": true, "channels": true,
+}
+
+// lenientPayloads are the values ParseLenient accepts as ON or OFF
+var lenientPayloads = PayloadMapping{
+	On:  []string{"1", "on", "true"},
+	Off: []string{"0", "off", "false"},
+}
+
+// ParseLenient makes a best-effort guess at the device and outlet of a
+// message on an unexpected topic: the outlet is the last level that looks
+// like an outlet number ("3", "POWER2", "relay_1"), or 1 if the topic ends
+// in a generic level such as "POWER" or "state", and the device is the
+// nearest earlier level that is not a generic word. Only plain ON/OFF
+// payloads are accepted.
+func ParseLenient(topic, payload string) ([]OutletState, error) {
+	status := lenientPayloads.Parse(payload)
+	if status != "ON" && status != "OFF" {
+		return nil, fmt.Errorf("payload is not a recognizable state: %q", payload)
+	}
+
+	levels := strings.Split(topic, "/")
+	outlet, outletIndex := "", -1
+	for i := len(levels) - 1; i > 0; i-- {
+		if match := outletLevel.FindStringSubmatch(levels[i]); match != nil {
+			outlet, outletIndex = match[1], i
+			break
+		}
+	}
+	if outletIndex < 0 {
+		// A single-outlet device, e.g. stat/plug1/POWER
+		last := len(levels) - 1
+		if !genericLevels[strings.ToLower(levels[last])] {
+			return nil, fmt.Errorf("no outlet found in topic %s", topic)
+		}
+		outlet, outletIndex = "1", last
+	}
+
+	for i := outletIndex - 1; i >= 0; i-- {
+		device := levels[i]
+		if device != "" && !genericLevels[strings.ToLower(device)] {
+			return []OutletState{{Device: device, Outlet: outlet, Status: status}}, nil
+		}
+	}
+	return nil, fmt.Errorf("no device found in topic %s", topic)
+}
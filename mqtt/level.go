@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LevelLevel is the topic level below an outlet's state topic on which
+// dimmable outlets publish their 0-100 level, e.g. power/<device>/outlets/<n>/level.
+// Levels are set on the same topic with a trailing /set.
+const LevelLevel = "level"
+
+// LevelSetter is implemented by adapters whose devices accept a 0-100 level
+type LevelSetter interface {
+	BuildLevelCommand(device, outlet string, level int) (topic string, payload string, err error)
+}
+
+// IsLevelTopic reports whether a topic carries an outlet level or a level command
+func IsLevelTopic(topic string) bool {
+	return strings.HasSuffix(topic, "/"+LevelLevel) || strings.HasSuffix(topic, "/"+LevelLevel+"/set")
+}
+
+// ParseLevel reads a 0-100 level; fractional levels are rounded
+func ParseLevel(payload string) (int, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(payload), 64)
+	if err != nil || value < 0 || value > 100 {
+		return 0, fmt.Errorf("invalid level: %q", payload)
+	}
+	return int(math.Round(value)), nil
+}
+
+// BuildLevelCommand returns the level command topic next to the outlet's
+// command topic, e.g. power/<device>/outlets/<n>/level/set
+func (p *PowerAdapter) BuildLevelCommand(device, outlet string, level int) (string, string, error) {
+	if level < 0 || level > 100 {
+		return "", "", fmt.Errorf("level must be between 0 and 100")
+	}
+
+	topic := p.commandTopic(device, outlet)
+	if strings.HasSuffix(topic, "/set") {
+		topic = strings.TrimSuffix(topic, "/set") + "/" + LevelLevel + "/set"
+	} else {
+		topic += "/" + LevelLevel
+	}
+	return topic, strconv.Itoa(level), nil
+}
@@ -0,0 +1,51 @@
+package mqtt
+
+import "strings"
+
+// PayloadMapping translates between ON/OFF and the payloads a device uses,
+// e.g. "on"/"off" or "true"/"false"
+type PayloadMapping struct {
+	On            []string // accepted as ON; the first is sent
+	Off           []string // accepted as OFF; the first is sent
+	CaseSensitive bool
+}
+
+// DefaultPayloadMapping is the 1/0 mapping of the stock PDU firmware
+var DefaultPayloadMapping = PayloadMapping{On: []string{"1"}, Off: []string{"0"}}
+
+// Parse converts a payload to "ON" or "OFF", returning other payloads as-is
+func (m PayloadMapping) Parse(payload string) string {
+	payload = strings.TrimSpace(payload)
+	switch {
+	case m.matches(m.On, payload):
+		return "ON"
+	case m.matches(m.Off, payload):
+		return "OFF"
+	default:
+		return payload
+	}
+}
+
+// Format converts "ON" or "OFF" (in any case) to the payload to send,
+// returning other states upper-cased
+func (m PayloadMapping) Format(status string) string {
+	status = strings.ToUpper(strings.TrimSpace(status))
+	switch {
+	case status == "ON" && len(m.On) > 0:
+		return m.On[0]
+	case status == "OFF" && len(m.Off) > 0:
+		return m.Off[0]
+	default:
+		return status
+	}
+}
+
+// matches reports whether the payload is one of the values
+func (m PayloadMapping) matches(values []string, payload string) bool {
+	for _, value := range values {
+		if value == payload || (!m.CaseSensitive && strings.EqualFold(value, payload)) {
+			return true
+		}
+	}
+	return false
+}
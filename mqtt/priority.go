@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// PriorityTimeout bounds how long a priority publish may take, including
+// the broker's acknowledgement
+const PriorityTimeout = time.Second
+
+// connectPriority opens the priority connection next to the main one. It
+// carries nothing but priority publishes, so they never wait behind the
+// main connection's rate limit, publish queue or in-flight messages. It is
+// opened in the background and keeps retrying the first connect as well as
+// reconnecting by itself; until it is up, priority publishes use the main
+// connection, still skipping the limits.
+func (c *Client) connectPriority(main *mqtt.ClientOptions) {
+	opts := mqtt.NewClientOptions()
+	for _, broker := range main.Servers {
+		opts.AddBroker(broker.String())
+	}
+	opts.SetClientID(main.ClientID + "-priority")
+	opts.SetUsername(main.Username)
+	opts.SetPassword(main.Password)
+	opts.SetKeepAlive(time.Duration(main.KeepAlive) * time.Second)
+	opts.SetPingTimeout(main.PingTimeout)
+	opts.SetConnectTimeout(main.ConnectTimeout)
+	opts.SetWriteTimeout(PriorityTimeout)
+	opts.SetOrderMatters(false)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectRetry(true) // a broker refusing the first attempt must not leave it down for good
+	opts.SetCleanSession(true)
+
+	client := mqtt.NewClient(opts)
+	c.mu.Lock()
+	previous := c.priority
+	c.priority = client
+	c.mu.Unlock()
+	if previous != nil {
+		previous.Disconnect(0)
+	}
+
+	go func() {
+		token := client.Connect()
+		if !token.WaitTimeout(main.ConnectTimeout) {
+			log.Printf("Priority connection not up yet; priority publishes will use the main connection until it is")
+			return
+		}
+		if err := token.Error(); err != nil {
+			log.Printf("Priority connection failed; priority publishes will use the main connection: %v", err)
+		}
+	}()
+}
+
+// disconnectPriority closes the priority connection
+func (c *Client) disconnectPriority() {
+	c.mu.Lock()
+	client := c.priority
+	c.priority = nil
+	c.mu.Unlock()
+
+	if client != nil {
+		client.Disconnect(250)
+	}
+}
+
+// PublishPriority publishes an emergency message with QoS 1 on the priority
+// connection, bypassing the publish rate limit and queue, and returns an
+// error if the broker has not acknowledged it within PriorityTimeout
+func (c *Client) PublishPriority(topic string, payload string) error {
+	c.mu.RLock()
+	client := c.priority
+	c.mu.RUnlock()
+
+	if client == nil || !client.IsConnectionOpen() {
+		client = c.client
+	}
+	if client == nil || !client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to broker")
+	}
+
+	token := client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(PriorityTimeout) {
+		c.recordError(fmt.Errorf("priority publish to %s timed out", topic))
+		return fmt.Errorf("priority publish to %s not acknowledged within %s", topic, PriorityTimeout)
+	}
+	if err := token.Error(); err != nil {
+		c.recordError(err)
+		return fmt.Errorf("priority publish failed: %w", err)
+	}
+
+	c.mu.Lock()
+	c.stats.MessagesSent++
+	c.stats.BytesSent += uint64(len(payload))
+	c.stats.PriorityPublishes++
+	c.mu.Unlock()
+
+	return nil
+}
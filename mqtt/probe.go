@@ -0,0 +1,178 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/google/uuid"
+)
+
+// ProbeFailure classifies why a connection probe failed
+type ProbeFailure string
+
+const (
+	ProbeOK              ProbeFailure = ""
+	ProbeInvalidSettings ProbeFailure = "invalid_settings"
+	ProbeDNS             ProbeFailure = "dns"
+	ProbeTCPRefused      ProbeFailure = "tcp_refused"
+	ProbeTCPUnreachable  ProbeFailure = "tcp_unreachable"
+	ProbeTimeout         ProbeFailure = "timeout"
+	ProbeAuthRejected    ProbeFailure = "auth_rejected"
+	ProbeNotAuthorized   ProbeFailure = "not_authorized"
+	ProbeProtocol        ProbeFailure = "protocol"
+	ProbeTLS             ProbeFailure = "tls"
+)
+
+// tlsCheckTimeout bounds the TLS handshake tried when the MQTT handshake
+// fails, to tell a TLS listener from a broken one
+const tlsCheckTimeout = 3 * time.Second
+
+// ProbeOptions describes the broker settings to test
+type ProbeOptions struct {
+	Server   string
+	Port     int
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// ProbeResult is the outcome of a connection probe
+type ProbeResult struct {
+	Success   bool         `json:"success"`
+	Failure   ProbeFailure `json:"failure,omitempty"`
+	Message   string       `json:"message"`
+	Addresses []string     `json:"addresses,omitempty"` // resolved broker addresses
+	LatencyMs float64      `json:"latencyMs"`           // time to complete the MQTT handshake
+}
+
+// Probe attempts a short-lived connection with the given settings and
+// reports the first stage that failed. It never touches the active client.
+func Probe(ctx context.Context, opts ProbeOptions) ProbeResult {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Server == "" {
+		return ProbeResult{Failure: ProbeInvalidSettings, Message: "server is required"}
+	}
+	if opts.Port < 1 || opts.Port > 65535 {
+		return ProbeResult{Failure: ProbeInvalidSettings, Message: fmt.Sprintf("invalid port: %d", opts.Port)}
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	// Stage 1: name resolution
+	addresses := []string{opts.Server}
+	if net.ParseIP(opts.Server) == nil {
+		resolved, err := net.DefaultResolver.LookupHost(ctx, opts.Server)
+		if err != nil {
+			return ProbeResult{Failure: ProbeDNS, Message: fmt.Sprintf("could not resolve %s: %v", opts.Server, err)}
+		}
+		addresses = resolved
+	}
+
+	// Stage 2: TCP reachability
+	address := net.JoinHostPort(opts.Server, strconv.Itoa(opts.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		result := ProbeResult{Addresses: addresses, Message: err.Error()}
+		var netErr net.Error
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			result.Failure = ProbeTCPRefused
+			result.Message = fmt.Sprintf("connection to %s refused; is the broker running on this port?", address)
+		case errors.As(err, &netErr) && netErr.Timeout(), errors.Is(err, context.DeadlineExceeded):
+			result.Failure = ProbeTimeout
+			result.Message = fmt.Sprintf("timed out connecting to %s", address)
+		default:
+			result.Failure = ProbeTCPUnreachable
+		}
+		return result
+	}
+	conn.Close()
+
+	// Stage 3: MQTT handshake and authentication
+	clientOpts := mqtt.NewClientOptions()
+	clientOpts.AddBroker(fmt.Sprintf("tcp://%s", address))
+	clientOpts.SetClientID("go-powercontrol-probe-" + uuid.New().String())
+	clientOpts.SetUsername(opts.Username)
+	clientOpts.SetPassword(opts.Password)
+	clientOpts.SetConnectTimeout(opts.Timeout)
+	clientOpts.SetAutoReconnect(false)
+	clientOpts.SetConnectRetry(false)
+	clientOpts.SetCleanSession(true)
+
+	client := mqtt.NewClient(clientOpts)
+	defer client.Disconnect(250) // Also aborts a handshake that timed out
+	start := time.Now()
+	token := client.Connect()
+
+	if !token.WaitTimeout(opts.Timeout) {
+		// A TLS listener may wait for a ClientHello instead of answering
+		if speaksTLS(parent, address, opts.Server) {
+			return tlsResult(addresses, opts.Port)
+		}
+		return ProbeResult{Failure: ProbeTimeout, Addresses: addresses, Message: "broker did not answer the MQTT handshake"}
+	}
+	latency := time.Since(start)
+
+	if err := token.Error(); err != nil {
+		result := ProbeResult{Addresses: addresses, Message: err.Error()}
+		switch {
+		case errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword):
+			result.Failure = ProbeAuthRejected
+			result.Message = "broker rejected the username or password"
+		case errors.Is(err, packets.ErrorRefusedNotAuthorised):
+			result.Failure = ProbeNotAuthorized
+			result.Message = "broker refused the connection: not authorized"
+		case speaksTLS(parent, address, opts.Server):
+			// A TLS listener drops a plain-text CONNECT without answering
+			return tlsResult(addresses, opts.Port)
+		default:
+			result.Failure = ProbeProtocol
+		}
+		return result
+	}
+
+	return ProbeResult{
+		Success:   true,
+		Addresses: addresses,
+		Message:   "connected successfully",
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+	}
+}
+
+// speaksTLS reports whether the listener at address completes a TLS
+// handshake. The certificate is not verified: this only tells what the
+// port expects.
+func speaksTLS(ctx context.Context, address, server string) bool {
+	ctx, cancel := context.WithTimeout(ctx, tlsCheckTimeout)
+	defer cancel()
+
+	dialer := tls.Dialer{Config: &tls.Config{ServerName: server, InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// tlsResult is the probe result for a broker listening with TLS
+func tlsResult(addresses []string, port int) ProbeResult {
+	return ProbeResult{
+		Failure:   ProbeTLS,
+		Addresses: addresses,
+		Message:   fmt.Sprintf("the broker expects TLS on port %d, which is not supported; use its plain MQTT port", port),
+	}
+}
@@ -0,0 +1,188 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy decides what happens to a publish that exceeds the rate limit
+type OverflowPolicy string
+
+const (
+	OverflowError OverflowPolicy = "error" // reject the publish with ErrRateLimited
+	OverflowDrop  OverflowPolicy = "drop"  // discard the publish with ErrPublishDropped
+	OverflowQueue OverflowPolicy = "queue" // queue the publish and send it when allowed
+)
+
+// publishQueueSize bounds the number of queued publishes
+const publishQueueSize = 256
+
+var (
+	// ErrRateLimited is returned when a publish exceeds the rate limit
+	ErrRateLimited = errors.New("publish rate limit exceeded")
+	// ErrPublishDropped is returned when a publish is discarded by the drop policy
+	ErrPublishDropped = errors.New("publish dropped by rate limiter")
+	// ErrPublishQueueFull is returned when the publish queue has no room left
+	ErrPublishQueueFull = errors.New("publish queue is full")
+)
+
+// RateLimit configures publish throttling
+type RateLimit struct {
+	Rate     float64 // messages per second; 0 disables limiting
+	Burst    int     // messages that may be sent back to back
+	MaxWait  time.Duration
+	Overflow OverflowPolicy
+}
+
+// tokenBucket is a token-bucket rate limiter
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one becomes available within maxWait and returns
+// how long the caller must wait before using it
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+
+	// Going negative reserves the token for this caller
+	b.tokens--
+	return wait, true
+}
+
+// queuedPublish is a publish waiting for the rate limiter
+type queuedPublish struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+// configureRateLimit installs a rate limit, replacing any previous one
+func (c *Client) configureRateLimit(limit RateLimit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queueCancel != nil {
+		c.queueCancel()
+		c.queueCancel = nil
+	}
+
+	c.rateLimit = limit
+	c.limiter = nil
+	c.publishQueue = nil
+	if limit.Rate <= 0 {
+		return
+	}
+
+	c.limiter = newTokenBucket(limit.Rate, limit.Burst)
+	if limit.Overflow == OverflowQueue {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.queueCancel = cancel
+		c.publishQueue = make(chan queuedPublish, publishQueueSize)
+		go c.drainPublishQueue(ctx, c.limiter, c.publishQueue)
+	}
+}
+
+// throttle applies the rate limit to a publish. It returns true if the caller
+// should publish now, or false if the publish was queued or rejected.
+func (c *Client) throttle(topic string, payload []byte, retained bool) (bool, error) {
+	c.mu.RLock()
+	limiter := c.limiter
+	limit := c.rateLimit
+	queue := c.publishQueue
+	c.mu.RUnlock()
+
+	if limiter == nil {
+		return true, nil
+	}
+
+	wait, ok := limiter.reserve(limit.MaxWait)
+	if ok {
+		time.Sleep(wait)
+		return true, nil
+	}
+
+	switch limit.Overflow {
+	case OverflowQueue:
+		select {
+		case queue <- queuedPublish{topic: topic, payload: payload, retained: retained}:
+			c.mu.Lock()
+			c.stats.PublishQueued++
+			c.mu.Unlock()
+			return false, nil
+		default:
+			c.mu.Lock()
+			c.stats.PublishRejected++
+			c.mu.Unlock()
+			return false, ErrPublishQueueFull
+		}
+	case OverflowDrop:
+		c.mu.Lock()
+		c.stats.PublishDropped++
+		c.mu.Unlock()
+		return false, ErrPublishDropped
+	default:
+		c.mu.Lock()
+		c.stats.PublishRejected++
+		c.mu.Unlock()
+		return false, ErrRateLimited
+	}
+}
+
+// drainPublishQueue sends queued publishes as the rate limit allows
+func (c *Client) drainPublishQueue(ctx context.Context, limiter *tokenBucket, queue chan queuedPublish) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-queue:
+			wait, _ := limiter.reserve(time.Hour)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			if err := c.publish(msg.topic, msg.payload, msg.retained); err != nil {
+				c.recordError(fmt.Errorf("queued publish to %s failed: %w", msg.topic, err))
+			}
+		}
+	}
+}
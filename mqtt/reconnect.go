@@ -0,0 +1,185 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ConnectionState describes the state of the broker connection
+type ConnectionState string
+
+const (
+	StateDisconnected ConnectionState = "disconnected"
+	StateConnecting   ConnectionState = "connecting"
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting"
+)
+
+// ConnectionStatus is passed to the ConnectionCallback on every state change
+type ConnectionStatus struct {
+	State       ConnectionState `json:"state"`
+	Attempt     int             `json:"attempt,omitempty"`     // current reconnect attempt
+	MaxAttempts int             `json:"maxAttempts,omitempty"` // 0 means unlimited
+	NextRetry   time.Time       `json:"nextRetry,omitempty"`   // when the next attempt starts
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Backoff computes reconnect delays using exponential backoff with jitter
+type Backoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	MaxAttempts int // 0 means retry forever
+}
+
+// jitterFraction is the share of each delay that is randomized
+const jitterFraction = 0.5
+
+// Delay returns the delay before the given attempt (starting at 1)
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+
+	// Randomize the upper part of the delay so a fleet of clients does not
+	// hammer the broker in lockstep after an outage
+	jitter := time.Duration(float64(delay) * jitterFraction * rand.Float64())
+	return delay - time.Duration(float64(delay)*jitterFraction) + jitter
+}
+
+// Reconnect immediately starts a fresh reconnect cycle, resetting the attempt counter
+func (c *Client) Reconnect() error {
+	if c.client == nil {
+		return fmt.Errorf("client not initialized")
+	}
+	if c.IsConnected() {
+		return nil
+	}
+
+	c.startReconnect(true)
+	return nil
+}
+
+// CancelReconnect stops any reconnect cycle in progress, aborting an
+// attempt in flight
+func (c *Client) CancelReconnect() {
+	c.mu.Lock()
+	cancel := c.reconnectCancel
+	c.reconnectCancel = nil
+	connected := c.state == StateConnected
+	client := c.client
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	if !connected {
+		if client != nil {
+			client.Disconnect(0)
+		}
+		c.setStatus(ConnectionStatus{State: StateDisconnected})
+	}
+}
+
+// startReconnect cancels any running reconnect cycle and starts a new one
+func (c *Client) startReconnect(immediate bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.mu.Lock()
+	if c.reconnectCancel != nil {
+		c.reconnectCancel()
+	}
+	c.reconnectCancel = cancel
+	c.mu.Unlock()
+
+	go c.reconnectLoop(ctx, immediate)
+}
+
+// reconnectLoop retries the connection until it succeeds, is cancelled,
+// or the maximum number of attempts is reached
+func (c *Client) reconnectLoop(ctx context.Context, immediate bool) {
+	c.mu.RLock()
+	client := c.client
+	backoff := c.backoff
+	connectTimeout := c.connectTimeout
+	c.mu.RUnlock()
+
+	for attempt := 1; backoff.MaxAttempts == 0 || attempt <= backoff.MaxAttempts; attempt++ {
+		delay := backoff.Delay(attempt)
+		if immediate && attempt == 1 {
+			delay = 0
+		}
+
+		// A cancelled cycle must not report over the state set by whoever
+		// cancelled it
+		reported := c.setStatusIf(func() bool { return ctx.Err() == nil }, ConnectionStatus{
+			State:       StateReconnecting,
+			Attempt:     attempt,
+			MaxAttempts: backoff.MaxAttempts,
+			NextRetry:   time.Now().Add(delay),
+			LastError:   c.Stats().LastError,
+		})
+		if !reported {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		token := client.Connect()
+		if !token.WaitTimeout(connectTimeout) {
+			// Abort the attempt so it cannot complete during the next one
+			client.Disconnect(0)
+			c.recordError(fmt.Errorf("connection timeout"))
+			continue
+		}
+		if err := token.Error(); err != nil {
+			c.recordError(err)
+			continue
+		}
+
+		// The OnConnect handler reports the connected state and ends the
+		// cycle; CancelReconnect and Disconnect abort attempts in flight
+		return
+	}
+
+	c.setStatusIf(func() bool { return ctx.Err() == nil }, ConnectionStatus{
+		State:     StateDisconnected,
+		LastError: fmt.Sprintf("gave up after %d attempts: %s", backoff.MaxAttempts, c.Stats().LastError),
+	})
+}
+
+// setStatus updates the connection state and notifies the callback
+func (c *Client) setStatus(status ConnectionStatus) {
+	c.setStatusIf(func() bool { return true }, status)
+}
+
+// setStatusIf updates the connection state and notifies the callback if ok
+// still holds once earlier state changes were reported, and tells whether
+// it did; state changes reach the callback in the order they were made
+func (c *Client) setStatusIf(ok func() bool, status ConnectionStatus) bool {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	if !ok() {
+		return false
+	}
+
+	c.mu.Lock()
+	c.state = status.State
+	callback := c.connectionCallback
+	c.mu.Unlock()
+
+	if callback != nil {
+		callback(status)
+	}
+	return true
+}
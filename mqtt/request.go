@@ -0,0 +1,213 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// Defaults for Request
+const (
+	DefaultRequestTimeout     = 10 * time.Second
+	DefaultCorrelationField   = "correlationData"
+	DefaultResponseTopicField = "responseTopic"
+)
+
+// RequestOptions describes a request/response exchange with a device.
+//
+// This is not MQTT 5 request/response. The broker connection is MQTT 3.1.1,
+// so no response topic or correlation data properties are sent; both are
+// fields added to the JSON request, and a reply is matched only if it is a
+// JSON object carrying the same correlation ID. Devices that answer MQTT 5
+// requests through their properties are not reached; devices bridged from
+// MQTT 5 or speaking a JSON RPC dialect (Shelly's "id"/"src", for example)
+// are, by naming their fields.
+type RequestOptions struct {
+	Topic              string        // where the request is published
+	Payload            string        // a JSON object; the two fields below are added to it
+	ResponseTopic      string        // where the reply is expected; empty uses powercontrol/<client ID>/response
+	CorrelationField   string        // field carrying the correlation ID; "correlationData" if empty
+	ResponseTopicField string        // field carrying the response topic; "responseTopic" if empty, "-" to leave it out
+	Timeout            time.Duration // DefaultRequestTimeout if zero
+}
+
+// requestRouter delivers replies to the requests waiting for them
+type requestRouter struct {
+	mu      sync.Mutex
+	pending map[string]chan string           // key: response topic + correlation ID
+	topics  map[string]*responseSubscription // response topic subscriptions in use
+}
+
+// responseSubscription is a response topic shared by the requests waiting
+// on it, which may use different correlation fields
+type responseSubscription struct {
+	users  int
+	fields map[string]int // correlation fields in use, with their requests
+	ready  chan struct{}  // closed once the subscribe finished
+	err    error          // why the subscribe failed; set before ready is closed
+}
+
+// Request publishes a request with a generated correlation ID, waits on the
+// response topic for the reply carrying the same ID and returns its payload
+func (c *Client) Request(ctx context.Context, opts RequestOptions) (string, error) {
+	if c.client == nil {
+		return "", fmt.Errorf("client not initialized")
+	}
+	if !c.IsConnected() {
+		return "", fmt.Errorf("not connected to broker")
+	}
+
+	c.mu.RLock()
+	clientID := c.clientID
+	c.mu.RUnlock()
+	if opts.ResponseTopic == "" {
+		opts.ResponseTopic = "powercontrol/" + clientID + "/response"
+	}
+	if opts.CorrelationField == "" {
+		opts.CorrelationField = DefaultCorrelationField
+	}
+	if opts.ResponseTopicField == "" {
+		opts.ResponseTopicField = DefaultResponseTopicField
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRequestTimeout
+	}
+
+	var request map[string]interface{}
+	if err := json.Unmarshal([]byte(opts.Payload), &request); err != nil || request == nil {
+		return "", fmt.Errorf("request payload must be a JSON object")
+	}
+	correlationID := uuid.New().String()
+	request[opts.CorrelationField] = correlationID
+	if opts.ResponseTopicField != "-" {
+		request[opts.ResponseTopicField] = opts.ResponseTopic
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	// Listen before publishing so a fast reply is not missed
+	reply, err := c.awaitReply(opts.ResponseTopic, opts.CorrelationField, correlationID)
+	if err != nil {
+		return "", err
+	}
+	defer c.stopAwaiting(opts.ResponseTopic, opts.CorrelationField, correlationID)
+
+	if err := c.Publish(opts.Topic, string(payload)); err != nil {
+		return "", err
+	}
+
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+	select {
+	case response := <-reply:
+		return response, nil
+	case <-timer.C:
+		return "", fmt.Errorf("no reply on %s within %s", opts.ResponseTopic, opts.Timeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// awaitReply registers a pending request, subscribing to its response topic
+// if no other request is using it. The router lock is not held while
+// subscribing, as the broker may deliver a reply to routeReply meanwhile.
+func (c *Client) awaitReply(responseTopic, correlationField, correlationID string) (chan string, error) {
+	router := &c.requests
+	reply := make(chan string, 1)
+
+	router.mu.Lock()
+	if router.pending == nil {
+		router.pending = make(map[string]chan string)
+		router.topics = make(map[string]*responseSubscription)
+	}
+	sub, subscribed := router.topics[responseTopic]
+	if !subscribed {
+		sub = &responseSubscription{fields: make(map[string]int), ready: make(chan struct{})}
+		router.topics[responseTopic] = sub
+	}
+	sub.users++
+	sub.fields[correlationField]++
+	router.pending[responseTopic+"\x00"+correlationID] = reply
+	router.mu.Unlock()
+
+	if subscribed {
+		<-sub.ready // A request that started just before may still be subscribing
+	} else {
+		token := c.client.Subscribe(responseTopic, 0, func(_ mqtt.Client, msg mqtt.Message) {
+			c.routeReply(msg.Topic(), string(msg.Payload()))
+		})
+		if !token.WaitTimeout(10 * time.Second) {
+			sub.err = fmt.Errorf("subscribe timeout")
+		} else if err := token.Error(); err != nil {
+			sub.err = fmt.Errorf("subscribe failed: %w", err)
+		}
+		close(sub.ready)
+	}
+
+	if sub.err != nil {
+		c.stopAwaiting(responseTopic, correlationField, correlationID)
+		return nil, sub.err
+	}
+	return reply, nil
+}
+
+// routeReply hands a reply to the request with its correlation ID, looked
+// up in every correlation field in use on the topic; replies nobody is
+// waiting for are dropped
+func (c *Client) routeReply(responseTopic, payload string) {
+	var reply map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &reply); err != nil {
+		return
+	}
+
+	router := &c.requests
+	router.mu.Lock()
+	var waiting chan string
+	if sub := router.topics[responseTopic]; sub != nil {
+		for field := range sub.fields {
+			if correlationID, ok := reply[field].(string); ok {
+				if ch, ok := router.pending[responseTopic+"\x00"+correlationID]; ok {
+					waiting = ch
+					break
+				}
+			}
+		}
+	}
+	router.mu.Unlock()
+
+	if waiting != nil {
+		select {
+		case waiting <- payload:
+		default: // A duplicate reply
+		}
+	}
+}
+
+// stopAwaiting forgets a request, unsubscribing from its response topic
+// once no other request is using it
+func (c *Client) stopAwaiting(responseTopic, correlationField, correlationID string) {
+	router := &c.requests
+	router.mu.Lock()
+	delete(router.pending, responseTopic+"\x00"+correlationID)
+	sub := router.topics[responseTopic]
+	if sub.fields[correlationField]--; sub.fields[correlationField] == 0 {
+		delete(sub.fields, correlationField)
+	}
+	sub.users--
+	if sub.users == 0 {
+		delete(router.topics, responseTopic)
+		// Queued under the lock so it cannot overtake the subscribe of a
+		// request starting right after, but not waited for
+		if c.client != nil && c.IsConnected() {
+			c.client.Unsubscribe(responseTopic) // Best effort; the reply wait is over either way
+		}
+	}
+	router.mu.Unlock()
+}
@@ -0,0 +1,160 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// shellyRPCSource identifies this app in RPC requests; Shelly devices send
+// replies to <source>/rpc
+const shellyRPCSource = "go-powercontrol"
+
+// shellyRequestID numbers RPC requests
+var shellyRequestID atomic.Uint64
+
+// shellySwitchStatus is the part of a Switch component status we use
+type shellySwitchStatus struct {
+	Output *bool    `json:"output"`
+	APower *float64 `json:"apower"`
+}
+
+// ParseShelly extracts outlet states from a Shelly Gen2 message. It
+// understands <device>/status/switch:<id> component statuses and
+// NotifyStatus frames on <device>/events/rpc. The switch id is used as the
+// outlet number.
+func ParseShelly(topic, payload string) ([]OutletState, error) {
+	if i := strings.LastIndex(topic, "/status/switch:"); i > 0 {
+		device := topic[:i]
+		id := topic[i+len("/status/switch:"):]
+		if id == "" || strings.Contains(id, "/") {
+			return nil, fmt.Errorf("invalid Shelly status topic: %s", topic)
+		}
+
+		var status shellySwitchStatus
+		if err := json.Unmarshal([]byte(payload), &status); err != nil {
+			return nil, fmt.Errorf("invalid Shelly status payload: %w", err)
+		}
+		if status.Output == nil {
+			return nil, fmt.Errorf("no output state in Shelly status")
+		}
+		return []OutletState{{Device: device, Outlet: id, Status: shellyStatus(*status.Output), Watts: status.APower}}, nil
+	}
+
+	if device, ok := strings.CutSuffix(topic, "/events/rpc"); ok && device != "" {
+		var frame struct {
+			Method string                     `json:"method"`
+			Params map[string]json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(payload), &frame); err != nil {
+			return nil, fmt.Errorf("invalid Shelly RPC payload: %w", err)
+		}
+		if frame.Method != "NotifyStatus" {
+			return nil, fmt.Errorf("unsupported Shelly notification: %s", frame.Method)
+		}
+
+		states := make([]OutletState, 0)
+		for component, raw := range frame.Params {
+			id, ok := strings.CutPrefix(component, "switch:")
+			if !ok {
+				continue
+			}
+			var status shellySwitchStatus
+			if err := json.Unmarshal(raw, &status); err != nil || (status.Output == nil && status.APower == nil) {
+				continue // Notifications often carry only changed fields
+			}
+			state := OutletState{Device: device, Outlet: id, Watts: status.APower}
+			if status.Output != nil {
+				state.Status = shellyStatus(*status.Output)
+			}
+			states = append(states, state)
+		}
+		if len(states) == 0 {
+			return nil, fmt.Errorf("no switch status in Shelly notification")
+		}
+
+		// Outlet 10 comes after outlet 9, as in the device list
+		sort.Slice(states, func(i, j int) bool { return models.NaturalLess(states[i].Outlet, states[j].Outlet) })
+		return states, nil
+	}
+
+	return nil, fmt.Errorf("unsupported Shelly topic: %s", topic)
+}
+
+// ShellyCommand builds a Switch.Set RPC request for a Shelly switch
+func ShellyCommand(device, outlet, state string) (topic string, payload string, err error) {
+	var on bool
+	switch strings.ToUpper(strings.TrimSpace(state)) {
+	case "ON", "1":
+		on = true
+	case "OFF", "0":
+		on = false
+	default:
+		return "", "", fmt.Errorf("unsupported state for Shelly switch: %s", state)
+	}
+
+	var id int
+	if _, err := fmt.Sscanf(outlet, "%d", &id); err != nil {
+		return "", "", fmt.Errorf("invalid Shelly switch id: %s", outlet)
+	}
+
+	request := map[string]interface{}{
+		"id":     shellyRequestID.Add(1),
+		"src":    shellyRPCSource,
+		"method": "Switch.Set",
+		"params": map[string]interface{}{"id": id, "on": on},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+	return device + "/rpc", string(data), nil
+}
+
+// ShellyToggle builds a Switch.Toggle RPC request for a Shelly switch
+func ShellyToggle(device, outlet string) (topic string, payload string, err error) {
+	var id int
+	if _, err := fmt.Sscanf(outlet, "%d", &id); err != nil {
+		return "", "", fmt.Errorf("invalid Shelly switch id: %s", outlet)
+	}
+
+	request := map[string]interface{}{
+		"id":     shellyRequestID.Add(1),
+		"src":    shellyRPCSource,
+		"method": "Switch.Toggle",
+		"params": map[string]interface{}{"id": id},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+	return device + "/rpc", string(data), nil
+}
+
+// ShellyUpdate builds a Shelly.Update RPC request that installs the
+// firmware image at url
+func ShellyUpdate(device, url string) (topic string, payload string, err error) {
+	request := map[string]interface{}{
+		"id":     shellyRequestID.Add(1),
+		"src":    shellyRPCSource,
+		"method": "Shelly.Update",
+		"params": map[string]interface{}{"url": url},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", "", err
+	}
+	return device + "/rpc", string(data), nil
+}
+
+// shellyStatus converts a switch output to ON/OFF
+func shellyStatus(output bool) string {
+	if output {
+		return "ON"
+	}
+	return "OFF"
+}
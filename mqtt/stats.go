@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stats holds connection statistics for diagnostics
+type Stats struct {
+	Connected        bool      `json:"connected"`
+	ConnectedSince   time.Time `json:"connectedSince"`
+	MessagesSent     uint64    `json:"messagesSent"`
+	MessagesReceived uint64    `json:"messagesReceived"`
+	BytesSent        uint64    `json:"bytesSent"`
+	BytesReceived    uint64    `json:"bytesReceived"`
+	ReconnectCount   int       `json:"reconnectCount"`
+	LastError        string    `json:"lastError"`
+	LastErrorTime    time.Time `json:"lastErrorTime"`
+	PingLatencyMs    float64   `json:"pingLatencyMs"`    // most recent round trip
+	AvgPingLatencyMs float64   `json:"avgPingLatencyMs"` // moving average
+	LastPing         time.Time `json:"lastPing"`
+	PublishQueued    uint64    `json:"publishQueued"`   // publishes delayed by the rate limiter
+	PublishDropped   uint64    `json:"publishDropped"`  // publishes discarded by the rate limiter
+	PublishRejected  uint64    `json:"publishRejected"` // publishes refused by the rate limiter
+
+	PriorityPublishes uint64 `json:"priorityPublishes"` // emergency publishes on the priority connection
+}
+
+// Stats returns a snapshot of the connection statistics
+func (c *Client) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := c.stats
+	stats.Connected = c.state == StateConnected
+	return stats
+}
+
+// Ping measures the broker round-trip time. It unsubscribes from a topic the
+// client never subscribed to, which the broker acknowledges without side effects.
+func (c *Client) Ping() (time.Duration, error) {
+	if c.client == nil {
+		return 0, fmt.Errorf("client not initialized")
+	}
+
+	c.mu.RLock()
+	probeTopic := "go-powercontrol/latency-probe/" + c.clientID
+	c.mu.RUnlock()
+
+	start := time.Now()
+	token := c.client.Unsubscribe(probeTopic)
+
+	if !token.WaitTimeout(10 * time.Second) {
+		c.recordError(fmt.Errorf("ping timeout"))
+		return 0, fmt.Errorf("ping timeout")
+	}
+
+	if err := token.Error(); err != nil {
+		c.recordError(err)
+		return 0, fmt.Errorf("ping failed: %w", err)
+	}
+
+	latency := time.Since(start)
+	ms := float64(latency) / float64(time.Millisecond)
+
+	c.mu.Lock()
+	if c.stats.AvgPingLatencyMs == 0 {
+		c.stats.AvgPingLatencyMs = ms
+	} else {
+		c.stats.AvgPingLatencyMs = 0.8*c.stats.AvgPingLatencyMs + 0.2*ms
+	}
+	c.stats.PingLatencyMs = ms
+	c.stats.LastPing = time.Now()
+	c.mu.Unlock()
+
+	return latency, nil
+}
+
+// recordError stores the most recent error
+func (c *Client) recordError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.LastError = err.Error()
+	c.stats.LastErrorTime = time.Now()
+}
@@ -0,0 +1,147 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// Tasmota topic prefixes (the firmware default %prefix%/%topic%/ layout)
+const (
+	TasmotaStatPrefix = "stat"
+	TasmotaTelePrefix = "tele"
+	TasmotaCmndPrefix = "cmnd"
+)
+
+// ParseTasmota extracts outlet states from a Tasmota message. It understands
+// stat/<device>/POWER<n> with ON/OFF payloads, stat/<device>/RESULT and
+// tele/<device>/STATE with JSON payloads carrying POWER<n> keys, and energy
+// readings on tele/<device>/SENSOR. A bare POWER refers to the first relay.
+func ParseTasmota(topic, payload string) ([]OutletState, error) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 3 || parts[1] == "" {
+		return nil, fmt.Errorf("not a Tasmota topic: %s", topic)
+	}
+	prefix, device, command := parts[0], parts[1], parts[2]
+
+	switch {
+	case prefix == TasmotaStatPrefix && isTasmotaPower(command):
+		return []OutletState{{
+			Device: device,
+			Outlet: tasmotaOutlet(command),
+			Status: ParsePayload(payload),
+		}}, nil
+	case prefix == TasmotaStatPrefix && command == "RESULT",
+		prefix == TasmotaTelePrefix && command == "STATE":
+		return parseTasmotaJSON(device, payload)
+	case prefix == TasmotaTelePrefix && command == "SENSOR":
+		return parseTasmotaEnergy(device, payload)
+	default:
+		return nil, fmt.Errorf("unsupported Tasmota topic: %s", topic)
+	}
+}
+
+// TasmotaCommand builds the command topic and payload for a Tasmota relay
+func TasmotaCommand(device, outlet, state string) (topic string, payload string) {
+	return fmt.Sprintf("%s/%s/POWER%s", TasmotaCmndPrefix, device, outlet), strings.ToUpper(strings.TrimSpace(state))
+}
+
+// TasmotaUpgrade builds a Backlog command that points OtaUrl at a firmware
+// image and starts the upgrade
+func TasmotaUpgrade(device, url string) (topic string, payload string, err error) {
+	// Backlog separates commands with semicolons
+	if strings.ContainsAny(url, "; ") {
+		return "", "", fmt.Errorf("firmware URL for Tasmota cannot contain spaces or semicolons")
+	}
+	return fmt.Sprintf("%s/%s/Backlog", TasmotaCmndPrefix, device), "OtaUrl " + url + "; Upgrade 1", nil
+}
+
+// parseTasmotaJSON reads the POWER<n> keys of a RESULT or STATE payload
+func parseTasmotaJSON(device, payload string) ([]OutletState, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return nil, fmt.Errorf("invalid Tasmota JSON payload: %w", err)
+	}
+
+	states := make([]OutletState, 0)
+	for key, value := range fields {
+		if !isTasmotaPower(key) {
+			continue
+		}
+		status, ok := value.(string)
+		if !ok {
+			continue
+		}
+		states = append(states, OutletState{
+			Device: device,
+			Outlet: tasmotaOutlet(key),
+			Status: ParsePayload(status),
+		})
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no relay state in Tasmota payload")
+	}
+
+	// Outlet 10 comes after outlet 9, as in the device list
+	sort.Slice(states, func(i, j int) bool { return models.NaturalLess(states[i].Outlet, states[j].Outlet) })
+	return states, nil
+}
+
+// parseTasmotaEnergy reads ENERGY.Power from a SENSOR payload; devices with
+// several channels report an array with one reading per relay
+func parseTasmotaEnergy(device, payload string) ([]OutletState, error) {
+	var sensor struct {
+		Energy struct {
+			Power json.RawMessage `json:"Power"`
+		} `json:"ENERGY"`
+	}
+	if err := json.Unmarshal([]byte(payload), &sensor); err != nil {
+		return nil, fmt.Errorf("invalid Tasmota JSON payload: %w", err)
+	}
+	if len(sensor.Energy.Power) == 0 {
+		return nil, fmt.Errorf("no energy reading in Tasmota payload")
+	}
+
+	var readings []float64
+	var single float64
+	if err := json.Unmarshal(sensor.Energy.Power, &single); err == nil {
+		readings = []float64{single}
+	} else if err := json.Unmarshal(sensor.Energy.Power, &readings); err != nil {
+		return nil, fmt.Errorf("invalid Tasmota energy reading: %w", err)
+	}
+
+	states := make([]OutletState, 0, len(readings))
+	for i := range readings {
+		states = append(states, OutletState{
+			Device: device,
+			Outlet: fmt.Sprint(i + 1),
+			Watts:  &readings[i],
+		})
+	}
+	return states, nil
+}
+
+// isTasmotaPower reports whether a command or key is POWER or POWER<n>
+func isTasmotaPower(name string) bool {
+	if !strings.HasPrefix(name, "POWER") {
+		return false
+	}
+	for _, r := range name[len("POWER"):] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// tasmotaOutlet returns the relay number of a POWER<n> name
+func tasmotaOutlet(name string) string {
+	outlet := strings.TrimPrefix(name, "POWER")
+	if outlet == "" {
+		return "1"
+	}
+	return outlet
+}
@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TelemetryLevel is the topic level below an outlet's state topic on which
+// PDUs publish electrical readings, e.g. power/<device>/outlets/<n>/energy
+const TelemetryLevel = "energy"
+
+// Accepted keys for each reading in a telemetry payload, matched case-insensitively
+var (
+	wattsKeys = []string{"watts", "power", "w"}
+	voltsKeys = []string{"volts", "voltage", "v"}
+	ampsKeys  = []string{"amps", "current", "a"}
+	kwhKeys   = []string{"kwh", "energy", "total"}
+)
+
+// IsTelemetryTopic reports whether a topic carries outlet telemetry
+func IsTelemetryTopic(topic string) bool {
+	return strings.HasSuffix(topic, "/"+TelemetryLevel)
+}
+
+// ParseTelemetry reads an outlet's electrical readings. The payload is
+// either a JSON object such as {"watts":42.1,"volts":230,"amps":0.18,"kwh":12.5}
+// or a bare number, which is taken as watts.
+func ParseTelemetry(device, outlet, payload string) (OutletState, error) {
+	state := OutletState{Device: device, Outlet: outlet}
+	payload = strings.TrimSpace(payload)
+
+	if watts, err := strconv.ParseFloat(payload, 64); err == nil {
+		state.Watts = &watts
+		return state, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return OutletState{}, fmt.Errorf("invalid telemetry payload: %w", err)
+	}
+
+	readings := make(map[string]float64, len(fields))
+	for key, value := range fields {
+		if number, ok := telemetryNumber(value); ok {
+			readings[strings.ToLower(key)] = number
+		}
+	}
+
+	state.Watts = telemetryReading(readings, wattsKeys)
+	state.Volts = telemetryReading(readings, voltsKeys)
+	state.Amps = telemetryReading(readings, ampsKeys)
+	state.KWh = telemetryReading(readings, kwhKeys)
+	if !state.HasTelemetry() {
+		return OutletState{}, fmt.Errorf("no readings in telemetry payload")
+	}
+	return state, nil
+}
+
+// telemetryReading returns the first reading present under any of the keys
+func telemetryReading(readings map[string]float64, keys []string) *float64 {
+	for _, key := range keys {
+		if value, ok := readings[key]; ok {
+			return &value
+		}
+	}
+	return nil
+}
+
+// telemetryNumber accepts JSON numbers and numeric strings
+func telemetryNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,190 @@
+package mqtt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Topic template placeholders
+const (
+	DevicePlaceholder = "{device}"
+	OutletPlaceholder = "{outlet}"
+	BankPlaceholder   = "{bank}" // optional; the bank or section of a PDU an outlet is on
+)
+
+// Default topic templates, matching power/<device>/outlets/<n>
+const (
+	DefaultStateTemplate   = "power/{device}/outlets/{outlet}/#"
+	DefaultCommandTemplate = "power/{device}/outlets/{outlet}/set"
+)
+
+// TopicSchema maps between topics and device/outlet pairs using templates
+// such as "stat/{device}/POWER{outlet}". In the state template a '+' level
+// matches any single level and a trailing "/#" allows any number of extra
+// levels (including none). Templates may also place the outlet's bank, as
+// in "pdu/{device}/bank/{bank}/outlet/{outlet}".
+type TopicSchema struct {
+	stateTemplate   string
+	commandTemplate string
+	matcher         *regexp.Regexp
+	deviceGroup     int
+	outletGroup     int
+	bankGroup       int // 0 if the state template has no bank
+}
+
+// DefaultSchema is the schema used by the stock PDU firmware
+var DefaultSchema = mustCompileSchema(DefaultStateTemplate, DefaultCommandTemplate)
+
+// NewTopicSchema compiles state and command templates into a schema
+func NewTopicSchema(stateTemplate, commandTemplate string) (*TopicSchema, error) {
+	if err := checkPlaceholders(stateTemplate); err != nil {
+		return nil, fmt.Errorf("invalid state template: %w", err)
+	}
+	if err := checkPlaceholders(commandTemplate); err != nil {
+		return nil, fmt.Errorf("invalid command template: %w", err)
+	}
+	if strings.ContainsAny(commandTemplate, "+#") {
+		return nil, fmt.Errorf("invalid command template: wildcards are not allowed: %s", commandTemplate)
+	}
+	if strings.Count(stateTemplate, BankPlaceholder) > 1 {
+		return nil, fmt.Errorf("invalid state template: %s may appear at most once in %s", BankPlaceholder, stateTemplate)
+	}
+	if strings.Count(commandTemplate, BankPlaceholder) > 1 ||
+		(strings.Contains(commandTemplate, BankPlaceholder) && !strings.Contains(stateTemplate, BankPlaceholder)) {
+		return nil, fmt.Errorf("invalid command template: %s must appear at most once, and only if the state template has it: %s", BankPlaceholder, commandTemplate)
+	}
+
+	pattern := stateTemplate
+	trailing := ""
+	if pattern == "#" || strings.HasSuffix(pattern, "/#") {
+		pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "#"), "/")
+		trailing = "(?:/.*)?"
+	}
+	if strings.Contains(pattern, "#") {
+		return nil, fmt.Errorf("invalid state template: '#' may only be the last level: %s", stateTemplate)
+	}
+
+	levels := strings.Split(pattern, "/")
+	var expr strings.Builder
+	expr.WriteString("^")
+	group := 0
+	deviceGroup, outletGroup, bankGroup := 0, 0, 0
+	for i, level := range levels {
+		if i > 0 {
+			expr.WriteString("/")
+		}
+		if level == "+" {
+			expr.WriteString("[^/]+")
+			continue
+		}
+		if strings.Contains(level, "+") {
+			return nil, fmt.Errorf("invalid state template: '+' must occupy an entire level: %s", stateTemplate)
+		}
+
+		// Split the level around placeholders, quoting the literal parts
+		rest := level
+		for rest != "" {
+			next, placeholder := -1, ""
+			for _, candidate := range []string{DevicePlaceholder, OutletPlaceholder, BankPlaceholder} {
+				if i := strings.Index(rest, candidate); i >= 0 && (next < 0 || i < next) {
+					next, placeholder = i, candidate
+				}
+			}
+			if next < 0 {
+				expr.WriteString(regexp.QuoteMeta(rest))
+				break
+			}
+
+			expr.WriteString(regexp.QuoteMeta(rest[:next]))
+			expr.WriteString("([^/]+)")
+			group++
+			switch placeholder {
+			case DevicePlaceholder:
+				deviceGroup = group
+			case OutletPlaceholder:
+				outletGroup = group
+			default:
+				bankGroup = group
+			}
+			rest = rest[next+len(placeholder):]
+		}
+	}
+	expr.WriteString(trailing)
+	expr.WriteString("$")
+
+	matcher, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid state template: %w", err)
+	}
+
+	return &TopicSchema{
+		stateTemplate:   stateTemplate,
+		commandTemplate: commandTemplate,
+		matcher:         matcher,
+		deviceGroup:     deviceGroup,
+		outletGroup:     outletGroup,
+		bankGroup:       bankGroup,
+	}, nil
+}
+
+// mustCompileSchema compiles a schema and panics on error
+func mustCompileSchema(stateTemplate, commandTemplate string) *TopicSchema {
+	schema, err := NewTopicSchema(stateTemplate, commandTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// checkPlaceholders ensures a template names the device and outlet exactly once
+func checkPlaceholders(template string) error {
+	if template == "" {
+		return fmt.Errorf("template is empty")
+	}
+	for _, placeholder := range []string{DevicePlaceholder, OutletPlaceholder} {
+		if n := strings.Count(template, placeholder); n != 1 {
+			return fmt.Errorf("%s must appear exactly once in %s", placeholder, template)
+		}
+	}
+	return nil
+}
+
+// StateTemplate returns the template used to parse state topics
+func (s *TopicSchema) StateTemplate() string {
+	return s.stateTemplate
+}
+
+// CommandTemplate returns the template used to build command topics
+func (s *TopicSchema) CommandTemplate() string {
+	return s.commandTemplate
+}
+
+// Parse extracts the device name and outlet number from a state topic
+func (s *TopicSchema) Parse(topic string) (device string, outlet string, err error) {
+	device, outlet, _, err = s.ParseBank(topic)
+	return device, outlet, err
+}
+
+// ParseBank extracts the device name, outlet number and bank from a state
+// topic; the bank is empty if the template has none
+func (s *TopicSchema) ParseBank(topic string) (device, outlet, bank string, err error) {
+	match := s.matcher.FindStringSubmatch(topic)
+	if match == nil {
+		return "", "", "", fmt.Errorf("topic does not match %s: %s", s.stateTemplate, topic)
+	}
+	if s.bankGroup > 0 {
+		bank = match[s.bankGroup]
+	}
+	return match[s.deviceGroup], match[s.outletGroup], bank, nil
+}
+
+// CommandTopic builds the command topic for a device/outlet
+func (s *TopicSchema) CommandTopic(device, outlet string) string {
+	return s.BankCommandTopic(device, outlet, "")
+}
+
+// BankCommandTopic builds the command topic for a device/outlet on a bank
+func (s *TopicSchema) BankCommandTopic(device, outlet, bank string) string {
+	return strings.NewReplacer(DevicePlaceholder, device, OutletPlaceholder, outlet, BankPlaceholder, bank).Replace(s.commandTemplate)
+}
@@ -0,0 +1,20 @@
+package notify
+
+import "github.com/levonbragg/go-powercontrol/models"
+
+// Sender delivers an alert to an external monitoring system
+type Sender interface {
+	Send(alert models.Alert) error
+}
+
+// severityRank orders severities from least to most urgent
+var severityRank = map[models.AlertSeverity]int{
+	models.SeverityInfo:     0,
+	models.SeverityWarning:  1,
+	models.SeverityCritical: 2,
+}
+
+// AtLeast reports whether severity is at least as urgent as minimum
+func AtLeast(severity, minimum models.AlertSeverity) bool {
+	return severityRank[severity] >= severityRank[minimum]
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// DefaultEnterpriseOID roots the trap and its variables. It sits under the
+// Net-SNMP experimental arc; sites with their own enterprise number should
+// configure it instead.
+const DefaultEnterpriseOID = "1.3.6.1.4.1.8072.9999.7400"
+
+// enterprisesOID is the arc private enterprise numbers are assigned under
+const enterprisesOID = "1.3.6.1.4.1"
+
+// Well-known OIDs carried by every SNMPv2 trap
+const (
+	sysUpTimeOID   = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOIDOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// BER tags used by SNMP
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagTimeTicks   = 0x43
+	tagTrapV2      = 0xA7
+)
+
+// startTime is the reference for sysUpTime
+var startTime = time.Now()
+
+// SNMPTrap sends alerts as SNMPv2c traps. The trap OID is <enterprise>.0.1
+// and the variables are <enterprise>.1.1 severity, .1.2 source, .1.3 device,
+// .1.4 outlet and .1.5 message.
+type SNMPTrap struct {
+	Address       string // host:port of the trap receiver
+	Community     string
+	EnterpriseOID string
+}
+
+// Send transmits one trap for the alert
+func (t *SNMPTrap) Send(alert models.Alert) error {
+	packet, err := t.encode(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode SNMP trap: %w", err)
+	}
+
+	conn, err := net.DialTimeout("udp", t.Address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to reach SNMP trap receiver: %w", err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("failed to send SNMP trap: %w", err)
+	}
+	return nil
+}
+
+// encode builds the SNMPv2c trap message
+func (t *SNMPTrap) encode(alert models.Alert) ([]byte, error) {
+	community := t.Community
+	if community == "" {
+		community = "public"
+	}
+	base := t.EnterpriseOID
+	if base == "" {
+		base = DefaultEnterpriseOID
+	}
+
+	type binding struct {
+		oid   string
+		value []byte
+	}
+	uptime := time.Since(startTime) / (10 * time.Millisecond)
+	trapOID, err := encodeOID(base + ".0.1")
+	if err != nil {
+		return nil, err
+	}
+	bindings := []binding{
+		{sysUpTimeOID, tlv(tagTimeTicks, encodeUint(uint64(uptime)))},
+		{snmpTrapOIDOID, trapOID},
+		{base + ".1.1", tlv(tagOctetString, []byte(alert.Severity))},
+		{base + ".1.2", tlv(tagOctetString, []byte(alert.Source))},
+		{base + ".1.3", tlv(tagOctetString, []byte(alert.DeviceName))},
+		{base + ".1.4", tlv(tagOctetString, []byte(alert.OutletNumber))},
+		{base + ".1.5", tlv(tagOctetString, []byte(alert.Message))},
+	}
+
+	var varbinds bytes.Buffer
+	for _, b := range bindings {
+		oid, err := encodeOID(b.oid)
+		if err != nil {
+			return nil, err
+		}
+		varbinds.Write(tlv(tagSequence, append(oid, b.value...)))
+	}
+
+	var pdu bytes.Buffer
+	pdu.Write(tlv(tagInteger, encodeUint(uint64(rand.Int31())))) // request-id
+	pdu.Write(tlv(tagInteger, []byte{0}))                        // error-status
+	pdu.Write(tlv(tagInteger, []byte{0}))                        // error-index
+	pdu.Write(tlv(tagSequence, varbinds.Bytes()))
+
+	var message bytes.Buffer
+	message.Write(tlv(tagInteger, []byte{1})) // version: SNMPv2c
+	message.Write(tlv(tagOctetString, []byte(community)))
+	message.Write(tlv(tagTrapV2, pdu.Bytes()))
+
+	return tlv(tagSequence, message.Bytes()), nil
+}
+
+// tlv encodes a BER tag-length-value triple
+func tlv(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	n := len(value)
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xFF:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// encodeUint encodes a non-negative integer in minimal two's complement form
+func encodeUint(v uint64) []byte {
+	out := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		out = append([]byte{byte(v)}, out...)
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+// encodeOID encodes a dotted object identifier
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID: %s", oid)
+	}
+
+	arcs := make([]uint64, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %s: %w", oid, err)
+		}
+		arcs[i] = arc
+	}
+
+	content := encodeArc(arcs[0]*40 + arcs[1])
+	for _, arc := range arcs[2:] {
+		content = append(content, encodeArc(arc)...)
+	}
+	return tlv(tagOID, content), nil
+}
+
+// encodeArc encodes one OID arc in base-128
+func encodeArc(arc uint64) []byte {
+	out := []byte{byte(arc & 0x7F)}
+	for arc >>= 7; arc > 0; arc >>= 7 {
+		out = append([]byte{byte(arc&0x7F) | 0x80}, out...)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/levonbragg/go-powercontrol/models"
+)
+
+// syslogFacility is local0, commonly routed to network equipment logs
+const syslogFacility = 16
+
+// Syslog sends alerts as RFC 5424 messages to a remote collector. The
+// alert's details are structured data with the SD-ID
+// powercontrol@<enterprise number>.
+type Syslog struct {
+	Network string // "udp" (default) or "tcp"
+	Address string // host:port of the collector
+	AppName string
+
+	// EnterpriseOID is the private enterprise OID (1.3.6.1.4.1.<number>...)
+	// whose number qualifies the SD-ID; DefaultEnterpriseOID if empty
+	EnterpriseOID string
+}
+
+// Send writes one syslog message for the alert
+func (s *Syslog) Send(alert models.Alert) error {
+	network := s.Network
+	if network == "" {
+		network = "udp"
+	}
+
+	conn, err := net.DialTimeout(network, s.Address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog collector: %w", err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+
+	message := s.format(alert)
+	if network == "tcp" {
+		// RFC 6587 octet counting frames messages on a stream
+		message = fmt.Sprintf("%d %s", len(message), message)
+	}
+
+	if _, err := conn.Write([]byte(message)); err != nil {
+		return fmt.Errorf("failed to send syslog message: %w", err)
+	}
+	return nil
+}
+
+// format renders an alert as an RFC 5424 message
+func (s *Syslog) format(alert models.Alert) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	appName := s.AppName
+	if appName == "" {
+		appName = "go-powercontrol"
+	}
+
+	data := fmt.Sprintf(`[powercontrol@%s source="%s" severity="%s"`,
+		enterpriseNumber(s.EnterpriseOID), escapeParam(alert.Source), alert.Severity)
+	if alert.DeviceName != "" {
+		data += fmt.Sprintf(` device="%s"`, escapeParam(alert.DeviceName))
+	}
+	if alert.OutletNumber != "" {
+		data += fmt.Sprintf(` outlet="%s"`, escapeParam(alert.OutletNumber))
+	}
+	data += "]"
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s",
+		syslogFacility*8+syslogSeverity(alert.Severity),
+		alert.Timestamp.UTC().Format(time.RFC3339Nano),
+		hostname,
+		appName,
+		os.Getpid(),
+		data,
+		alert.Message,
+	)
+}
+
+// enterpriseNumber returns the private enterprise number of an enterprise
+// OID, falling back to the one of DefaultEnterpriseOID
+func enterpriseNumber(oid string) string {
+	if number, ok := strings.CutPrefix(oid, enterprisesOID+"."); ok {
+		number, _, _ = strings.Cut(number, ".")
+		if _, err := strconv.ParseUint(number, 10, 32); err == nil {
+			return number
+		}
+	}
+	return enterpriseNumber(DefaultEnterpriseOID)
+}
+
+// syslogSeverity maps an alert severity to a syslog severity level
+func syslogSeverity(severity models.AlertSeverity) int {
+	switch severity {
+	case models.SeverityCritical:
+		return 2 // crit
+	case models.SeverityWarning:
+		return 4 // warning
+	default:
+		return 6 // informational
+	}
+}
+
+// escapeParam escapes a structured data parameter value
+func escapeParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,204 @@
+// Package quirks describes vendor payload and topic oddities, such as
+// lower-case or translated ON/OFF payloads, outlets numbered from 0 and
+// devices that toggle themselves, as JSON definitions. Built-in quirks ship
+// with the app; quirk files in a directory add to or replace them, so they
+// can be updated without a new release.
+package quirks
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed builtin/*.json
+var builtin embed.FS
+
+// Where a quirk was loaded from
+const (
+	SourceBuiltin = "builtin"
+	SourceFile    = "file"
+)
+
+// Quirk is one vendor oddity. Fields left empty are not affected by it.
+type Quirk struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description,omitempty"`
+	Version       int      `json:"version,omitempty"`
+	On            []string `json:"on,omitempty"`  // accepted as ON; the first is sent
+	Off           []string `json:"off,omitempty"` // accepted as OFF; the first is sent
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+	OutletOffset  int      `json:"outletOffset,omitempty"` // device outlet number minus the one shown, e.g. -1 for outlets numbered from 0
+	Toggle        string   `json:"toggle,omitempty"`       // payload that flips an outlet on its command topic
+	Source        string   `json:"source,omitempty"`       // builtin or file; set when loaded
+}
+
+// Validate checks a quirk's name and payloads
+func (q Quirk) Validate() error {
+	if strings.TrimSpace(q.Name) == "" {
+		return fmt.Errorf("quirk name is required")
+	}
+	if (len(q.On) == 0) != (len(q.Off) == 0) {
+		return fmt.Errorf("quirk %s needs both ON and OFF payloads, or neither", q.Name)
+	}
+	for _, on := range q.On {
+		for _, off := range q.Off {
+			if on == off || (!q.CaseSensitive && strings.EqualFold(on, off)) {
+				return fmt.Errorf("quirk %s maps payload %q to both ON and OFF", q.Name, on)
+			}
+		}
+	}
+	return nil
+}
+
+// Merge returns the quirk with the fields set by other applied on top
+func (q Quirk) Merge(other Quirk) Quirk {
+	if len(other.On) > 0 {
+		q.On, q.Off, q.CaseSensitive = other.On, other.Off, other.CaseSensitive
+	}
+	if other.OutletOffset != 0 {
+		q.OutletOffset = other.OutletOffset
+	}
+	if other.Toggle != "" {
+		q.Toggle = other.Toggle
+	}
+	return q
+}
+
+// ToDevice converts a shown outlet number to the one the device uses;
+// outlets that are not numbers are returned as-is
+func (q Quirk) ToDevice(outlet string) string {
+	return q.shift(outlet, q.OutletOffset)
+}
+
+// FromDevice converts the outlet number a device reported to the one shown
+func (q Quirk) FromDevice(outlet string) string {
+	return q.shift(outlet, -q.OutletOffset)
+}
+
+// shift adds offset to a numeric outlet number
+func (q Quirk) shift(outlet string, offset int) string {
+	if offset == 0 {
+		return outlet
+	}
+	n, err := strconv.Atoi(outlet)
+	if err != nil {
+		return outlet
+	}
+	return strconv.Itoa(n + offset)
+}
+
+// Library holds the available quirks by name
+type Library struct {
+	mu     sync.RWMutex
+	quirks map[string]Quirk // key: lower-case name
+}
+
+// NewLibrary creates a library of the built-in quirks
+func NewLibrary() *Library {
+	l := &Library{}
+	l.Load("")
+	return l
+}
+
+// Load replaces the library with the built-in quirks and the *.json quirk
+// files in dir, which replace built-in quirks of the same name. A missing
+// dir is not an error; files that cannot be used are skipped and reported.
+func (l *Library) Load(dir string) error {
+	quirks := make(map[string]Quirk)
+	var errs []error
+
+	entries, _ := builtin.ReadDir("builtin")
+	for _, entry := range entries {
+		data, err := builtin.ReadFile("builtin/" + entry.Name())
+		if err == nil {
+			err = add(quirks, data, SourceBuiltin)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("built-in quirk %s: %w", entry.Name(), err))
+		}
+	}
+
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err == nil {
+				err = add(quirks, data, SourceFile)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("quirk file %s: %w", filepath.Base(file), err))
+			}
+		}
+	}
+
+	l.mu.Lock()
+	l.quirks = quirks
+	l.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// add decodes and validates a quirk definition and stores it
+func add(quirks map[string]Quirk, data []byte, source string) error {
+	var quirk Quirk
+	if err := json.Unmarshal(data, &quirk); err != nil {
+		return err
+	}
+	quirk.Name = strings.TrimSpace(quirk.Name)
+	if err := quirk.Validate(); err != nil {
+		return err
+	}
+	quirk.Source = source
+	quirks[strings.ToLower(quirk.Name)] = quirk
+	return nil
+}
+
+// Get returns a quirk by name, ignoring case
+func (l *Library) Get(name string) (Quirk, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	quirk, ok := l.quirks[strings.ToLower(strings.TrimSpace(name))]
+	return quirk, ok
+}
+
+// All returns the quirks sorted by name
+func (l *Library) All() []Quirk {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	quirks := make([]Quirk, 0, len(l.quirks))
+	for _, quirk := range l.quirks {
+		quirks = append(quirks, quirk)
+	}
+	sort.Slice(quirks, func(a, b int) bool { return quirks[a].Name < quirks[b].Name })
+	return quirks
+}
+
+// Resolve merges the named quirks in order, later ones taking precedence,
+// and returns the names that are not in the library
+func (l *Library) Resolve(names []string) (Quirk, []string) {
+	var merged Quirk
+	var unknown []string
+	for _, name := range names {
+		quirk, ok := l.Get(name)
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		merged = merged.Merge(quirk)
+	}
+	merged.Name = strings.Join(names, "+")
+	return merged, unknown
+}
@@ -0,0 +1,438 @@
+// Package sim runs a small MQTT broker and simulated power devices in
+// process, so the app can be exercised end to end (connect, subscribe,
+// status, command, confirm) without hardware or an external broker.
+package sim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/levonbragg/go-powercontrol/mqtt"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetPubrec      = 5
+	packetPubrel      = 6
+	packetPubcomp     = 7
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetUnsubscribe = 10
+	packetUnsuback    = 11
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+)
+
+// maxPacketSize bounds the packets the broker accepts
+const maxPacketSize = 1 << 20
+
+// message is a publication held by the broker
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// Broker is a minimal MQTT 3.1.1 broker for simulations. It accepts any
+// client, keeps retained messages and publishes last wills, and delivers
+// every message at QoS 0 whatever QoS it was published or subscribed with.
+type Broker struct {
+	mu       sync.Mutex
+	listener net.Listener
+	sessions map[*session]bool
+	retained map[string]message
+	wg       sync.WaitGroup
+}
+
+// session is one connected client
+type session struct {
+	conn     net.Conn
+	writeMu  sync.Mutex
+	clientID string
+	filters  map[string]bool // guarded by Broker.mu
+	will     *message        // guarded by Broker.mu
+}
+
+// NewBroker starts a broker listening on addr, e.g. "127.0.0.1:0" for a
+// free port
+func NewBroker(addr string) (*Broker, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	b := &Broker{
+		listener: listener,
+		sessions: make(map[*session]bool),
+		retained: make(map[string]message),
+	}
+	b.wg.Add(1)
+	go b.serve()
+	return b, nil
+}
+
+// Addr returns the host:port the broker listens on
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Close stops the broker and disconnects every client
+func (b *Broker) Close() error {
+	err := b.listener.Close()
+
+	b.mu.Lock()
+	for s := range b.sessions {
+		s.will = nil // Closed by the broker, not lost
+		s.conn.Close()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return err
+}
+
+// Publish delivers a message from the broker itself, as if a client sent it
+func (b *Broker) Publish(topic string, payload []byte, retain bool) {
+	b.route(message{topic: topic, payload: payload, retain: retain})
+}
+
+// serve accepts connections until the listener is closed
+func (b *Broker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handle(conn)
+		}()
+	}
+}
+
+// handle runs one client connection
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	kind, _, body, err := readPacket(r)
+	if err != nil || kind != packetConnect {
+		return
+	}
+	s, err := parseConnect(body)
+	if err != nil {
+		return
+	}
+	s.conn = conn
+	if err := s.write(packetConnack<<4, []byte{0, 0}); err != nil {
+		return
+	}
+	b.add(s)
+
+	clean := false
+	defer func() {
+		if will := b.remove(s); !clean && will != nil {
+			b.route(*will)
+		}
+	}()
+
+	for {
+		kind, flags, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch kind {
+		case packetPublish:
+			msg, qos, id, err := parsePublish(flags, body)
+			if err != nil {
+				return
+			}
+			switch qos {
+			case 1:
+				s.write(packetPuback<<4, id)
+			case 2:
+				s.write(packetPubrec<<4, id)
+			}
+			b.route(msg)
+		case packetPubrel:
+			s.write(packetPubcomp<<4, body)
+		case packetSubscribe:
+			b.subscribe(s, body)
+		case packetUnsubscribe:
+			b.unsubscribe(s, body)
+		case packetPingreq:
+			s.write(packetPingresp<<4, nil)
+		case packetDisconnect:
+			clean = true
+			return
+		}
+	}
+}
+
+// add registers a session, taking over from one with the same client ID
+func (b *Broker) add(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for other := range b.sessions {
+		if other.clientID == s.clientID && s.clientID != "" {
+			delete(b.sessions, other)
+			other.conn.Close()
+		}
+	}
+	b.sessions[s] = true
+}
+
+// remove unregisters a session and returns its last will
+func (b *Broker) remove(s *session) *message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sessions, s)
+	return s.will
+}
+
+// route stores a retained message and delivers a message to the sessions
+// subscribed to its topic
+func (b *Broker) route(msg message) {
+	b.mu.Lock()
+	if msg.retain {
+		if len(msg.payload) == 0 {
+			delete(b.retained, msg.topic)
+		} else {
+			b.retained[msg.topic] = msg
+		}
+	}
+	targets := make([]*session, 0)
+	for s := range b.sessions {
+		if s.matches(msg.topic) {
+			targets = append(targets, s)
+		}
+	}
+	b.mu.Unlock()
+
+	// Live deliveries do not carry the retain flag
+	delivered := message{topic: msg.topic, payload: msg.payload}
+	for _, s := range targets {
+		s.publish(delivered)
+	}
+}
+
+// subscribe adds the filters of a SUBSCRIBE packet and sends the matching
+// retained messages
+func (b *Broker) subscribe(s *session, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	id, rest := body[:2], body[2:]
+
+	var filters []string
+	granted := make([]byte, 0)
+	for len(rest) > 0 {
+		filter, n, err := readString(rest)
+		if err != nil || len(rest) < n+1 {
+			return
+		}
+		rest = rest[n+1:] // skip the requested QoS
+		filters = append(filters, filter)
+		granted = append(granted, 0)
+	}
+
+	b.mu.Lock()
+	retained := make([]message, 0)
+	for _, filter := range filters {
+		s.filters[filter] = true
+		for _, msg := range b.retained {
+			if mqtt.TopicMatches(filter, msg.topic) {
+				retained = append(retained, msg)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	s.write(packetSuback<<4, append(append([]byte{}, id...), granted...))
+	for _, msg := range retained {
+		s.publish(msg)
+	}
+}
+
+// unsubscribe removes the filters of an UNSUBSCRIBE packet
+func (b *Broker) unsubscribe(s *session, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	id, rest := body[:2], body[2:]
+
+	b.mu.Lock()
+	for len(rest) > 0 {
+		filter, n, err := readString(rest)
+		if err != nil {
+			break
+		}
+		rest = rest[n:]
+		delete(s.filters, filter)
+	}
+	b.mu.Unlock()
+
+	s.write(packetUnsuback<<4, id)
+}
+
+// matches reports whether the session subscribed to a topic; the caller
+// must hold Broker.mu
+func (s *session) matches(topic string) bool {
+	for filter := range s.filters {
+		if mqtt.TopicMatches(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish sends a message to the client at QoS 0
+func (s *session) publish(msg message) {
+	header := byte(packetPublish << 4)
+	if msg.retain {
+		header |= 1
+	}
+	body := appendString(nil, msg.topic)
+	s.write(header, append(body, msg.payload...))
+}
+
+// write sends one packet
+func (s *session) write(header byte, body []byte) error {
+	packet := []byte{header}
+	packet = appendLength(packet, len(body))
+	packet = append(packet, body...)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err := s.conn.Write(packet)
+	return err
+}
+
+// parseConnect reads the client ID and last will of a CONNECT packet
+func parseConnect(body []byte) (*session, error) {
+	_, n, err := readString(body) // protocol name
+	if err != nil || len(body) < n+4 {
+		return nil, errors.New("malformed CONNECT")
+	}
+	flags := body[n+1]
+	rest := body[n+4:] // level, flags, keep alive
+
+	s := &session{filters: make(map[string]bool)}
+	if s.clientID, n, err = readString(rest); err != nil {
+		return nil, err
+	}
+	rest = rest[n:]
+
+	if flags&0x04 != 0 {
+		topic, n, err := readString(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+		payload, _, err := readString(rest)
+		if err != nil {
+			return nil, err
+		}
+		s.will = &message{topic: topic, payload: []byte(payload), retain: flags&0x20 != 0}
+	}
+	return s, nil // Credentials are not checked
+}
+
+// parsePublish reads a PUBLISH packet, returning its QoS and packet ID
+func parsePublish(flags byte, body []byte) (message, byte, []byte, error) {
+	topic, n, err := readString(body)
+	if err != nil {
+		return message{}, 0, nil, err
+	}
+	body = body[n:]
+
+	qos := (flags >> 1) & 0x03
+	var id []byte
+	if qos > 0 {
+		if len(body) < 2 {
+			return message{}, 0, nil, errors.New("malformed PUBLISH")
+		}
+		id, body = body[:2], body[2:]
+	}
+	return message{topic: topic, payload: body, retain: flags&0x01 != 0}, qos, id, nil
+}
+
+// readPacket reads one packet, returning its type, flags and body
+func readPacket(r *bufio.Reader) (byte, byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if length > maxPacketSize {
+		return 0, 0, nil, fmt.Errorf("packet of %d bytes is too large", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0f, body, nil
+}
+
+// readString reads a length-prefixed string, returning the bytes consumed
+func readString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, errors.New("truncated string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", 0, errors.New("truncated string")
+	}
+	return string(b[2 : 2+n]), 2 + n, nil
+}
+
+// appendString appends a length-prefixed string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendLength appends a remaining length
+func appendLength(b []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			return b
+		}
+	}
+}
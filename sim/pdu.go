@@ -0,0 +1,180 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// PDU simulates a power distribution unit speaking the stock firmware
+// protocol: it publishes each outlet's state (1 or 0) retained on
+// power/<name>/outlets/<n>, switches on 1, 0, ON, OFF and TOGGLE commands
+// sent to .../set, and reports online/offline on power/<name>/availability
+// with a last will
+type PDU struct {
+	Name       string
+	ReplyDelay time.Duration // wait before reporting a switched state, like a slow relay
+	Watts      float64       // load of each ON outlet; 0 publishes no telemetry
+
+	mu     sync.Mutex
+	states []bool // index: outlet number - 1
+	client paho.Client
+}
+
+// NewPDU creates a PDU with the given number of outlets, all OFF
+func NewPDU(name string, outlets int) *PDU {
+	return &PDU{Name: name, states: make([]bool, outlets)}
+}
+
+// Connect connects the PDU to a broker at host:port and publishes its
+// availability and outlet states
+func (p *PDU) Connect(addr string) error {
+	opts := paho.NewClientOptions().
+		AddBroker("tcp://"+addr).
+		SetClientID("sim-"+p.Name).
+		SetWill(p.topic("availability"), "offline", 1, true).
+		SetAutoReconnect(false).
+		SetOrderMatters(false) // commands publish from the handler
+	client := paho.NewClient(opts)
+	if token := client.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		return fmt.Errorf("failed to connect simulated PDU %s: %v", p.Name, token.Error())
+	}
+
+	token := client.Subscribe(p.topic("outlets/+/set"), 1, p.handleCommand)
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		client.Disconnect(0)
+		return fmt.Errorf("failed to subscribe simulated PDU %s: %v", p.Name, token.Error())
+	}
+
+	p.mu.Lock()
+	p.client = client
+	p.mu.Unlock()
+
+	p.publish("availability", "online")
+	for outlet := 1; outlet <= p.Outlets(); outlet++ {
+		p.report(outlet)
+	}
+	return nil
+}
+
+// Disconnect reports the PDU offline and disconnects it
+func (p *PDU) Disconnect() {
+	p.publish("availability", "offline")
+
+	p.mu.Lock()
+	client := p.client
+	p.client = nil
+	p.mu.Unlock()
+	if client != nil {
+		client.Disconnect(250)
+	}
+}
+
+// Outlets returns the number of outlets
+func (p *PDU) Outlets() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.states)
+}
+
+// State reports whether an outlet (numbered from 1) is ON
+func (p *PDU) State(outlet int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if outlet < 1 || outlet > len(p.states) {
+		return false
+	}
+	return p.states[outlet-1]
+}
+
+// Set switches an outlet locally, as with a button on the unit, and
+// reports the new state
+func (p *PDU) Set(outlet int, on bool) error {
+	p.mu.Lock()
+	if outlet < 1 || outlet > len(p.states) {
+		p.mu.Unlock()
+		return fmt.Errorf("outlet %d not found on %s", outlet, p.Name)
+	}
+	p.states[outlet-1] = on
+	p.mu.Unlock()
+
+	p.report(outlet)
+	return nil
+}
+
+// handleCommand switches an outlet on a command message
+func (p *PDU) handleCommand(_ paho.Client, msg paho.Message) {
+	levels := strings.Split(msg.Topic(), "/")
+	if len(levels) < 2 {
+		return
+	}
+	outlet, err := strconv.Atoi(levels[len(levels)-2])
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	if outlet < 1 || outlet > len(p.states) {
+		p.mu.Unlock()
+		return
+	}
+	switch strings.ToUpper(strings.TrimSpace(string(msg.Payload()))) {
+	case "1", "ON":
+		p.states[outlet-1] = true
+	case "0", "OFF":
+		p.states[outlet-1] = false
+	case "TOGGLE":
+		p.states[outlet-1] = !p.states[outlet-1]
+	default:
+		p.mu.Unlock()
+		return // Unknown commands are ignored, as by real devices
+	}
+	delay := p.ReplyDelay
+	p.mu.Unlock()
+
+	if delay > 0 {
+		time.AfterFunc(delay, func() { p.report(outlet) })
+		return
+	}
+	p.report(outlet)
+}
+
+// report publishes an outlet's state and, if Watts is set, its load
+func (p *PDU) report(outlet int) {
+	on := p.State(outlet)
+	prefix := "outlets/" + strconv.Itoa(outlet)
+
+	state := "0"
+	if on {
+		state = "1"
+	}
+	p.publish(prefix, state)
+
+	if p.Watts > 0 {
+		watts := 0.0
+		if on {
+			watts = p.Watts
+		}
+		p.publish(prefix+"/energy", strconv.FormatFloat(watts, 'f', 1, 64))
+	}
+}
+
+// publish sends a retained message below the PDU's topic
+func (p *PDU) publish(suffix, payload string) {
+	p.mu.Lock()
+	client := p.client
+	p.mu.Unlock()
+	if client == nil {
+		return
+	}
+	client.Publish(p.topic(suffix), 1, true, payload).WaitTimeout(5 * time.Second)
+}
+
+// topic returns a topic below power/<name>
+func (p *PDU) topic(suffix string) string {
+	return "power/" + p.Name + "/" + suffix
+}